@@ -0,0 +1,304 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accesslog
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tacusci/logging"
+)
+
+const (
+	//rotatedTimeFormat how the time a log was rotated is added to its file name
+	rotatedTimeFormat = "20060102-150405"
+	//bufferSize bytes of entries held before they're written to the file
+	bufferSize = 64 * 1024
+	//flushInterval longest entries are held before they're written to the file
+	flushInterval = time.Second
+)
+
+//Options where and how requests are logged
+type Options struct {
+	//Path file entries are written to
+	Path string
+	//Format one of Formats
+	Format string
+	//MaxSize bytes the file can grow to before it's rotated, 0 to not rotate by size
+	MaxSize int64
+	//RotateEvery how often the file is rotated, eg., 24h rotates daily at midnight UTC, 0 to not rotate by time
+	RotateEvery time.Duration
+	//Keep how many rotated files are kept, 0 keeps them all
+	Keep int
+	//Anonymise whether the last part of each client's IP address is blanked out
+	Anonymise bool
+}
+
+//Validate checks the options make sense
+func (o Options) Validate() error {
+	if len(o.Path) == 0 {
+		return errors.New("Access log path can't be blank")
+	}
+	if err := ValidFormat(o.Format); err != nil {
+		return err
+	}
+	if o.MaxSize < 0 || o.RotateEvery < 0 || o.Keep < 0 {
+		return errors.New("Access log rotation size, interval and files kept can't be negative")
+	}
+	return nil
+}
+
+//Logger writes entries to a file in the background, rotating it once it's too big or too old
+type Logger struct {
+	opts Options
+
+	mu     sync.Mutex
+	file   *os.File
+	buf    *bufio.Writer
+	size   int64
+	opened time.Time
+	closed bool
+	stop   chan bool
+	done   chan bool
+}
+
+//New opens the access log opts describes, appending to it if it already exists
+func New(opts Options) (*Logger, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	l := &Logger{opts: opts, stop: make(chan bool), done: make(chan bool)}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	go l.flushPeriodically()
+	return l, nil
+}
+
+//Options where and how l logs requests
+func (l *Logger) Options() Options {
+	return l.opts
+}
+
+//Log writes e to the log, the client's IP address is anonymised first if l is set to
+func (l *Logger) Log(e *Entry) {
+	entry := *e
+	if l.opts.Anonymise {
+		entry.RemoteAddr = AnonymiseIP(entry.RemoteAddr)
+	}
+	line, err := entry.Line(l.opts.Format)
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return
+	}
+
+	if l.dueForRotation(entry.Time, int64(len(line))) {
+		if err := l.rotate(entry.Time); err != nil {
+			logging.Error(fmt.Sprintf("Unable to rotate access log %s -> %s", l.opts.Path, err.Error()))
+		}
+	}
+
+	n, err := l.buf.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		logging.Error(fmt.Sprintf("Unable to write to access log %s -> %s", l.opts.Path, err.Error()))
+	}
+}
+
+//Flush writes any entries being held to the file
+func (l *Logger) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil
+	}
+	return l.buf.Flush()
+}
+
+//Close writes any entries being held and closes the file, entries logged afterwards are dropped
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	l.mu.Unlock()
+
+	close(l.stop)
+	<-l.done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.buf.Flush(); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+//flushPeriodically writes held entries every flushInterval so they're not held for long on a quiet site
+func (l *Logger) flushPeriodically() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.Flush(); err != nil {
+				logging.Error(fmt.Sprintf("Unable to write to access log %s -> %s", l.opts.Path, err.Error()))
+			}
+		}
+	}
+}
+
+//open opens the log file for appending, treating an existing file as opened when it was last written to
+func (l *Logger) open() error {
+	if dir := filepath.Dir(l.opts.Path); len(dir) > 0 {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(l.opts.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	l.buf = bufio.NewWriterSize(f, bufferSize)
+	l.size = info.Size()
+	l.opened = info.ModTime()
+	if l.size == 0 {
+		l.opened = time.Now()
+	}
+	return nil
+}
+
+//dueForRotation whether the file has to be rotated before an entry of length written at now is added to it
+func (l *Logger) dueForRotation(now time.Time, length int64) bool {
+	if l.size == 0 {
+		return false
+	}
+	if l.opts.MaxSize > 0 && l.size+length > l.opts.MaxSize {
+		return true
+	}
+	return l.opts.RotateEvery > 0 && !now.Truncate(l.opts.RotateEvery).Equal(l.opened.Truncate(l.opts.RotateEvery))
+}
+
+//rotate moves the file aside, named after when it was rotated at now, starts a new one
+//and removes the oldest rotated files beyond those kept
+func (l *Logger) rotate(now time.Time) error {
+	if err := l.buf.Flush(); err != nil {
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	rotatedPath := fmt.Sprintf("%s.%s", l.opts.Path, now.Format(rotatedTimeFormat))
+	for i := 1; fileExists(rotatedPath); i++ {
+		rotatedPath = fmt.Sprintf("%s.%s-%d", l.opts.Path, now.Format(rotatedTimeFormat), i)
+	}
+	renameErr := os.Rename(l.opts.Path, rotatedPath)
+
+	if err := l.open(); err != nil {
+		return err
+	}
+	l.opened = now
+	if renameErr != nil {
+		return renameErr
+	}
+
+	return l.removeOldest()
+}
+
+//removeOldest deletes the oldest rotated files beyond those kept
+func (l *Logger) removeOldest() error {
+	if l.opts.Keep == 0 {
+		return nil
+	}
+
+	matches, err := filepath.Glob(l.opts.Path + ".*")
+	if err != nil {
+		return err
+	}
+	//other files next to the log, such as a backup of it, aren't rotated logs so are left alone
+	rotated := []string{}
+	for _, path := range matches {
+		if isRotated(l.opts.Path, path) {
+			rotated = append(rotated, path)
+		}
+	}
+	if len(rotated) <= l.opts.Keep {
+		return nil
+	}
+
+	//rotated files are named after when they were rotated so sort oldest first
+	sort.Strings(rotated)
+	for _, path := range rotated[:len(rotated)-l.opts.Keep] {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//isRotated whether path is named like a log at logPath once it's been rotated, eg., access.log.20190601-120000-1
+func isRotated(logPath string, path string) bool {
+	suffix := strings.TrimPrefix(path, logPath+".")
+	if len(suffix) < len(rotatedTimeFormat) {
+		return false
+	}
+	if _, err := time.Parse(rotatedTimeFormat, suffix[:len(rotatedTimeFormat)]); err != nil {
+		return false
+	}
+
+	//files rotated within the same second are numbered
+	counter := suffix[len(rotatedTimeFormat):]
+	if len(counter) == 0 {
+		return true
+	}
+	number := strings.TrimPrefix(counter, "-")
+	return len(number) > 0 && len(number) < len(counter) && strings.Trim(number, "0123456789") == ""
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	//FormatCommon NCSA Common Log Format
+	FormatCommon = "common"
+	//FormatCombined NCSA Combined Log Format, the common format followed by the referer and user agent
+	FormatCombined = "combined"
+	//FormatJSON one JSON object per line
+	FormatJSON = "json"
+
+	//clfTimeFormat how times are written in the common and combined formats
+	clfTimeFormat = "02/Jan/2006:15:04:05 -0700"
+)
+
+//Formats the formats entries can be written in
+var Formats = []string{FormatCommon, FormatCombined, FormatJSON}
+
+//Entry a request the site has responded to
+type Entry struct {
+	Time       time.Time
+	RemoteAddr string
+	User       string
+	Method     string
+	URI        string
+	Protocol   string
+	Status     int
+	Size       int64
+	Duration   time.Duration
+	Referer    string
+	UserAgent  string
+}
+
+//jsonEntry an entry as it's written as a JSON line
+type jsonEntry struct {
+	Time       string  `json:"time"`
+	RemoteAddr string  `json:"remoteaddr"`
+	User       string  `json:"user,omitempty"`
+	Method     string  `json:"method"`
+	URI        string  `json:"uri"`
+	Protocol   string  `json:"protocol"`
+	Status     int     `json:"status"`
+	Size       int64   `json:"size"`
+	DurationMS float64 `json:"durationms"`
+	Referer    string  `json:"referer,omitempty"`
+	UserAgent  string  `json:"useragent,omitempty"`
+}
+
+//ValidFormat checks format is one entries can be written in
+func ValidFormat(format string) error {
+	for _, known := range Formats {
+		if format == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown access log format '%s', must be one of %s", format, strings.Join(Formats, ", "))
+}
+
+//Line e written out in format, ending with a newline
+func (e *Entry) Line(format string) ([]byte, error) {
+	switch format {
+	case FormatCommon:
+		return []byte(e.common() + "\n"), nil
+	case FormatCombined:
+		return []byte(fmt.Sprintf("%s %s %s\n", e.common(), quote(e.Referer), quote(e.UserAgent))), nil
+	case FormatJSON:
+		line, err := json.Marshal(&jsonEntry{
+			Time:       e.Time.Format(time.RFC3339),
+			RemoteAddr: e.RemoteAddr,
+			User:       e.User,
+			Method:     e.Method,
+			URI:        e.URI,
+			Protocol:   e.Protocol,
+			Status:     e.Status,
+			Size:       e.Size,
+			DurationMS: float64(e.Duration) / float64(time.Millisecond),
+			Referer:    e.Referer,
+			UserAgent:  e.UserAgent,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return append(line, '\n'), nil
+	}
+	return nil, ValidFormat(format)
+}
+
+//common e in the common log format
+func (e *Entry) common() string {
+	size := "-"
+	if e.Size > 0 {
+		size = strconv.FormatInt(e.Size, 10)
+	}
+	return fmt.Sprintf("%s - %s [%s] %s %d %s",
+		orDash(e.RemoteAddr), orDash(e.User), e.Time.Format(clfTimeFormat),
+		quote(fmt.Sprintf("%s %s %s", e.Method, e.URI, e.Protocol)), e.Status, size)
+}
+
+//quote value in double quotes, escaping anything which would break the line apart, "-" if it's blank
+func quote(value string) string {
+	if len(value) == 0 {
+		return `"-"`
+	}
+	return strconv.Quote(value)
+}
+
+//orDash value, or "-" if it's blank or would break the line apart
+func orDash(value string) string {
+	if len(value) == 0 || strings.ContainsAny(value, " \t\n") {
+		return "-"
+	}
+	return value
+}
+
+//AnonymiseIP blanks the part of ip which identifies a host, keeping the network it's from, an IPv4 address
+//loses its last octet and an IPv6 address everything after the first 48 bits
+func AnonymiseIP(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+	if ipv4 := parsed.To4(); ipv4 != nil {
+		return ipv4.Mask(net.CIDRMask(24, 32)).String()
+	}
+	return parsed.Mask(net.CIDRMask(48, 128)).String()
+}
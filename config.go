@@ -0,0 +1,341 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tacusci/berrycms/accesslog"
+	"github.com/tacusci/berrycms/web"
+	"github.com/tacusci/logging"
+	"gopkg.in/yaml.v2"
+)
+
+//envPrefix environment variables named this followed by a setting's name in capitals set it, eg., BERRYCMS_DBPASS
+const envPrefix = "BERRYCMS_"
+
+//settingNames the command line options which can also be set in the config file or environment, along with the
+//name they go by there, those which are one-off actions such as -wipe can only be given on the command line
+var settingNames = map[string]string{
+	"dbg":             "debug",
+	"p":               "port",
+	"a":               "address",
+	"db":              "db",
+	"dbuser":          "dbuser",
+	"dbpass":          "dbpass",
+	"dbaddr":          "dbaddr",
+	"actlog":          "activitylog",
+	"actlogformat":    "activitylogformat",
+	"actlogmaxsize":   "activitylogmaxsize",
+	"actlogrotate":    "activitylogrotate",
+	"actlogkeep":      "activitylogkeep",
+	"actloganon":      "activityloganonymise",
+	"ahp":             "adminhiddenpassword",
+	"nrtxt":           "norobots",
+	"nsxml":           "nositemap",
+	"nfeeds":          "nofeeds",
+	"napi":            "noapi",
+	"apd":             "admindisabled",
+	"log":             "logfile",
+	"cpuprofile":      "cpuprofile",
+	"autocert":        "autocert",
+	"nocomp":          "nocompression",
+	"compmin":         "compressionminsize",
+	"comptypes":       "compressiontypes",
+	"overrides":       "overrides",
+	"baseurl":         "baseurl",
+	"smtphost":        "smtphost",
+	"smtpport":        "smtpport",
+	"smtpuser":        "smtpuser",
+	"smtppass":        "smtppass",
+	"smtptls":         "smtptls",
+	"mailfrom":        "mailfrom",
+	"maildir":         "maildir",
+	"sessionidle":     "sessionidle",
+	"sessionlifetime": "sessionlifetime",
+	"rememberme":      "rememberme",
+	"htmlpolicy":      "htmlpolicy",
+}
+
+//reloadableSettings command line options which take effect straight away when reloaded with SIGHUP,
+//changing any others only takes effect after a restart
+var reloadableSettings = map[string]bool{
+	"dbg":             true,
+	"actlog":          true,
+	"actlogformat":    true,
+	"actlogmaxsize":   true,
+	"actlogrotate":    true,
+	"actlogkeep":      true,
+	"actloganon":      true,
+	"nrtxt":           true,
+	"nsxml":           true,
+	"nfeeds":          true,
+	"napi":            true,
+	"nocomp":          true,
+	"compmin":         true,
+	"comptypes":       true,
+	"baseurl":         true,
+	"sessionidle":     true,
+	"sessionlifetime": true,
+	"rememberme":      true,
+	"htmlpolicy":      true,
+}
+
+//loadOptions reads the options from args, then fills in those not given from the environment and after that
+//the config file, anything still not set is left as its default
+func loadOptions(args []string, errorHandling flag.ErrorHandling) (*options, *flag.FlagSet, error) {
+	opts := &options{}
+	fs := newFlagSet(opts, errorHandling)
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	problems := []string{}
+
+	if configFile, ok := os.LookupEnv(envPrefix + "CONFIG"); ok && !given["config"] {
+		opts.configFile = configFile
+	}
+
+	for flagName, name := range settingNames {
+		if value, ok := os.LookupEnv(envPrefix + strings.ToUpper(name)); ok && !given[flagName] {
+			if err := setOption(fs, flagName, value); err != nil {
+				problems = append(problems, fmt.Sprintf("Environment variable %s%s has invalid value '%s', it %s", envPrefix, strings.ToUpper(name), value, err.Error()))
+			}
+			given[flagName] = true
+		}
+	}
+
+	if len(opts.configFile) > 0 {
+		fileProblems, err := loadConfigFile(fs, opts.configFile, given)
+		if err != nil {
+			return nil, nil, err
+		}
+		problems = append(problems, fileProblems...)
+	}
+
+	problems = append(problems, validateOptions(opts)...)
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, nil, fmt.Errorf("Invalid settings:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return opts, fs, nil
+}
+
+//loadConfigFile sets the options in the YAML config file at path which haven't already been given
+func loadConfigFile(fs *flag.FlagSet, path string, given map[string]bool) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read config file -> %s", err.Error())
+	}
+
+	settings := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("Unable to parse config file %s -> %s", path, err.Error())
+	}
+
+	flagNames := map[string]string{}
+	for flagName, name := range settingNames {
+		flagNames[name] = flagName
+	}
+
+	problems := []string{}
+	for name, rawValue := range settings {
+		flagName, ok := flagNames[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("Config file %s has unknown setting '%s'", path, name))
+			continue
+		}
+		if given[flagName] {
+			continue
+		}
+
+		value, err := settingValue(rawValue)
+		if err == nil {
+			err = setOption(fs, flagName, value)
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("Config file %s has invalid value for '%s', it %s", path, name, err.Error()))
+		}
+	}
+	return problems, nil
+}
+
+//settingValue the command line form of a value from the config file, lists become comma separated
+func settingValue(rawValue interface{}) (string, error) {
+	switch value := rawValue.(type) {
+	case string, bool, int, float64:
+		return fmt.Sprint(value), nil
+	case []interface{}:
+		items := []string{}
+		for _, item := range value {
+			itemValue, err := settingValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, itemValue)
+		}
+		return strings.Join(items, ","), nil
+	case nil:
+		return "", nil
+	}
+	return "", errors.New("must be a single value or a list of them")
+}
+
+//setOption sets the option flagName to value, describing what's expected if value isn't valid
+func setOption(fs *flag.FlagSet, flagName string, value string) error {
+	previous := fs.Lookup(flagName).Value.String()
+	err := fs.Set(flagName, value)
+	if err == nil {
+		return nil
+	}
+	//some options are zeroed by a value they can't parse, which shouldn't cause more problems of its own
+	fs.Set(flagName, previous)
+
+	switch fs.Lookup(flagName).Value.(flag.Getter).Get().(type) {
+	case bool:
+		return errors.New("must be true or false")
+	case int, uint:
+		return errors.New("must be a whole number")
+	case time.Duration:
+		return errors.New("must be a duration such as 90s, 20m or 24h")
+	}
+	return err
+}
+
+//validateOptions checks opts make sense together, describing each which doesn't
+func validateOptions(opts *options) []string {
+	problems := []string{}
+	if opts.port == 0 || opts.port > 65535 {
+		problems = append(problems, fmt.Sprintf("Port %d must be between 1 and 65535", opts.port))
+	}
+	if opts.sql != "sqlite" && opts.sql != "mysql" {
+		problems = append(problems, fmt.Sprintf("Unknown database server type '%s', must be sqlite or mysql", opts.sql))
+	}
+	if opts.smtpPort < 1 || opts.smtpPort > 65535 {
+		problems = append(problems, fmt.Sprintf("SMTP port %d must be between 1 and 65535", opts.smtpPort))
+	}
+	if opts.smtpTLS != "starttls" && opts.smtpTLS != "required" && opts.smtpTLS != "implicit" {
+		problems = append(problems, fmt.Sprintf("Unknown SMTP TLS mode '%s', must be starttls, required or implicit", opts.smtpTLS))
+	}
+	if err := accesslog.ValidFormat(opts.activityLogFormat); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if opts.activityLogMaxSize < 0 || opts.activityLogRotate < 0 || opts.activityLogKeep < 0 {
+		problems = append(problems, "Activity log rotation size, interval and number kept can't be negative")
+	}
+	if opts.compressionMinSize < 0 {
+		problems = append(problems, "Minimum size to compress can't be negative")
+	}
+	if opts.sessionIdle <= 0 || opts.sessionLifetime <= 0 || opts.rememberMe <= 0 {
+		problems = append(problems, "Session lifetimes must be longer than 0")
+	} else if opts.sessionIdle > opts.sessionLifetime {
+		problems = append(problems, fmt.Sprintf("Session idle timeout %s can't be longer than the session lifetime %s", opts.sessionIdle, opts.sessionLifetime))
+	}
+	return problems
+}
+
+//listenForReloadSig reloads the settings each time SIGHUP is sent to the process, applying those
+//which are safe to change while running
+func listenForReloadSig(rs *web.MutableRouter, fs *flag.FlagSet) {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	for range reload {
+		logging.Info("Caught SIGHUP, reloading settings...")
+		opts, reloadedFS, err := loadOptions(os.Args[1:], flag.ContinueOnError)
+		if err != nil {
+			logging.Error(fmt.Sprintf("Keeping current settings -> %s", err.Error()))
+			continue
+		}
+		applySettings(rs, opts, changedSettings(fs, reloadedFS))
+		fs = reloadedFS
+	}
+}
+
+//changedSettings the names of the options which are different in after than they were in before
+func changedSettings(before *flag.FlagSet, after *flag.FlagSet) map[string]bool {
+	changed := map[string]bool{}
+	after.VisitAll(func(f *flag.Flag) {
+		if before.Lookup(f.Name).Value.String() != f.Value.String() {
+			changed[f.Name] = true
+		}
+	})
+	return changed
+}
+
+//applySettings puts the reloaded changed options which are safe to change while running into effect
+func applySettings(rs *web.MutableRouter, opts *options, changed map[string]bool) {
+	restartNeeded := []string{}
+	for flagName := range changed {
+		if !reloadableSettings[flagName] {
+			restartNeeded = append(restartNeeded, settingNames[flagName])
+		}
+	}
+	if len(restartNeeded) > 0 {
+		sort.Strings(restartNeeded)
+		logging.Warn(fmt.Sprintf("Restart to apply changes to %s", strings.Join(restartNeeded, ", ")))
+	}
+
+	if changed["dbg"] {
+		setLogLevel(opts)
+	}
+
+	if changed["baseurl"] {
+		if err := web.SetBaseURL(opts.baseURL); err != nil {
+			logging.Error(err.Error())
+		}
+	}
+
+	if changed["htmlpolicy"] {
+		if err := web.SetSanitisePolicy(opts.htmlPolicy); err != nil {
+			logging.Error(err.Error())
+		}
+	}
+
+	if changed["sessionidle"] || changed["sessionlifetime"] || changed["rememberme"] {
+		if err := web.SetSessionLifetimes(opts.sessionIdle, opts.sessionLifetime, opts.rememberMe); err != nil {
+			logging.Error(err.Error())
+		}
+	}
+
+	if changed["actlog"] || changed["actlogformat"] || changed["actlogmaxsize"] || changed["actlogrotate"] || changed["actlogkeep"] || changed["actloganon"] ||
+		changed["nrtxt"] || changed["nsxml"] || changed["nfeeds"] || changed["napi"] || changed["nocomp"] || changed["compmin"] || changed["comptypes"] {
+		//requests are still being served, so the router's settings are only changed under its lock
+		rs.Reconfigure(func() {
+			rs.ActivityLog = activityLogOptions(opts)
+			rs.NoRobots = opts.noRobots
+			rs.NoSitemap = opts.noSitemap
+			rs.NoFeeds = opts.noFeeds
+			rs.NoAPI = opts.noAPI
+			rs.NoCompression = opts.noCompression
+			rs.CompressionMinSize = opts.compressionMinSize
+			rs.CompressionTypes = splitList(opts.compressionTypes)
+		})
+	}
+
+	logging.Info("Reloaded settings")
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/web"
+)
+
+func init() {
+	db.Connect(db.SQLITE, "./berrycmstesting.db", "")
+	db.Wipe()
+	db.Setup()
+}
+
+//writeConfigFile writes a config file holding contents to a new temporary directory, returning its path
+func writeConfigFile(t *testing.T, contents string) string {
+	path := filepath.Join(t.TempDir(), "berrycms.yml")
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadOptions(t *testing.T) {
+	configFile := writeConfigFile(t, "port: 9000\ndbuser: fileuser\naddress: 10.0.0.1\ncompressiontypes: [text/html, text/css]\nsessionidle: 10m\n")
+
+	tests := []struct {
+		name          string
+		args          []string
+		env           map[string]string
+		expectedPort  uint
+		expectedUser  string
+		expectedAddr  string
+		expectedIdle  time.Duration
+		expectedTypes string
+	}{
+		{"defaults", nil, nil, 8080, "berryadmin", "0.0.0.0", web.DefaultSessionIdleTimeout, strings.Join(web.DefaultCompressibleContentTypes, ",")},
+		{"the file over defaults", []string{"-config", configFile}, nil, 9000, "fileuser", "10.0.0.1", 10 * time.Minute, "text/html,text/css"},
+		{"the file named by the environment", nil, map[string]string{"BERRYCMS_CONFIG": configFile}, 9000, "fileuser", "10.0.0.1", 10 * time.Minute, "text/html,text/css"},
+		{"the environment over the file", []string{"-config", configFile}, map[string]string{"BERRYCMS_PORT": "8000", "BERRYCMS_DBUSER": "envuser"}, 8000, "envuser", "10.0.0.1", 10 * time.Minute, "text/html,text/css"},
+		{"flags over the environment and file", []string{"-config", configFile, "-p", "7000", "-dbuser", "flaguser"}, map[string]string{"BERRYCMS_PORT": "8000", "BERRYCMS_DBUSER": "envuser"}, 7000, "flaguser", "10.0.0.1", 10 * time.Minute, "text/html,text/css"},
+		//the environment isn't read for settings given as flags, so it can't make them invalid
+		{"flags over an invalid environment", []string{"-p", "7000"}, map[string]string{"BERRYCMS_PORT": "notaport"}, 7000, "berryadmin", "0.0.0.0", web.DefaultSessionIdleTimeout, strings.Join(web.DefaultCompressibleContentTypes, ",")},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			opts, _, err := loadOptions(test.args, flag.ContinueOnError)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if opts.port != test.expectedPort || opts.sqlUsername != test.expectedUser || opts.addr != test.expectedAddr {
+				t.Errorf("Expected port %d, dbuser %s and address %s, got %d, %s and %s", test.expectedPort, test.expectedUser, test.expectedAddr, opts.port, opts.sqlUsername, opts.addr)
+			}
+			if opts.sessionIdle != test.expectedIdle || opts.compressionTypes != test.expectedTypes {
+				t.Errorf("Expected session idle timeout %s and compression types %s, got %s and %s", test.expectedIdle, test.expectedTypes, opts.sessionIdle, opts.compressionTypes)
+			}
+		})
+	}
+}
+
+func TestLoadOptionsProblems(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		args     []string
+		problems []string
+	}{
+		{"an unknown setting", "nosuchsetting: 1\n", nil, nil, []string{"has unknown setting 'nosuchsetting'"}},
+		{"a flag's name rather than its setting's", "p: 9000\n", nil, nil, []string{"has unknown setting 'p'"}},
+		{"a number which isn't", "port: abc\n", nil, nil, []string{"invalid value for 'port', it must be a whole number"}},
+		{"a duration which isn't", "sessionidle: soon\n", nil, nil, []string{"invalid value for 'sessionidle', it must be a duration"}},
+		{"a map", "compressiontypes: {text: html}\n", nil, nil, []string{"must be a single value or a list of them"}},
+		{"an invalid environment variable", "", map[string]string{"BERRYCMS_DEBUG": "maybe"}, nil, []string{"BERRYCMS_DEBUG has invalid value 'maybe', it must be true or false"}},
+		{"a port out of range", "port: 70000\n", nil, nil, []string{"Port 70000 must be between 1 and 65535"}},
+		{"an unknown database", "", nil, []string{"-db", "postgres"}, []string{"Unknown database server type 'postgres'"}},
+		{"sessions idling longer than they last", "sessionidle: 2h\nsessionlifetime: 1h\n", nil, nil, []string{"can't be longer than the session lifetime"}},
+		{"every problem at once", "nosuchsetting: 1\nport: abc\n", map[string]string{"BERRYCMS_NOAPI": "sometimes"}, nil, []string{"unknown setting 'nosuchsetting'", "invalid value for 'port'", "BERRYCMS_NOAPI has invalid value"}},
+		{"an unparsable file", "port: [\n", nil, nil, []string{"Unable to parse config file"}},
+		{"an unknown flag", "", nil, []string{"-nosuchflag"}, []string{"-nosuchflag"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for name, value := range test.env {
+				t.Setenv(name, value)
+			}
+			args := test.args
+			if len(test.file) > 0 {
+				args = append([]string{"-config", writeConfigFile(t, test.file)}, args...)
+			}
+			_, _, err := loadOptions(args, flag.ContinueOnError)
+			if err == nil {
+				t.Fatalf("Expected settings with %s to be rejected", test.name)
+			}
+			for _, problem := range test.problems {
+				if !strings.Contains(err.Error(), problem) {
+					t.Errorf("Expected problem '%s' to be described, got %s", problem, err.Error())
+				}
+			}
+		})
+	}
+
+	if _, _, err := loadOptions([]string{"-config", filepath.Join(t.TempDir(), "missing.yml")}, flag.ContinueOnError); err == nil || !strings.Contains(err.Error(), "Unable to read config file") {
+		t.Errorf("Expected a missing config file to be rejected, got %v", err)
+	}
+}
+
+func TestChangedSettings(t *testing.T) {
+	_, before, err := loadOptions(nil, flag.ContinueOnError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, after, err := loadOptions([]string{"-nrtxt", "-p", "9000", "-dbuser", "berryadmin"}, flag.ContinueOnError)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//giving a setting its default isn't a change
+	if changed := changedSettings(before, after); len(changed) != 2 || !changed["nrtxt"] || !changed["p"] {
+		t.Errorf("Expected only the settings given different values to have changed, got %v", changed)
+	}
+	if changed := changedSettings(after, after); len(changed) != 0 {
+		t.Errorf("Expected nothing to have changed, got %v", changed)
+	}
+}
+
+func TestApplySettings(t *testing.T) {
+	//the sitemap's only served with a base URL to locate pages under
+	if err := web.SetBaseURL("https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	defer web.SetBaseURL("")
+
+	rs := &web.MutableRouter{Server: &http.Server{}}
+	rs.Reload()
+
+	_, before, err := loadOptions(nil, flag.ContinueOnError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, after, err := loadOptions([]string{"-p", "9000", "-nrtxt", "-nsxml", "-comptypes", "text/html", "-baseurl", "https://example.org"}, flag.ContinueOnError)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	status := func(uri string) int {
+		responseRecorder := httptest.NewRecorder()
+		rs.Root.ServeHTTP(responseRecorder, httptest.NewRequest("GET", uri, nil))
+		return responseRecorder.Code
+	}
+	for _, uri := range []string{"/robots.txt", "/sitemap.xml"} {
+		if code := status(uri); code != http.StatusOK {
+			t.Errorf("Expected %s to be served before it's turned off, got %d", uri, code)
+		}
+	}
+
+	//only the settings which changed are applied, anything else is left as it is
+	applySettings(rs, opts, map[string]bool{"p": true})
+	if rs.NoRobots || rs.NoSitemap {
+		t.Errorf("Expected settings which needed a restart not to reload the router")
+	}
+
+	applySettings(rs, opts, changedSettings(before, after))
+	if !rs.NoRobots || !rs.NoSitemap || len(rs.CompressionTypes) != 1 || rs.CompressionTypes[0] != "text/html" {
+		t.Errorf("Expected the changed router settings to be applied, got robots off %t, sitemap off %t and compression types %v", rs.NoRobots, rs.NoSitemap, rs.CompressionTypes)
+	}
+
+	//the reloaded router serves the new settings straight away
+	for _, uri := range []string{"/robots.txt", "/sitemap.xml"} {
+		if code := status(uri); code != http.StatusNotFound {
+			t.Errorf("Expected %s to be turned off, got %d", uri, code)
+		}
+	}
+}
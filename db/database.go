@@ -121,14 +121,12 @@ func CreateTestData() {
 	println()
 }
 
-func Heartbeat() {
-	for {
-		time.Sleep(time.Second * 60)
-		err := Conn.Ping()
-		if err != nil {
-			logging.Error(fmt.Sprintf("DB Ping error -> %s", err.Error()))
-		}
+//Heartbeat pings the database to keep the connection to it alive
+func Heartbeat() error {
+	if err := Conn.Ping(); err != nil {
+		return fmt.Errorf("DB Ping error -> %s", err.Error())
 	}
+	return nil
 }
 
 //Wipe drops all database tables
@@ -136,7 +134,7 @@ func Wipe() error {
 	logging.Info("Wiping database...")
 	for _, tableToDrop := range getTables() {
 		logging.Debug(fmt.Sprintf("Dropping %s table...", tableToDrop.Name()))
-		dropSmt := fmt.Sprintf("DROP TABLE %s;", tableToDrop.Name())
+		dropSmt := fmt.Sprintf("DROP TABLE IF EXISTS %s;", tableToDrop.Name())
 		_, err := Conn.Exec(dropSmt)
 		if err != nil {
 			return err
@@ -176,6 +174,10 @@ func createTables(db *sql.DB) {
 			logging.Error(err.Error())
 		}
 
+		if err := migrateTable(db, tableToCreate); err != nil {
+			logging.Error(err.Error())
+		}
+
 		bar.Add(1)
 	}
 
@@ -184,5 +186,5 @@ func createTables(db *sql.DB) {
 }
 
 func getTables() []Table {
-	return []Table{&SystemInfoTable{}, &UsersTable{}, &GroupTable{}, &GroupMembershipTable{}, &PagesTable{}, &AuthSessionsTable{}}
+	return []Table{&SystemInfoTable{}, &UsersTable{}, &GroupTable{}, &GroupMembershipTable{}, &PagesTable{}, &AuthSessionsTable{}, &SettingsTable{}, &FeedsTable{}, &RobotsGroupsTable{}, &APITokensTable{}, &OIDCProvidersTable{}, &OIDCIdentitiesTable{}, &TwoFactorsTable{}, &TwoFactorChallengesTable{}, &RecoveryCodesTable{}, &PasswordResetsTable{}, &OutboxTable{}, &LoginAttemptsTable{}, &SessionKeysTable{}, &ScheduledJobsTable{}, &DeferredJobsTable{}}
 }
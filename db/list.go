@@ -0,0 +1,107 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	//DefaultListLimit number of rows listed when no limit has been given
+	DefaultListLimit = 50
+	//MaxListLimit most rows which can be listed at once
+	MaxListLimit = 500
+)
+
+//FilterMatch how a filter value is compared against its column
+type FilterMatch int
+
+const (
+	//MatchEquals column must equal the filter value
+	MatchEquals FilterMatch = iota
+	//MatchContains column must contain the filter value
+	MatchContains
+)
+
+//ListOptions pagination and filters for listing a table's rows
+type ListOptions struct {
+	Limit  int
+	Offset int
+	//Filters column name to value, only columns a table allows filtering by are used
+	Filters map[string]string
+}
+
+//normalise clamps limit and offset into their allowed ranges
+func (lo *ListOptions) normalise() {
+	if lo.Limit <= 0 {
+		lo.Limit = DefaultListLimit
+	}
+	if lo.Limit > MaxListLimit {
+		lo.Limit = MaxListLimit
+	}
+	if lo.Offset < 0 {
+		lo.Offset = 0
+	}
+}
+
+//selectList runs a paginated 'SELECT *' against table using filters the table allows, returning
+//the rows of the requested page and the total number of rows matching the filters
+func selectList(db *sql.DB, table string, allowed map[string]FilterMatch, orderBy string, opts ListOptions) (*sql.Rows, int, error) {
+	opts.normalise()
+
+	columns := []string{}
+	for column := range opts.Filters {
+		columns = append(columns, column)
+	}
+	//filters are applied in a fixed order so the same filters build the same statement
+	sort.Strings(columns)
+
+	conditions := []string{}
+	args := []interface{}{}
+	for _, column := range columns {
+		match, ok := allowed[column]
+		if !ok {
+			return nil, 0, fmt.Errorf("Unable to filter %s by '%s'", table, column)
+		}
+		switch match {
+		case MatchContains:
+			conditions = append(conditions, fmt.Sprintf("%s LIKE ?", column))
+			args = append(args, "%"+opts.Filters[column]+"%")
+		default:
+			conditions = append(conditions, fmt.Sprintf("%s = ?", column))
+			args = append(args, opts.Filters[column])
+		}
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s%s", table, where), args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s%s ORDER BY %s LIMIT ? OFFSET ?", table, where, orderBy), append(args, opts.Limit, opts.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return rows, total, nil
+}
@@ -13,3 +13,50 @@
 // limitations under the License.
 
 package db
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/tacusci/logging"
+)
+
+//migrateTable adds any columns which exist in the table struct but are missing from the
+//existing table in the database, tables are only ever created if they don't exist so this
+//is what brings older databases up to date with newly added fields
+func migrateTable(db *sql.DB, t Table) error {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", t.Name()))
+	if err != nil {
+		return err
+	}
+
+	existingColumns, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		return err
+	}
+
+	existing := map[string]bool{}
+	for _, column := range existingColumns {
+		existing[column] = true
+	}
+
+	for _, field := range t.buildFields() {
+		if existing[field.Name] {
+			continue
+		}
+
+		alterStatement := fmt.Sprintf("ALTER TABLE `%s` ADD COLUMN `%s` %s", t.Name(), field.Name, field.Type)
+		//existing rows need a value for the new column, so not null columns must have a default
+		if field.NotNull {
+			alterStatement += fmt.Sprintf(" NOT NULL DEFAULT %s", field.defaultValue())
+		}
+
+		logging.Debug(fmt.Sprintf("Running migration statement: \"%s\"", alterStatement))
+		if _, err := db.Exec(alterStatement); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
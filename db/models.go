@@ -122,6 +122,15 @@ func (f *Field) getFormatString() string {
 	}
 }
 
+func (f *Field) defaultValue() string {
+	switch f.kind {
+	case reflect.String:
+		return "''"
+	default:
+		return "0"
+	}
+}
+
 // ****************************************** TABLES ******************************************
 
 //Table interface to inherit from all table structs
@@ -287,7 +296,7 @@ func (ut *UsersTable) SelectRootUser(db *sql.DB) (*User, error) {
 
 func (ut *UsersTable) SelectByUsername(db *sql.DB, username string) (*User, error) {
 	u := &User{}
-	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE username = '%s'", ut.Name(), username))
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE username = ?", ut.Name()), username)
 
 	if err != nil {
 		return nil, err
@@ -305,6 +314,27 @@ func (ut *UsersTable) SelectByUsername(db *sql.DB, username string) (*User, erro
 	return u, nil
 }
 
+//SelectByEmail get the first user with email, matched ignoring case
+func (ut *UsersTable) SelectByEmail(db *sql.DB, email string) (*User, error) {
+	u := &User{}
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE LOWER(email) = LOWER(?) ORDER BY userid LIMIT 1", ut.Name()), email)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		err = rows.Scan(&u.UserId, &u.CreatedDateTime, &u.UserroleId, &u.UUID, &u.Username, &u.AuthHash, &u.FirstName, &u.LastName, &u.Email)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return u, rows.Err()
+}
+
 func (ut *UsersTable) SelectByUUID(db *sql.DB, uuid string) (*User, error) {
 	u := &User{}
 	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE uuid = '%s'", ut.Name(), uuid))
@@ -325,6 +355,38 @@ func (ut *UsersTable) SelectByUUID(db *sql.DB, uuid string) (*User, error) {
 	return u, nil
 }
 
+//Update saves every column of user u, matched by its UUID
+func (ut *UsersTable) Update(db *sql.DB, u *User) error {
+	if err := u.Validate(); err != nil {
+		return err
+	}
+	updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, userroleid = ?, username = ?, authhash = ?, firstname = ?, lastname = ?, email = ? WHERE uuid = ?", ut.Name())
+	_, err := db.Exec(updateStatement, u.CreatedDateTime, u.UserroleId, u.Username, u.AuthHash, u.FirstName, u.LastName, u.Email, u.UUID)
+	return err
+}
+
+//List get a page of users matching opts's filters, along with the total number of matching users
+func (ut *UsersTable) List(db *sql.DB, opts ListOptions) ([]*User, int, error) {
+	allowed := map[string]FilterMatch{"username": MatchContains, "email": MatchContains, "userroleid": MatchEquals}
+	rows, total, err := selectList(db, ut.Name(), allowed, "userid", opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		u := &User{}
+		if err := rows.Scan(&u.UserId, &u.CreatedDateTime, &u.UserroleId, &u.UUID, &u.Username, &u.AuthHash, &u.FirstName, &u.LastName, &u.Email); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, u)
+	}
+
+	return users, total, rows.Err()
+}
+
 func (ut *UsersTable) DeleteByUUID(db *sql.DB, uuid string) (int64, error) {
 	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE uuid = ?", ut.Name()), uuid)
 
@@ -412,7 +474,7 @@ func (gt *GroupTable) Insert(db *sql.DB, g *Group) error {
 
 func (gt *GroupTable) Update(db *sql.DB, g *Group) error {
 	if g.Validate() {
-		updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, uuid = ?, title = ? WHERE uuid = ?", gt.Name())
+		updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, title = ? WHERE uuid = ?", gt.Name())
 		_, err := db.Exec(updateStatement, g.CreatedDateTime, g.Title, g.UUID)
 		if err != nil {
 			return err
@@ -431,7 +493,7 @@ func (gt *GroupTable) Select(db *sql.DB, whatToSelect string, whereClause string
 
 func (gt *GroupTable) SelectByTitle(db *sql.DB, groupTitle string) (*Group, error) {
 	g := &Group{}
-	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE title = '%s'", gt.Name(), groupTitle))
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE title = ?", gt.Name()), groupTitle)
 
 	if err != nil {
 		return nil, err
@@ -468,6 +530,27 @@ func (gt *GroupTable) SelectByUUID(db *sql.DB, groupUUID string) (*Group, error)
 	return g, nil
 }
 
+//List get a page of groups matching opts's filters, along with the total number of matching groups
+func (gt *GroupTable) List(db *sql.DB, opts ListOptions) ([]*Group, int, error) {
+	rows, total, err := selectList(db, gt.Name(), map[string]FilterMatch{"title": MatchContains}, "groupid", opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	groups := []*Group{}
+	for rows.Next() {
+		g := &Group{}
+		if err := rows.Scan(&g.Groupid, &g.CreatedDateTime, &g.UUID, &g.Title); err != nil {
+			return nil, 0, err
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, total, rows.Err()
+}
+
 func (gt *GroupTable) DeleteByUUID(db *sql.DB, groupUUID string) (int64, error) {
 
 	gmt := GroupMembershipTable{}
@@ -597,6 +680,28 @@ func (gmt *GroupMembershipTable) DeleteUserFromGroup(db *sql.DB, u *User, g *Gro
 	return numDeleted, nil
 }
 
+//List get a page of memberships matching opts's filters, along with the total number of matching memberships
+func (gmt *GroupMembershipTable) List(db *sql.DB, opts ListOptions) ([]*GroupMembership, int, error) {
+	allowed := map[string]FilterMatch{"groupuuid": MatchEquals, "useruuid": MatchEquals}
+	rows, total, err := selectList(db, gmt.Name(), allowed, "groupmembershipid", opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	memberships := []*GroupMembership{}
+	for rows.Next() {
+		gm := &GroupMembership{}
+		if err := rows.Scan(&gm.Groupmembershipid, &gm.CreatedDateTime, &gm.GroupUUID, &gm.UserUUID); err != nil {
+			return nil, 0, err
+		}
+		memberships = append(memberships, gm)
+	}
+
+	return memberships, total, rows.Err()
+}
+
 func (gmt *GroupMembershipTable) Select(db *sql.DB, whatToSelect string, whereClause string) (*sql.Rows, error) {
 	if len(whereClause) > 0 {
 		return db.Query(fmt.Sprintf("SELECT %s FROM %s WHERE %s", whatToSelect, gmt.Name(), whereClause))
@@ -619,14 +724,32 @@ func (gmt *GroupMembershipTable) buildPreparedInsertStatement(m Model) string {
 // ******** Start Pages Table ********
 
 type PagesTable struct {
-	Pageid          int    `tbl:"PKNNAIUI"`
-	CreatedDateTime int64  `tbl:"NNDT"`
-	UUID            string `tbl:"NNUI"`
-	Roleprotected   bool   `tbl:"NN"`
-	AuthorUUID      string `tbl:"NN"`
-	Title           string `tbl:"NNUI"`
-	Route           string `tbl:"NNUI"`
-	Content         string `tbl:"NN"`
+	Pageid            int    `tbl:"PKNNAIUI"`
+	CreatedDateTime   int64  `tbl:"NNDT"`
+	UUID              string `tbl:"NNUI"`
+	Roleprotected     bool   `tbl:"NN"`
+	AuthorUUID        string `tbl:"NN"`
+	Title             string `tbl:"NNUI"`
+	Route             string `tbl:"NNUI"`
+	Content           string `tbl:"NN"`
+	Modifieddatetime  int64  `tbl:"NNDT"`
+	Cachepolicy       string `tbl:"NN"`
+	Layout            string `tbl:"NN"`
+	Contentformat     string `tbl:"NN"`
+	Trustedhtml       bool   `tbl:"NN"`
+	Tags              string `tbl:"NN"`
+	Sitemapchangefreq string `tbl:"NN"`
+	Sitemappriority   string `tbl:"NN"`
+	Metatitle         string `tbl:"NN"`
+	Metadescription   string `tbl:"NN"`
+	Canonicalurl      string `tbl:"NN"`
+	Noindex           bool   `tbl:"NN"`
+	Nofollow          bool   `tbl:"NN"`
+	Ogtitle           string `tbl:"NN"`
+	Ogdescription     string `tbl:"NN"`
+	Ogimage           string `tbl:"NN"`
+	Twittercard       string `tbl:"NN"`
+	Jsonld            string `tbl:"NN"`
 }
 
 func (pt *PagesTable) Init(db *sql.DB) {}
@@ -648,7 +771,7 @@ func (pt *PagesTable) Insert(db *sql.DB, p *Page) error {
 		}
 		p.UUID = newUUID.String()
 		insertStatement := pt.buildPreparedInsertStatement(p)
-		_, err = db.Exec(insertStatement, p.CreatedDateTime, p.UUID, p.Roleprotected, p.AuthorUUID, p.Title, p.Route, p.Content)
+		_, err = db.Exec(insertStatement, p.CreatedDateTime, p.UUID, p.Roleprotected, p.AuthorUUID, p.Title, p.Route, p.Content, p.ModifiedDateTime, p.CachePolicy, p.Layout, p.ContentFormat, p.TrustedHTML, p.Tags, p.SitemapChangeFreq, p.SitemapPriority, p.MetaTitle, p.MetaDescription, p.CanonicalURL, p.NoIndex, p.NoFollow, p.OGTitle, p.OGDescription, p.OGImage, p.TwitterCard, p.JSONLD)
 		if err != nil {
 			return err
 		}
@@ -657,8 +780,8 @@ func (pt *PagesTable) Insert(db *sql.DB, p *Page) error {
 }
 
 func (pt *PagesTable) Update(db *sql.DB, p *Page) error {
-	updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, uuid = ?, roleprotected = ?, authoruuid = ?, title = ?, route = ?, content = ? WHERE uuid = ?", pt.Name())
-	_, err := db.Exec(updateStatement, p.CreatedDateTime, p.UUID, p.Roleprotected, p.AuthorUUID, p.Title, p.Route, p.Content, p.UUID)
+	updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, uuid = ?, roleprotected = ?, authoruuid = ?, title = ?, route = ?, content = ?, modifieddatetime = ?, cachepolicy = ?, layout = ?, contentformat = ?, trustedhtml = ?, tags = ?, sitemapchangefreq = ?, sitemappriority = ?, metatitle = ?, metadescription = ?, canonicalurl = ?, noindex = ?, nofollow = ?, ogtitle = ?, ogdescription = ?, ogimage = ?, twittercard = ?, jsonld = ? WHERE uuid = ?", pt.Name())
+	_, err := db.Exec(updateStatement, p.CreatedDateTime, p.UUID, p.Roleprotected, p.AuthorUUID, p.Title, p.Route, p.Content, p.ModifiedDateTime, p.CachePolicy, p.Layout, p.ContentFormat, p.TrustedHTML, p.Tags, p.SitemapChangeFreq, p.SitemapPriority, p.MetaTitle, p.MetaDescription, p.CanonicalURL, p.NoIndex, p.NoFollow, p.OGTitle, p.OGDescription, p.OGImage, p.TwitterCard, p.JSONLD, p.UUID)
 	if err != nil {
 		return err
 	}
@@ -685,7 +808,7 @@ func (pt *PagesTable) SelectByRoute(db *sql.DB, route string) (*Page, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		err = rows.Scan(&p.PageId, &p.CreatedDateTime, &p.UUID, &p.Roleprotected, &p.AuthorUUID, &p.Title, &p.Route, &p.Content)
+		err = scanPage(rows, p)
 		if err != nil {
 			return nil, err
 		}
@@ -702,7 +825,7 @@ func (pt *PagesTable) SelectByRoute(db *sql.DB, route string) (*Page, error) {
 func (pt *PagesTable) SelectByUUID(db *sql.DB, uuid string) (*Page, error) {
 	p := &Page{}
 	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE uuid = '%s'", pt.Name(), uuid))
-	err := row.Scan(&p.PageId, &p.CreatedDateTime, &p.UUID, &p.Roleprotected, &p.AuthorUUID, &p.Title, &p.Route, &p.Content)
+	err := scanPage(row, p)
 	if err != nil {
 		return nil, err
 	}
@@ -713,6 +836,59 @@ func (pt *PagesTable) SelectByUUID(db *sql.DB, uuid string) (*Page, error) {
 	return p, nil
 }
 
+//SelectRecent get most recently created public pages, newest first, skipping the special '[404]' style pages
+func (pt *PagesTable) SelectRecent(db *sql.DB, count int) ([]*Page, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE roleprotected = ? AND route NOT LIKE '[%%' ORDER BY createddatetime DESC LIMIT ?", pt.Name()), false, count)
+	if err != nil {
+		return nil, err
+	}
+	return scanPages(rows)
+}
+
+//SelectPublic get all public pages, newest first, skipping the special '[404]' style pages
+func (pt *PagesTable) SelectPublic(db *sql.DB) ([]*Page, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE roleprotected = ? AND route NOT LIKE '[%%' ORDER BY createddatetime DESC", pt.Name()), false)
+	if err != nil {
+		return nil, err
+	}
+	return scanPages(rows)
+}
+
+//scanPages reads every row of a 'SELECT *' pages query, closing the rows once done
+func scanPages(rows *sql.Rows) ([]*Page, error) {
+	defer rows.Close()
+
+	pages := []*Page{}
+	for rows.Next() {
+		p := &Page{}
+		if err := scanPage(rows, p); err != nil {
+			return nil, err
+		}
+		pages = append(pages, p)
+	}
+
+	return pages, rows.Err()
+}
+
+//List get a page of pages matching opts's filters, along with the total number of matching pages
+func (pt *PagesTable) List(db *sql.DB, opts ListOptions) ([]*Page, int, error) {
+	allowed := map[string]FilterMatch{
+		"route":         MatchEquals,
+		"title":         MatchContains,
+		"authoruuid":    MatchEquals,
+		"contentformat": MatchEquals,
+		"tags":          MatchContains,
+		"roleprotected": MatchEquals,
+	}
+	rows, total, err := selectList(db, pt.Name(), allowed, "createddatetime DESC, pageid DESC", opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pages, err := scanPages(rows)
+	return pages, total, err
+}
+
 func (pt *PagesTable) DeleteByUUID(db *sql.DB, uuid string) (int64, error) {
 	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE uuid = ?", pt.Name()), uuid)
 
@@ -729,6 +905,17 @@ func (pt *PagesTable) DeleteByUUID(db *sql.DB, uuid string) (int64, error) {
 	return numDeleted, nil
 }
 
+//rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+//scanPage reads every column of a 'SELECT *' pages row into the page struct, the
+//order must match the field order of the PagesTable struct
+func scanPage(row rowScanner, p *Page) error {
+	return row.Scan(&p.PageId, &p.CreatedDateTime, &p.UUID, &p.Roleprotected, &p.AuthorUUID, &p.Title, &p.Route, &p.Content, &p.ModifiedDateTime, &p.CachePolicy, &p.Layout, &p.ContentFormat, &p.TrustedHTML, &p.Tags, &p.SitemapChangeFreq, &p.SitemapPriority, &p.MetaTitle, &p.MetaDescription, &p.CanonicalURL, &p.NoIndex, &p.NoFollow, &p.OGTitle, &p.OGDescription, &p.OGImage, &p.TwitterCard, &p.JSONLD)
+}
+
 func (pt *PagesTable) buildFields() []Field {
 	return buildFieldsFromTable(pt)
 }
@@ -745,22 +932,55 @@ func (pt *PagesTable) buildPreparedInsertStatement(m Model) string {
 
 // ******** Start Auth Table ********
 
+//AuthSessionsTable logged in sessions, a user has one for each browser or device they've logged in on
 type AuthSessionsTable struct {
 	Authsessionid      int    `tbl:"PKNNAIUI"`
 	CreatedDateTime    int64  `tbl:"NNDT"`
 	LastActiveDateTime int64  `tbl:"NNDT"`
-	UserUUID           string `tbl:"NNUI"`
+	UserUUID           string `tbl:"NN"`
 	SessionUUID        string `tbl:"NNUI"`
+	Ipaddress          string `tbl:"NN"`
+	Useragent          string `tbl:"NN"`
+	Rememberme         bool   `tbl:"NN"`
 }
 
-func (ast *AuthSessionsTable) Init(db *sql.DB) {}
+//Init recreates the table if it's from before users could have more than one session, as it only allowed one
+//per user, the sessions in it are lost so everyone has to log in again
+func (ast *AuthSessionsTable) Init(db *sql.DB) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s LIMIT 0", ast.Name()))
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+	columns, err := rows.Columns()
+	rows.Close()
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	for _, column := range columns {
+		if column == "ipaddress" {
+			return
+		}
+	}
+
+	logging.Info(fmt.Sprintf("Recreating %s table to allow more than one session per user...", ast.Name()))
+	if _, err := db.Exec(fmt.Sprintf("DROP TABLE %s", ast.Name())); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+	if _, err := db.Exec(createStatement(ast)); err != nil {
+		logging.Error(err.Error())
+	}
+}
 
 func (ast *AuthSessionsTable) Name() string { return "authsessions" }
 
 func (ast *AuthSessionsTable) Insert(db *sql.DB, as *AuthSession) error {
 	if as.Validate() {
 		insertStatement := ast.buildPreparedInsertStatement(as)
-		_, err := db.Exec(insertStatement, as.CreatedDateTime, as.LastActiveDateTime, as.UserUUID, as.SessionUUID)
+		_, err := db.Exec(insertStatement, as.CreatedDateTime, as.LastActiveDateTime, as.UserUUID, as.SessionUUID, as.IPAddress, as.UserAgent, as.RememberMe)
 		if err != nil {
 			return err
 		}
@@ -769,11 +989,11 @@ func (ast *AuthSessionsTable) Insert(db *sql.DB, as *AuthSession) error {
 	return errors.New("AuthSession doesn't have a user UUID and/or a session UUID")
 }
 
-//Update - Takes auth session to update existing user session entry session UUID
+//Update - Takes auth session to update when and where the existing session with its session UUID was last active
 func (ast *AuthSessionsTable) Update(db *sql.DB, as *AuthSession) error {
 	if as.Validate() {
-		updateStatement := fmt.Sprintf("UPDATE %s SET createddatetime = ?, lastactivedatetime = ?, sessionuuid = ? WHERE useruuid = ?", ast.Name())
-		_, err := db.Exec(updateStatement, as.CreatedDateTime, as.LastActiveDateTime, as.SessionUUID, as.UserUUID)
+		updateStatement := fmt.Sprintf("UPDATE %s SET lastactivedatetime = ?, ipaddress = ? WHERE sessionuuid = ?", ast.Name())
+		_, err := db.Exec(updateStatement, as.LastActiveDateTime, as.IPAddress, as.SessionUUID)
 		if err != nil {
 			return err
 		}
@@ -789,24 +1009,47 @@ func (ast *AuthSessionsTable) Select(db *sql.DB, whatToSelect string, whereClaus
 	return db.Query(fmt.Sprintf("SELECT %s FROM %s", whatToSelect, ast.Name()))
 }
 
+func (ast *AuthSessionsTable) scan(rows *sql.Rows) ([]*AuthSession, error) {
+	defer rows.Close()
+
+	sessions := []*AuthSession{}
+	for rows.Next() {
+		as := &AuthSession{}
+		if err := rows.Scan(&as.Authsessionid, &as.CreatedDateTime, &as.LastActiveDateTime, &as.UserUUID, &as.SessionUUID, &as.IPAddress, &as.UserAgent, &as.RememberMe); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, as)
+	}
+
+	return sessions, rows.Err()
+}
+
 func (ast *AuthSessionsTable) SelectBySessionUUID(db *sql.DB, sessionUUID string) (*AuthSession, error) {
 	as := &AuthSession{}
-	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE sessionuuid = '%s'", ast.Name(), sessionUUID))
-	err := row.Scan(&as.Authsessionid, &as.CreatedDateTime, &as.LastActiveDateTime, &as.UserUUID, &as.SessionUUID)
+	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE sessionuuid = ?", ast.Name()), sessionUUID)
+	err := row.Scan(&as.Authsessionid, &as.CreatedDateTime, &as.LastActiveDateTime, &as.UserUUID, &as.SessionUUID, &as.IPAddress, &as.UserAgent, &as.RememberMe)
 	if err != nil {
 		return nil, err
 	}
 	return as, nil
 }
 
-func (ast *AuthSessionsTable) SelectByUserUUID(db *sql.DB, userUUID string) (*AuthSession, error) {
-	as := &AuthSession{}
-	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE useruuid = '%s'", ast.Name(), userUUID))
-	err := row.Scan(&as.Authsessionid, &as.CreatedDateTime, &as.LastActiveDateTime, &as.UserUUID, &as.SessionUUID)
+//SelectByUserUUID get every session of the user with userUUID, most recently active first
+func (ast *AuthSessionsTable) SelectByUserUUID(db *sql.DB, userUUID string) ([]*AuthSession, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE useruuid = ? ORDER BY lastactivedatetime DESC", ast.Name()), userUUID)
 	if err != nil {
 		return nil, err
 	}
-	return as, nil
+	return ast.scan(rows)
+}
+
+//SelectAll get every user's sessions, most recently active first
+func (ast *AuthSessionsTable) SelectAll(db *sql.DB) ([]*AuthSession, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s ORDER BY lastactivedatetime DESC", ast.Name()))
+	if err != nil {
+		return nil, err
+	}
+	return ast.scan(rows)
 }
 
 func (ast *AuthSessionsTable) Delete(db *sql.DB, whereClause string) error {
@@ -820,6 +1063,15 @@ func (ast *AuthSessionsTable) Delete(db *sql.DB, whereClause string) error {
 	return errors.New("Where to delete clause is blank")
 }
 
+//DeleteAll ends every session, logging everyone out
+func (ast *AuthSessionsTable) DeleteAll(db *sql.DB) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s", ast.Name()))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 func (ast *AuthSessionsTable) DeleteBySessionUUID(db *sql.DB, sessionUUID string) error {
 	if len(sessionUUID) > 0 {
 		_, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE sessionuuid = ?", ast.Name()), sessionUUID)
@@ -831,6 +1083,28 @@ func (ast *AuthSessionsTable) DeleteBySessionUUID(db *sql.DB, sessionUUID string
 	return errors.New("Session UUID to delete by is blank")
 }
 
+//DeleteExpired ends sessions which were last active before idleBefore, along with those created before createdBefore,
+//or if they're remembered created before rememberedCreatedBefore
+func (ast *AuthSessionsTable) DeleteExpired(db *sql.DB, idleBefore int64, createdBefore int64, rememberedCreatedBefore int64) (int64, error) {
+	res, err := db.Exec(
+		fmt.Sprintf("DELETE FROM %s WHERE (rememberme = ? AND (lastactivedatetime <= ? OR createddatetime <= ?)) OR (rememberme = ? AND createddatetime <= ?)", ast.Name()),
+		false, idleBefore, createdBefore, true, rememberedCreatedBefore,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+//DeleteByUserUUID logs the user with userUUID out everywhere
+func (ast *AuthSessionsTable) DeleteByUserUUID(db *sql.DB, userUUID string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE useruuid = ?", ast.Name()), userUUID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
 //BuildFields takes the table struct and maps all of the struct fields to their own struct
 func (ast *AuthSessionsTable) buildFields() []Field {
 	return buildFieldsFromTable(ast)
@@ -893,135 +1167,1411 @@ func (sit *SystemInfoTable) buildPreparedInsertStatement(m Model) string {
 
 // ******** End SystemInfo Table ********
 
-// ****************************************** END TABLES ******************************************
-/////////////////////////////////////////////////////////////////////////////////
-//////////////////////////////////////////////////////////////////////
-////////////////////////////////////////////////////////////
-///////////////////////////////////////////////////////
-//////////////////////////////////////////////
-//////////////////////////////////////////////////////
-///////////////////////////////////////////////////////////
-/////////////////////////////////////////////////////////////////////
-////////////////////////////////////////////////////////////////////////////////
-// ****************************************** MODELS ******************************************
+// ******** Start Settings Table ********
 
-//Model describes the structure of a model
-type Model interface {
-	TableName() string
-	BuildFields() []Field
+//SettingsTable describes the table structure for site wide name/value settings
+type SettingsTable struct {
+	Settingid   int    `tbl:"PKNNAIUI"`
+	Settingname string `tbl:"NNUI"`
+	Value       string `tbl:"NN"`
 }
 
-//User describes the content of a user, it should match the columns present in the users table
-type User struct {
-	UserId          int    `tbl:"AI" json:"userid"`
-	CreatedDateTime int64  `json:"createddatetime"`
-	UserroleId      int    `json:"userroleid"`
-	UUID            string `json:"UUID"`
-	Username        string `json:"username"`
-	AuthHash        string `json:"authhash"`
-	FirstName       string `json:"firstname"`
-	LastName        string `json:"lastname"`
-	Email           string `json:"email"`
+func (st *SettingsTable) Init(db *sql.DB) {}
+
+func (st *SettingsTable) Name() string { return "settings" }
+
+//Get retrieves the value of the named setting, returns fallback value if the setting has never been set
+func (st *SettingsTable) Get(db *sql.DB, name string, fallback string) (string, error) {
+	var value string
+	err := db.QueryRow(fmt.Sprintf("SELECT value FROM %s WHERE settingname = ?", st.Name()), name).Scan(&value)
+	if err == sql.ErrNoRows {
+		return fallback, nil
+	}
+	if err != nil {
+		return fallback, err
+	}
+	return value, nil
 }
 
-//Login takes the current username and authhash values of self and tries
-//using them to authenticate/login. A successful login will return/generate
-//a JWT token for further use in any subsequent API request
-func (u *User) Login() bool {
-	ut := &UsersTable{}
-	user, err := ut.SelectByUsername(Conn, u.Username)
+//Set stores the value of the named setting, creating the setting if it doesn't exist yet
+func (st *SettingsTable) Set(db *sql.DB, name string, value string) error {
+	res, err := db.Exec(fmt.Sprintf("UPDATE %s SET value = ? WHERE settingname = ?", st.Name()), value, name)
+	if err != nil {
+		return err
+	}
 
+	numUpdated, err := res.RowsAffected()
 	if err != nil {
-		logging.Error(err.Error())
-		return false
+		return err
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(user.AuthHash), []byte(u.AuthHash))
-	if err == nil {
-		return true
+
+	if numUpdated > 0 {
+		return nil
 	}
-	return false
-}
 
-//TableName gets the name of the users table
-func (u *User) TableName() string {
-	return "users"
+	insertStatement := st.buildPreparedInsertStatement(&Setting{})
+	_, err = db.Exec(insertStatement, name, value)
+	return err
 }
 
-//BuildFields generates a list of fields generated from the fields of the user struct
-func (u *User) BuildFields() []Field {
-	return buildFieldsFromModel(u)
+func (st *SettingsTable) buildFields() []Field {
+	return buildFieldsFromTable(st)
 }
 
-//Validate makes sure that required fields have not been left blank
-func (u *User) Validate() error {
-	if u.Username == "" {
-		return fmt.Errorf("Missing username")
-	}
-	if u.AuthHash == "" {
-		return fmt.Errorf("Missing password")
-	}
-	return nil
+func (st *SettingsTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(st, m)
 }
 
-type Group struct {
-	Groupid         int    `tbl:"AI" json:"groupid"`
-	CreatedDateTime int64  `json:"createddatetime"`
-	UUID            string `json:"UUID"`
-	Title           string `json:"title"`
+func (st *SettingsTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(st, m)
 }
 
-func (g *Group) TableName() string {
-	return "groups"
-}
+// ******** End Settings Table ********
 
-func (g *Group) BuildFields() []Field {
-	return buildFieldsFromModel(g)
+// ******** Start Feeds Table ********
+
+//FeedsTable describes the table structure for the page collections which are syndicated as RSS/Atom feeds
+type FeedsTable struct {
+	Feedid          int    `tbl:"PKNNAIUI"`
+	CreatedDateTime int64  `tbl:"NNDT"`
+	Slug            string `tbl:"NNUI"`
+	Title           string `tbl:"NN"`
+	Routeprefix     string `tbl:"NN"`
+	Tag             string `tbl:"NN"`
+	Itemcount       int    `tbl:"NN"`
 }
 
-func (g *Group) Validate() bool {
-	return len(g.UUID) > 0
+func (ft *FeedsTable) Init(db *sql.DB) {}
+
+func (ft *FeedsTable) Name() string { return "feeds" }
+
+func (ft *FeedsTable) Insert(db *sql.DB, f *Feed) error {
+	insertStatement := ft.buildPreparedInsertStatement(f)
+	_, err := db.Exec(insertStatement, f.CreatedDateTime, f.Slug, f.Title, f.RoutePrefix, f.Tag, f.ItemCount)
+	return err
 }
 
-type GroupMembership struct {
-	Groupmembershipid int    `tbl:"AI" json:"groupmembershipid"`
-	CreatedDateTime   int64  `json:"createddatetime"`
-	GroupUUID         string `json:"GroupUUID"`
-	UserUUID          string `json:"UserUUID"`
+//SelectAll get every feed, ordered by slug
+func (ft *FeedsTable) SelectAll(db *sql.DB) ([]*Feed, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s ORDER BY slug", ft.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	feeds := []*Feed{}
+	for rows.Next() {
+		f := &Feed{}
+		if err := rows.Scan(&f.Feedid, &f.CreatedDateTime, &f.Slug, &f.Title, &f.RoutePrefix, &f.Tag, &f.ItemCount); err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, f)
+	}
+
+	return feeds, rows.Err()
 }
 
-func (gm *GroupMembership) TableName() string {
-	return "groupmemberships"
+func (ft *FeedsTable) SelectBySlug(db *sql.DB, slug string) (*Feed, error) {
+	f := &Feed{}
+	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE slug = ?", ft.Name()), slug)
+	if err := row.Scan(&f.Feedid, &f.CreatedDateTime, &f.Slug, &f.Title, &f.RoutePrefix, &f.Tag, &f.ItemCount); err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
-func (gm *GroupMembership) BuildFields() []Field {
-	return buildFieldsFromModel(gm)
+func (ft *FeedsTable) DeleteBySlug(db *sql.DB, slug string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE slug = ?", ft.Name()), slug)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
 }
 
-//UserRole describes the content of a userrole entry, it should match the columns present in the userrole table
-type UserRole struct {
-	Userroleid int `tbl:"AI"`
-	Rolename   string
+func (ft *FeedsTable) buildFields() []Field {
+	return buildFieldsFromTable(ft)
 }
 
-//TableName gets the name of the userrole table
-func (ur *UserRole) TableName() string {
-	return "userroles"
+func (ft *FeedsTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(ft, m)
 }
 
-//BuildFields generates a list of fields generated from the fields of the userrole struct
-func (ur *UserRole) BuildFields() []Field {
-	return buildFieldsFromModel(ur)
+func (ft *FeedsTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(ft, m)
 }
 
-type Page struct {
-	PageId          int    `tbl:"AI" json:"pageid"`
+// ******** End Feeds Table ********
+
+// ******** Start Robots Groups Table ********
+
+//RobotsGroupsTable user-agent groups of robots.txt rules added on top of the automatic ones
+type RobotsGroupsTable struct {
+	Robotsgroupid   int    `tbl:"PKNNAIUI"`
+	CreatedDateTime int64  `tbl:"NNDT"`
+	Useragents      string `tbl:"NN"`
+	Rules           string `tbl:"NN"`
+	Pluginmanaged   bool   `tbl:"NN"`
+}
+
+func (rgt *RobotsGroupsTable) Init(db *sql.DB) {}
+
+func (rgt *RobotsGroupsTable) Name() string { return "robotsgroups" }
+
+func (rgt *RobotsGroupsTable) Insert(db *sql.DB, g *RobotsGroup) error {
+	insertStatement := rgt.buildPreparedInsertStatement(g)
+	_, err := db.Exec(insertStatement, g.CreatedDateTime, g.UserAgents, g.Rules, g.PluginManaged)
+	return err
+}
+
+func (rgt *RobotsGroupsTable) Update(db *sql.DB, g *RobotsGroup) error {
+	updateStatement := fmt.Sprintf("UPDATE %s SET useragents = ?, rules = ?, pluginmanaged = ? WHERE robotsgroupid = ?", rgt.Name())
+	_, err := db.Exec(updateStatement, g.UserAgents, g.Rules, g.PluginManaged, g.Robotsgroupid)
+	return err
+}
+
+//SelectAll get every group in the order they were created
+func (rgt *RobotsGroupsTable) SelectAll(db *sql.DB) ([]*RobotsGroup, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s ORDER BY robotsgroupid", rgt.Name()))
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	groups := []*RobotsGroup{}
+	for rows.Next() {
+		g := &RobotsGroup{}
+		if err := rows.Scan(&g.Robotsgroupid, &g.CreatedDateTime, &g.UserAgents, &g.Rules, &g.PluginManaged); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+
+	return groups, rows.Err()
+}
+
+func (rgt *RobotsGroupsTable) SelectByID(db *sql.DB, id int) (*RobotsGroup, error) {
+	g := &RobotsGroup{}
+	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE robotsgroupid = ?", rgt.Name()), id)
+	if err := row.Scan(&g.Robotsgroupid, &g.CreatedDateTime, &g.UserAgents, &g.Rules, &g.PluginManaged); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+//SelectPluginManaged get the group holding lines added by plugins
+func (rgt *RobotsGroupsTable) SelectPluginManaged(db *sql.DB) (*RobotsGroup, error) {
+	g := &RobotsGroup{}
+	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE pluginmanaged = ? ORDER BY robotsgroupid LIMIT 1", rgt.Name()), true)
+	if err := row.Scan(&g.Robotsgroupid, &g.CreatedDateTime, &g.UserAgents, &g.Rules, &g.PluginManaged); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (rgt *RobotsGroupsTable) DeleteByID(db *sql.DB, id int) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE robotsgroupid = ?", rgt.Name()), id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (rgt *RobotsGroupsTable) buildFields() []Field {
+	return buildFieldsFromTable(rgt)
+}
+
+func (rgt *RobotsGroupsTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(rgt, m)
+}
+
+func (rgt *RobotsGroupsTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(rgt, m)
+}
+
+// ******** End Robots Groups Table ********
+
+// ******** Start API Tokens Table ********
+
+//APITokensTable personal tokens users authenticate machine access with, only a hash of each token's secret is kept
+type APITokensTable struct {
+	Apitokenid       int    `tbl:"PKNNAIUI"`
+	CreatedDateTime  int64  `tbl:"NNDT"`
+	UUID             string `tbl:"NNUI"`
+	UserUUID         string `tbl:"NN"`
+	Tokenname        string `tbl:"NN"`
+	Secrethash       string `tbl:"NN"`
+	Scopes           string `tbl:"NN"`
+	Expiresdatetime  int64  `tbl:"NN"`
+	Lastuseddatetime int64  `tbl:"NN"`
+}
+
+func (att *APITokensTable) Init(db *sql.DB) {}
+
+func (att *APITokensTable) Name() string { return "apitokens" }
+
+func (att *APITokensTable) Insert(db *sql.DB, t *APIToken) error {
+	if t.UUID != "" {
+		return fmt.Errorf("API token to insert already has UUID %s", t.UUID)
+	}
+
+	newUUID, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	t.UUID = newUUID.String()
+
+	insertStatement := att.buildPreparedInsertStatement(t)
+	_, err = db.Exec(insertStatement, t.CreatedDateTime, t.UUID, t.UserUUID, t.Name, t.SecretHash, t.Scopes, t.ExpiresDateTime, t.LastUsedDateTime)
+	return err
+}
+
+//SelectByUUID get the token with tokenUUID
+func (att *APITokensTable) SelectByUUID(db *sql.DB, tokenUUID string) (*APIToken, error) {
+	t := &APIToken{}
+	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE uuid = ?", att.Name()), tokenUUID)
+	if err := row.Scan(&t.Apitokenid, &t.CreatedDateTime, &t.UUID, &t.UserUUID, &t.Name, &t.SecretHash, &t.Scopes, &t.ExpiresDateTime, &t.LastUsedDateTime); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+//SelectByUserUUID get every token belonging to the user with userUUID, newest first
+func (att *APITokensTable) SelectByUserUUID(db *sql.DB, userUUID string) ([]*APIToken, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE useruuid = ? ORDER BY createddatetime DESC, apitokenid DESC", att.Name()), userUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	tokens := []*APIToken{}
+	for rows.Next() {
+		t := &APIToken{}
+		if err := rows.Scan(&t.Apitokenid, &t.CreatedDateTime, &t.UUID, &t.UserUUID, &t.Name, &t.SecretHash, &t.Scopes, &t.ExpiresDateTime, &t.LastUsedDateTime); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+//UpdateLastUsed records the token with tokenUUID was used at lastUsed
+func (att *APITokensTable) UpdateLastUsed(db *sql.DB, tokenUUID string, lastUsed int64) error {
+	_, err := db.Exec(fmt.Sprintf("UPDATE %s SET lastuseddatetime = ? WHERE uuid = ?", att.Name()), lastUsed, tokenUUID)
+	return err
+}
+
+func (att *APITokensTable) DeleteByUUID(db *sql.DB, tokenUUID string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE uuid = ?", att.Name()), tokenUUID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+//DeleteByUserUUID revokes every token belonging to the user with userUUID
+func (att *APITokensTable) DeleteByUserUUID(db *sql.DB, userUUID string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE useruuid = ?", att.Name()), userUUID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (att *APITokensTable) buildFields() []Field {
+	return buildFieldsFromTable(att)
+}
+
+func (att *APITokensTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(att, m)
+}
+
+func (att *APITokensTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(att, m)
+}
+
+// ******** End API Tokens Table ********
+
+// ******** Start OIDC Providers Table ********
+
+//OIDCProvidersTable OpenID Connect identity providers users can sign in with
+type OIDCProvidersTable struct {
+	Oidcproviderid  int    `tbl:"PKNNAIUI"`
+	CreatedDateTime int64  `tbl:"NNDT"`
+	Slug            string `tbl:"NNUI"`
+	Title           string `tbl:"NN"`
+	Issuer          string `tbl:"NN"`
+	Clientid        string `tbl:"NN"`
+	Clientsecret    string `tbl:"NN"`
+	Scopes          string `tbl:"NN"`
+	Groupsclaim     string `tbl:"NN"`
+	Groupmappings   string `tbl:"NN"`
+	Rolemappings    string `tbl:"NN"`
+	Defaultrole     int    `tbl:"NN"`
+	Enabled         bool   `tbl:"NN"`
+}
+
+func (opt *OIDCProvidersTable) Init(db *sql.DB) {}
+
+func (opt *OIDCProvidersTable) Name() string { return "oidcproviders" }
+
+func (opt *OIDCProvidersTable) Insert(db *sql.DB, p *OIDCProvider) error {
+	insertStatement := opt.buildPreparedInsertStatement(p)
+	_, err := db.Exec(insertStatement, p.CreatedDateTime, p.Slug, p.Title, p.Issuer, p.ClientID, p.ClientSecret, p.Scopes, p.GroupsClaim, p.GroupMappings, p.RoleMappings, p.DefaultRole, p.Enabled)
+	return err
+}
+
+func (opt *OIDCProvidersTable) Update(db *sql.DB, p *OIDCProvider) error {
+	updateStatement := fmt.Sprintf("UPDATE %s SET title = ?, issuer = ?, clientid = ?, clientsecret = ?, scopes = ?, groupsclaim = ?, groupmappings = ?, rolemappings = ?, defaultrole = ?, enabled = ? WHERE oidcproviderid = ?", opt.Name())
+	_, err := db.Exec(updateStatement, p.Title, p.Issuer, p.ClientID, p.ClientSecret, p.Scopes, p.GroupsClaim, p.GroupMappings, p.RoleMappings, p.DefaultRole, p.Enabled, p.Oidcproviderid)
+	return err
+}
+
+//SelectAll get every provider, ordered by slug
+func (opt *OIDCProvidersTable) SelectAll(db *sql.DB) ([]*OIDCProvider, error) {
+	return opt.selectWhere(db, "1 = 1")
+}
+
+//SelectEnabled get every provider users can currently sign in with, ordered by slug
+func (opt *OIDCProvidersTable) SelectEnabled(db *sql.DB) ([]*OIDCProvider, error) {
+	return opt.selectWhere(db, "enabled = ?", true)
+}
+
+func (opt *OIDCProvidersTable) selectWhere(db *sql.DB, where string, args ...interface{}) ([]*OIDCProvider, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE %s ORDER BY slug", opt.Name(), where), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	providers := []*OIDCProvider{}
+	for rows.Next() {
+		p := &OIDCProvider{}
+		if err := rows.Scan(&p.Oidcproviderid, &p.CreatedDateTime, &p.Slug, &p.Title, &p.Issuer, &p.ClientID, &p.ClientSecret, &p.Scopes, &p.GroupsClaim, &p.GroupMappings, &p.RoleMappings, &p.DefaultRole, &p.Enabled); err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+
+	return providers, rows.Err()
+}
+
+func (opt *OIDCProvidersTable) SelectBySlug(db *sql.DB, slug string) (*OIDCProvider, error) {
+	p := &OIDCProvider{}
+	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE slug = ?", opt.Name()), slug)
+	if err := row.Scan(&p.Oidcproviderid, &p.CreatedDateTime, &p.Slug, &p.Title, &p.Issuer, &p.ClientID, &p.ClientSecret, &p.Scopes, &p.GroupsClaim, &p.GroupMappings, &p.RoleMappings, &p.DefaultRole, &p.Enabled); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (opt *OIDCProvidersTable) DeleteBySlug(db *sql.DB, slug string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE slug = ?", opt.Name()), slug)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (opt *OIDCProvidersTable) buildFields() []Field {
+	return buildFieldsFromTable(opt)
+}
+
+func (opt *OIDCProvidersTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(opt, m)
+}
+
+func (opt *OIDCProvidersTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(opt, m)
+}
+
+// ******** End OIDC Providers Table ********
+
+// ******** Start OIDC Identities Table ********
+
+//OIDCIdentitiesTable links a user at an identity provider to the berrycms user they sign in as
+type OIDCIdentitiesTable struct {
+	Oidcidentityid  int    `tbl:"PKNNAIUI"`
+	CreatedDateTime int64  `tbl:"NNDT"`
+	Providerslug    string `tbl:"NN"`
+	Subject         string `tbl:"NN"`
+	UserUUID        string `tbl:"NN"`
+}
+
+func (oit *OIDCIdentitiesTable) Init(db *sql.DB) {}
+
+func (oit *OIDCIdentitiesTable) Name() string { return "oidcidentities" }
+
+func (oit *OIDCIdentitiesTable) Insert(db *sql.DB, i *OIDCIdentity) error {
+	insertStatement := oit.buildPreparedInsertStatement(i)
+	_, err := db.Exec(insertStatement, i.CreatedDateTime, i.ProviderSlug, i.Subject, i.UserUUID)
+	return err
+}
+
+//SelectByProviderSubject get the identity of the user with subject at the provider with providerSlug
+func (oit *OIDCIdentitiesTable) SelectByProviderSubject(db *sql.DB, providerSlug string, subject string) (*OIDCIdentity, error) {
+	i := &OIDCIdentity{}
+	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE providerslug = ? AND subject = ?", oit.Name()), providerSlug, subject)
+	if err := row.Scan(&i.Oidcidentityid, &i.CreatedDateTime, &i.ProviderSlug, &i.Subject, &i.UserUUID); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+//DeleteByUserUUID unlinks every identity the user with userUUID signs in with
+func (oit *OIDCIdentitiesTable) DeleteByUserUUID(db *sql.DB, userUUID string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE useruuid = ?", oit.Name()), userUUID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+//DeleteByProviderSlug unlinks every identity at the provider with providerSlug
+func (oit *OIDCIdentitiesTable) DeleteByProviderSlug(db *sql.DB, providerSlug string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE providerslug = ?", oit.Name()), providerSlug)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (oit *OIDCIdentitiesTable) buildFields() []Field {
+	return buildFieldsFromTable(oit)
+}
+
+func (oit *OIDCIdentitiesTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(oit, m)
+}
+
+func (oit *OIDCIdentitiesTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(oit, m)
+}
+
+// ******** End OIDC Identities Table ********
+
+// ******** Start Two Factors Table ********
+
+//TwoFactorsTable users' TOTP secrets, a user's secret is pending until they've confirmed enrolment with a code
+type TwoFactorsTable struct {
+	Twofactorid     int    `tbl:"PKNNAIUI"`
+	CreatedDateTime int64  `tbl:"NNDT"`
+	UserUUID        string `tbl:"NNUI"`
+	Secret          string `tbl:"NN"`
+	Enabled         bool   `tbl:"NN"`
+	Laststep        int64  `tbl:"NN"`
+}
+
+func (tft *TwoFactorsTable) Init(db *sql.DB) {}
+
+func (tft *TwoFactorsTable) Name() string { return "twofactors" }
+
+func (tft *TwoFactorsTable) Insert(db *sql.DB, tf *TwoFactor) error {
+	insertStatement := tft.buildPreparedInsertStatement(tf)
+	_, err := db.Exec(insertStatement, tf.CreatedDateTime, tf.UserUUID, tf.Secret, tf.Enabled, tf.LastStep)
+	return err
+}
+
+//SelectByUserUUID get the TOTP secret of the user with userUUID
+func (tft *TwoFactorsTable) SelectByUserUUID(db *sql.DB, userUUID string) (*TwoFactor, error) {
+	tf := &TwoFactor{}
+	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE useruuid = ?", tft.Name()), userUUID)
+	if err := row.Scan(&tf.Twofactorid, &tf.CreatedDateTime, &tf.UserUUID, &tf.Secret, &tf.Enabled, &tf.LastStep); err != nil {
+		return nil, err
+	}
+	return tf, nil
+}
+
+//Enable confirms the enrolment of the user with userUUID, step is the period of the code they confirmed with
+func (tft *TwoFactorsTable) Enable(db *sql.DB, userUUID string, step int64) error {
+	_, err := db.Exec(fmt.Sprintf("UPDATE %s SET enabled = ?, laststep = ? WHERE useruuid = ?", tft.Name()), true, step, userUUID)
+	return err
+}
+
+//UseStep records the user with userUUID signed in with a code from step, failing if that step or a later one has already been used
+func (tft *TwoFactorsTable) UseStep(db *sql.DB, userUUID string, step int64) (bool, error) {
+	res, err := db.Exec(fmt.Sprintf("UPDATE %s SET laststep = ? WHERE useruuid = ? AND laststep < ?", tft.Name()), step, userUUID, step)
+	if err != nil {
+		return false, err
+	}
+	numUpdated, err := res.RowsAffected()
+	return numUpdated > 0, err
+}
+
+func (tft *TwoFactorsTable) DeleteByUserUUID(db *sql.DB, userUUID string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE useruuid = ?", tft.Name()), userUUID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (tft *TwoFactorsTable) buildFields() []Field {
+	return buildFieldsFromTable(tft)
+}
+
+func (tft *TwoFactorsTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(tft, m)
+}
+
+func (tft *TwoFactorsTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(tft, m)
+}
+
+// ******** End Two Factors Table ********
+
+// ******** Start Two Factor Challenges Table ********
+
+//TwoFactorChallengesTable pending challenges of users who've entered their password but not yet their second factor,
+//keyed by a random ID kept in the client's cookie so the wrong codes counted against a challenge can't be reset by the client
+type TwoFactorChallengesTable struct {
+	Twofactorchallengeid int    `tbl:"PKNNAIUI"`
+	CreatedDateTime      int64  `tbl:"NNDT"`
+	Challengeid          string `tbl:"NNUI"`
+	UserUUID             string `tbl:"NN"`
+	Rememberme           bool   `tbl:"NN"`
+	Attempts             int    `tbl:"NN"`
+}
+
+func (tfct *TwoFactorChallengesTable) Init(db *sql.DB) {}
+
+func (tfct *TwoFactorChallengesTable) Name() string { return "twofactorchallenges" }
+
+func (tfct *TwoFactorChallengesTable) Insert(db *sql.DB, tfc *TwoFactorChallenge) error {
+	insertStatement := tfct.buildPreparedInsertStatement(tfc)
+	_, err := db.Exec(insertStatement, tfc.CreatedDateTime, tfc.ChallengeID, tfc.UserUUID, tfc.RememberMe, tfc.Attempts)
+	return err
+}
+
+//SelectByChallengeID get the challenge with challengeID, whether or not it's expired
+func (tfct *TwoFactorChallengesTable) SelectByChallengeID(db *sql.DB, challengeID string) (*TwoFactorChallenge, error) {
+	tfc := &TwoFactorChallenge{}
+	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE challengeid = ?", tfct.Name()), challengeID)
+	if err := row.Scan(&tfc.Twofactorchallengeid, &tfc.CreatedDateTime, &tfc.ChallengeID, &tfc.UserUUID, &tfc.RememberMe, &tfc.Attempts); err != nil {
+		return nil, err
+	}
+	return tfc, nil
+}
+
+//UseAttempt counts an attempt against the challenge with challengeID, failing if it's already had maxAttempts
+func (tfct *TwoFactorChallengesTable) UseAttempt(db *sql.DB, challengeID string, maxAttempts int) (bool, error) {
+	res, err := db.Exec(fmt.Sprintf("UPDATE %s SET attempts = attempts + 1 WHERE challengeid = ? AND attempts < ?", tfct.Name()), challengeID, maxAttempts)
+	if err != nil {
+		return false, err
+	}
+	numUpdated, err := res.RowsAffected()
+	return numUpdated > 0, err
+}
+
+func (tfct *TwoFactorChallengesTable) DeleteByChallengeID(db *sql.DB, challengeID string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE challengeid = ?", tfct.Name()), challengeID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (tfct *TwoFactorChallengesTable) DeleteByUserUUID(db *sql.DB, userUUID string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE useruuid = ?", tfct.Name()), userUUID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+//DeleteExpired removes challenges which were started before createdBefore
+func (tfct *TwoFactorChallengesTable) DeleteExpired(db *sql.DB, createdBefore int64) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE createddatetime < ?", tfct.Name()), createdBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (tfct *TwoFactorChallengesTable) buildFields() []Field {
+	return buildFieldsFromTable(tfct)
+}
+
+func (tfct *TwoFactorChallengesTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(tfct, m)
+}
+
+func (tfct *TwoFactorChallengesTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(tfct, m)
+}
+
+// ******** End Two Factor Challenges Table ********
+
+// ******** Start Recovery Codes Table ********
+
+//RecoveryCodesTable one-time codes users can sign in with instead of a TOTP code, only hashes of the codes are kept
+type RecoveryCodesTable struct {
+	Recoverycodeid  int    `tbl:"PKNNAIUI"`
+	CreatedDateTime int64  `tbl:"NNDT"`
+	UserUUID        string `tbl:"NN"`
+	Codehash        string `tbl:"NN"`
+}
+
+func (rct *RecoveryCodesTable) Init(db *sql.DB) {}
+
+func (rct *RecoveryCodesTable) Name() string { return "recoverycodes" }
+
+func (rct *RecoveryCodesTable) Insert(db *sql.DB, rc *RecoveryCode) error {
+	insertStatement := rct.buildPreparedInsertStatement(rc)
+	_, err := db.Exec(insertStatement, rc.CreatedDateTime, rc.UserUUID, rc.CodeHash)
+	return err
+}
+
+//SelectByUserUUID get the unused recovery codes of the user with userUUID
+func (rct *RecoveryCodesTable) SelectByUserUUID(db *sql.DB, userUUID string) ([]*RecoveryCode, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE useruuid = ? ORDER BY recoverycodeid", rct.Name()), userUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	codes := []*RecoveryCode{}
+	for rows.Next() {
+		rc := &RecoveryCode{}
+		if err := rows.Scan(&rc.Recoverycodeid, &rc.CreatedDateTime, &rc.UserUUID, &rc.CodeHash); err != nil {
+			return nil, err
+		}
+		codes = append(codes, rc)
+	}
+
+	return codes, rows.Err()
+}
+
+//DeleteByID uses up a recovery code, reporting whether it was still unused
+func (rct *RecoveryCodesTable) DeleteByID(db *sql.DB, id int) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE recoverycodeid = ?", rct.Name()), id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (rct *RecoveryCodesTable) DeleteByUserUUID(db *sql.DB, userUUID string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE useruuid = ?", rct.Name()), userUUID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (rct *RecoveryCodesTable) buildFields() []Field {
+	return buildFieldsFromTable(rct)
+}
+
+func (rct *RecoveryCodesTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(rct, m)
+}
+
+func (rct *RecoveryCodesTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(rct, m)
+}
+
+// ******** End Recovery Codes Table ********
+
+// ******** Start Password Resets Table ********
+
+//PasswordResetsTable single use links users who've forgotten their password can set a new one with, only hashes of the tokens are kept
+type PasswordResetsTable struct {
+	Passwordresetid int    `tbl:"PKNNAIUI"`
+	CreatedDateTime int64  `tbl:"NNDT"`
+	Expiresdatetime int64  `tbl:"NN"`
+	UserUUID        string `tbl:"NN"`
+	Tokenhash       string `tbl:"NNUI"`
+}
+
+func (prt *PasswordResetsTable) Init(db *sql.DB) {}
+
+func (prt *PasswordResetsTable) Name() string { return "passwordresets" }
+
+func (prt *PasswordResetsTable) Insert(db *sql.DB, pr *PasswordReset) error {
+	insertStatement := prt.buildPreparedInsertStatement(pr)
+	_, err := db.Exec(insertStatement, pr.CreatedDateTime, pr.ExpiresDateTime, pr.UserUUID, pr.TokenHash)
+	return err
+}
+
+//SelectByTokenHash get the reset with tokenHash, whether or not it's expired
+func (prt *PasswordResetsTable) SelectByTokenHash(db *sql.DB, tokenHash string) (*PasswordReset, error) {
+	pr := &PasswordReset{}
+	row := db.QueryRow(fmt.Sprintf("SELECT * FROM %s WHERE tokenhash = ?", prt.Name()), tokenHash)
+	if err := row.Scan(&pr.Passwordresetid, &pr.CreatedDateTime, &pr.ExpiresDateTime, &pr.UserUUID, &pr.TokenHash); err != nil {
+		return nil, err
+	}
+	return pr, nil
+}
+
+//CountUnexpiredByUserUUID get how many of the user's resets haven't expired by now
+func (prt *PasswordResetsTable) CountUnexpiredByUserUUID(db *sql.DB, userUUID string, now int64) (int, error) {
+	var count int
+	row := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE useruuid = ? AND expiresdatetime > ?", prt.Name()), userUUID, now)
+	if err := row.Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+//DeleteByID uses up a reset, reporting whether it was still unused
+func (prt *PasswordResetsTable) DeleteByID(db *sql.DB, id int) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE passwordresetid = ?", prt.Name()), id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (prt *PasswordResetsTable) DeleteByUserUUID(db *sql.DB, userUUID string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE useruuid = ?", prt.Name()), userUUID)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+//DeleteExpired removes resets which expired before now
+func (prt *PasswordResetsTable) DeleteExpired(db *sql.DB, now int64) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE expiresdatetime <= ?", prt.Name()), now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (prt *PasswordResetsTable) buildFields() []Field {
+	return buildFieldsFromTable(prt)
+}
+
+func (prt *PasswordResetsTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(prt, m)
+}
+
+func (prt *PasswordResetsTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(prt, m)
+}
+
+// ******** End Password Resets Table ********
+
+// ******** Start Outbox Table ********
+
+//OutboxTable mail waiting to be delivered, along with what's been sent or given up on
+type OutboxTable struct {
+	Outboxid            int    `tbl:"PKNNAIUI"`
+	CreatedDateTime     int64  `tbl:"NNDT"`
+	Sender              string `tbl:"NN"`
+	Recipients          string `tbl:"NN"`
+	Subject             string `tbl:"NN"`
+	Body                string `tbl:"NN"`
+	Status              string `tbl:"NN"`
+	Attempts            int    `tbl:"NN"`
+	Nextattemptdatetime int64  `tbl:"NN"`
+	Lasterror           string `tbl:"NN"`
+	Sentdatetime        int64  `tbl:"NN"`
+	Sensitive           bool   `tbl:"NN"`
+}
+
+func (ot *OutboxTable) Init(db *sql.DB) {}
+
+func (ot *OutboxTable) Name() string { return "outbox" }
+
+func (ot *OutboxTable) Insert(db *sql.DB, om *OutboxMessage) error {
+	insertStatement := ot.buildPreparedInsertStatement(om)
+	res, err := db.Exec(insertStatement, om.CreatedDateTime, om.Sender, om.Recipients, om.Subject, om.Body, om.Status, om.Attempts, om.NextAttemptDateTime, om.LastError, om.SentDateTime, om.Sensitive)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	om.Outboxid = int(id)
+	return nil
+}
+
+//Update saves the delivery status of om, and its body which is cleared once a sensitive message is sent
+func (ot *OutboxTable) Update(db *sql.DB, om *OutboxMessage) error {
+	updateStatement := fmt.Sprintf("UPDATE %s SET body = ?, status = ?, attempts = ?, nextattemptdatetime = ?, lasterror = ?, sentdatetime = ? WHERE outboxid = ?", ot.Name())
+	_, err := db.Exec(updateStatement, om.Body, om.Status, om.Attempts, om.NextAttemptDateTime, om.LastError, om.SentDateTime, om.Outboxid)
+	return err
+}
+
+func (ot *OutboxTable) scan(rows *sql.Rows) ([]*OutboxMessage, error) {
+	defer rows.Close()
+
+	messages := []*OutboxMessage{}
+	for rows.Next() {
+		om := &OutboxMessage{}
+		if err := rows.Scan(&om.Outboxid, &om.CreatedDateTime, &om.Sender, &om.Recipients, &om.Subject, &om.Body, &om.Status, &om.Attempts, &om.NextAttemptDateTime, &om.LastError, &om.SentDateTime, &om.Sensitive); err != nil {
+			return nil, err
+		}
+		messages = append(messages, om)
+	}
+
+	return messages, rows.Err()
+}
+
+//SelectDue get up to limit messages with status which are due to be tried by now, oldest first
+func (ot *OutboxTable) SelectDue(db *sql.DB, status string, now int64, limit int) ([]*OutboxMessage, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE status = ? AND nextattemptdatetime <= ? ORDER BY nextattemptdatetime, outboxid LIMIT ?", ot.Name()), status, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return ot.scan(rows)
+}
+
+func (ot *OutboxTable) SelectByID(db *sql.DB, id int) (*OutboxMessage, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE outboxid = ?", ot.Name()), id)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := ot.scan(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return messages[0], nil
+}
+
+//DeleteSentBefore removes messages with status that were sent before before
+func (ot *OutboxTable) DeleteSentBefore(db *sql.DB, status string, before int64) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE status = ? AND sentdatetime < ?", ot.Name()), status, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (ot *OutboxTable) buildFields() []Field {
+	return buildFieldsFromTable(ot)
+}
+
+func (ot *OutboxTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(ot, m)
+}
+
+func (ot *OutboxTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(ot, m)
+}
+
+// ******** End Outbox Table ********
+
+// ******** Start Login Attempts Table ********
+
+//LoginAttemptsTable recent failed logins, keyed by the client's IP or the username tried, used to slow down and lock out guessing
+type LoginAttemptsTable struct {
+	Loginattemptid      int    `tbl:"PKNNAIUI"`
+	Attemptkey          string `tbl:"NNUI"`
+	Failures            int    `tbl:"NN"`
+	Lastfailuredatetime int64  `tbl:"NN"`
+	Lockeduntildatetime int64  `tbl:"NN"`
+}
+
+func (lat *LoginAttemptsTable) Init(db *sql.DB) {}
+
+func (lat *LoginAttemptsTable) Name() string { return "loginattempts" }
+
+func (lat *LoginAttemptsTable) scan(rows *sql.Rows) ([]*LoginAttempt, error) {
+	defer rows.Close()
+
+	attempts := []*LoginAttempt{}
+	for rows.Next() {
+		la := &LoginAttempt{}
+		if err := rows.Scan(&la.Loginattemptid, &la.AttemptKey, &la.Failures, &la.LastFailureDateTime, &la.LockedUntilDateTime); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, la)
+	}
+
+	return attempts, rows.Err()
+}
+
+//SelectByKey get the failed logins recorded against key, a blank record for key if there aren't any
+func (lat *LoginAttemptsTable) SelectByKey(db *sql.DB, key string) (*LoginAttempt, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE attemptkey = ?", lat.Name()), key)
+	if err != nil {
+		return nil, err
+	}
+	attempts, err := lat.scan(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(attempts) == 0 {
+		return &LoginAttempt{AttemptKey: key}, nil
+	}
+	return attempts[0], nil
+}
+
+//SelectLocked get the keys locked out at now which start with prefix
+func (lat *LoginAttemptsTable) SelectLocked(db *sql.DB, prefix string, now int64) ([]*LoginAttempt, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE attemptkey LIKE ? AND lockeduntildatetime > ?", lat.Name()), prefix+"%", now)
+	if err != nil {
+		return nil, err
+	}
+	return lat.scan(rows)
+}
+
+//Save inserts or updates the failed logins recorded against la's key
+func (lat *LoginAttemptsTable) Save(db *sql.DB, la *LoginAttempt) error {
+	res, err := db.Exec(fmt.Sprintf("UPDATE %s SET failures = ?, lastfailuredatetime = ?, lockeduntildatetime = ? WHERE attemptkey = ?", lat.Name()), la.Failures, la.LastFailureDateTime, la.LockedUntilDateTime, la.AttemptKey)
+	if err != nil {
+		return err
+	}
+	if updated, err := res.RowsAffected(); err != nil || updated > 0 {
+		return err
+	}
+
+	insertStatement := lat.buildPreparedInsertStatement(la)
+	_, err = db.Exec(insertStatement, la.AttemptKey, la.Failures, la.LastFailureDateTime, la.LockedUntilDateTime)
+	return err
+}
+
+func (lat *LoginAttemptsTable) DeleteByKey(db *sql.DB, key string) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE attemptkey = ?", lat.Name()), key)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+//DeleteStale removes records whose last failure was before before and which aren't locked out any more
+func (lat *LoginAttemptsTable) DeleteStale(db *sql.DB, before int64, now int64) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE lastfailuredatetime < ? AND lockeduntildatetime <= ?", lat.Name()), before, now)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (lat *LoginAttemptsTable) buildFields() []Field {
+	return buildFieldsFromTable(lat)
+}
+
+func (lat *LoginAttemptsTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(lat, m)
+}
+
+func (lat *LoginAttemptsTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(lat, m)
+}
+
+// ******** End Login Attempts Table ********
+
+// ******** Start Session Keys Table ********
+
+//SessionKeysTable keys cookies are signed and encrypted with, the newest signs new cookies and older ones are kept to still read cookies they signed
+type SessionKeysTable struct {
+	Sessionkeyid    int    `tbl:"PKNNAIUI"`
+	CreatedDateTime int64  `tbl:"NNDT"`
+	Hashkey         string `tbl:"NN"`
+	Blockkey        string `tbl:"NN"`
+}
+
+func (skt *SessionKeysTable) Init(db *sql.DB) {}
+
+func (skt *SessionKeysTable) Name() string { return "sessionkeys" }
+
+func (skt *SessionKeysTable) Insert(db *sql.DB, sk *SessionKey) error {
+	insertStatement := skt.buildPreparedInsertStatement(sk)
+	res, err := db.Exec(insertStatement, sk.CreatedDateTime, sk.HashKey, sk.BlockKey)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	sk.Sessionkeyid = int(id)
+	return nil
+}
+
+//SelectNewest get up to limit keys, newest first
+func (skt *SessionKeysTable) SelectNewest(db *sql.DB, limit int) ([]*SessionKey, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s ORDER BY sessionkeyid DESC LIMIT ?", skt.Name()), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*SessionKey{}
+	for rows.Next() {
+		sk := &SessionKey{}
+		if err := rows.Scan(&sk.Sessionkeyid, &sk.CreatedDateTime, &sk.HashKey, &sk.BlockKey); err != nil {
+			return nil, err
+		}
+		keys = append(keys, sk)
+	}
+
+	return keys, rows.Err()
+}
+
+//DeleteOlderThan removes the keys created before the key with id
+func (skt *SessionKeysTable) DeleteOlderThan(db *sql.DB, id int) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE sessionkeyid < ?", skt.Name()), id)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (skt *SessionKeysTable) buildFields() []Field {
+	return buildFieldsFromTable(skt)
+}
+
+func (skt *SessionKeysTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(skt, m)
+}
+
+func (skt *SessionKeysTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(skt, m)
+}
+
+// ******** End Session Keys Table ********
+
+// ******** Start Scheduled Jobs Table ********
+
+//ScheduledJobsTable when each job run on a schedule last ran and is next due, kept so runs missed while the server was down are caught up
+type ScheduledJobsTable struct {
+	Scheduledjobid  int    `tbl:"PKNNAIUI"`
+	Jobname         string `tbl:"NNUI"`
+	Schedule        string `tbl:"NN"`
+	Lastrundatetime int64  `tbl:"NN"`
+	Nextrundatetime int64  `tbl:"NN"`
+	Lastduration    int64  `tbl:"NN"`
+	Lasterror       string `tbl:"NN"`
+	Runs            int    `tbl:"NN"`
+	Failures        int    `tbl:"NN"`
+}
+
+func (sjt *ScheduledJobsTable) Init(db *sql.DB) {}
+
+func (sjt *ScheduledJobsTable) Name() string { return "scheduledjobs" }
+
+func (sjt *ScheduledJobsTable) Insert(db *sql.DB, sj *ScheduledJob) error {
+	insertStatement := sjt.buildPreparedInsertStatement(sj)
+	res, err := db.Exec(insertStatement, sj.Name, sj.Schedule, sj.LastRunDateTime, sj.NextRunDateTime, sj.LastDuration, sj.LastError, sj.Runs, sj.Failures)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	sj.Scheduledjobid = int(id)
+	return nil
+}
+
+//Update saves when the job with sj's name last ran, how it went and when it's next due
+func (sjt *ScheduledJobsTable) Update(db *sql.DB, sj *ScheduledJob) error {
+	updateStatement := fmt.Sprintf("UPDATE %s SET schedule = ?, lastrundatetime = ?, nextrundatetime = ?, lastduration = ?, lasterror = ?, runs = ?, failures = ? WHERE jobname = ?", sjt.Name())
+	_, err := db.Exec(updateStatement, sj.Schedule, sj.LastRunDateTime, sj.NextRunDateTime, sj.LastDuration, sj.LastError, sj.Runs, sj.Failures, sj.Name)
+	return err
+}
+
+func (sjt *ScheduledJobsTable) scan(rows *sql.Rows) ([]*ScheduledJob, error) {
+	defer rows.Close()
+
+	jobs := []*ScheduledJob{}
+	for rows.Next() {
+		sj := &ScheduledJob{}
+		if err := rows.Scan(&sj.Scheduledjobid, &sj.Name, &sj.Schedule, &sj.LastRunDateTime, &sj.NextRunDateTime, &sj.LastDuration, &sj.LastError, &sj.Runs, &sj.Failures); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, sj)
+	}
+
+	return jobs, rows.Err()
+}
+
+func (sjt *ScheduledJobsTable) SelectByName(db *sql.DB, name string) (*ScheduledJob, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE jobname = ?", sjt.Name()), name)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := sjt.scan(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return jobs[0], nil
+}
+
+//SelectAll get every scheduled job, ordered by name
+func (sjt *ScheduledJobsTable) SelectAll(db *sql.DB) ([]*ScheduledJob, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s ORDER BY jobname", sjt.Name()))
+	if err != nil {
+		return nil, err
+	}
+	return sjt.scan(rows)
+}
+
+func (sjt *ScheduledJobsTable) buildFields() []Field {
+	return buildFieldsFromTable(sjt)
+}
+
+func (sjt *ScheduledJobsTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(sjt, m)
+}
+
+func (sjt *ScheduledJobsTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(sjt, m)
+}
+
+// ******** End Scheduled Jobs Table ********
+
+// ******** Start Deferred Jobs Table ********
+
+//DeferredJobsTable jobs to be run once at a later time, along with those which have run or been given up on
+type DeferredJobsTable struct {
+	Deferredjobid    int    `tbl:"PKNNAIUI"`
+	CreatedDateTime  int64  `tbl:"NNDT"`
+	Kind             string `tbl:"NN"`
+	Payload          string `tbl:"NN"`
+	Status           string `tbl:"NN"`
+	Attempts         int    `tbl:"NN"`
+	Rundatetime      int64  `tbl:"NN"`
+	Lasterror        string `tbl:"NN"`
+	Finisheddatetime int64  `tbl:"NN"`
+}
+
+func (djt *DeferredJobsTable) Init(db *sql.DB) {}
+
+func (djt *DeferredJobsTable) Name() string { return "deferredjobs" }
+
+func (djt *DeferredJobsTable) Insert(db *sql.DB, dj *DeferredJob) error {
+	insertStatement := djt.buildPreparedInsertStatement(dj)
+	res, err := db.Exec(insertStatement, dj.CreatedDateTime, dj.Kind, dj.Payload, dj.Status, dj.Attempts, dj.RunDateTime, dj.LastError, dj.FinishedDateTime)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	dj.Deferredjobid = int(id)
+	return nil
+}
+
+//Update saves how running dj went and when it's next due
+func (djt *DeferredJobsTable) Update(db *sql.DB, dj *DeferredJob) error {
+	updateStatement := fmt.Sprintf("UPDATE %s SET status = ?, attempts = ?, rundatetime = ?, lasterror = ?, finisheddatetime = ? WHERE deferredjobid = ?", djt.Name())
+	_, err := db.Exec(updateStatement, dj.Status, dj.Attempts, dj.RunDateTime, dj.LastError, dj.FinishedDateTime, dj.Deferredjobid)
+	return err
+}
+
+func (djt *DeferredJobsTable) scan(rows *sql.Rows) ([]*DeferredJob, error) {
+	defer rows.Close()
+
+	jobs := []*DeferredJob{}
+	for rows.Next() {
+		dj := &DeferredJob{}
+		if err := rows.Scan(&dj.Deferredjobid, &dj.CreatedDateTime, &dj.Kind, &dj.Payload, &dj.Status, &dj.Attempts, &dj.RunDateTime, &dj.LastError, &dj.FinishedDateTime); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, dj)
+	}
+
+	return jobs, rows.Err()
+}
+
+//SelectDue get up to limit jobs with status which are due to run by now, oldest first
+func (djt *DeferredJobsTable) SelectDue(db *sql.DB, status string, now int64, limit int) ([]*DeferredJob, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s WHERE status = ? AND rundatetime <= ? ORDER BY rundatetime, deferredjobid LIMIT ?", djt.Name()), status, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	return djt.scan(rows)
+}
+
+//SelectRecent get up to limit jobs, most recently created first
+func (djt *DeferredJobsTable) SelectRecent(db *sql.DB, limit int) ([]*DeferredJob, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT * FROM %s ORDER BY deferredjobid DESC LIMIT ?", djt.Name()), limit)
+	if err != nil {
+		return nil, err
+	}
+	return djt.scan(rows)
+}
+
+//DeleteFinishedBefore removes jobs with status that finished before before
+func (djt *DeferredJobsTable) DeleteFinishedBefore(db *sql.DB, status string, before int64) (int64, error) {
+	res, err := db.Exec(fmt.Sprintf("DELETE FROM %s WHERE status = ? AND finisheddatetime < ?", djt.Name()), status, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (djt *DeferredJobsTable) buildFields() []Field {
+	return buildFieldsFromTable(djt)
+}
+
+func (djt *DeferredJobsTable) buildInsertStatement(m Model) string {
+	return buildInsertStatementFromTable(djt, m)
+}
+
+func (djt *DeferredJobsTable) buildPreparedInsertStatement(m Model) string {
+	return buildPreparedInsertStatementFromTable(djt, m)
+}
+
+// ******** End Deferred Jobs Table ********
+
+// ****************************************** END TABLES ******************************************
+/////////////////////////////////////////////////////////////////////////////////
+//////////////////////////////////////////////////////////////////////
+////////////////////////////////////////////////////////////
+///////////////////////////////////////////////////////
+//////////////////////////////////////////////
+//////////////////////////////////////////////////////
+///////////////////////////////////////////////////////////
+/////////////////////////////////////////////////////////////////////
+////////////////////////////////////////////////////////////////////////////////
+// ****************************************** MODELS ******************************************
+
+//Model describes the structure of a model
+type Model interface {
+	TableName() string
+	BuildFields() []Field
+}
+
+//User describes the content of a user, it should match the columns present in the users table
+type User struct {
+	UserId          int    `tbl:"AI" json:"userid"`
+	CreatedDateTime int64  `json:"createddatetime"`
+	UserroleId      int    `json:"userroleid"`
+	UUID            string `json:"UUID"`
+	Username        string `json:"username"`
+	AuthHash        string `json:"authhash"`
+	FirstName       string `json:"firstname"`
+	LastName        string `json:"lastname"`
+	Email           string `json:"email"`
+}
+
+//Login takes the current username and authhash values of self and tries
+//using them to authenticate/login. A successful login will return/generate
+//a JWT token for further use in any subsequent API request
+func (u *User) Login() bool {
+	ut := &UsersTable{}
+	user, err := ut.SelectByUsername(Conn, u.Username)
+
+	if err != nil {
+		logging.Error(err.Error())
+		return false
+	}
+	err = bcrypt.CompareHashAndPassword([]byte(user.AuthHash), []byte(u.AuthHash))
+	if err == nil {
+		return true
+	}
+	return false
+}
+
+//TableName gets the name of the users table
+func (u *User) TableName() string {
+	return "users"
+}
+
+//BuildFields generates a list of fields generated from the fields of the user struct
+func (u *User) BuildFields() []Field {
+	return buildFieldsFromModel(u)
+}
+
+//Validate makes sure that required fields have not been left blank
+func (u *User) Validate() error {
+	if u.Username == "" {
+		return fmt.Errorf("Missing username")
+	}
+	if u.AuthHash == "" {
+		return fmt.Errorf("Missing password")
+	}
+	return nil
+}
+
+type Group struct {
+	Groupid         int    `tbl:"AI" json:"groupid"`
 	CreatedDateTime int64  `json:"createddatetime"`
 	UUID            string `json:"UUID"`
-	Roleprotected   bool   `json:"roleprotected"`
-	AuthorUUID      string `json:"authoruuid"`
 	Title           string `json:"title"`
-	Route           string `json:"route"`
-	Content         string `json:"content"`
+}
+
+func (g *Group) TableName() string {
+	return "groups"
+}
+
+func (g *Group) BuildFields() []Field {
+	return buildFieldsFromModel(g)
+}
+
+func (g *Group) Validate() bool {
+	return len(g.UUID) > 0
+}
+
+type GroupMembership struct {
+	Groupmembershipid int    `tbl:"AI" json:"groupmembershipid"`
+	CreatedDateTime   int64  `json:"createddatetime"`
+	GroupUUID         string `json:"GroupUUID"`
+	UserUUID          string `json:"UserUUID"`
+}
+
+func (gm *GroupMembership) TableName() string {
+	return "groupmemberships"
+}
+
+func (gm *GroupMembership) BuildFields() []Field {
+	return buildFieldsFromModel(gm)
+}
+
+//UserRole describes the content of a userrole entry, it should match the columns present in the userrole table
+type UserRole struct {
+	Userroleid int `tbl:"AI"`
+	Rolename   string
+}
+
+//TableName gets the name of the userrole table
+func (ur *UserRole) TableName() string {
+	return "userroles"
+}
+
+//BuildFields generates a list of fields generated from the fields of the userrole struct
+func (ur *UserRole) BuildFields() []Field {
+	return buildFieldsFromModel(ur)
+}
+
+type Page struct {
+	PageId            int    `tbl:"AI" json:"pageid"`
+	CreatedDateTime   int64  `json:"createddatetime"`
+	UUID              string `json:"UUID"`
+	Roleprotected     bool   `json:"roleprotected"`
+	AuthorUUID        string `json:"authoruuid"`
+	Title             string `json:"title"`
+	Route             string `json:"route"`
+	Content           string `json:"content"`
+	ModifiedDateTime  int64  `json:"modifieddatetime"`
+	CachePolicy       string `json:"cachepolicy"`
+	Layout            string `json:"layout"`
+	ContentFormat     string `json:"contentformat"`
+	TrustedHTML       bool   `json:"trustedhtml"`
+	Tags              string `json:"tags"`
+	SitemapChangeFreq string `json:"sitemapchangefreq"`
+	SitemapPriority   string `json:"sitemappriority"`
+	MetaTitle         string `json:"metatitle"`
+	MetaDescription   string `json:"metadescription"`
+	CanonicalURL      string `json:"canonicalurl"`
+	NoIndex           bool   `json:"noindex"`
+	NoFollow          bool   `json:"nofollow"`
+	OGTitle           string `json:"ogtitle"`
+	OGDescription     string `json:"ogdescription"`
+	OGImage           string `json:"ogimage"`
+	TwitterCard       string `json:"twittercard"`
+	JSONLD            string `json:"jsonld"`
 }
 
 func (p *Page) TableName() string {
@@ -1032,12 +2582,26 @@ func (p *Page) BuildFields() []Field {
 	return buildFieldsFromModel(p)
 }
 
+//TagList get the page's comma separated tags as a list
+func (p *Page) TagList() []string {
+	tags := []string{}
+	for _, tag := range strings.Split(p.Tags, ",") {
+		if tag = strings.TrimSpace(tag); len(tag) > 0 {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
 type AuthSession struct {
 	Authsessionid      int    `tbl:"AI" json:"authsessionid"`
 	CreatedDateTime    int64  `json:"createddatetime"`
 	LastActiveDateTime int64  `json:"lastactivedatetime"`
 	UserUUID           string `json:"userUUID"`
 	SessionUUID        string `json:"sessionUUID"`
+	IPAddress          string `json:"ipaddress"`
+	UserAgent          string `json:"useragent"`
+	RememberMe         bool   `json:"rememberme"`
 }
 
 func (as *AuthSession) TableName() string {
@@ -1064,6 +2628,320 @@ func (si *SystemInfo) BuildFields() []Field {
 	return buildFieldsFromModel(si)
 }
 
+type Setting struct {
+	Settingid   int    `tbl:"AI" json:"settingid"`
+	SettingName string `json:"settingname"`
+	Value       string `json:"value"`
+}
+
+func (s *Setting) TableName() string {
+	return "settings"
+}
+
+func (s *Setting) BuildFields() []Field {
+	return buildFieldsFromModel(s)
+}
+
+//Feed describes a page collection syndicated as RSS/Atom, it should match the columns present in the feeds table
+type Feed struct {
+	Feedid          int    `tbl:"AI" json:"feedid"`
+	CreatedDateTime int64  `json:"createddatetime"`
+	Slug            string `json:"slug"`
+	Title           string `json:"title"`
+	RoutePrefix     string `json:"routeprefix"`
+	Tag             string `json:"tag"`
+	ItemCount       int    `json:"itemcount"`
+}
+
+func (f *Feed) TableName() string {
+	return "feeds"
+}
+
+func (f *Feed) BuildFields() []Field {
+	return buildFieldsFromModel(f)
+}
+
+//RobotsGroup describes a user-agent group of robots.txt rules, it should match the columns present in the robotsgroups table
+type RobotsGroup struct {
+	Robotsgroupid   int    `tbl:"AI" json:"robotsgroupid"`
+	CreatedDateTime int64  `json:"createddatetime"`
+	UserAgents      string `json:"useragents"`
+	Rules           string `json:"rules"`
+	PluginManaged   bool   `json:"pluginmanaged"`
+}
+
+func (g *RobotsGroup) TableName() string {
+	return "robotsgroups"
+}
+
+func (g *RobotsGroup) BuildFields() []Field {
+	return buildFieldsFromModel(g)
+}
+
+//APIToken describes the content of a personal API token, it should match the columns present in the apitokens table
+type APIToken struct {
+	Apitokenid       int    `tbl:"AI" json:"apitokenid"`
+	CreatedDateTime  int64  `json:"createddatetime"`
+	UUID             string `json:"UUID"`
+	UserUUID         string `json:"useruuid"`
+	Name             string `json:"name"`
+	SecretHash       string `json:"-"`
+	Scopes           string `json:"scopes"`
+	ExpiresDateTime  int64  `json:"expiresdatetime"`
+	LastUsedDateTime int64  `json:"lastuseddatetime"`
+}
+
+func (t *APIToken) TableName() string {
+	return "apitokens"
+}
+
+func (t *APIToken) BuildFields() []Field {
+	return buildFieldsFromModel(t)
+}
+
+//ScopeList get the token's comma separated scopes as a list
+func (t *APIToken) ScopeList() []string {
+	scopes := []string{}
+	for _, scope := range strings.Split(t.Scopes, ",") {
+		if scope = strings.TrimSpace(scope); len(scope) > 0 {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+//HasScope checks the token was granted scope
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+//Expired checks whether the token has expired at now, tokens without an expiry never do
+func (t *APIToken) Expired(now int64) bool {
+	return t.ExpiresDateTime > 0 && now >= t.ExpiresDateTime
+}
+
+//OIDCProvider describes an OpenID Connect identity provider, it should match the columns present in the oidcproviders table
+type OIDCProvider struct {
+	Oidcproviderid  int    `tbl:"AI" json:"oidcproviderid"`
+	CreatedDateTime int64  `json:"createddatetime"`
+	Slug            string `json:"slug"`
+	Title           string `json:"title"`
+	Issuer          string `json:"issuer"`
+	ClientID        string `json:"clientid"`
+	ClientSecret    string `json:"-"`
+	Scopes          string `json:"scopes"`
+	GroupsClaim     string `json:"groupsclaim"`
+	GroupMappings   string `json:"groupmappings"`
+	RoleMappings    string `json:"rolemappings"`
+	DefaultRole     int    `json:"defaultrole"`
+	Enabled         bool   `json:"enabled"`
+}
+
+func (p *OIDCProvider) TableName() string {
+	return "oidcproviders"
+}
+
+func (p *OIDCProvider) BuildFields() []Field {
+	return buildFieldsFromModel(p)
+}
+
+//ScopeList get the provider's space or comma separated scopes as a list
+func (p *OIDCProvider) ScopeList() []string {
+	return strings.Fields(strings.Replace(p.Scopes, ",", " ", -1))
+}
+
+//OIDCIdentity describes a user at an identity provider, it should match the columns present in the oidcidentities table
+type OIDCIdentity struct {
+	Oidcidentityid  int    `tbl:"AI" json:"oidcidentityid"`
+	CreatedDateTime int64  `json:"createddatetime"`
+	ProviderSlug    string `json:"providerslug"`
+	Subject         string `json:"subject"`
+	UserUUID        string `json:"useruuid"`
+}
+
+func (i *OIDCIdentity) TableName() string {
+	return "oidcidentities"
+}
+
+func (i *OIDCIdentity) BuildFields() []Field {
+	return buildFieldsFromModel(i)
+}
+
+//TwoFactor describes a user's TOTP secret, it should match the columns present in the twofactors table
+type TwoFactor struct {
+	Twofactorid     int    `tbl:"AI" json:"twofactorid"`
+	CreatedDateTime int64  `json:"createddatetime"`
+	UserUUID        string `json:"useruuid"`
+	Secret          string `json:"-"`
+	Enabled         bool   `json:"enabled"`
+	LastStep        int64  `json:"laststep"`
+}
+
+func (tf *TwoFactor) TableName() string {
+	return "twofactors"
+}
+
+func (tf *TwoFactor) BuildFields() []Field {
+	return buildFieldsFromModel(tf)
+}
+
+//TwoFactorChallenge describes a pending two-factor challenge, it should match the columns present in the twofactorchallenges table
+type TwoFactorChallenge struct {
+	Twofactorchallengeid int    `tbl:"AI" json:"twofactorchallengeid"`
+	CreatedDateTime      int64  `json:"createddatetime"`
+	ChallengeID          string `json:"-"`
+	UserUUID             string `json:"useruuid"`
+	RememberMe           bool   `json:"rememberme"`
+	Attempts             int    `json:"attempts"`
+}
+
+func (tfc *TwoFactorChallenge) TableName() string {
+	return "twofactorchallenges"
+}
+
+func (tfc *TwoFactorChallenge) BuildFields() []Field {
+	return buildFieldsFromModel(tfc)
+}
+
+//RecoveryCode describes a hashed one-time recovery code, it should match the columns present in the recoverycodes table
+type RecoveryCode struct {
+	Recoverycodeid  int    `tbl:"AI" json:"recoverycodeid"`
+	CreatedDateTime int64  `json:"createddatetime"`
+	UserUUID        string `json:"useruuid"`
+	CodeHash        string `json:"-"`
+}
+
+func (rc *RecoveryCode) TableName() string {
+	return "recoverycodes"
+}
+
+func (rc *RecoveryCode) BuildFields() []Field {
+	return buildFieldsFromModel(rc)
+}
+
+//PasswordReset describes a password reset link, it should match the columns present in the passwordresets table
+type PasswordReset struct {
+	Passwordresetid int    `tbl:"AI" json:"passwordresetid"`
+	CreatedDateTime int64  `json:"createddatetime"`
+	ExpiresDateTime int64  `json:"expiresdatetime"`
+	UserUUID        string `json:"useruuid"`
+	TokenHash       string `json:"-"`
+}
+
+func (pr *PasswordReset) TableName() string {
+	return "passwordresets"
+}
+
+func (pr *PasswordReset) BuildFields() []Field {
+	return buildFieldsFromModel(pr)
+}
+
+//OutboxMessage describes a queued email, it should match the columns present in the outbox table
+type OutboxMessage struct {
+	Outboxid            int    `tbl:"AI" json:"outboxid"`
+	CreatedDateTime     int64  `json:"createddatetime"`
+	Sender              string `json:"sender"`
+	Recipients          string `json:"recipients"`
+	Subject             string `json:"subject"`
+	Body                string `json:"body"`
+	Status              string `json:"status"`
+	Attempts            int    `json:"attempts"`
+	NextAttemptDateTime int64  `json:"nextattemptdatetime"`
+	LastError           string `json:"lasterror"`
+	SentDateTime        int64  `json:"sentdatetime"`
+	Sensitive           bool   `json:"sensitive"`
+}
+
+func (om *OutboxMessage) TableName() string {
+	return "outbox"
+}
+
+func (om *OutboxMessage) BuildFields() []Field {
+	return buildFieldsFromModel(om)
+}
+
+//LoginAttempt describes recent failed logins against a key, it should match the columns present in the loginattempts table
+type LoginAttempt struct {
+	Loginattemptid      int    `tbl:"AI" json:"loginattemptid"`
+	AttemptKey          string `json:"attemptkey"`
+	Failures            int    `json:"failures"`
+	LastFailureDateTime int64  `json:"lastfailuredatetime"`
+	LockedUntilDateTime int64  `json:"lockeduntildatetime"`
+}
+
+func (la *LoginAttempt) TableName() string {
+	return "loginattempts"
+}
+
+func (la *LoginAttempt) BuildFields() []Field {
+	return buildFieldsFromModel(la)
+}
+
+//SessionKey describes a cookie signing and encryption key pair, it should match the columns present in the sessionkeys table
+type SessionKey struct {
+	Sessionkeyid    int    `tbl:"AI" json:"sessionkeyid"`
+	CreatedDateTime int64  `json:"createddatetime"`
+	HashKey         string `json:"-"`
+	BlockKey        string `json:"-"`
+}
+
+func (sk *SessionKey) TableName() string {
+	return "sessionkeys"
+}
+
+func (sk *SessionKey) BuildFields() []Field {
+	return buildFieldsFromModel(sk)
+}
+
+//ScheduledJob describes when a job run on a schedule last ran and is next due, it should match the columns present in the scheduledjobs table
+type ScheduledJob struct {
+	Scheduledjobid  int    `tbl:"AI" json:"scheduledjobid"`
+	Name            string `json:"name"`
+	Schedule        string `json:"schedule"`
+	LastRunDateTime int64  `json:"lastrundatetime"`
+	NextRunDateTime int64  `json:"nextrundatetime"`
+	//LastDuration how many milliseconds the last run took
+	LastDuration int64  `json:"lastduration"`
+	LastError    string `json:"lasterror"`
+	Runs         int    `json:"runs"`
+	//Failures how many runs in a row have failed
+	Failures int `json:"failures"`
+}
+
+func (sj *ScheduledJob) TableName() string {
+	return "scheduledjobs"
+}
+
+func (sj *ScheduledJob) BuildFields() []Field {
+	return buildFieldsFromModel(sj)
+}
+
+//DeferredJob describes a job to be run once at a later time, it should match the columns present in the deferredjobs table
+type DeferredJob struct {
+	Deferredjobid    int    `tbl:"AI" json:"deferredjobid"`
+	CreatedDateTime  int64  `json:"createddatetime"`
+	Kind             string `json:"kind"`
+	Payload          string `json:"payload"`
+	Status           string `json:"status"`
+	Attempts         int    `json:"attempts"`
+	RunDateTime      int64  `json:"rundatetime"`
+	LastError        string `json:"lasterror"`
+	FinishedDateTime int64  `json:"finisheddatetime"`
+}
+
+func (dj *DeferredJob) TableName() string {
+	return "deferredjobs"
+}
+
+func (dj *DeferredJob) BuildFields() []Field {
+	return buildFieldsFromModel(dj)
+}
+
 // ****************************************** END MODELS ******************************************
 
 func buildInsertStatementFromTable(t Table, m Model) string {
@@ -0,0 +1,243 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feeds
+
+import (
+	"encoding/xml"
+	"sync"
+	"time"
+)
+
+const (
+	//RSS RSS 2.0 feed format
+	RSS = "rss"
+	//Atom Atom 1.0 feed format
+	Atom = "atom"
+)
+
+//Feed a page collection ready to be written out as RSS or Atom
+type Feed struct {
+	Title       string
+	Link        string
+	FeedURL     string
+	Description string
+	Updated     time.Time
+	Items       []Item
+}
+
+//Item a single page in a feed
+type Item struct {
+	Title     string
+	Link      string
+	Summary   string
+	Author    string
+	Published time.Time
+	Updated   time.Time
+}
+
+var (
+	mu    sync.Mutex
+	cache = map[string]*Feed{}
+)
+
+//Cached get cached feed stored under key
+func Cached(key string) (*Feed, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	feed, ok := cache[key]
+	return feed, ok
+}
+
+//Store caches feed under key until the next reset, its links should be relative to the site so they
+//can be made absolute for whichever base URL it's served under
+func Store(key string, feed *Feed) {
+	mu.Lock()
+	defer mu.Unlock()
+	cache[key] = feed
+}
+
+//Reset clears all cached feeds so they're generated again on their next request
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	cache = map[string]*Feed{}
+}
+
+//Absolute copy of feed with its site relative links, eg., '/blog/post', made absolute under baseURL, eg., 'https://example.com'
+func (f *Feed) Absolute(baseURL string) *Feed {
+	absolute := *f
+	absolute.Link = baseURL + f.Link
+	absolute.FeedURL = baseURL + f.FeedURL
+	absolute.Items = make([]Item, len(f.Items))
+	for i, item := range f.Items {
+		item.Link = baseURL + item.Link
+		absolute.Items[i] = item
+	}
+	return &absolute
+}
+
+//Generate writes feed out in named format
+func Generate(feed *Feed, format string) ([]byte, error) {
+	if format == Atom {
+		return generateAtom(feed)
+	}
+	return generateRSS(feed)
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	DCNS    string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	SelfLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	GUID        rssGUID `xml:"guid"`
+	Description string  `xml:"description,omitempty"`
+	Author      string  `xml:"dc:creator,omitempty"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+func generateRSS(feed *Feed) ([]byte, error) {
+	doc := rssDocument{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		DCNS:    "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:       feed.Title,
+			Link:        feed.Link,
+			Description: feed.Description,
+			SelfLink:    atomLink{Href: feed.FeedURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+
+	if !feed.Updated.IsZero() {
+		doc.Channel.LastBuildDate = feed.Updated.UTC().Format(time.RFC1123Z)
+	}
+
+	for _, item := range feed.Items {
+		rss := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			GUID:        rssGUID{IsPermaLink: true, Value: item.Link},
+			Description: item.Summary,
+			Author:      item.Author,
+		}
+		if !item.Published.IsZero() {
+			rss.PubDate = item.Published.UTC().Format(time.RFC1123Z)
+		}
+		doc.Channel.Items = append(doc.Channel.Items, rss)
+	}
+
+	return marshal(doc)
+}
+
+type atomDocument struct {
+	XMLName  xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title    string      `xml:"title"`
+	ID       string      `xml:"id"`
+	Updated  string      `xml:"updated"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Author   *atomAuthor `xml:"author,omitempty"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      atomLink    `xml:"link"`
+	Published string      `xml:"published,omitempty"`
+	Updated   string      `xml:"updated"`
+	Author    *atomAuthor `xml:"author,omitempty"`
+	Summary   string      `xml:"summary,omitempty"`
+}
+
+func generateAtom(feed *Feed) ([]byte, error) {
+	doc := atomDocument{
+		Title:    feed.Title,
+		ID:       feed.FeedURL,
+		Updated:  atomTime(feed.Updated),
+		Subtitle: feed.Description,
+		//atom requires an author for the feed if any entry doesn't have one
+		Author: &atomAuthor{Name: feed.Title},
+		Links: []atomLink{
+			{Href: feed.FeedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: feed.Link, Rel: "alternate", Type: "text/html"},
+		},
+	}
+
+	for _, item := range feed.Items {
+		entry := atomEntry{
+			Title:   item.Title,
+			ID:      item.Link,
+			Link:    atomLink{Href: item.Link, Rel: "alternate", Type: "text/html"},
+			Updated: atomTime(item.Updated),
+			Summary: item.Summary,
+		}
+		if !item.Published.IsZero() {
+			entry.Published = atomTime(item.Published)
+		}
+		if len(item.Author) > 0 {
+			entry.Author = &atomAuthor{Name: item.Author}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	return marshal(doc)
+}
+
+func atomTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+//marshal writes out document with the XML declaration
+func marshal(doc interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
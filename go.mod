@@ -3,7 +3,9 @@ module github.com/tacusci/berrycms
 go 1.17
 
 require (
+	github.com/JohannesKaufmann/html-to-markdown v1.3.6
 	github.com/PuerkitoBio/goquery v1.8.0
+	github.com/andybalholm/brotli v1.0.4
 	github.com/cornelk/hashmap v1.0.1
 	github.com/dchenk/go-render-quill v0.0.0-20211110010230-f51106477162
 	github.com/go-sql-driver/mysql v1.6.0
@@ -12,11 +14,14 @@ require (
 	github.com/gorilla/mux v1.8.0
 	github.com/gorilla/sessions v1.2.1
 	github.com/mattn/go-sqlite3 v1.14.9
+	github.com/microcosm-cc/bluemonday v1.0.16
 	github.com/radovskyb/watcher v1.0.7
 	github.com/robertkrimen/otto v0.0.0-20211024170158-b87d35c0b86f
 	github.com/schollz/progressbar v1.0.0
 	github.com/tacusci/logging v1.0.0
+	github.com/yuin/goldmark v1.4.14
 	golang.org/x/crypto v0.0.0-20211115234514-b4de73f9ece8
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -35,14 +40,13 @@ require (
 	github.com/gorilla/securecookie v1.1.1 // indirect
 	github.com/mattn/go-colorable v0.1.9 // indirect
 	github.com/mattn/go-isatty v0.0.14 // indirect
-	github.com/microcosm-cc/bluemonday v1.0.16 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/sergi/go-diff v1.2.0 // indirect
 	github.com/sourcegraph/annotate v0.0.0-20160123013949-f4cad6c6324d // indirect
 	github.com/sourcegraph/syntaxhighlight v0.0.0-20170531221838-bd320f5d308e // indirect
-	golang.org/x/net v0.0.0-20211015210444-4f30a5c0130f // indirect
+	golang.org/x/net v0.0.0-20220909164309-bea034e7d591 // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
-	golang.org/x/sys v0.0.0-20210630005230-0f9fa26af87c // indirect
-	golang.org/x/text v0.3.6 // indirect
+	golang.org/x/sys v0.0.0-20220728004956-3c1f35247d10 // indirect
+	golang.org/x/text v0.3.7 // indirect
 	gopkg.in/sourcemap.v1 v1.0.5 // indirect
 )
@@ -0,0 +1,250 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net"
+	netmail "net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tacusci/logging"
+)
+
+//Message a plain text email
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+	//Sensitive the body holds a secret, such as a password reset link, so it's never logged or kept once sent
+	Sensitive bool
+}
+
+//Mailer delivers messages
+type Mailer interface {
+	Send(m *Message) error
+}
+
+//headerValue strips line breaks so values can't add their own headers
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
+//Validate checks m has a sender and recipients, and all of its recipients' addresses are valid
+func (m *Message) Validate() error {
+	if len(strings.TrimSpace(m.From)) == 0 {
+		return errors.New("Message has no sender")
+	}
+	if len(m.To) == 0 {
+		return errors.New("Message has no recipients")
+	}
+	for _, to := range m.To {
+		if _, err := envelopeAddress(to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Bytes renders m as an RFC 5322 message
+func (m *Message) Bytes() []byte {
+	to := make([]string, len(m.To))
+	for i, recipient := range m.To {
+		to[i] = headerValue(recipient)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", headerValue(m.From))
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", headerValue(m.Subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes()
+}
+
+//SMTPMailer delivers messages through an SMTP server, upgrading the connection with STARTTLS
+//if the server supports it, and authenticating if there's a username
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	//ImplicitTLS connects with TLS from the start, as on port 465, rather than upgrading with STARTTLS
+	ImplicitTLS bool
+	//RequireTLS refuses to send if the server doesn't support STARTTLS
+	RequireTLS bool
+	//TLSConfig used to connect with TLS, verifies the server is Host if nil
+	TLSConfig *tls.Config
+	//Timeout for the whole delivery, defaults to DefaultSMTPTimeout
+	Timeout time.Duration
+}
+
+//DefaultSMTPTimeout how long delivering a message through an SMTP server can take
+const DefaultSMTPTimeout = 30 * time.Second
+
+func (s *SMTPMailer) tlsConfig() *tls.Config {
+	if s.TLSConfig != nil {
+		return s.TLSConfig
+	}
+	return &tls.Config{ServerName: s.Host}
+}
+
+//Send delivers m through the server
+func (s *SMTPMailer) Send(m *Message) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	from, err := envelopeAddress(m.From)
+	if err != nil {
+		return err
+	}
+	recipients := make([]string, len(m.To))
+	for i, to := range m.To {
+		if recipients[i], err = envelopeAddress(to); err != nil {
+			return err
+		}
+	}
+
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultSMTPTimeout
+	}
+
+	addr := net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	if s.ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, s.tlsConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if !s.ImplicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(s.tlsConfig()); err != nil {
+				return err
+			}
+		} else if s.RequireTLS {
+			return fmt.Errorf("SMTP server %s doesn't support STARTTLS", addr)
+		}
+	}
+
+	if len(s.Username) > 0 {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return fmt.Errorf("SMTP server %s doesn't support authentication", addr)
+		}
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, to := range recipients {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.Bytes()); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return c.Quit()
+}
+
+//envelopeAddress gets the bare address of address, which may have a display name, eg., "Berry CMS <berrycms@example.com>"
+func envelopeAddress(address string) (string, error) {
+	parsed, err := netmail.ParseAddress(address)
+	if err != nil {
+		return "", fmt.Errorf("Invalid address '%s' -> %s", address, err.Error())
+	}
+	return parsed.Address, nil
+}
+
+//LogMailer doesn't deliver messages, for development it writes them to files in Dir, or logs who
+//they're to and their subject if there's no Dir, sensitive messages are never written anywhere
+type LogMailer struct {
+	Dir string
+}
+
+//Send writes m to a new .eml file in Dir, or logs it without its body
+func (l *LogMailer) Send(m *Message) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	if m.Sensitive {
+		logging.Warn(fmt.Sprintf("Not writing sensitive mail to %s -> %s, an SMTP server is needed to deliver it", strings.Join(m.To, ", "), m.Subject))
+		return nil
+	}
+
+	if len(l.Dir) == 0 {
+		logging.Info(fmt.Sprintf("Mail to %s -> %s", strings.Join(m.To, ", "), m.Subject))
+		return nil
+	}
+
+	if err := os.MkdirAll(l.Dir, 0700); err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(l.Dir, fmt.Sprintf("%d-*.eml", time.Now().Unix()))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, err := f.Write(m.Bytes()); err != nil {
+		return err
+	}
+
+	logging.Info(fmt.Sprintf("Wrote mail to %s -> %s", strings.Join(m.To, ", "), filepath.Join(l.Dir, filepath.Base(f.Name()))))
+	return nil
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//DefaultFrom address mail is sent from if one isn't set
+	DefaultFrom = "berrycms@localhost"
+
+	//StatusQueued message is waiting to be delivered
+	StatusQueued = "queued"
+	//StatusSent message has been delivered
+	StatusSent = "sent"
+	//StatusFailed delivering message was given up on after MaxAttempts
+	StatusFailed = "failed"
+
+	//MaxAttempts times delivering a message is tried before it's given up on
+	MaxAttempts = 8
+
+	//retryDelay how long after the first failed attempt a message is tried again, doubling after each attempt
+	retryDelay = time.Minute
+	//maxRetryDelay longest to wait between attempts
+	maxRetryDelay = 6 * time.Hour
+	//deliverBatchSize most messages tried each time the outbox is checked
+	deliverBatchSize = 50
+	//sentRetention how long sent messages are kept in the outbox
+	sentRetention = 30 * 24 * time.Hour
+)
+
+var (
+	mu sync.RWMutex
+	//mailer delivers queued messages, defaults to logging them
+	mailer Mailer = &LogMailer{}
+	from          = DefaultFrom
+)
+
+//SetMailer sets what delivers queued messages, and the address they're sent from
+func SetMailer(m Mailer, sender string) error {
+	if m == nil {
+		return errors.New("Mailer can't be nil")
+	}
+	sender = strings.TrimSpace(sender)
+	if len(sender) == 0 {
+		sender = DefaultFrom
+	}
+	if _, err := envelopeAddress(sender); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	mailer = m
+	from = sender
+	return nil
+}
+
+func configured() (Mailer, string) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return mailer, from
+}
+
+//Queue adds a message to the outbox to be delivered to the to addresses in the background
+func Queue(to []string, subject string, body string) error {
+	return QueueMessage(&Message{To: to, Subject: subject, Body: body})
+}
+
+//QueueMessage adds m to the outbox to be delivered in the background, it's sent from the configured address
+func QueueMessage(m *Message) error {
+	_, sender := configured()
+
+	m.From = sender
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	ot := db.OutboxTable{}
+	return ot.Insert(db.Conn, &db.OutboxMessage{
+		CreatedDateTime:     now,
+		Sender:              m.From,
+		Recipients:          strings.Join(m.To, "\n"),
+		Subject:             headerValue(m.Subject),
+		Body:                m.Body,
+		Status:              StatusQueued,
+		NextAttemptDateTime: now,
+		Sensitive:           m.Sensitive,
+	})
+}
+
+//QueueTemplate fills in t with data and adds the message to the outbox
+func QueueTemplate(to []string, t *Template, data interface{}) error {
+	subject, body, err := t.Render(data)
+	if err != nil {
+		return err
+	}
+	return Queue(to, subject, body)
+}
+
+//Backoff how long to wait before trying a message again which has failed attempts times
+func Backoff(attempts int) time.Duration {
+	return util.Backoff(attempts, retryDelay, maxRetryDelay)
+}
+
+//DeliverQueued tries to deliver the messages due to be tried by now, returning how many were sent
+func DeliverQueued(now time.Time) (int, error) {
+	m, _ := configured()
+	ot := db.OutboxTable{}
+
+	due, err := ot.SelectDue(db.Conn, StatusQueued, now.Unix(), deliverBatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, om := range due {
+		err := m.Send(&Message{From: om.Sender, To: strings.Split(om.Recipients, "\n"), Subject: om.Subject, Body: om.Body, Sensitive: om.Sensitive})
+		om.Attempts++
+
+		switch {
+		case err == nil:
+			om.Status = StatusSent
+			om.SentDateTime = now.Unix()
+			om.LastError = ""
+			sent++
+		case om.Attempts >= MaxAttempts:
+			om.Status = StatusFailed
+			om.LastError = err.Error()
+			logging.Error(fmt.Sprintf("Giving up delivering mail %d to %s after %d attempts -> %s", om.Outboxid, om.Recipients, om.Attempts, err.Error()))
+		default:
+			om.NextAttemptDateTime = now.Add(Backoff(om.Attempts)).Unix()
+			om.LastError = err.Error()
+			logging.Debug(fmt.Sprintf("Unable to deliver mail %d, will try again -> %s", om.Outboxid, err.Error()))
+		}
+
+		//the secret in a sensitive message isn't kept once there's no more use for it
+		if om.Sensitive && om.Status != StatusQueued {
+			om.Body = ""
+		}
+
+		if err := ot.Update(db.Conn, om); err != nil {
+			return sent, err
+		}
+	}
+
+	if _, err := ot.DeleteSentBefore(db.Conn, StatusSent, now.Add(-sentRetention).Unix()); err != nil {
+		return sent, err
+	}
+
+	return sent, nil
+}
+
+//SendQueued delivers the messages due to be tried by now, it's run as a scheduled job to work through the outbox
+func SendQueued(now time.Time) error {
+	_, err := DeliverQueued(now)
+	return err
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//Package smtptest provides a local SMTP sink which keeps the messages delivered to it, for testing mail delivery against
+package smtptest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+//Message a message delivered to the sink
+type Message struct {
+	From string
+	To   []string
+	Data string
+}
+
+//Server a local SMTP sink, it doesn't support STARTTLS
+type Server struct {
+	Host     string
+	Port     int
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	messages []Message
+	username string
+	password string
+	failures int
+}
+
+//NewServer starts a sink listening on a random local port
+func NewServer() *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &Server{Host: addr.IP.String(), Port: addr.Port, listener: listener}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+//RequireAuth has the sink only accept messages from clients who authenticate as username with password
+func (s *Server) RequireAuth(username string, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.username = username
+	s.password = password
+}
+
+//FailNext has the sink temporarily reject the next n messages sent to it
+func (s *Server) FailNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = n
+}
+
+//Messages get the messages delivered to the sink so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message{}, s.messages...)
+}
+
+//Close stops the sink
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(textproto.NewConn(conn))
+		}()
+	}
+}
+
+//address gets the address between the angle brackets of a MAIL FROM or RCPT TO argument
+func address(arg string) string {
+	start, end := strings.Index(arg, "<"), strings.Index(arg, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
+
+func (s *Server) handle(conn *textproto.Conn) {
+	s.mu.Lock()
+	username, password := s.username, s.password
+	s.mu.Unlock()
+
+	authenticated := len(username) == 0
+	current := Message{}
+
+	conn.PrintfLine("220 smtptest ESMTP")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg := line, ""
+		if i := strings.Index(line, " "); i > 0 {
+			verb, arg = line[:i], line[i+1:]
+		}
+
+		switch strings.ToUpper(verb) {
+		case "EHLO", "HELO":
+			conn.PrintfLine("250-smtptest")
+			conn.PrintfLine("250-8BITMIME")
+			conn.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			fields := strings.Fields(arg)
+			if len(fields) != 2 || strings.ToUpper(fields[0]) != "PLAIN" {
+				conn.PrintfLine("504 5.5.4 Unrecognised authentication type")
+				continue
+			}
+			credentials, err := base64.StdEncoding.DecodeString(fields[1])
+			parts := bytes.Split(credentials, []byte{0})
+			if err != nil || len(parts) != 3 || string(parts[1]) != username || string(parts[2]) != password {
+				conn.PrintfLine("535 5.7.8 Authentication failed")
+				continue
+			}
+			authenticated = true
+			conn.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			if !authenticated {
+				conn.PrintfLine("530 5.7.0 Authentication required")
+				continue
+			}
+			s.mu.Lock()
+			fail := s.failures > 0
+			if fail {
+				s.failures--
+			}
+			s.mu.Unlock()
+			if fail {
+				conn.PrintfLine("451 4.3.0 Try again later")
+				continue
+			}
+			current = Message{From: address(arg)}
+			conn.PrintfLine("250 2.1.0 OK")
+		case "RCPT":
+			current.To = append(current.To, address(arg))
+			conn.PrintfLine("250 2.1.5 OK")
+		case "DATA":
+			conn.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			lines, err := conn.ReadDotLines()
+			if err != nil {
+				return
+			}
+			current.Data = strings.Join(lines, "\n")
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			current = Message{}
+			conn.PrintfLine("250 2.0.0 OK")
+		case "RSET":
+			current = Message{}
+			conn.PrintfLine("250 2.0.0 OK")
+		case "NOOP":
+			conn.PrintfLine("250 2.0.0 OK")
+		case "QUIT":
+			conn.PrintfLine("221 2.0.0 Bye")
+			return
+		default:
+			conn.PrintfLine("502 5.5.2 Command not implemented")
+		}
+	}
+}
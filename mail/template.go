@@ -0,0 +1,67 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+//Template a message's subject and body to fill in, written as a "Subject: " line followed by
+//a blank line and the body, each using Go's text/template syntax, eg.,
+//
+//	Subject: Welcome {{.Username}}
+//
+//	Hi {{.Username}}, thanks for signing up.
+type Template struct {
+	subject *template.Template
+	body    *template.Template
+}
+
+//ParseTemplate parses text as a template called name
+func ParseTemplate(name string, text string) (*Template, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	parts := strings.SplitN(text, "\n\n", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], "Subject:") || strings.Contains(parts[0], "\n") {
+		return nil, fmt.Errorf("Mail template %s must start with a single 'Subject: ' line followed by a blank line", name)
+	}
+
+	subject, err := template.New(name + " subject").Parse(strings.TrimSpace(strings.TrimPrefix(parts[0], "Subject:")))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := template.New(name).Parse(parts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return &Template{subject: subject, body: body}, nil
+}
+
+//Render fills in the template with data, returning the subject and body
+func (t *Template) Render(data interface{}) (string, string, error) {
+	var subject, body bytes.Buffer
+	if err := t.subject.Execute(&subject, data); err != nil {
+		return "", "", err
+	}
+	if err := t.body.Execute(&body, data); err != nil {
+		return "", "", err
+	}
+	return headerValue(subject.String()), body.String(), nil
+}
@@ -28,12 +28,17 @@ import (
 
 	"golang.org/x/crypto/acme/autocert"
 
+	"github.com/tacusci/berrycms/accesslog"
 	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/mail"
+	"github.com/tacusci/berrycms/scheduler"
 	"github.com/tacusci/berrycms/web"
 	"github.com/tacusci/logging"
 )
 
 type options struct {
+	configFile          string
+	debug               bool
 	cpuProfile          bool
 	testData            bool
 	wipe                bool
@@ -45,54 +50,128 @@ type options struct {
 	sqlPassword         string
 	sqlAddress          string
 	activityLogLoc      string
+	activityLogFormat   string
+	activityLogMaxSize  int
+	activityLogRotate   time.Duration
+	activityLogKeep     int
+	activityLogAnon     bool
 	adminHiddenPassword string
 	adminPagesDisabled  bool
 	noRobots            bool
 	noSitemap           bool
+	noFeeds             bool
+	noAPI               bool
 	logFileName         string
 	autoCertDomain      string
+	noCompression       bool
+	compressionMinSize  int
+	compressionTypes    string
+	precompress         bool
+	rotateSessionKeys   bool
+	overrideDir         string
+	htmlPolicy          string
+	sessionIdle         time.Duration
+	sessionLifetime     time.Duration
+	rememberMe          time.Duration
+	baseURL             string
+	smtpHost            string
+	smtpPort            int
+	smtpUsername        string
+	smtpPassword        string
+	smtpTLS             string
+	mailFrom            string
+	mailDir             string
 }
 
 var shuttingDown bool
 
-func parseCmdArgs() *options {
-	opts := &options{}
-
-	debugLevel := flag.Bool("dbg", false, "Set logging to debug")
-	flag.BoolVar(&opts.testData, "testdb", false, "Creates testing data")
-	flag.BoolVar(&opts.wipe, "wipe", false, "Completely wipes database")
-	flag.BoolVar(&opts.yesToAll, "y", false, "Automatically agree to cli confirmation requests")
-	flag.UintVar(&opts.port, "p", 8080, "Port to listen for HTTP requests on")
-	flag.StringVar(&opts.addr, "a", "0.0.0.0", "IP address to listen against if multiple network adapters")
-	flag.StringVar(&opts.sql, "db", "sqlite", "Database server type to try to connect to [sqlite/mysql]")
-	flag.StringVar(&opts.sqlUsername, "dbuser", "berryadmin", "Database server username, ignored if using sqlite")
-	flag.StringVar(&opts.sqlPassword, "dbpass", "", "Database server password, ignored if using sqlite")
-	flag.StringVar(&opts.sqlAddress, "dbaddr", "/", "Database server location, ignored if using sqlite")
-	flag.StringVar(&opts.activityLogLoc, "actlog", "", "Activity/access log file location")
-	flag.StringVar(&opts.adminHiddenPassword, "ahp", "", "URI prefix to hide admin pages behind")
-	flag.BoolVar(&opts.noRobots, "nrtxt", false, "Don't provide a robots.txt URI")
-	flag.BoolVar(&opts.noSitemap, "nsxml", false, "Don't provide a sitemap.xml URI")
-	flag.BoolVar(&opts.adminPagesDisabled, "apd", false, "Admin interface pages disabled")
-	flag.StringVar(&opts.logFileName, "log", "", "Server log file location")
-	flag.BoolVar(&opts.cpuProfile, "cpuprofile", false, "Enable CPU profiling")
-	flag.StringVar(&opts.autoCertDomain, "autocert", "", "Domain/web address to serve HTTPS against")
-
-	flag.Parse()
-
-	loggingLevel := logging.WarnLevel
+//parseCmdArgs reads the options from the command line, environment and config file, exiting if they're invalid
+func parseCmdArgs() (*options, *flag.FlagSet) {
 	logging.ColorLogLevelLabelOnly = true
 
-	if *debugLevel {
-		logging.SetLevel(logging.DebugLevel)
-		return opts
+	opts, fs, err := loadOptions(os.Args[1:], flag.ExitOnError)
+	if err != nil {
+		logging.ErrorAndExit(err.Error())
 	}
-	logging.SetLevel(loggingLevel)
 
-	return opts
+	setLogLevel(opts)
+
+	return opts, fs
+}
+
+//newFlagSet command line options which fill in opts
+func newFlagSet(opts *options, errorHandling flag.ErrorHandling) *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], errorHandling)
+	fs.StringVar(&opts.configFile, "config", "", "YAML config file to read settings from, also set by "+envPrefix+"CONFIG")
+	fs.BoolVar(&opts.debug, "dbg", false, "Set logging to debug")
+	fs.BoolVar(&opts.testData, "testdb", false, "Creates testing data")
+	fs.BoolVar(&opts.wipe, "wipe", false, "Completely wipes database")
+	fs.BoolVar(&opts.yesToAll, "y", false, "Automatically agree to cli confirmation requests")
+	fs.UintVar(&opts.port, "p", 8080, "Port to listen for HTTP requests on")
+	fs.StringVar(&opts.addr, "a", "0.0.0.0", "IP address to listen against if multiple network adapters")
+	fs.StringVar(&opts.sql, "db", "sqlite", "Database server type to try to connect to [sqlite/mysql]")
+	fs.StringVar(&opts.sqlUsername, "dbuser", "berryadmin", "Database server username, ignored if using sqlite")
+	fs.StringVar(&opts.sqlPassword, "dbpass", "", "Database server password, ignored if using sqlite, prefer setting "+envPrefix+"DBPASS or dbpass in the config file so it isn't visible to other users")
+	fs.StringVar(&opts.sqlAddress, "dbaddr", "/", "Database server location, ignored if using sqlite")
+	fs.StringVar(&opts.activityLogLoc, "actlog", "", "Activity/access log file location, requests aren't logged if blank")
+	fs.StringVar(&opts.activityLogFormat, "actlogformat", accesslog.FormatCombined, "Activity/access log format [common/combined/json]")
+	fs.IntVar(&opts.activityLogMaxSize, "actlogmaxsize", 100, "Size in MB the activity/access log can grow to before it's rotated, 0 to not rotate by size")
+	fs.DurationVar(&opts.activityLogRotate, "actlogrotate", 24*time.Hour, "How often the activity/access log is rotated, 0 to not rotate by time")
+	fs.IntVar(&opts.activityLogKeep, "actlogkeep", 7, "Number of rotated activity/access logs to keep, 0 keeps them all")
+	fs.BoolVar(&opts.activityLogAnon, "actloganon", false, "Blank out the last part of client IP addresses in the activity/access log")
+	fs.StringVar(&opts.adminHiddenPassword, "ahp", "", "URI prefix to hide admin pages behind")
+	fs.BoolVar(&opts.noRobots, "nrtxt", false, "Don't provide a robots.txt URI")
+	fs.BoolVar(&opts.noSitemap, "nsxml", false, "Don't provide a sitemap.xml URI")
+	fs.BoolVar(&opts.noFeeds, "nfeeds", false, "Don't provide RSS/Atom feed URIs")
+	fs.BoolVar(&opts.noAPI, "napi", false, "Don't provide the JSON REST API URIs")
+	fs.BoolVar(&opts.adminPagesDisabled, "apd", false, "Admin interface pages disabled")
+	fs.StringVar(&opts.logFileName, "log", "", "Server log file location")
+	fs.BoolVar(&opts.cpuProfile, "cpuprofile", false, "Enable CPU profiling")
+	fs.StringVar(&opts.autoCertDomain, "autocert", "", "Domain/web address to serve HTTPS against")
+	fs.BoolVar(&opts.noCompression, "nocomp", false, "Don't gzip/brotli compress responses")
+	fs.IntVar(&opts.compressionMinSize, "compmin", web.DefaultCompressionMinSize, "Minimum response size in bytes to compress")
+	fs.StringVar(&opts.compressionTypes, "comptypes", strings.Join(web.DefaultCompressibleContentTypes, ","), "Comma separated list of content types to compress")
+	fs.BoolVar(&opts.precompress, "precompress", false, "Write gzip/brotli compressed copies of static files into the override directory and exit")
+	fs.BoolVar(&opts.rotateSessionKeys, "rotatekeys", false, "Replace the keys cookies are signed and encrypted with, logging everyone out, and exit")
+	fs.StringVar(&opts.overrideDir, "overrides", "", "Directory containing 'res', 'static' and 'themes' files to use instead of the built in ones, and any further themes to install")
+	fs.StringVar(&opts.baseURL, "baseurl", "", "Canonical scheme and host of the site used in the sitemap, feeds, canonical links, single sign on and password reset emails, the sitemap isn't served, canonical links are left out, single sign on won't start and emails aren't sent without it, eg., https://example.com")
+	fs.StringVar(&opts.smtpHost, "smtphost", "", "SMTP server to send mail through, mail is logged instead if blank")
+	fs.IntVar(&opts.smtpPort, "smtpport", 587, "SMTP server port")
+	fs.StringVar(&opts.smtpUsername, "smtpuser", "", "SMTP server username, leave blank if the server doesn't need authenticating with")
+	fs.StringVar(&opts.smtpPassword, "smtppass", "", "SMTP server password")
+	fs.StringVar(&opts.smtpTLS, "smtptls", "starttls", "How to secure the connection to the SMTP server [starttls/required/implicit], 'starttls' only upgrades if the server supports it")
+	fs.StringVar(&opts.mailFrom, "mailfrom", mail.DefaultFrom, "Address mail is sent from")
+	fs.StringVar(&opts.mailDir, "maildir", "", "Directory to write mail to as .eml files instead of logging who it's to, ignored if there's an SMTP server")
+	fs.DurationVar(&opts.sessionIdle, "sessionidle", web.DefaultSessionIdleTimeout, "How long a login session can go unused before it's ended")
+	fs.DurationVar(&opts.sessionLifetime, "sessionlifetime", web.DefaultSessionLifetime, "How long after logging in a login session is ended, however active it's been")
+	fs.DurationVar(&opts.rememberMe, "rememberme", web.DefaultSessionRememberMeLifetime, "How long a login session lasts when 'Remember me' is ticked")
+	fs.StringVar(&opts.htmlPolicy, "htmlpolicy", web.DefaultSanitisePolicy, "Sanitisation policy for page HTML not saved by root [strict/relaxed/off]")
+	return fs
+}
+
+//activityLogOptions where and how opts asks for requests to be logged
+func activityLogOptions(opts *options) accesslog.Options {
+	return accesslog.Options{
+		Path:        opts.activityLogLoc,
+		Format:      opts.activityLogFormat,
+		MaxSize:     int64(opts.activityLogMaxSize) * 1024 * 1024,
+		RotateEvery: opts.activityLogRotate,
+		Keep:        opts.activityLogKeep,
+		Anonymise:   opts.activityLogAnon,
+	}
+}
+
+//setLogLevel log at the level opts asks for
+func setLogLevel(opts *options) {
+	if opts.debug {
+		logging.SetLevel(logging.DebugLevel)
+		return
+	}
+	logging.SetLevel(logging.WarnLevel)
 }
 
 func main() {
-	opts := parseCmdArgs()
+	opts, fs := parseCmdArgs()
 
 	flushInitialised := make(chan bool)
 	if len(opts.logFileName) > 0 {
@@ -103,6 +182,15 @@ func main() {
 
 	logging.WhiteOutput(fmt.Sprintf("🍓 Berry CMS %s 🍓\n", db.VERSION))
 
+	if opts.precompress {
+		compressedCount, err := web.PrecompressStatic(defaultAssets, opts.overrideDir, opts.compressionMinSize, splitList(opts.compressionTypes))
+		if err != nil {
+			logging.ErrorAndExit(fmt.Sprintf("Error precompressing static files: %s", err.Error()))
+		}
+		logging.Info(fmt.Sprintf("Precompressed %d static files...", compressedCount))
+		return
+	}
+
 	switch opts.sql {
 	case "sqlite":
 		db.Connect(db.SQLITE, "", "berrycms")
@@ -140,7 +228,17 @@ func main() {
 		}
 	}
 
-	go db.Heartbeat()
+	if opts.rotateSessionKeys {
+		if err := web.RotateSessionKeys(true); err != nil {
+			logging.ErrorAndExit(fmt.Sprintf("Error rotating session keys: %s", err.Error()))
+		}
+		db.Close()
+		return
+	}
+
+	if err := web.LoadSessionKeys(); err != nil {
+		logging.ErrorAndExit(fmt.Sprintf("Error loading session keys: %s", err.Error()))
+	}
 
 	var certManager *autocert.Manager
 
@@ -164,22 +262,52 @@ func main() {
 		srv.TLSConfig = certManager.TLSConfig()
 	}
 
+	web.SetAssets(defaultAssets, opts.overrideDir)
+
+	if err := web.SetSanitisePolicy(opts.htmlPolicy); err != nil {
+		logging.ErrorAndExit(err.Error())
+	}
+
+	if err := web.SetBaseURL(opts.baseURL); err != nil {
+		logging.ErrorAndExit(err.Error())
+	}
+
+	if err := web.SetSessionLifetimes(opts.sessionIdle, opts.sessionLifetime, opts.rememberMe); err != nil {
+		logging.ErrorAndExit(err.Error())
+	}
+
+	if m, err := mailer(opts); err != nil {
+		logging.ErrorAndExit(err.Error())
+	} else if err := mail.SetMailer(m, opts.mailFrom); err != nil {
+		logging.ErrorAndExit(err.Error())
+	}
+
 	rs := web.MutableRouter{
 		Server:              srv,
-		ActivityLogLoc:      opts.activityLogLoc,
+		ActivityLog:         activityLogOptions(opts),
 		AdminOff:            opts.adminPagesDisabled,
 		AdminHidden:         len(opts.adminHiddenPassword) > 0,
 		AdminHiddenPassword: opts.adminHiddenPassword,
 		NoRobots:            opts.noRobots,
 		NoSitemap:           opts.noSitemap,
+		NoFeeds:             opts.noFeeds,
+		NoAPI:               opts.noAPI,
 		CpuProfile:          opts.cpuProfile,
+		NoCompression:       opts.noCompression,
+		CompressionMinSize:  opts.compressionMinSize,
+		CompressionTypes:    splitList(opts.compressionTypes),
 	}
 	rs.Reload()
 
-	clearOldSessionsStop := make(chan bool)
+	if err := scheduleJobs(); err != nil {
+		logging.ErrorAndExit(fmt.Sprintf("Error scheduling jobs: %s", err.Error()))
+	}
 
-	go web.ClearOldSessions(&clearOldSessionsStop)
-	go listenForStopSig(srv, &clearOldSessionsStop)
+	schedulerStop := make(chan bool)
+
+	go scheduler.Run(&schedulerStop)
+	go listenForStopSig(srv, &schedulerStop)
+	go listenForReloadSig(&rs, fs)
 
 	logging.Info(fmt.Sprintf("Starting http server @ %s 🌏 ...", srv.Addr))
 
@@ -197,6 +325,13 @@ func main() {
 		}
 	}
 
+	//let jobs which were running when told to stop finish before closing the DB connection they're using
+	scheduler.Wait()
+
+	if err := rs.CloseActivityLog(); err != nil {
+		logging.Error(err.Error())
+	}
+
 	logging.Info("Closing DB connection...")
 	db.Close()
 
@@ -232,6 +367,60 @@ func askConfirmToWipe() bool {
 	}
 }
 
+//splitList splits comma separated command line list value into its trimmed non-empty items
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+//scheduleJobs registers the background work run periodically
+func scheduleJobs() error {
+	jobs := []struct {
+		name string
+		spec string
+		run  scheduler.JobFunc
+	}{
+		{"heartbeat", "@every 1m", func(time.Time) error { return db.Heartbeat() }},
+		{"clearoldsessions", "@every 10s", web.ClearOldSessions},
+		{"sendqueuedmail", "@every 10s", mail.SendQueued},
+	}
+	for _, job := range jobs {
+		if err := scheduler.Every(job.name, job.spec, job.run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//mailer gets what to deliver mail with from the command line options
+func mailer(opts *options) (mail.Mailer, error) {
+	if len(opts.smtpHost) == 0 {
+		return &mail.LogMailer{Dir: opts.mailDir}, nil
+	}
+
+	m := &mail.SMTPMailer{
+		Host:     opts.smtpHost,
+		Port:     opts.smtpPort,
+		Username: opts.smtpUsername,
+		Password: opts.smtpPassword,
+	}
+	switch opts.smtpTLS {
+	case "starttls":
+	case "required":
+		m.RequireTLS = true
+	case "implicit":
+		m.ImplicitTLS = true
+	default:
+		return nil, fmt.Errorf("Unknown SMTP TLS mode %s...", opts.smtpTLS)
+	}
+	return m, nil
+}
+
 func cacheDir(domain string) (dir string) {
 	if domain != "" {
 		dir = fmt.Sprintf("%s%scache-autocert-%s", os.TempDir(), string(os.PathSeparator), domain)
@@ -246,14 +435,16 @@ func cacheDir(domain string) (dir string) {
 }
 
 //fires on Ctrl+C/SIGTERM send to process
-func listenForStopSig(srv *http.Server, wc *chan bool) {
+func listenForStopSig(srv *http.Server, wcs ...*chan bool) {
 	var gracefulStop = make(chan os.Signal)
 	signal.Notify(gracefulStop, syscall.SIGTERM)
 	signal.Notify(gracefulStop, syscall.SIGINT)
 	sig := <-gracefulStop
-	logging.Debug("Stopping clearing old sessions...")
-	//send a terminate command to the session clearing goroutine's channel
-	*wc <- true
+	logging.Debug("Stopping scheduled jobs...")
+	//send a terminate command to each background goroutine's channel
+	for _, wc := range wcs {
+		*wc <- true
+	}
 	shuttingDown = true
 	logging.Error(fmt.Sprintf("☠️ Caught sig: %+v (Shutting down and cleaning up...) ☠️", sig))
 	logging.Info("Stopping HTTP server...")
@@ -0,0 +1,228 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+//HTTPClient client used to talk to identity providers
+var HTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+//discoveryTTL how long discovered provider metadata and keys are kept before being fetched again
+const discoveryTTL = time.Hour
+
+//Metadata the parts of a provider's discovery document used for the authorization code flow
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+//Config a relying party's registration with a provider
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	//Scopes requested on top of 'openid'
+	Scopes []string
+}
+
+//Tokens the tokens returned by a provider's token endpoint
+type Tokens struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type discovered struct {
+	metadata  *Metadata
+	keys      *keySet
+	fetchedAt time.Time
+}
+
+var (
+	mu    sync.Mutex
+	cache = map[string]*discovered{}
+)
+
+//Discover fetches the issuer's discovery document, cached for an hour
+func Discover(issuer string) (*Metadata, error) {
+	d, err := discover(issuer)
+	if err != nil {
+		return nil, err
+	}
+	return d.metadata, nil
+}
+
+func discover(issuer string) (*discovered, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	mu.Lock()
+	d, exists := cache[issuer]
+	mu.Unlock()
+	if exists && time.Since(d.fetchedAt) < discoveryTTL {
+		return d, nil
+	}
+
+	metadata := &Metadata{}
+	if err := getJSON(issuer+"/.well-known/openid-configuration", metadata); err != nil {
+		return nil, fmt.Errorf("Unable to discover OpenID provider %s -> %s", issuer, err.Error())
+	}
+
+	if strings.TrimSuffix(metadata.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OpenID provider %s claims to be issuer %s", issuer, metadata.Issuer)
+	}
+	if len(metadata.AuthorizationEndpoint) == 0 || len(metadata.TokenEndpoint) == 0 || len(metadata.JWKSURI) == 0 {
+		return nil, fmt.Errorf("OpenID provider %s discovery document is missing endpoints", issuer)
+	}
+
+	d = &discovered{metadata: metadata, fetchedAt: time.Now()}
+
+	mu.Lock()
+	cache[issuer] = d
+	mu.Unlock()
+
+	return d, nil
+}
+
+//Reset forgets every discovered provider, so they're fetched again when next used
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	cache = map[string]*discovered{}
+}
+
+//RandomString generates a URL safe random string, used for states, nonces and PKCE verifiers
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+//CodeChallenge derives the S256 PKCE code challenge from verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+//AuthCodeURL get the provider URL to send the user to in order to sign in
+func AuthCodeURL(cfg Config, state string, nonce string, verifier string) (string, error) {
+	metadata, err := Discover(cfg.Issuer)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(metadata.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	query := authURL.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", cfg.ClientID)
+	query.Set("redirect_uri", cfg.RedirectURL)
+	query.Set("scope", strings.Join(append([]string{"openid"}, cfg.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", CodeChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+	authURL.RawQuery = query.Encode()
+
+	return authURL.String(), nil
+}
+
+//Exchange swaps the authorization code returned to the redirect URL for tokens
+func Exchange(cfg Config, code string, verifier string) (*Tokens, error) {
+	metadata, err := Discover(cfg.Issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	req, err := http.NewRequest("POST", metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OpenID provider token endpoint returned %d -> %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	tokens := &Tokens{}
+	if err := json.Unmarshal(body, tokens); err != nil {
+		return nil, err
+	}
+	if len(tokens.IDToken) == 0 {
+		return nil, errors.New("OpenID provider didn't return an ID token")
+	}
+
+	return tokens, nil
+}
+
+func getJSON(uri string, val interface{}) error {
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", uri, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(val)
+}
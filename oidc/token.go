@@ -0,0 +1,216 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+//clockSkew leeway allowed when checking token expiry against our clock
+const clockSkew = 2 * time.Minute
+
+//Claims the claims of a verified ID token
+type Claims map[string]interface{}
+
+//String get claim name as a string, blank if it's missing or not a string
+func (c Claims) String(name string) string {
+	if val, ok := c[name].(string); ok {
+		return val
+	}
+	return ""
+}
+
+//Subject the provider's unique identifier for the user
+func (c Claims) Subject() string {
+	return c.String("sub")
+}
+
+//Strings get claim name as a list of strings, a single string is returned as a list of one
+func (c Claims) Strings(name string) []string {
+	vals := []string{}
+	switch claim := c[name].(type) {
+	case string:
+		if len(claim) > 0 {
+			vals = append(vals, claim)
+		}
+	case []interface{}:
+		for _, val := range claim {
+			if s, ok := val.(string); ok && len(s) > 0 {
+				vals = append(vals, s)
+			}
+		}
+	}
+	return vals
+}
+
+//jwk a single public key from a provider's JWKS
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type keySet struct {
+	Keys []jwk `json:"keys"`
+}
+
+//find get the RSA public key with kid, any signing key if kid is blank
+func (ks *keySet) find(kid string) (*rsa.PublicKey, error) {
+	for _, key := range ks.Keys {
+		if key.Kty != "RSA" || (len(key.Use) > 0 && key.Use != "sig") {
+			continue
+		}
+		if len(kid) > 0 && key.Kid != kid {
+			continue
+		}
+		return key.publicKey()
+	}
+	return nil, fmt.Errorf("No signing key with ID '%s'", kid)
+}
+
+func (key jwk) publicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(key.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(key.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() > 1<<31 {
+		return nil, errors.New("RSA key exponent is too large")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+//signingKey get the provider's key with kid, fetching its keys again if it's not one we've seen
+func signingKey(issuer string, kid string) (*rsa.PublicKey, error) {
+	d, err := discover(issuer)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	keys := d.keys
+	mu.Unlock()
+
+	if keys != nil {
+		if key, err := keys.find(kid); err == nil {
+			return key, nil
+		}
+	}
+
+	//the provider may have rotated its keys since we last fetched them
+	keys = &keySet{}
+	if err := getJSON(d.metadata.JWKSURI, keys); err != nil {
+		return nil, fmt.Errorf("Unable to fetch OpenID provider keys -> %s", err.Error())
+	}
+
+	mu.Lock()
+	d.keys = keys
+	mu.Unlock()
+
+	return keys.find(kid)
+}
+
+//VerifyIDToken checks the ID token is signed by the provider, was issued to us for the sign in
+//started with nonce and hasn't expired, returning its claims
+func VerifyIDToken(cfg Config, rawIDToken string, nonce string) (Claims, error) {
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("ID token is malformed")
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("ID token header is malformed -> %s", err.Error())
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("ID token signed with unsupported algorithm '%s'", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("ID token signature is malformed")
+	}
+
+	key, err := signingKey(cfg.Issuer, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, errors.New("ID token signature is invalid")
+	}
+
+	claims := Claims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("ID token claims are malformed -> %s", err.Error())
+	}
+
+	if strings.TrimSuffix(claims.String("iss"), "/") != strings.TrimSuffix(cfg.Issuer, "/") {
+		return nil, fmt.Errorf("ID token was issued by '%s'", claims.String("iss"))
+	}
+
+	audienceMatches := false
+	for _, aud := range claims.Strings("aud") {
+		if aud == cfg.ClientID {
+			audienceMatches = true
+		}
+	}
+	if !audienceMatches {
+		return nil, errors.New("ID token wasn't issued to this client")
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok || time.Unix(int64(exp), 0).Add(clockSkew).Before(time.Now()) {
+		return nil, errors.New("ID token has expired")
+	}
+
+	if subtle.ConstantTimeCompare([]byte(claims.String("nonce")), []byte(nonce)) != 1 {
+		return nil, errors.New("ID token nonce doesn't match this sign in")
+	}
+
+	if len(claims.Subject()) == 0 {
+		return nil, errors.New("ID token has no subject")
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(segment string, val interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, val)
+}
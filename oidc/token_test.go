@@ -0,0 +1,100 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oidc_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/oidc"
+	"github.com/tacusci/berrycms/oidc/oidctest"
+)
+
+//validClaims claims of a token the issuer would issue to the client for the sign in started with nonce
+func validClaims(issuer *oidctest.Server, nonce string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"sub":   "abc123",
+		"iss":   issuer.URL,
+		"aud":   issuer.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": nonce,
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := oidctest.NewServer("berrycms", "secret")
+	defer issuer.Close()
+	defer oidc.Reset()
+
+	cfg := oidc.Config{Issuer: issuer.URL, ClientID: issuer.ClientID, ClientSecret: issuer.ClientSecret}
+
+	token, err := issuer.Sign(validClaims(issuer, "nonce"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := oidc.VerifyIDToken(cfg, token, "nonce")
+	if err != nil {
+		t.Fatalf("Expected a token issued to the client to be valid, got %s", err.Error())
+	}
+	if claims.Subject() != "abc123" {
+		t.Errorf("Expected the token's subject, got %s", claims.Subject())
+	}
+
+	if _, err := oidc.VerifyIDToken(cfg, token, "another"); err == nil {
+		t.Error("Expected a token for a different sign in's nonce to be rejected")
+	}
+
+	//swap in the signature over different claims so it no longer matches the token's payload
+	other, err := issuer.Sign(validClaims(issuer, "other"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := token[:strings.LastIndex(token, ".")] + other[strings.LastIndex(other, "."):]
+	if _, err := oidc.VerifyIDToken(cfg, forged, "nonce"); err == nil {
+		t.Error("Expected a token with a bad signature to be rejected")
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(claims map[string]interface{})
+	}{
+		{"the wrong audience", func(claims map[string]interface{}) { claims["aud"] = "someoneelse" }},
+		{"the wrong issuer", func(claims map[string]interface{}) { claims["iss"] = "https://attacker.example.com" }},
+		{"an expiry in the past", func(claims map[string]interface{}) { claims["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"no expiry", func(claims map[string]interface{}) { delete(claims, "exp") }},
+		{"another sign in's nonce", func(claims map[string]interface{}) { claims["nonce"] = "replayed" }},
+		{"no subject", func(claims map[string]interface{}) { delete(claims, "sub") }},
+	}
+	for _, test := range tests {
+		claims := validClaims(issuer, "nonce")
+		test.tamper(claims)
+		token, err := issuer.Sign(claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := oidc.VerifyIDToken(cfg, token, "nonce"); err == nil {
+			t.Errorf("Expected a token with %s to be rejected", test.name)
+		}
+	}
+
+	for _, malformed := range []string{"", "not.a.jwt", "onlyone"} {
+		if _, err := oidc.VerifyIDToken(cfg, malformed, "nonce"); err == nil {
+			t.Errorf("Expected malformed token %q to be rejected", malformed)
+		}
+	}
+}
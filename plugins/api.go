@@ -26,6 +26,7 @@ import (
 
 	"github.com/robertkrimen/otto"
 	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/mail"
 	"github.com/tacusci/berrycms/robots"
 	"github.com/tacusci/berrycms/sitemap"
 	"github.com/tacusci/logging"
@@ -339,6 +340,89 @@ func (s *sessionapi) Get(call otto.FunctionCall) otto.Value {
 
 // ******** END SESSION FUNCS ********
 
+// ******** MAIL FUNCS ********
+
+type mailapi struct{}
+
+//recipients reads the to argument of mail funcs, a single address or an array of them
+func (m *mailapi) recipients(val otto.Value) ([]string, bool) {
+	if val.IsString() {
+		return []string{val.String()}, true
+	}
+	exported, err := val.Export()
+	if err != nil {
+		return nil, false
+	}
+	switch to := exported.(type) {
+	case []string:
+		return to, true
+	case []interface{}:
+		addresses := []string{}
+		for _, address := range to {
+			s, ok := address.(string)
+			if !ok {
+				return nil, false
+			}
+			addresses = append(addresses, s)
+		}
+		return addresses, true
+	}
+	return nil, false
+}
+
+//Send queues an email to be delivered, returning whether it was queued, eg., mail.Send("someone@example.com", "Subject", "Body")
+func (m *mailapi) Send(call otto.FunctionCall) otto.Value {
+	if len(call.ArgumentList) != 3 {
+		apiError(&call, "wrong number of arguments to call 'mail.Send', want (string or array, string, string)")
+		return otto.FalseValue()
+	}
+	to, ok := m.recipients(call.Argument(0))
+	if !ok || !call.Argument(1).IsString() || !call.Argument(2).IsString() {
+		apiError(&call, "'mail.Send' function expected (string or array, string, string)")
+		return otto.FalseValue()
+	}
+
+	if err := mail.Queue(to, call.Argument(1).String(), call.Argument(2).String()); err != nil {
+		apiError(&call, err.Error())
+		return otto.FalseValue()
+	}
+	return otto.TrueValue()
+}
+
+//SendTemplate fills in a mail template with data and queues it to be delivered, returning whether it was queued,
+//eg., mail.SendTemplate("someone@example.com", "Subject: Hi {{.name}}\n\nThanks {{.name}}", {name: "Berry"})
+func (m *mailapi) SendTemplate(call otto.FunctionCall) otto.Value {
+	if len(call.ArgumentList) != 3 {
+		apiError(&call, "wrong number of arguments to call 'mail.SendTemplate', want (string or array, string, object)")
+		return otto.FalseValue()
+	}
+	to, ok := m.recipients(call.Argument(0))
+	if !ok || !call.Argument(1).IsString() {
+		apiError(&call, "'mail.SendTemplate' function expected (string or array, string, object)")
+		return otto.FalseValue()
+	}
+
+	data, err := call.Argument(2).Export()
+	if err != nil {
+		apiError(&call, err.Error())
+		return otto.FalseValue()
+	}
+
+	t, err := mail.ParseTemplate("plugin", call.Argument(1).String())
+	if err != nil {
+		apiError(&call, err.Error())
+		return otto.FalseValue()
+	}
+
+	if err := mail.QueueTemplate(to, t, data); err != nil {
+		apiError(&call, err.Error())
+		return otto.FalseValue()
+	}
+	return otto.TrueValue()
+}
+
+// ******** END MAIL FUNCS ********
+
 // ******** MISC FUNCS ********
 
 func apiError(call *otto.FunctionCall, outputMessage string) otto.Value {
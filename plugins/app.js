@@ -37,6 +37,18 @@ function onGetRender(uri, vars) {
 
 function onPostRecieve(uri, data) {}
 
+//called for each shortcode in shortcodesToRegister found in page content, eg., [greeting name="Berry"]
+function onShortcode(name, args, content, route) {
+    if (name === "greeting") {
+        //arguments are written by page editors, so escape them before outputting
+        var who = (args["name"] || "there").replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;");
+        return "<p>Hello " + who + "!</p>";
+    }
+}
+
+//this list of shortcodes gets registered on plugin load, before main() is called
+var shortcodesToRegister = ["greeting"];
+
 //this list of routes gets mapped on plugin load, before main() is called
 var routesToRegister = ["/main.go", "/images/{imgfilename}"];
 
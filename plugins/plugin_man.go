@@ -55,6 +55,7 @@ func (p *Plugin) ParseFile() error {
 		}
 		data = append(data, []byte("function on_get_render(args) { return onGetRender(args[0], args[1]); }\n")...)
 		data = append(data, []byte("function on_post_recieve(args) { return onPostRecieve(args[0], args[1]); }\n")...)
+		data = append(data, []byte("function on_shortcode(args) { return onShortcode(args[0], args[1], args[2], args[3]); }\n")...)
 		p.src = string(data)
 	}
 	return nil
@@ -167,6 +168,7 @@ func (m *Manager) loadPlugin(fileFullPath string) error {
 		plugin.VM.Set("sitemap", &sitemapapi{})
 		plugin.VM.Set("files", &filesapi{})
 		plugin.VM.Set("session", &sessionapi{})
+		plugin.VM.Set("mail", &mailapi{})
 		plugin.VM.Set("gsession", globalSession)
 		plugin.VM.Set("cmsdb", &cmsdatabaseapi{
 			Conn:       db.Conn,
@@ -0,0 +1,337 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+//specAlignmentPositions alignment pattern centres for versions 1 to 10, from ISO/IEC 18004 annex E
+var specAlignmentPositions = [][]int{nil, {}, {6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34}, {6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50}}
+
+//specMediumBlocks error correction codewords per block and number of blocks at medium error correction for
+//versions 1 to 10, from ISO/IEC 18004 table 9
+var specMediumBlocks = [][2]int{{}, {10, 1}, {16, 1}, {26, 1}, {18, 2}, {24, 2}, {16, 4}, {18, 4}, {22, 4}, {22, 5}, {26, 5}}
+
+//readPNG reads the modules of the QR code rendered in data with each module scale pixels wide, dropping the quiet zone
+func readPNG(t *testing.T, data []byte, scale int) [][]bool {
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() != bounds.Dy() || bounds.Dx()%scale != 0 {
+		t.Fatalf("Expected a square image a whole number of modules wide, got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+
+	size := bounds.Dx()/scale - quietZone*2
+	modules := make([][]bool, size)
+	for y := range modules {
+		modules[y] = make([]bool, size)
+		for x := range modules[y] {
+			r, _, _, _ := img.At((x+quietZone)*scale+scale/2, (y+quietZone)*scale+scale/2).RGBA()
+			modules[y][x] = r < 0x8000
+		}
+	}
+	for i := 0; i < bounds.Dx(); i++ {
+		if r, _, _, _ := img.At(i, 0).RGBA(); r < 0x8000 {
+			t.Fatal("Expected the quiet zone around the code to be blank")
+		}
+	}
+	return modules
+}
+
+//readFormat decodes the error correction level and mask from the format information next to the top left finder,
+//checking it's a valid BCH code and matches the copy split between the other two finders
+func readFormat(t *testing.T, modules [][]bool) (int, int) {
+	size := len(modules)
+	dark := func(x int, y int) int {
+		if modules[y][x] {
+			return 1
+		}
+		return 0
+	}
+
+	first, second := 0, 0
+	for i := 0; i <= 5; i++ {
+		first |= dark(8, i) << uint(i)
+	}
+	first |= dark(8, 7)<<6 | dark(8, 8)<<7 | dark(7, 8)<<8
+	for i := 9; i < 15; i++ {
+		first |= dark(14-i, 8) << uint(i)
+	}
+	for i := 0; i < 8; i++ {
+		second |= dark(size-1-i, 8) << uint(i)
+	}
+	for i := 8; i < 15; i++ {
+		second |= dark(8, size-15+i) << uint(i)
+	}
+	if first != second {
+		t.Fatalf("Expected both copies of the format information to match, got %015b and %015b", first, second)
+	}
+
+	for data := 0; data < 32; data++ {
+		rem := data
+		for i := 0; i < 10; i++ {
+			rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+		}
+		if (data<<10|rem)^0x5412 == first {
+			return data >> 3, data & 7
+		}
+	}
+	t.Fatalf("Format information %015b isn't a valid BCH code", first)
+	return 0, 0
+}
+
+//isFunctionModule checks whether the module at x, y in a code of version is part of a fixed pattern rather than data
+func isFunctionModule(version int, x int, y int) bool {
+	size := version*4 + 17
+
+	//finder patterns, their separators and the format information next to them
+	if (x <= 8 && y <= 8) || (x >= size-8 && y <= 8) || (x <= 8 && y >= size-8) {
+		return true
+	}
+	//timing patterns
+	if x == 6 || y == 6 {
+		return true
+	}
+	//version information
+	if version >= 7 && ((x >= size-11 && x <= size-9 && y <= 5) || (y >= size-11 && y <= size-9 && x <= 5)) {
+		return true
+	}
+
+	positions := specAlignmentPositions[version]
+	last := len(positions) - 1
+	for i, cx := range positions {
+		for j, cy := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			if abs(x-cx) <= 2 && abs(y-cy) <= 2 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//maskInverts checks whether mask inverts the module at x, y, from ISO/IEC 18004 table 10
+func maskInverts(mask int, x int, y int) bool {
+	switch mask {
+	case 0:
+		return (y+x)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (y+x)%3 == 0
+	case 4:
+		return (y/2+x/3)%2 == 0
+	case 5:
+		return (y*x)%2+(y*x)%3 == 0
+	case 6:
+		return ((y*x)%2+(y*x)%3)%2 == 0
+	default:
+		return ((y+x)%2+(y*x)%3)%2 == 0
+	}
+}
+
+//syndromesZero checks block, its data codewords followed by its error correction codewords, has no errors
+func syndromesZero(block []byte, eccLen int) bool {
+	for i := 0; i < eccLen; i++ {
+		//evaluate the block as a polynomial at alpha to the power i
+		root := byte(1)
+		for j := 0; j < i; j++ {
+			root = gfMultiply(root, 2)
+		}
+		sum := byte(0)
+		for _, b := range block {
+			sum = gfMultiply(sum, root) ^ b
+		}
+		if sum != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//decode reads the text held in a medium error correction byte mode QR code's modules
+func decode(t *testing.T, modules [][]bool) string {
+	size := len(modules)
+	version := (size - 17) / 4
+	if size != version*4+17 || version < 1 || version >= len(specAlignmentPositions) {
+		t.Fatalf("Unexpected size %d for a version 1 to 10 QR code", size)
+	}
+
+	level, mask := readFormat(t, modules)
+	if level != 0 {
+		t.Fatalf("Expected medium error correction, got level bits %02b", level)
+	}
+
+	if version >= 7 {
+		bits := 0
+		for i := 0; i < 18; i++ {
+			if modules[i/3][size-11+i%3] {
+				bits |= 1 << uint(i)
+			}
+		}
+		if bits>>12 != version {
+			t.Fatalf("Expected version information %d, got %d", version, bits>>12)
+		}
+	}
+
+	//read the data modules up and down pairs of columns from the bottom right, skipping the vertical timing pattern
+	var bits []bool
+	upwards := true
+	for right := size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for i := 0; i < size; i++ {
+			y := i
+			if upwards {
+				y = size - 1 - i
+			}
+			for _, x := range []int{right, right - 1} {
+				if !isFunctionModule(version, x, y) {
+					bits = append(bits, modules[y][x] != maskInverts(mask, x, y))
+				}
+			}
+		}
+		upwards = !upwards
+	}
+
+	codewords := make([]byte, len(bits)/8)
+	for i := range codewords {
+		for j := 0; j < 8; j++ {
+			if bits[i*8+j] {
+				codewords[i] |= 1 << uint(7-j)
+			}
+		}
+	}
+
+	eccLen, numBlocks := specMediumBlocks[version][0], specMediumBlocks[version][1]
+	shortBlockLen := len(codewords) / numBlocks
+	numShortBlocks := numBlocks - len(codewords)%numBlocks
+	blocks := make([][]byte, numBlocks)
+	dataLen := func(block int) int {
+		if block < numShortBlocks {
+			return shortBlockLen - eccLen
+		}
+		return shortBlockLen - eccLen + 1
+	}
+
+	k := 0
+	for i := 0; i <= shortBlockLen-eccLen; i++ {
+		for block := range blocks {
+			if i < dataLen(block) {
+				blocks[block] = append(blocks[block], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for block := range blocks {
+			blocks[block] = append(blocks[block], codewords[k])
+			k++
+		}
+	}
+
+	var data []byte
+	for i, block := range blocks {
+		if !syndromesZero(block, eccLen) {
+			t.Fatalf("Block %d's error correction codewords don't match its data", i)
+		}
+		data = append(data, block[:dataLen(i)]...)
+	}
+
+	read := func(pos *int, n int) int {
+		val := 0
+		for i := 0; i < n; i++ {
+			val <<= 1
+			if data[(*pos+i)/8]&(1<<uint(7-(*pos+i)%8)) != 0 {
+				val |= 1
+			}
+		}
+		*pos += n
+		return val
+	}
+
+	pos := 0
+	if mode := read(&pos, 4); mode != 0x4 {
+		t.Fatalf("Expected byte mode, got mode %04b", mode)
+	}
+	countBits := 8
+	if version > 9 {
+		countBits = 16
+	}
+	text := make([]byte, read(&pos, countBits))
+	for i := range text {
+		text[i] = byte(read(&pos, 8))
+	}
+	return string(text)
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	tests := []struct {
+		text    string
+		version int
+	}{
+		{"berrycms", 1},
+		{"otpauth://totp/berrycms:jane?secret=JBSWY3DPEHPK3PXP&issuer=berrycms&algorithm=SHA1&digits=6&period=30", 6},
+		{strings.Repeat("0123456789", 15), 8},
+		{strings.Repeat("x", 200), 10},
+	}
+
+	for _, test := range tests {
+		code, err := Encode(test.text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code.Version != test.version || code.Size != test.version*4+17 {
+			t.Errorf("Expected %d bytes to need version %d, got version %d", len(test.text), test.version, code.Version)
+		}
+
+		data, err := code.PNG(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		modules := readPNG(t, data, 3)
+		for y := range modules {
+			for x := range modules[y] {
+				if modules[y][x] != code.Dark(x, y) {
+					t.Fatalf("Module %d,%d of the PNG doesn't match the code", x, y)
+				}
+			}
+		}
+
+		if decoded := decode(t, modules); decoded != test.text {
+			t.Errorf("Expected the code to decode to %q, got %q", test.text, decoded)
+		}
+	}
+}
+
+func TestEncodeTooLong(t *testing.T) {
+	if _, err := Encode(strings.Repeat("x", 2331)); err != nil {
+		t.Errorf("Expected the most bytes a medium error correction code holds to fit, got %s", err.Error())
+	}
+	if _, err := Encode(strings.Repeat("x", 2332)); err != ErrTooLong {
+		t.Errorf("Expected text too long for any version to fail with %v, got %v", ErrTooLong, err)
+	}
+}
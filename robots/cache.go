@@ -15,96 +15,229 @@
 package robots
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
 )
 
-var cache *bytes.Buffer
+var (
+	mu    sync.Mutex
+	cache []byte
+	//adminDisabled whether admin pages were disabled when the cache was last generated
+	adminDisabled bool
+)
 
+//Add persists a line added by a plugin, eg., 'Disallow: /private', in the plugin managed group
 func Add(val *[]byte) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	if cache == nil {
 		return errors.New("Robots cache unmutable... User has likely disabled robots.txt")
 	}
-	//add newline to uri to add so caller doesn't have to
-	*val = append(*val, []byte("\n")...)
-	_, err := cache.Write(*val)
+
+	rule, err := ParseRule(string(*val))
 	if err != nil {
 		return err
 	}
-	return nil
+
+	rgt := db.RobotsGroupsTable{}
+	group, err := rgt.SelectPluginManaged(db.Conn)
+	if err != nil {
+		//no plugin has added a line yet
+		group = &db.RobotsGroup{CreatedDateTime: time.Now().Unix(), UserAgents: "*", PluginManaged: true}
+	}
+
+	parsed, _ := ParseGroup(group.UserAgents, group.Rules)
+	for _, existing := range parsed.Rules {
+		if existing == rule {
+			return nil
+		}
+	}
+	group.Rules = FormatRules(append(parsed.Rules, rule))
+
+	if group.Robotsgroupid == 0 {
+		err = rgt.Insert(db.Conn, group)
+	} else {
+		err = rgt.Update(db.Conn, group)
+	}
+	if err != nil {
+		return err
+	}
+
+	return generate()
 }
 
+//Del removes a line previously added by a plugin from the plugin managed group
 func Del(val *[]byte) error {
+	mu.Lock()
+	defer mu.Unlock()
+
 	if cache == nil {
 		return errors.New("Robots cache unmutable... User has likely disabled robots.txt")
 	}
 
-	//*OPTIMISATION* immediately return if there's nothing to delete from
-	if cache.Len() == 0 {
+	rule, err := ParseRule(string(*val))
+	if err != nil {
+		return err
+	}
+
+	rgt := db.RobotsGroupsTable{}
+	group, err := rgt.SelectPluginManaged(db.Conn)
+	if err != nil {
+		//nothing has been added by plugins to delete
 		return nil
 	}
 
-	//add newline to uri to add so caller doesn't have to
-	*val = append(*val, []byte("\n")...)
-	existingVal := cache.Bytes()
-	cache.Reset()
-	cache.Write(bytes.Replace(existingVal, *val, []byte{}, -1))
-	return nil
+	parsed, _ := ParseGroup(group.UserAgents, group.Rules)
+	remaining := []Rule{}
+	for _, existing := range parsed.Rules {
+		if existing != rule {
+			remaining = append(remaining, existing)
+		}
+	}
+
+	if len(remaining) == len(parsed.Rules) {
+		return nil
+	}
+
+	group.Rules = FormatRules(remaining)
+	if err := rgt.Update(db.Conn, group); err != nil {
+		return err
+	}
+
+	return generate()
 }
 
+//Generate creates robots.txt from the automatic entries merged with the groups saved in the database
 func Generate(adminPagesDisabled bool) error {
-	Reset()
-	_, err := cache.WriteString("User-agent: *\n")
+	mu.Lock()
+	defer mu.Unlock()
+
+	adminDisabled = adminPagesDisabled
+	return generate()
+}
+
+//Regenerate creates robots.txt again after its saved groups have changed, if it's been generated before
+func Regenerate() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if cache == nil {
+		return nil
+	}
+	return generate()
+}
+
+func generate() error {
+	groups, err := mergedGroups(adminDisabled, 0, nil)
 	if err != nil {
 		return err
 	}
+	cache = Render(groups)
+	return nil
+}
 
-	if !adminPagesDisabled {
-		_, err = cache.WriteString("Disallow: /admin\n")
-		if err != nil {
-			return err
+//Preview renders robots.txt as it would be with the saved group with id replaced by draft,
+//or with draft added as a new group if id is 0
+func Preview(id int, draft *Group) ([]byte, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	groups, err := mergedGroups(adminDisabled, id, draft)
+	if err != nil {
+		return nil, err
+	}
+	return Render(groups), nil
+}
+
+//mergedGroups get the automatic group followed by every group saved in the database,
+//with the group with replaceID swapped for replacement, or replacement added on the end if replaceID is 0
+func mergedGroups(adminPagesDisabled bool, replaceID int, replacement *Group) ([]*Group, error) {
+	automatic, err := automaticGroup(adminPagesDisabled)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []*Group{automatic}
+
+	rgt := db.RobotsGroupsTable{}
+	saved, err := rgt.SelectAll(db.Conn)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range saved {
+		if replacement != nil && s.Robotsgroupid == replaceID {
+			groups = append(groups, replacement)
+			continue
+		}
+		group, errs := ParseGroup(s.UserAgents, s.Rules)
+		for _, err := range errs {
+			//groups are validated when saved, so this only happens if they've been edited elsewhere
+			logging.Error(fmt.Sprintf("Robots group %d -> %s", s.Robotsgroupid, err.Error()))
 		}
+		groups = append(groups, group)
+	}
+
+	if replacement != nil && replaceID == 0 {
+		groups = append(groups, replacement)
+	}
+
+	return groups, nil
+}
+
+//automaticGroup disallows every crawler from the admin pages and role protected pages
+func automaticGroup(adminPagesDisabled bool) (*Group, error) {
+	group := &Group{UserAgents: []string{"*"}}
+
+	if !adminPagesDisabled {
+		group.Rules = append(group.Rules, Rule{Directive: Disallow, Value: "/admin"})
 	}
 
 	pt := db.PagesTable{}
 	rows, err := pt.Select(db.Conn, "route", "roleprotected = '1'")
-
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	defer rows.Close()
+
 	var pageRouteToDisallow string
 
 	for rows.Next() {
-		err := rows.Scan(&pageRouteToDisallow)
-		if err != nil {
-			return err
+		if err := rows.Scan(&pageRouteToDisallow); err != nil {
+			return nil, err
 		}
-
-		_, err = cache.WriteString(fmt.Sprintf("Disallow: %s\n", pageRouteToDisallow))
-		if err != nil {
-			return err
+		if !strings.HasPrefix(pageRouteToDisallow, "/") {
+			continue
 		}
+		group.Rules = append(group.Rules, Rule{Directive: Disallow, Value: pageRouteToDisallow})
 	}
 
-	return nil
+	return group, rows.Err()
 }
 
 func CacheExists() bool {
+	mu.Lock()
+	defer mu.Unlock()
 	return cache != nil
 }
 
 func CacheBytes() []byte {
-	return cache.Bytes()
+	mu.Lock()
+	defer mu.Unlock()
+	return cache
 }
 
+//Reset drops the generated robots.txt, it won't be served until it's generated again
 func Reset() {
-	//we don't want to allocate memory each reset
-	if cache == nil {
-		cache = &bytes.Buffer{}
-	}
-	cache.Reset()
+	mu.Lock()
+	defer mu.Unlock()
+	cache = nil
 }
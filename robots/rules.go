@@ -0,0 +1,204 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package robots
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	//Allow directive allowing crawling of a path
+	Allow = "Allow"
+	//Disallow directive disallowing crawling of a path
+	Disallow = "Disallow"
+	//CrawlDelay directive asking crawlers to wait between requests
+	CrawlDelay = "Crawl-delay"
+	//Sitemap directive pointing crawlers at a sitemap, applies to every user-agent
+	Sitemap = "Sitemap"
+)
+
+//Rule a single line of a robots.txt group, eg., 'Disallow: /private'
+type Rule struct {
+	Directive string
+	Value     string
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%s: %s", r.Directive, r.Value)
+}
+
+//Group rules applied to one or more user-agents
+type Group struct {
+	UserAgents []string
+	Rules      []Rule
+}
+
+//ParseRule parses and validates a single rule line
+func ParseRule(line string) (Rule, error) {
+	colon := strings.IndexByte(line, ':')
+	if colon < 0 {
+		return Rule{}, fmt.Errorf("Rule '%s' is missing ':' between directive and value", line)
+	}
+
+	rule := Rule{Value: strings.TrimSpace(line[colon+1:])}
+	directive := strings.TrimSpace(line[:colon])
+
+	for _, d := range []string{Allow, Disallow, CrawlDelay, Sitemap} {
+		if strings.EqualFold(directive, d) {
+			rule.Directive = d
+		}
+	}
+
+	switch rule.Directive {
+	case Allow, Disallow:
+		//a blank disallow allows everything
+		if len(rule.Value) > 0 && !strings.HasPrefix(rule.Value, "/") && !strings.HasPrefix(rule.Value, "*") {
+			return Rule{}, fmt.Errorf("Rule '%s' path must start with '/' or '*'", line)
+		}
+	case CrawlDelay:
+		if delay, err := strconv.ParseFloat(rule.Value, 64); err != nil || delay < 0 {
+			return Rule{}, fmt.Errorf("Rule '%s' delay must be a number of seconds", line)
+		}
+	case Sitemap:
+		if u, err := url.Parse(rule.Value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return Rule{}, fmt.Errorf("Rule '%s' sitemap must be an absolute http(s) URL", line)
+		}
+	default:
+		return Rule{}, fmt.Errorf("Rule '%s' has unknown directive, expected one of Allow, Disallow, Crawl-delay or Sitemap", line)
+	}
+
+	if strings.ContainsAny(rule.Value, " \t") {
+		return Rule{}, fmt.Errorf("Rule '%s' value can't contain whitespace", line)
+	}
+
+	return rule, nil
+}
+
+//ParseGroup parses and validates newline separated user-agents and rules, returning every problem found
+func ParseGroup(userAgents string, rules string) (*Group, []error) {
+	group := &Group{}
+	errs := []error{}
+
+	for _, agent := range splitLines(userAgents) {
+		if strings.ContainsAny(agent, ": \t") {
+			errs = append(errs, fmt.Errorf("User-agent '%s' can't contain ':' or whitespace", agent))
+			continue
+		}
+		group.UserAgents = append(group.UserAgents, agent)
+	}
+
+	if len(group.UserAgents) == 0 && len(errs) == 0 {
+		errs = append(errs, fmt.Errorf("Group needs at least one user-agent"))
+	}
+
+	for _, line := range splitLines(rules) {
+		rule, err := ParseRule(line)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		group.Rules = append(group.Rules, rule)
+	}
+
+	return group, errs
+}
+
+//FormatRules writes rules out one per line, as stored and edited
+func FormatRules(rules []Rule) string {
+	lines := []string{}
+	for _, rule := range rules {
+		lines = append(lines, rule.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+//Render writes groups out as a robots.txt document, merging groups for the same user-agents
+//and moving sitemap lines to the end as they don't belong to any group
+func Render(groups []*Group) []byte {
+	merged := []*Group{}
+	byAgents := map[string]*Group{}
+	sitemaps := []Rule{}
+
+	for _, group := range groups {
+		if len(group.UserAgents) == 0 {
+			continue
+		}
+
+		key := strings.ToLower(strings.Join(group.UserAgents, "\n"))
+		target, exists := byAgents[key]
+		if !exists {
+			target = &Group{UserAgents: group.UserAgents}
+			byAgents[key] = target
+			merged = append(merged, target)
+		}
+
+		for _, rule := range group.Rules {
+			if rule.Directive == Sitemap {
+				sitemaps = appendUnique(sitemaps, rule)
+				continue
+			}
+			target.Rules = appendUnique(target.Rules, rule)
+		}
+	}
+
+	var buf bytes.Buffer
+	for i, group := range merged {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		for _, agent := range group.UserAgents {
+			buf.WriteString(fmt.Sprintf("User-agent: %s\n", agent))
+		}
+		for _, rule := range group.Rules {
+			buf.WriteString(rule.String() + "\n")
+		}
+	}
+
+	if len(sitemaps) > 0 {
+		buf.WriteString("\n")
+		for _, rule := range sitemaps {
+			buf.WriteString(rule.String() + "\n")
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func appendUnique(rules []Rule, rule Rule) []Rule {
+	for _, r := range rules {
+		if r == rule {
+			return rules
+		}
+	}
+	return append(rules, rule)
+}
+
+//splitLines splits text into its trimmed non-empty lines, ignoring comments
+func splitLines(text string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if hash := strings.IndexByte(line, '#'); hash >= 0 {
+			line = line[:hash]
+		}
+		if line = strings.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//searchLimit furthest ahead a cron schedule is searched for its next run, long enough to find 29th February
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+//Schedule works out when a job is next due to run
+type Schedule interface {
+	//Next first time after after the job is due, zero if it never is
+	Next(after time.Time) time.Time
+}
+
+//shorthands schedules which can be given by name instead of as cron fields
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+//Parse reads a schedule, either five cron fields 'minute hour day-of-month month day-of-week', one of the
+//shorthands such as '@daily', or '@every <duration>' eg., '@every 10s'
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if strings.HasPrefix(spec, "@every ") {
+		interval, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, fmt.Errorf("Schedule '%s' has an invalid interval -> %s", spec, err.Error())
+		}
+		if interval < time.Second {
+			return nil, fmt.Errorf("Schedule '%s' must be at least a second apart", spec)
+		}
+		return every{interval: interval}, nil
+	}
+
+	if cronSpec, ok := shorthands[spec]; ok {
+		return parseCron(cronSpec)
+	}
+
+	c, err := parseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	if c.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("Schedule '%s' is never due", spec)
+	}
+	return c, nil
+}
+
+//every schedule due a fixed interval after it last ran
+type every struct {
+	interval time.Duration
+}
+
+func (e every) Next(after time.Time) time.Time {
+	return after.Truncate(time.Second).Add(e.interval)
+}
+
+//cron schedule due on the minutes matching each of its fields, each field is a set of the values which match
+type cron struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+	//anyDayOfMonth, anyDayOfWeek whether the day fields were '*', if neither was a day matching either is due
+	anyDayOfMonth, anyDayOfWeek bool
+}
+
+func parseCron(spec string) (*cron, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("Schedule '%s' must have 5 fields: minute hour day-of-month month day-of-week", spec)
+	}
+
+	c := &cron{
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*",
+	}
+	var err error
+	if c.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dayOfMonth, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	//both 0 and 7 are Sunday
+	if c.dayOfWeek, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if c.dayOfWeek&(1<<7) != 0 {
+		c.dayOfWeek |= 1
+	}
+	return c, nil
+}
+
+//parseField reads a comma separated list of values, 'min-max' ranges and '*', each optionally followed by '/step'
+func parseField(field string, min int, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("Schedule field '%s' has an invalid step", field)
+			}
+			part = part[:i]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("Schedule field '%s' has an invalid value", field)
+			}
+			end = start
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("Schedule field '%s' has an invalid value", field)
+				}
+			} else if step > 1 {
+				end = max
+			}
+		}
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("Schedule field '%s' must be between %d and %d", field, min, max)
+		}
+
+		for value := start; value <= end; value += step {
+			set |= 1 << uint(value)
+		}
+	}
+	return set, nil
+}
+
+//Next searches the wall clock times after after's, so a time repeated when clocks go back is only due once,
+//and a time skipped when they go forward is due as they jump
+func (c *cron) Next(after time.Time) time.Time {
+	//wall clock times are stepped through in UTC, which has no daylight saving to skip or repeat any
+	wall := time.Date(after.Year(), after.Month(), after.Day(), after.Hour(), after.Minute(), 0, 0, time.UTC)
+	t := wall.Add(time.Minute)
+	limit := wall.Add(searchLimit)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, time.UTC)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			if next := inLocation(t, after.Location()); next.After(after) {
+				return next
+			}
+			t = t.Add(time.Minute)
+		}
+	}
+	return time.Time{}
+}
+
+//inLocation the first time the clock in loc reads wall, or the time clocks jump to if they skip over it
+func inLocation(wall time.Time, loc *time.Location) time.Time {
+	t := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc)
+
+	//when clocks go back Date can give the second of the times reading wall, the first had the offset from before
+	_, offset := t.Add(-12 * time.Hour).Zone()
+	if earlier := wall.Add(-time.Duration(offset) * time.Second).In(loc); earlier.Before(t) && sameWallClock(earlier, wall) {
+		return earlier
+	}
+	return t
+}
+
+//sameWallClock whether t's clock reads the same date, hour and minute as wall
+func sameWallClock(t time.Time, wall time.Time) bool {
+	return t.Year() == wall.Year() && t.YearDay() == wall.YearDay() && t.Hour() == wall.Hour() && t.Minute() == wall.Minute()
+}
+
+//dayMatches whether t's day is due, if both day fields are restricted matching either is enough
+func (c *cron) dayMatches(t time.Time) bool {
+	dayOfMonth := c.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := c.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if c.anyDayOfMonth || c.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
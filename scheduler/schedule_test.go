@@ -0,0 +1,124 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSchedules(t *testing.T) {
+	//a Saturday
+	after := time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+	for spec, expected := range map[string]time.Time{
+		"30 9 * * 1-5":   time.Date(2019, time.June, 3, 9, 30, 0, 0, time.UTC),
+		"*/15 * * * *":   time.Date(2019, time.June, 1, 12, 15, 0, 0, time.UTC),
+		"0 0 29 2 *":     time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC),
+		"0 12 1,15 * 3":  time.Date(2019, time.June, 5, 12, 0, 0, 0, time.UTC),
+		"@daily":         time.Date(2019, time.June, 2, 0, 0, 0, 0, time.UTC),
+		"@every 1h30m":   time.Date(2019, time.June, 1, 13, 30, 0, 0, time.UTC),
+		"0 8-18/5 * * 0": time.Date(2019, time.June, 2, 8, 0, 0, 0, time.UTC),
+	} {
+		schedule, err := Parse(spec)
+		if err != nil {
+			t.Errorf("Expected schedule '%s' to parse -> %s", spec, err.Error())
+			continue
+		}
+		if next := schedule.Next(after); !next.Equal(expected) {
+			t.Errorf("Expected schedule '%s' to next be due %s, got %s", spec, expected, next)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "0 0 31 2 *", "@every 10ms", "@fortnightly"} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Expected schedule '%s' to be rejected", spec)
+		}
+	}
+}
+
+func TestScheduleDays(t *testing.T) {
+	tests := []struct {
+		spec     string
+		after    time.Time
+		expected time.Time
+	}{
+		//with both day fields restricted a day matching either is due
+		{"0 0 13 * 5", time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC), time.Date(2019, time.June, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2019, time.June, 8, 12, 0, 0, 0, time.UTC), time.Date(2019, time.June, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * 1", time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC), time.Date(2019, time.June, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1-7 * 1", time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC), time.Date(2019, time.June, 2, 0, 0, 0, 0, time.UTC)},
+		//with one of them '*' only the other has to match
+		{"0 0 13 * *", time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC), time.Date(2019, time.June, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 5", time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC), time.Date(2019, time.June, 7, 0, 0, 0, 0, time.UTC)},
+		//both 0 and 7 are Sunday
+		{"0 0 * * 7", time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC), time.Date(2019, time.June, 2, 0, 0, 0, 0, time.UTC)},
+		//the 31st is skipped in months without one
+		{"0 0 31 * *", time.Date(2019, time.June, 1, 12, 0, 0, 0, time.UTC), time.Date(2019, time.July, 31, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		schedule, err := Parse(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := schedule.Next(test.after); !next.Equal(test.expected) {
+			t.Errorf("Expected schedule '%s' after %s to next be due %s, got %s", test.spec, test.after, test.expected, next)
+		}
+	}
+}
+
+func TestScheduleDaylightSaving(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skipf("No time zone data -> %s", err.Error())
+	}
+	at := func(month time.Month, day int, hour int, minute int, zone string) time.Time {
+		//in 2019 clocks went forward at 1am GMT on 31st March, and back at 2am BST on 27th October
+		offset := 0
+		if zone == "BST" {
+			offset = 60 * 60
+		}
+		return time.Date(2019, month, day, hour, minute, 0, 0, time.FixedZone(zone, offset)).In(london)
+	}
+
+	tests := []struct {
+		spec     string
+		after    time.Time
+		expected []time.Time
+	}{
+		//a time skipped when clocks go forward is due as they jump, once however many were skipped
+		{"30 1 * * *", at(time.March, 30, 12, 0, "GMT"), []time.Time{at(time.March, 31, 2, 30, "BST"), at(time.April, 1, 1, 30, "BST")}},
+		{"*/20 * * * *", at(time.March, 31, 0, 40, "GMT"), []time.Time{at(time.March, 31, 2, 0, "BST"), at(time.March, 31, 2, 20, "BST")}},
+		//a time repeated when clocks go back is due the first time round only
+		{"30 1 * * *", at(time.October, 26, 12, 0, "BST"), []time.Time{at(time.October, 27, 1, 30, "BST"), at(time.October, 28, 1, 30, "GMT")}},
+		{"*/30 * * * *", at(time.October, 27, 0, 45, "BST"), []time.Time{at(time.October, 27, 1, 0, "BST"), at(time.October, 27, 1, 30, "BST"), at(time.October, 27, 2, 0, "GMT")}},
+		//intervals are kept whatever the clocks do
+		{"@every 1h", at(time.October, 27, 0, 30, "BST"), []time.Time{at(time.October, 27, 1, 30, "BST"), at(time.October, 27, 1, 30, "GMT")}},
+	}
+
+	for _, test := range tests {
+		schedule, err := Parse(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		next := test.after
+		for _, expected := range test.expected {
+			if next = schedule.Next(next); !next.Equal(expected) {
+				t.Errorf("Expected schedule '%s' after %s to be due %s, got %s", test.spec, test.after, expected, next)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//StatusQueued deferred job is waiting to run
+	StatusQueued = "queued"
+	//StatusDone deferred job has run
+	StatusDone = "done"
+	//StatusFailed running deferred job was given up on after MaxAttempts
+	StatusFailed = "failed"
+
+	//MaxAttempts times running a deferred job is tried before it's given up on
+	MaxAttempts = 5
+
+	//tickInterval how often jobs are checked to see if they're due
+	tickInterval = time.Second
+	//retryDelay how long after the first failed attempt a deferred job is tried again, doubling after each attempt
+	retryDelay = time.Minute
+	//maxRetryDelay longest to wait between attempts
+	maxRetryDelay = time.Hour
+	//deferredBatchSize most deferred jobs run each time they're checked
+	deferredBatchSize = 50
+	//doneRetention how long deferred jobs which have run are kept
+	doneRetention = 7 * 24 * time.Hour
+)
+
+//JobFunc work a scheduled job does when it's due at now
+type JobFunc func(now time.Time) error
+
+//HandlerFunc work a deferred job of a kind does with the payload it was deferred with
+type HandlerFunc func(payload string) error
+
+//Job a scheduled job as it stands
+type Job struct {
+	Name         string
+	Schedule     string
+	LastRun      time.Time
+	NextRun      time.Time
+	LastDuration time.Duration
+	LastError    string
+	Runs         int
+	Failures     int
+	Running      bool
+}
+
+//scheduledJob a job registered to be run on a schedule, along with its saved state
+type scheduledJob struct {
+	schedule Schedule
+	run      JobFunc
+	state    *db.ScheduledJob
+	running  bool
+}
+
+var (
+	mu sync.Mutex
+	//scheduled jobs run on a schedule by name
+	scheduled = map[string]*scheduledJob{}
+	//handlers what runs deferred jobs by kind
+	handlers = map[string]HandlerFunc{}
+	//runningDeferred whether deferred jobs are being run already
+	runningDeferred bool
+	running         sync.WaitGroup
+)
+
+//Every registers run to be run under name whenever spec says it's due, replacing any job already registered with name,
+//if the job was due while the server was down it's run straight away to catch up
+func Every(name string, spec string, run JobFunc) error {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	sjt := db.ScheduledJobsTable{}
+	state, err := sjt.SelectByName(db.Conn, name)
+	switch {
+	case err == sql.ErrNoRows:
+		state = &db.ScheduledJob{Name: name, Schedule: spec, NextRunDateTime: schedule.Next(now).Unix()}
+		if err := sjt.Insert(db.Conn, state); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case state.Schedule != spec:
+		state.Schedule = spec
+		state.NextRunDateTime = schedule.Next(now).Unix()
+		if err := sjt.Update(db.Conn, state); err != nil {
+			return err
+		}
+	case state.NextRunDateTime < now.Unix():
+		logging.Info(fmt.Sprintf("Job %s was due at %s, catching up...", name, time.Unix(state.NextRunDateTime, 0).Format(time.RFC1123)))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	scheduled[name] = &scheduledJob{schedule: schedule, run: run, state: state}
+	return nil
+}
+
+//Handle registers run to run deferred jobs of kind
+func Handle(kind string, run HandlerFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers[kind] = run
+}
+
+//Defer queues a job of kind to be run with payload once delay has passed, it's saved so it still runs if the server restarts first
+func Defer(kind string, payload string, delay time.Duration) error {
+	if len(kind) == 0 {
+		return errors.New("Deferred job must have a kind")
+	}
+
+	now := time.Now()
+	djt := db.DeferredJobsTable{}
+	return djt.Insert(db.Conn, &db.DeferredJob{
+		CreatedDateTime: now.Unix(),
+		Kind:            kind,
+		Payload:         payload,
+		Status:          StatusQueued,
+		RunDateTime:     now.Add(delay).Unix(),
+	})
+}
+
+//Jobs get the registered scheduled jobs, ordered by name
+func Jobs() []Job {
+	mu.Lock()
+	defer mu.Unlock()
+
+	jobs := []Job{}
+	for _, sj := range scheduled {
+		job := Job{
+			Name:         sj.state.Name,
+			Schedule:     sj.state.Schedule,
+			NextRun:      time.Unix(sj.state.NextRunDateTime, 0),
+			LastDuration: time.Duration(sj.state.LastDuration) * time.Millisecond,
+			LastError:    sj.state.LastError,
+			Runs:         sj.state.Runs,
+			Failures:     sj.state.Failures,
+			Running:      sj.running,
+		}
+		if sj.state.LastRunDateTime > 0 {
+			job.LastRun = time.Unix(sj.state.LastRunDateTime, 0)
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+//Run runs jobs as they fall due until told to stop, then waits for those still running to finish
+func Run(stop *chan bool) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-*stop:
+			logging.Info("Waiting for running jobs to finish...")
+			Wait()
+			return
+		case now := <-ticker.C:
+			RunDue(now)
+		}
+	}
+}
+
+//RunDue starts every job due to run by now which isn't still running from when it was last due
+func RunDue(now time.Time) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for name, sj := range scheduled {
+		if sj.running || sj.state.NextRunDateTime > now.Unix() {
+			continue
+		}
+		sj.running = true
+		sj.state.NextRunDateTime = sj.schedule.Next(now).Unix()
+		running.Add(1)
+		go runScheduled(name, sj, now)
+	}
+
+	if !runningDeferred {
+		runningDeferred = true
+		running.Add(1)
+		go runDeferred(now)
+	}
+}
+
+//Wait blocks until the jobs which are running have finished
+func Wait() {
+	running.Wait()
+}
+
+//runScheduled runs sj, saving how it went
+func runScheduled(name string, sj *scheduledJob, now time.Time) {
+	defer running.Done()
+
+	started := time.Now()
+	err := safely(func() error { return sj.run(now) })
+	took := time.Since(started)
+
+	mu.Lock()
+	sj.running = false
+	sj.state.LastRunDateTime = started.Unix()
+	sj.state.LastDuration = int64(took / time.Millisecond)
+	sj.state.Runs++
+	if err != nil {
+		sj.state.Failures++
+		sj.state.LastError = err.Error()
+		logging.Error(fmt.Sprintf("Job %s failed -> %s", name, err.Error()))
+	} else {
+		sj.state.Failures = 0
+		sj.state.LastError = ""
+	}
+	state := *sj.state
+	mu.Unlock()
+
+	sjt := db.ScheduledJobsTable{}
+	if err := sjt.Update(db.Conn, &state); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//runDeferred runs the deferred jobs due by now, trying those which fail again later
+func runDeferred(now time.Time) {
+	defer func() {
+		mu.Lock()
+		runningDeferred = false
+		mu.Unlock()
+		running.Done()
+	}()
+
+	djt := db.DeferredJobsTable{}
+	due, err := djt.SelectDue(db.Conn, StatusQueued, now.Unix(), deferredBatchSize)
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	for _, dj := range due {
+		mu.Lock()
+		handler, ok := handlers[dj.Kind]
+		mu.Unlock()
+
+		err := fmt.Errorf("There's nothing to run deferred jobs of kind %s", dj.Kind)
+		if ok {
+			err = safely(func() error { return handler(dj.Payload) })
+		}
+		dj.Attempts++
+
+		switch {
+		case err == nil:
+			dj.Status = StatusDone
+			dj.FinishedDateTime = now.Unix()
+			dj.LastError = ""
+		case !ok || dj.Attempts >= MaxAttempts:
+			dj.Status = StatusFailed
+			dj.FinishedDateTime = now.Unix()
+			dj.LastError = err.Error()
+			logging.Error(fmt.Sprintf("Giving up running %s job %d after %d attempts -> %s", dj.Kind, dj.Deferredjobid, dj.Attempts, err.Error()))
+		default:
+			dj.RunDateTime = now.Add(util.Backoff(dj.Attempts, retryDelay, maxRetryDelay)).Unix()
+			dj.LastError = err.Error()
+			logging.Debug(fmt.Sprintf("Unable to run %s job %d, will try again -> %s", dj.Kind, dj.Deferredjobid, err.Error()))
+		}
+
+		if err := djt.Update(db.Conn, dj); err != nil {
+			logging.Error(err.Error())
+		}
+	}
+
+	if _, err := djt.DeleteFinishedBefore(db.Conn, StatusDone, now.Add(-doneRetention).Unix()); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//safely runs run, turning a panic into an error so one broken job can't take the server down
+func safely(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Job panicked -> %v", r)
+		}
+	}()
+	return run()
+}
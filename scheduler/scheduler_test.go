@@ -0,0 +1,138 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package scheduler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+)
+
+func init() {
+	db.Connect(db.SQLITE, "./berrycmstesting.db", "")
+	db.Wipe()
+	db.Setup()
+}
+
+//jobNamed get the registered scheduled job with name
+func jobNamed(t *testing.T, name string) Job {
+	for _, job := range Jobs() {
+		if job.Name == name {
+			return job
+		}
+	}
+	t.Fatalf("Expected job %s to be registered", name)
+	return Job{}
+}
+
+func TestScheduler(t *testing.T) {
+	runs := 0
+	if err := Every("testjob", "@every 1m", func(time.Time) error {
+		runs++
+		if runs == 2 {
+			return errors.New("Something went wrong")
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	RunDue(time.Now())
+	Wait()
+	if runs != 0 {
+		t.Fatalf("Expected a new job not to run until it's first due")
+	}
+
+	RunDue(time.Now().Add(time.Minute))
+	Wait()
+	RunDue(time.Now().Add(2 * time.Minute))
+	Wait()
+	if job := jobNamed(t, "testjob"); runs != 2 || job.Runs != 2 || job.Failures != 1 || job.LastError != "Something went wrong" {
+		t.Errorf("Expected job to have run twice, failing the second time, got %+v", job)
+	}
+
+	//a run missed while the server was down is caught up once it's registered again
+	sjt := db.ScheduledJobsTable{}
+	if _, err := db.Conn.Exec("UPDATE "+sjt.Name()+" SET nextrundatetime = ? WHERE jobname = ?", time.Now().Add(-time.Hour).Unix(), "testjob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Every("testjob", "@every 1m", func(time.Time) error {
+		runs++
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	RunDue(time.Now())
+	Wait()
+	if job := jobNamed(t, "testjob"); runs != 3 || job.Runs != 3 || job.Failures != 0 || !job.NextRun.After(time.Now()) {
+		t.Errorf("Expected missed run to be caught up once, got %+v", job)
+	}
+
+	if err := Every("panickingjob", "@every 1m", func(time.Time) error { panic("oops") }); err != nil {
+		t.Fatal(err)
+	}
+	RunDue(time.Now().Add(time.Minute))
+	Wait()
+	if job := jobNamed(t, "panickingjob"); job.Failures != 1 {
+		t.Errorf("Expected a panicking job to count as failing")
+	}
+}
+
+func TestDeferredJobs(t *testing.T) {
+	//deferred jobs are tried again until they work
+	payloads := []string{}
+	Handle("testkind", func(payload string) error {
+		payloads = append(payloads, payload)
+		if len(payloads) == 1 {
+			return errors.New("Not yet")
+		}
+		return nil
+	})
+	if err := Defer("testkind", "hello", 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := Defer("unknownkind", "", 0); err != nil {
+		t.Fatal(err)
+	}
+	RunDue(time.Now())
+	Wait()
+	djt := db.DeferredJobsTable{}
+	deferred, err := djt.SelectRecent(db.Conn, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dj := range deferred {
+		if dj.Kind == "testkind" && (dj.Status != StatusQueued || dj.RunDateTime < time.Now().Add(retryDelay).Unix()-1) {
+			t.Errorf("Expected failed deferred job to wait %s before it's tried again", retryDelay)
+		}
+	}
+
+	RunDue(time.Now().Add(2 * time.Minute))
+	Wait()
+	if deferred, err = djt.SelectRecent(db.Conn, 10); err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]string{}
+	for _, dj := range deferred {
+		statuses[dj.Kind] = dj.Status
+	}
+	if len(payloads) != 2 || payloads[1] != "hello" || statuses["testkind"] != StatusDone {
+		t.Errorf("Expected deferred job to run again after failing, got payloads %v and status %s", payloads, statuses["testkind"])
+	}
+	if statuses["unknownkind"] != StatusFailed {
+		t.Errorf("Expected deferred job nothing can run to fail")
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package shortcodes
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/tacusci/logging"
+)
+
+//maxDepth how deeply shortcodes can be nested inside each other before they're left unexpanded
+const maxDepth = 8
+
+//Shortcode a single use of a shortcode found in page content, eg., [recent-pages count=5]
+type Shortcode struct {
+	Name string
+	Args map[string]string
+	//Content the already expanded content between the opening and closing tags, blank if self closing
+	Content string
+	//Route of the page being rendered
+	Route string
+}
+
+//Arg get named argument, or fallback value if the argument wasn't given
+func (sc *Shortcode) Arg(name string, fallback string) string {
+	if val, ok := sc.Args[name]; ok {
+		return val
+	}
+	return fallback
+}
+
+//Func renders a shortcode into HTML
+type Func func(sc *Shortcode) (string, error)
+
+var (
+	mu      sync.RWMutex
+	builtin = map[string]Func{}
+	plugin  = map[string]Func{}
+)
+
+//Register adds shortcode implemented in Go, these can't be replaced by plugins
+func Register(name string, fn Func) {
+	mu.Lock()
+	defer mu.Unlock()
+	builtin[name] = fn
+}
+
+//RegisterPlugin adds shortcode implemented by a plugin, these are dropped by ResetPlugins
+func RegisterPlugin(name string, fn Func) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, exists := builtin[name]; exists {
+		return fmt.Errorf("Shortcode '%s' is built in and can't be replaced", name)
+	}
+	plugin[name] = fn
+	return nil
+}
+
+//ResetPlugins removes all shortcodes registered by plugins, ready for plugins to be reloaded
+func ResetPlugins() {
+	mu.Lock()
+	defer mu.Unlock()
+	plugin = map[string]Func{}
+}
+
+//Registered get names of all registered shortcodes
+func Registered() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	names := []string{}
+	for name := range builtin {
+		names = append(names, name)
+	}
+	for name := range plugin {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookup(name string) (Func, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if fn, ok := builtin[name]; ok {
+		return fn, true
+	}
+	fn, ok := plugin[name]
+	return fn, ok
+}
+
+//Expand replaces every registered shortcode in content with its rendered output, unknown shortcodes
+//are left as they are and '[[name]]' can be used to write out '[name]' literally
+func Expand(content string, route string) string {
+	return expand(content, route, 0)
+}
+
+func expand(content string, route string, depth int) string {
+	if depth > maxDepth || !strings.Contains(content, "[") {
+		return content
+	}
+
+	var out bytes.Buffer
+	i := 0
+	for i < len(content) {
+		start := strings.IndexByte(content[i:], '[')
+		if start < 0 {
+			out.WriteString(content[i:])
+			break
+		}
+		start += i
+		out.WriteString(content[i:start])
+
+		//escaped shortcode, write it out without one set of brackets
+		if strings.HasPrefix(content[start:], "[[") {
+			if end := strings.Index(content[start:], "]]"); end > 0 {
+				if _, _, ok := parseTag(content[start+2 : start+end]); ok {
+					out.WriteString(content[start+1 : start+end+1])
+					i = start + end + 2
+					continue
+				}
+			}
+		}
+
+		end := strings.IndexByte(content[start:], ']')
+		if end < 0 {
+			out.WriteString(content[start:])
+			break
+		}
+		end += start
+
+		name, args, ok := parseTag(content[start+1 : end])
+		if !ok {
+			out.WriteByte('[')
+			i = start + 1
+			continue
+		}
+
+		fn, registered := lookup(name)
+		if !registered {
+			out.WriteString(content[start : end+1])
+			i = end + 1
+			continue
+		}
+
+		sc := &Shortcode{Name: name, Args: args, Route: route}
+		i = end + 1
+
+		if innerEnd, closeEnd := findClosingTag(content, i, name); innerEnd >= 0 {
+			sc.Content = expand(content[i:innerEnd], route, depth+1)
+			i = closeEnd
+		}
+
+		rendered, err := fn(sc)
+		if err != nil {
+			logging.Error(fmt.Sprintf("Shortcode [%s] -> %s", name, err.Error()))
+			continue
+		}
+		out.WriteString(rendered)
+	}
+
+	return out.String()
+}
+
+//findClosingTag finds the closing tag for shortcode name opened before from, taking nested
+//shortcodes of the same name into account, returns -1 if it's self closing
+func findClosingTag(content string, from int, name string) (int, int) {
+	openTag := "[" + name
+	closeTag := "[/" + name + "]"
+	nested := 0
+
+	for i := from; i < len(content); {
+		next := strings.IndexByte(content[i:], '[')
+		if next < 0 {
+			break
+		}
+		i += next
+
+		if strings.HasPrefix(content[i:], closeTag) {
+			if nested == 0 {
+				return i, i + len(closeTag)
+			}
+			nested--
+			i += len(closeTag)
+			continue
+		}
+
+		if strings.HasPrefix(content[i:], openTag) && len(content) > i+len(openTag) {
+			if c := content[i+len(openTag)]; c == ']' || unicode.IsSpace(rune(c)) {
+				nested++
+			}
+		}
+		i++
+	}
+
+	return -1, -1
+}
+
+//parseTag parses the text between the brackets of a shortcode's opening tag into its name and arguments,
+//the content has usually been rendered to HTML by this point, so entities are decoded first
+func parseTag(tag string) (string, map[string]string, bool) {
+	tag = html.UnescapeString(tag)
+	if strings.ContainsAny(tag, "[]<>") {
+		return "", nil, false
+	}
+
+	tokens, ok := tokenise(tag)
+	if !ok || len(tokens) == 0 || !validName(tokens[0]) {
+		return "", nil, false
+	}
+
+	args := map[string]string{}
+	for _, token := range tokens[1:] {
+		if eq := strings.IndexByte(token, '='); eq > 0 {
+			args[token[:eq]] = unquote(token[eq+1:])
+		} else {
+			args[unquote(token)] = ""
+		}
+	}
+
+	return tokens[0], args, true
+}
+
+//tokenise splits tag on whitespace outside of quotes
+func tokenise(tag string) ([]string, bool) {
+	tokens := []string{}
+	var current strings.Builder
+	var quote rune
+
+	for _, r := range tag {
+		switch {
+		case quote != 0:
+			current.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			current.WriteRune(r)
+		case unicode.IsSpace(r):
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+
+	if quote != 0 {
+		return nil, false
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens, true
+}
+
+func unquote(val string) string {
+	if len(val) >= 2 && (val[0] == '"' || val[0] == '\'') && val[len(val)-1] == val[0] {
+		return val[1 : len(val)-1]
+	}
+	return val
+}
+
+//validName shortcode names start with a letter and only contain letters, digits, '-' and '_'
+func validName(name string) bool {
+	for i, r := range name {
+		if i == 0 && !unicode.IsLetter(r) {
+			return false
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return len(name) > 0
+}
@@ -1,110 +1,273 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
 package sitemap
 
 import (
-	"bytes"
+	"encoding/xml"
 	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/tacusci/berrycms/db"
 	"github.com/tacusci/berrycms/util"
 )
 
-var cache *bytes.Buffer
-var additionalRoutes *[]string
+const (
+	//MaxURLs most URLs the sitemap protocol allows in a single sitemap file
+	MaxURLs = 50000
+	//IndexName name of the file served at /sitemap.xml, an index of the other files once there are too many URLs for one
+	IndexName = "sitemap.xml"
 
-func Add(val *string) error {
-	if additionalRoutes == nil {
-		additionalRoutes = &[]string{}
+	namespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+//ChangeFreqs get the change frequencies allowed by the sitemap protocol
+func ChangeFreqs() []string {
+	return []string{"always", "hourly", "daily", "weekly", "monthly", "yearly", "never"}
+}
+
+//ValidChangeFreq checks whether freq is blank or one of the protocol's change frequencies
+func ValidChangeFreq(freq string) bool {
+	if len(freq) == 0 {
+		return true
+	}
+	for _, f := range ChangeFreqs() {
+		if f == freq {
+			return true
+		}
 	}
+	return false
+}
+
+//ValidPriority checks whether priority is blank or a number between 0.0 and 1.0
+func ValidPriority(priority string) bool {
+	if len(priority) == 0 {
+		return true
+	}
+	val, err := strconv.ParseFloat(priority, 64)
+	return err == nil && val >= 0 && val <= 1
+}
+
+var (
+	mu sync.Mutex
+	//entries every location in the sitemap relative to the site, nil until it's generated
+	entries          []entry
+	additionalRoutes []string
+)
+
+//Add includes route added by a plugin in the sitemap
+func Add(val *string) error {
+	mu.Lock()
+	defer mu.Unlock()
 
-	for _, v := range *additionalRoutes {
+	for _, v := range additionalRoutes {
 		if *val == v {
 			return nil
 		}
 	}
 
-	*additionalRoutes = append(*additionalRoutes, *val)
+	additionalRoutes = append(additionalRoutes, *val)
+	entries = nil
 
 	return nil
 }
 
+//Del removes route previously added by a plugin from the sitemap
 func Del(val *string) error {
-	if additionalRoutes == nil {
-		return nil
-	}
+	mu.Lock()
+	defer mu.Unlock()
 
-	*additionalRoutes = util.RemoveStringFromSlice(*additionalRoutes, *val)
+	additionalRoutes = util.RemoveStringFromSlice(additionalRoutes, *val)
+	entries = nil
 
 	return nil
 }
 
-func Generate(httpScheme string, urlDomainPrefix string) error {
-	Reset()
+type urlset struct {
+	XMLName xml.Name `xml:"urlset"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	URLs    []entry  `xml:"url"`
+}
 
-	if httpScheme == "" {
-		httpScheme = "http"
-	}
+type entry struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
 
-	_, err := cache.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<urlset xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">\n")
-	if err != nil {
-		return err
-	}
+type sitemapindex struct {
+	XMLName  xml.Name       `xml:"sitemapindex"`
+	XMLNS    string         `xml:"xmlns,attr"`
+	Sitemaps []indexedEntry `xml:"sitemap"`
+}
 
-	pt := db.PagesTable{}
-	rows, err := pt.Select(db.Conn, "route", "roleprotected = '0'")
+type indexedEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+//Generate collects the sitemap entries for every public page and plugin added route, their locations are
+//relative to the site so the sitemap can be served under whichever base URL it's requested from
+func Generate() error {
+	mu.Lock()
+	defer mu.Unlock()
 
+	pt := db.PagesTable{}
+	pages, err := pt.SelectPublic(db.Conn)
 	if err != nil {
 		return err
 	}
 
-	var pageRouteToAdd string
+	generated := []entry{}
+	listed := map[string]bool{}
 
-	for rows.Next() {
-		err := rows.Scan(&pageRouteToAdd)
-		if err != nil {
-			return err
+	for _, p := range pages {
+		if listed[p.Route] {
+			continue
 		}
+		listed[p.Route] = true
 
-		var alreadyExists bool
-		for _, v := range *additionalRoutes {
-			if pageRouteToAdd == v {
-				alreadyExists = true
-				break
-			}
+		e := entry{
+			Loc:        p.Route,
+			ChangeFreq: p.SitemapChangeFreq,
+			Priority:   p.SitemapPriority,
 		}
+		if modified := pageModified(p); !modified.IsZero() {
+			e.LastMod = modified.UTC().Format(time.RFC3339)
+		}
+		generated = append(generated, e)
+	}
 
-		if alreadyExists {
+	for _, route := range additionalRoutes {
+		if listed[route] {
 			continue
 		}
+		listed[route] = true
+		generated = append(generated, entry{Loc: route})
+	}
+
+	entries = generated
+
+	return nil
+}
+
+//File writes out the generated sitemap file with name, with each location under baseURL, eg., 'https://example.com',
+//a single urlset or once there are more than MaxURLs, numbered urlset files listed by a sitemap index
+func File(name string, baseURL string) ([]byte, bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if entries == nil {
+		return nil, false, nil
+	}
 
-		_, err = cache.WriteString(fmt.Sprintf("\t<url>\n\t\t<loc>%s://%s%s</loc>\n\t</url>\n", httpScheme, urlDomainPrefix, pageRouteToAdd))
-		if err != nil {
-			return err
+	if len(entries) <= MaxURLs {
+		if name != IndexName {
+			return nil, false, nil
 		}
+		data, err := marshal(urlset{XMLNS: namespace, URLs: absolute(entries, baseURL)})
+		return data, true, err
 	}
 
-	if additionalRoutes != nil {
-		for _, v := range *additionalRoutes {
-			_, err = cache.WriteString(fmt.Sprintf("\t<url>\n\t\t<loc>%s://%s%s</loc>\n\t</url>\n", httpScheme, urlDomainPrefix, v))
+	if name == IndexName {
+		index := sitemapindex{XMLNS: namespace}
+		for start, n := 0, 1; start < len(entries); start, n = start+MaxURLs, n+1 {
+			index.Sitemaps = append(index.Sitemaps, indexedEntry{Loc: fmt.Sprintf("%s/%s", baseURL, splitName(n)), LastMod: latestLastMod(split(n))})
 		}
+		data, err := marshal(index)
+		return data, true, err
 	}
 
-	cache.WriteString("</urlset>")
+	var n int
+	if _, err := fmt.Sscanf(name, "sitemap-%d.xml", &n); err != nil || name != splitName(n) || len(split(n)) == 0 {
+		return nil, false, nil
+	}
+	data, err := marshal(urlset{XMLNS: namespace, URLs: absolute(split(n), baseURL)})
+	return data, true, err
+}
 
-	return nil
+//splitName name of the nth numbered urlset file, counting from 1
+func splitName(n int) string {
+	return fmt.Sprintf("sitemap-%d.xml", n)
 }
 
-func CacheExists() bool {
-	return cache != nil
+//split the entries in the nth numbered urlset file, counting from 1
+func split(n int) []entry {
+	start := (n - 1) * MaxURLs
+	if n < 1 || start >= len(entries) {
+		return nil
+	}
+	end := start + MaxURLs
+	if end > len(entries) {
+		end = len(entries)
+	}
+	return entries[start:end]
+}
+
+//absolute copies of entries with their locations under baseURL
+func absolute(relative []entry, baseURL string) []entry {
+	absolute := make([]entry, len(relative))
+	for i, e := range relative {
+		e.Loc = baseURL + e.Loc
+		absolute[i] = e
+	}
+	return absolute
 }
 
-func CacheBytes() []byte {
-	return cache.Bytes()
+//latestLastMod get the most recent modification time of entries
+func latestLastMod(entries []entry) string {
+	latest := ""
+	for _, e := range entries {
+		//RFC3339 times in UTC compare in time order
+		if e.LastMod > latest {
+			latest = e.LastMod
+		}
+	}
+	return latest
 }
 
-func Reset() {
-	//we don't want to allocate memory each reset
-	if cache == nil {
-		cache = &bytes.Buffer{}
+func pageModified(p *db.Page) time.Time {
+	if p.ModifiedDateTime > 0 {
+		return time.Unix(p.ModifiedDateTime, 0)
+	}
+	if p.CreatedDateTime > 0 {
+		return time.Unix(p.CreatedDateTime, 0)
+	}
+	return time.Time{}
+}
+
+func marshal(doc interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(doc, "", "\t")
+	if err != nil {
+		return nil, err
 	}
-	cache.Reset()
+	return append([]byte(xml.Header), data...), nil
+}
+
+//CacheExists checks whether the sitemap has been generated since it was last reset
+func CacheExists() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return entries != nil
+}
+
+//Reset drops the generated sitemap so it's generated again on its next request
+func Reset() {
+	mu.Lock()
+	defer mu.Unlock()
+	entries = nil
 }
@@ -84,6 +84,15 @@ $(document).ready(function() {
       });
     }
   
+    // hidden field carrying the CSRF token the admin pages need with every form sent
+    function csrfField() {
+      var csrfField = document.createElement("input");
+      csrfField.setAttribute("type", "hidden");
+      csrfField.setAttribute("name", "csrftoken");
+      csrfField.setAttribute("value", $('meta[name="csrf-token"]').attr("content"));
+      return csrfField;
+    }
+
     $("#pagesdelete").click(function() {
 
       var pagesToDeleteUUIDs = [];
@@ -110,6 +119,7 @@ $(document).ready(function() {
             hiddenField.setAttribute("value", pagesToDeleteUUIDs[i]);
             form.appendChild(hiddenField);
           }
+          form.appendChild(csrfField());
           document.body.appendChild(form);
           form._submit_function_();
         }
@@ -140,6 +150,7 @@ $(document).ready(function() {
             hiddenField.setAttribute("value", usersToDeleteUUIDs[i]);
             form.appendChild(hiddenField);
           }
+          form.appendChild(csrfField());
           document.body.appendChild(form);
           form._submit_function_();
         }
@@ -170,6 +181,7 @@ $(document).ready(function() {
             hiddenField.setAttribute("value", groupsToDeleteUUIDs[i]);
             form.appendChild(hiddenField);
           }
+          form.appendChild(csrfField());
           document.body.appendChild(form);
           form._submit_function_();
         }
@@ -200,6 +212,7 @@ $(document).ready(function() {
             hiddenField.setAttribute("value", usesrToAddUUIDs[i]);
             form.appendChild(hiddenField);
           }
+          form.appendChild(csrfField());
           document.body.appendChild(form);
           form._submit_function_();
         }
@@ -230,6 +243,7 @@ $(document).ready(function() {
             hiddenField.setAttribute("value", usesrToRemoveUUIDs[i]);
             form.appendChild(hiddenField);
           }
+          form.appendChild(csrfField());
           document.body.appendChild(form);
           form._submit_function_();
         }
@@ -0,0 +1,235 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package themes
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//DefaultTheme name of the theme which is always available
+	DefaultTheme = "default"
+	//DefaultLayout name of the layout used when a page hasn't chosen one
+	DefaultLayout = "default"
+
+	themesDir     = "themes"
+	layoutsDir    = "layouts"
+	partialsDir   = "partials"
+	assetsDir     = "assets"
+	templateExt   = ".html"
+	activeSetting = "theme"
+)
+
+//fallbackLayout page shell used if not even the default theme can be loaded
+const fallbackLayout = "<html><head><link rel=\"stylesheet\" href=\"/css/berry-default.css\"><link rel=\"stylesheet\" href=\"/css/font.css\"></head><body><%= pagecontent %></body></html>"
+
+var (
+	mu          sync.Mutex
+	themesFS    fs.FS
+	activeTheme string
+)
+
+//Theme a directory containing layout templates, partials and assets
+type Theme struct {
+	Name string
+	fs   fs.FS
+}
+
+//SetFS sets the file system containing the 'themes' directory to load themes from
+func SetFS(fsys fs.FS) {
+	mu.Lock()
+	defer mu.Unlock()
+	themesFS = fsys
+	activeTheme = ""
+}
+
+//List get names of all installed themes
+func List() []string {
+	mu.Lock()
+	defer mu.Unlock()
+
+	names := []string{}
+	if themesFS == nil {
+		return names
+	}
+
+	entries, err := fs.ReadDir(themesFS, themesDir)
+	if err != nil {
+		logging.Error(err.Error())
+		return names
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+//Get loads named theme
+func Get(name string) (*Theme, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return get(name)
+}
+
+func get(name string) (*Theme, error) {
+	if themesFS == nil {
+		return nil, errors.New("Themes have not been loaded")
+	}
+
+	//theme names come from admin forms, never allow them to point outside of the themes dir
+	if len(name) == 0 || strings.ContainsAny(name, "/\\") || name == "." || name == ".." {
+		return nil, fmt.Errorf("Invalid theme name '%s'", name)
+	}
+
+	themeFS, err := fs.Sub(themesFS, path.Join(themesDir, name))
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := fs.Stat(themeFS, path.Join(layoutsDir, DefaultLayout+templateExt)); err != nil {
+		return nil, fmt.Errorf("Theme '%s' is missing its %s layout", name, DefaultLayout)
+	}
+
+	return &Theme{Name: name, fs: themeFS}, nil
+}
+
+//Active get the theme selected in the admin, falls back to the default theme
+func Active() *Theme {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(activeTheme) == 0 {
+		st := db.SettingsTable{}
+		name, err := st.Get(db.Conn, activeSetting, DefaultTheme)
+		if err != nil {
+			logging.Error(err.Error())
+		}
+		activeTheme = name
+	}
+
+	theme, err := get(activeTheme)
+	if err != nil {
+		logging.Error(err.Error())
+		theme, err = get(DefaultTheme)
+		if err != nil {
+			logging.Error(err.Error())
+			return &Theme{Name: DefaultTheme}
+		}
+	}
+
+	return theme
+}
+
+//SetActive makes named theme the active theme and saves the selection
+func SetActive(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err := get(name); err != nil {
+		return err
+	}
+
+	st := db.SettingsTable{}
+	if err := st.Set(db.Conn, activeSetting, name); err != nil {
+		return err
+	}
+
+	activeTheme = name
+	return nil
+}
+
+//Layouts get the names of all layouts this theme provides
+func (t *Theme) Layouts() []string {
+	if t.fs == nil {
+		return []string{DefaultLayout}
+	}
+
+	names := []string{}
+	entries, err := fs.ReadDir(t.fs, layoutsDir)
+	if err != nil {
+		return names
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), templateExt) {
+			names = append(names, strings.TrimSuffix(entry.Name(), templateExt))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+//Layout reads named layout template, falls back to the default layout if the theme doesn't have it
+func (t *Theme) Layout(name string) (string, error) {
+	if t.fs == nil {
+		return fallbackLayout, nil
+	}
+
+	if len(name) == 0 || strings.ContainsAny(name, "/\\") {
+		name = DefaultLayout
+	}
+
+	data, err := fs.ReadFile(t.fs, path.Join(layoutsDir, name+templateExt))
+	if err != nil && name != DefaultLayout {
+		data, err = fs.ReadFile(t.fs, path.Join(layoutsDir, DefaultLayout+templateExt))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+//Partial reads named partial template, suitable for use as plush's 'partialFeeder'
+func (t *Theme) Partial(name string) (string, error) {
+	if t.fs == nil {
+		return "", fmt.Errorf("Partial %s not found", name)
+	}
+
+	if !strings.HasSuffix(name, templateExt) {
+		name += templateExt
+	}
+
+	data, err := fs.ReadFile(t.fs, path.Join(partialsDir, path.Clean("/"+name)))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+//Assets get the file system of the theme's static assets
+func (t *Theme) Assets() (fs.FS, error) {
+	if t.fs == nil {
+		return nil, errors.New("Theme has no assets")
+	}
+	if _, err := fs.Stat(t.fs, assetsDir); err != nil {
+		return nil, err
+	}
+	return fs.Sub(t.fs, assetsDir)
+}
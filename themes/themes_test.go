@@ -0,0 +1,175 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package themes
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/tacusci/berrycms/db"
+)
+
+func init() {
+	db.Connect(db.SQLITE, "./berrycmstesting.db", "")
+	db.Wipe()
+	db.Setup()
+}
+
+//testThemes a default theme with two layouts and partials, a custom theme with only its default layout
+//and assets, and a broken theme which is missing its default layout
+var testThemes = fstest.MapFS{
+	"themes/default/layouts/default.html":  {Data: []byte("  <%= partial(\"base.html\") %>\n")},
+	"themes/default/layouts/bare.html":     {Data: []byte("<%= pagecontent %>")},
+	"themes/default/partials/base.html":    {Data: []byte("<html><%= partial(\"head\") %></html>")},
+	"themes/default/partials/head.html":    {Data: []byte("<head></head>")},
+	"themes/custom/layouts/default.html":   {Data: []byte("custom")},
+	"themes/custom/assets/css/custom.css":  {Data: []byte("body {}")},
+	"themes/broken/partials/anything.html": {Data: []byte("broken")},
+}
+
+func TestLayouts(t *testing.T) {
+	SetFS(testThemes)
+	defer SetFS(nil)
+
+	if names := List(); len(names) != 3 || names[0] != "broken" || names[1] != "custom" || names[2] != DefaultTheme {
+		t.Errorf("Expected every theme directory to be listed in order, got %v", names)
+	}
+
+	theme, err := Get(DefaultTheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layouts := theme.Layouts(); len(layouts) != 2 || layouts[0] != "bare" || layouts[1] != DefaultLayout {
+		t.Errorf("Expected the default theme's two layouts, got %v", layouts)
+	}
+
+	tests := []struct {
+		layout string
+		want   string
+	}{
+		{"bare", "<%= pagecontent %>"},
+		{"", "<%= partial(\"base.html\") %>"},
+		{"missing", "<%= partial(\"base.html\") %>"},
+		{"../custom/layouts/default", "<%= partial(\"base.html\") %>"},
+	}
+	for _, test := range tests {
+		layout, err := theme.Layout(test.layout)
+		if err != nil {
+			t.Errorf("Unable to read layout %q -> %s", test.layout, err.Error())
+			continue
+		}
+		if layout != test.want {
+			t.Errorf("Layout %q should be %q, got %q", test.layout, test.want, layout)
+		}
+	}
+
+	for _, name := range []string{"", "..", "../themes", "missing", "broken"} {
+		if _, err := Get(name); err == nil {
+			t.Errorf("Expected theme %q not to load", name)
+		}
+	}
+}
+
+func TestPartials(t *testing.T) {
+	SetFS(testThemes)
+	defer SetFS(nil)
+
+	theme, err := Get(DefaultTheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"head", "head.html", "../head", "/head"} {
+		partial, err := theme.Partial(name)
+		if err != nil {
+			t.Errorf("Unable to read partial %q -> %s", name, err.Error())
+			continue
+		}
+		if partial != "<head></head>" {
+			t.Errorf("Partial %q should be the head partial, got %q", name, partial)
+		}
+	}
+
+	for _, name := range []string{"missing", "../layouts/bare"} {
+		if _, err := theme.Partial(name); err == nil {
+			t.Errorf("Expected partial %q not to be found", name)
+		}
+	}
+
+	custom, err := Get("custom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets, err := custom.Assets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := fs.ReadFile(assets, "css/custom.css"); err != nil || string(data) != "body {}" {
+		t.Errorf("Expected the custom theme's stylesheet in its assets, got %q", data)
+	}
+	if _, err := theme.Assets(); err == nil {
+		t.Error("Expected the default theme to have no assets")
+	}
+}
+
+func TestActiveFallback(t *testing.T) {
+	SetFS(testThemes)
+	defer SetFS(nil)
+
+	if active := Active(); active.Name != DefaultTheme {
+		t.Errorf("Expected the default theme to be active before one is chosen, got %s", active.Name)
+	}
+
+	if err := SetActive("broken"); err == nil {
+		t.Error("Expected a theme missing its default layout not to be made active")
+	}
+	if err := SetActive("custom"); err != nil {
+		t.Fatal(err)
+	}
+	if active := Active(); active.Name != "custom" {
+		t.Errorf("Expected the chosen theme to be active, got %s", active.Name)
+	}
+
+	//the chosen theme is removed, eg., from the override directory, while it's still selected
+	withoutCustom := fstest.MapFS{}
+	for name, file := range testThemes {
+		if name != "themes/custom/layouts/default.html" {
+			withoutCustom[name] = file
+		}
+	}
+	SetFS(withoutCustom)
+	if active := Active(); active.Name != DefaultTheme {
+		t.Errorf("Expected the default theme once the chosen one can't be loaded, got %s", active.Name)
+	}
+
+	//not even the default theme can be loaded so pages are still rendered with the built in shell
+	SetFS(fstest.MapFS{})
+	active := Active()
+	if active.Name != DefaultTheme {
+		t.Errorf("Expected the default theme's name without any themes, got %s", active.Name)
+	}
+	if layout, err := active.Layout("bare"); err != nil || layout != fallbackLayout {
+		t.Errorf("Expected the fallback layout without any themes, got %q", layout)
+	}
+	if layouts := active.Layouts(); len(layouts) != 1 || layouts[0] != DefaultLayout {
+		t.Errorf("Expected only the default layout without any themes, got %v", layouts)
+	}
+
+	st := db.SettingsTable{}
+	if err := st.Set(db.Conn, activeSetting, DefaultTheme); err != nil {
+		t.Fatal(err)
+	}
+}
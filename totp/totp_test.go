@@ -0,0 +1,133 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package totp
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+//rfcSecret the SHA1 secret from RFC 6238 appendix B, "12345678901234567890", base32 encoded
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+//rfcVectors the SHA1 test vectors from RFC 6238 appendix B, their 8 digit codes cut to the last 6 digits
+var rfcVectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "287082"},
+	{1111111109, "081804"},
+	{1111111111, "050471"},
+	{1234567890, "005924"},
+	{2000000000, "279037"},
+	{20000000000, "353130"},
+}
+
+func TestCodeAt(t *testing.T) {
+	for _, vector := range rfcVectors {
+		code, err := CodeAt(rfcSecret, vector.unix/Period)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != vector.code {
+			t.Errorf("Code at %d should be %s, got %s", vector.unix, vector.code, code)
+		}
+
+		//secrets are often typed in lower case, spaced out or with padding
+		typed := strings.ToLower(rfcSecret[:8]) + " " + rfcSecret[8:] + "===="
+		if code, err := Code(typed, time.Unix(vector.unix, 0)); err != nil || code != vector.code {
+			t.Errorf("Code at %d for the typed secret should be %s, got %s", vector.unix, vector.code, code)
+		}
+	}
+
+	if _, err := CodeAt("not base32!", 1); err == nil {
+		t.Error("Expected a secret which isn't base32 to fail")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	tests := []struct {
+		offset int64
+		valid  bool
+	}{
+		{-2, false},
+		{-1, true},
+		{0, true},
+		{1, true},
+		{2, false},
+	}
+	for _, test := range tests {
+		code, err := CodeAt(rfcSecret, step+test.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matched, valid := Validate(rfcSecret, code, now)
+		if valid != test.valid {
+			t.Errorf("Code from %d steps away should be valid %t, got %t", test.offset, test.valid, valid)
+			continue
+		}
+		//the step matched is returned so a code can't be used again within the window
+		if valid && matched != step+test.offset {
+			t.Errorf("Code from %d steps away should match step %d, got %d", test.offset, step+test.offset, matched)
+		}
+	}
+
+	code, _ := CodeAt(rfcSecret, step)
+	if matched, valid := Validate(rfcSecret, code[:3]+" "+code[3:], now); !valid || matched != step {
+		t.Error("Expected a code typed with a space to be valid")
+	}
+	for _, wrong := range []string{"", "12345", "1234567", "abcdef"} {
+		if _, valid := Validate(rfcSecret, wrong, now); valid {
+			t.Errorf("Expected code %q to be invalid", wrong)
+		}
+	}
+
+	//the same code is valid for its whole step, the step returned is what stops it being reused
+	stepStart := time.Unix(step*Period, 0)
+	first, _ := Validate(rfcSecret, code, stepStart)
+	second, _ := Validate(rfcSecret, code, stepStart.Add((Period-1)*time.Second))
+	if first != step || second != step {
+		t.Errorf("Expected the same code used twice in a step to match the same step, got %d and %d", first, second)
+	}
+}
+
+func TestGenerateSecretAndURI(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := decodeSecret(secret); err != nil || len(key) != secretSize {
+		t.Fatalf("Expected a %d byte base32 secret, got %q", secretSize, secret)
+	}
+	if another, _ := GenerateSecret(); another == secret {
+		t.Error("Expected each secret to be random")
+	}
+
+	uri, err := url.Parse(URI("berrycms", "jane doe", secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/berrycms:jane doe" {
+		t.Errorf("Expected an otpauth TOTP URI labelled with the issuer and account, got %s", uri.String())
+	}
+	if query := uri.Query(); query.Get("secret") != secret || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("Expected the URI to hold the secret, digits and period, got %s", uri.RawQuery)
+	}
+}
@@ -15,6 +15,8 @@
 package util
 
 import (
+	"time"
+
 	"github.com/schollz/progressbar"
 )
 
@@ -38,3 +40,16 @@ func RemoveDuplicates(elements []string) []string {
 	}
 	return result
 }
+
+//Backoff how long to wait before trying something again which has failed attempts times, starting
+//at first and doubling after each attempt up to max
+func Backoff(attempts int, first time.Duration, max time.Duration) time.Duration {
+	delay := first
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		return max
+	}
+	return delay
+}
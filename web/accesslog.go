@@ -0,0 +1,183 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/tacusci/berrycms/accesslog"
+	"github.com/tacusci/logging"
+)
+
+//redacted what secrets in logged URIs are replaced with
+const redacted = "REDACTED"
+
+//sensitivePathPrefixes paths whose next segment is a secret, such as the token in a password reset link
+var sensitivePathPrefixes = []string{"/login/reset/"}
+
+//sensitiveQueryParams query parameters which hold secrets, such as the code and state an OIDC provider redirects back with
+var sensitiveQueryParams = map[string]bool{"code": true, "state": true}
+
+//redactURI blanks out the secrets in uri so they aren't kept in the access log, leaving the rest as it is
+func redactURI(uri string) string {
+	path, query, hasQuery := uri, "", false
+	if i := strings.Index(uri, "?"); i >= 0 {
+		path, query, hasQuery = uri[:i], uri[i+1:], true
+	}
+
+	for _, prefix := range sensitivePathPrefixes {
+		if i := strings.Index(path, prefix); i >= 0 {
+			start := i + len(prefix)
+			end := len(path)
+			if j := strings.Index(path[start:], "/"); j >= 0 {
+				end = start + j
+			}
+			if end > start {
+				path = path[:start] + redacted + path[end:]
+			}
+		}
+	}
+
+	if !hasQuery {
+		return path
+	}
+
+	//the query's rewritten a parameter at a time so the others are logged in the order they were sent
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name := param
+		if j := strings.Index(param, "="); j >= 0 {
+			name = param[:j]
+		}
+		if unescaped, err := url.QueryUnescape(name); err == nil && sensitiveQueryParams[unescaped] {
+			params[i] = name + "=" + redacted
+		}
+	}
+	return path + "?" + strings.Join(params, "&")
+}
+
+//ActivityLogMiddleware writes an entry to the access log for each request once it's been responded to
+type ActivityLogMiddleware struct {
+	Router *MutableRouter
+	Logger *accesslog.Logger
+}
+
+//Middleware attaches http handler to middleware
+func (alm *ActivityLogMiddleware) Middleware(next http.Handler) http.Handler {
+	if alm.Logger == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		aw := &accessLogResponseWriter{ResponseWriter: w}
+
+		next.ServeHTTP(aw, r)
+
+		status := aw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		alm.Logger.Log(&accesslog.Entry{
+			Time:       started,
+			RemoteAddr: clientIP(r),
+			Method:     r.Method,
+			URI:        redactURI(r.RequestURI),
+			Protocol:   r.Proto,
+			Status:     status,
+			Size:       aw.size,
+			Duration:   time.Since(started),
+			Referer:    redactURI(r.Referer()),
+			UserAgent:  r.UserAgent(),
+		})
+	})
+}
+
+//accessLogResponseWriter notes the status and number of bytes of the response sent to the client
+type accessLogResponseWriter struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (aw *accessLogResponseWriter) WriteHeader(code int) {
+	if aw.status == 0 {
+		aw.status = code
+	}
+	aw.ResponseWriter.WriteHeader(code)
+}
+
+func (aw *accessLogResponseWriter) Write(data []byte) (int, error) {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+	n, err := aw.ResponseWriter.Write(data)
+	aw.size += int64(n)
+	return n, err
+}
+
+//Flush sends anything buffered to the client, implements http.Flusher
+func (aw *accessLogResponseWriter) Flush() {
+	if flusher, ok := aw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+//Unwrap get the response writer being wrapped
+func (aw *accessLogResponseWriter) Unwrap() http.ResponseWriter { return aw.ResponseWriter }
+
+//openActivityLog opens the access log if it's turned on, reusing the one already open unless its options have changed
+func (mr *MutableRouter) openActivityLog() *accesslog.Logger {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if mr.activityLog != nil && mr.activityLog.Options() == mr.ActivityLog {
+		return mr.activityLog
+	}
+
+	previous := mr.activityLog
+	mr.activityLog = nil
+	if len(mr.ActivityLog.Path) > 0 {
+		logger, err := accesslog.New(mr.ActivityLog)
+		if err != nil {
+			logging.Error(fmt.Sprintf("Unable to open access log %s -> %s", mr.ActivityLog.Path, err.Error()))
+		} else {
+			mr.activityLog = logger
+		}
+	}
+
+	if previous != nil {
+		if err := previous.Close(); err != nil {
+			logging.Error(fmt.Sprintf("Unable to close access log %s -> %s", previous.Options().Path, err.Error()))
+		}
+	}
+	return mr.activityLog
+}
+
+//CloseActivityLog writes out any access log entries being held and closes the file
+func (mr *MutableRouter) CloseActivityLog() error {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	if mr.activityLog == nil {
+		return nil
+	}
+	err := mr.activityLog.Close()
+	mr.activityLog = nil
+	return err
+}
@@ -0,0 +1,224 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/accesslog"
+)
+
+//serveLogged sends a request from remoteAddr through the access log middleware to a handler
+//which responds with status and body, returning what was logged
+func serveLogged(t *testing.T, opts accesslog.Options, remoteAddr string, status int, body string) string {
+	logger, err := accesslog.New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alm := ActivityLogMiddleware{Logger: logger}
+	handler := alm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+
+	req := httptest.NewRequest("GET", "/blog?page=2", nil)
+	req.RemoteAddr = remoteAddr
+	req.Header.Set("Referer", "https://example.com/")
+	req.Header.Set("User-Agent", `berry "test" agent`)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	logged, err := ioutil.ReadFile(opts.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(logged)
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	dir := t.TempDir()
+
+	combined := serveLogged(t, accesslog.Options{Path: filepath.Join(dir, "combined.log"), Format: accesslog.FormatCombined}, "203.0.113.7:4242", http.StatusNotFound, "missing")
+	for _, want := range []string{"203.0.113.7 - - [", `"GET /blog?page=2 HTTP/1.1" 404 7 "https://example.com/" "berry \"test\" agent"`} {
+		if !strings.Contains(combined, want) {
+			t.Errorf("Combined log line %q doesn't contain %q", combined, want)
+		}
+	}
+	if strings.Count(combined, "\n") != 1 {
+		t.Errorf("Combined log should have one line, got %q", combined)
+	}
+
+	common := serveLogged(t, accesslog.Options{Path: filepath.Join(dir, "common.log"), Format: accesslog.FormatCommon}, "203.0.113.7:4242", http.StatusNoContent, "")
+	if !strings.HasSuffix(common, `"GET /blog?page=2 HTTP/1.1" 204 -`+"\n") {
+		t.Errorf("Common log line %q should end with the request, status and no size", common)
+	}
+
+	jsonLine := serveLogged(t, accesslog.Options{Path: filepath.Join(dir, "json.log"), Format: accesslog.FormatJSON, Anonymise: true}, "[2001:db8:85a3:8d3:1319:8a2e:370:7348]:4242", http.StatusOK, "hello")
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(jsonLine), &entry); err != nil {
+		t.Fatalf("JSON log line %q doesn't parse -> %s", jsonLine, err.Error())
+	}
+	if entry["remoteaddr"] != "2001:db8:85a3::" {
+		t.Errorf("Expected anonymised IPv6 address 2001:db8:85a3::, got %v", entry["remoteaddr"])
+	}
+	if entry["status"] != float64(200) || entry["size"] != float64(5) || entry["uri"] != "/blog?page=2" {
+		t.Errorf("JSON log line has the wrong request details %q", jsonLine)
+	}
+
+	if anonymised := accesslog.AnonymiseIP("198.51.100.23"); anonymised != "198.51.100.0" {
+		t.Errorf("Expected anonymised IPv4 address 198.51.100.0, got %s", anonymised)
+	}
+}
+
+func TestAccessLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	logger, err := accesslog.New(accesslog.Options{Path: path, Format: accesslog.FormatCommon, MaxSize: 200, Keep: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//files next to the log which aren't rotated logs are never removed
+	unrelated := []string{path + ".bak", path + ".old", path + ".20190601-120000.gz", path + ".20190601-120000-x"}
+	isUnrelated := map[string]bool{}
+	for _, p := range unrelated {
+		if err := ioutil.WriteFile(p, []byte("keep me"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		isUnrelated[p] = true
+	}
+
+	now := time.Now()
+	for i := 0; i < 20; i++ {
+		logger.Log(&accesslog.Entry{Time: now.Add(time.Duration(i) * time.Second), RemoteAddr: "192.0.2.1", Method: "GET", URI: "/", Protocol: "HTTP/1.1", Status: 200, Size: 10})
+	}
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := []string{}
+	for _, p := range matches {
+		if !isUnrelated[p] {
+			rotated = append(rotated, p)
+		}
+	}
+	if len(rotated) != 2 {
+		t.Errorf("Expected 2 rotated logs to be kept, got %d: %v", len(rotated), rotated)
+	}
+	for _, p := range append(rotated, path) {
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 200 {
+			t.Errorf("Log %s is %d bytes, bigger than the 200 it should be rotated at", p, len(data))
+		}
+	}
+
+	for _, p := range unrelated {
+		if _, err := os.Stat(p); err != nil {
+			t.Errorf("Expected %s not to be removed with the oldest rotated logs", p)
+		}
+	}
+
+	//a log carried over from before the rotation interval started is rotated by the first entry after it
+	timed := filepath.Join(t.TempDir(), "timed.log")
+	logger, err = accesslog.New(accesslog.Options{Path: timed, Format: accesslog.FormatCommon, RotateEvery: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &accesslog.Entry{Time: now, RemoteAddr: "192.0.2.1", Method: "GET", URI: "/", Protocol: "HTTP/1.1", Status: 200}
+	logger.Log(entry)
+	entry.Time = now.Add(2 * time.Hour)
+	logger.Log(entry)
+	logger.Close()
+	if rotated, _ := filepath.Glob(timed + ".*"); len(rotated) != 1 {
+		t.Errorf("Expected the log to be rotated once after an hour, got %v", rotated)
+	}
+}
+
+func TestAccessLogRedaction(t *testing.T) {
+	tests := []struct {
+		uri      string
+		expected string
+	}{
+		{"/blog?page=2", "/blog?page=2"},
+		{"/login/reset/abc123", "/login/reset/REDACTED"},
+		{"/hidden/login/reset/abc123?next=%2Fadmin", "/hidden/login/reset/REDACTED?next=%2Fadmin"},
+		{"/login/reset/", "/login/reset/"},
+		{"/login/oidc/google/callback?state=s3cr3t&code=abc&scope=openid", "/login/oidc/google/callback?state=REDACTED&code=REDACTED&scope=openid"},
+		{"/search?q=code&codes=1&%63ode=abc", "/search?q=code&codes=1&%63ode=REDACTED"},
+		{"/search?code", "/search?code=REDACTED"},
+		{"https://example.com/login/reset/abc123", "https://example.com/login/reset/REDACTED"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if uri := redactURI(test.uri); uri != test.expected {
+			t.Errorf("Expected %q to be logged as %q, got %q", test.uri, test.expected, uri)
+		}
+	}
+
+	//the token's redacted from the page it's sent from too
+	path := filepath.Join(t.TempDir(), "access.log")
+	logger, err := accesslog.New(accesslog.Options{Path: path, Format: accesslog.FormatCombined})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alm := ActivityLogMiddleware{Logger: logger}
+	req := httptest.NewRequest("POST", "/login/reset/abc123", nil)
+	req.Header.Set("Referer", "https://example.com/login/reset/abc123")
+	alm.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(httptest.NewRecorder(), req)
+	if err := logger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	logged, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(logged), "abc123") || !strings.Contains(string(logged), `"POST /login/reset/REDACTED HTTP/1.1" 200 - "https://example.com/login/reset/REDACTED"`) {
+		t.Errorf("Expected the reset token to be redacted from the log, got %q", logged)
+	}
+}
+
+func TestAccessLogOff(t *testing.T) {
+	alm := ActivityLogMiddleware{}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	handler := alm.Middleware(next)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected requests to pass straight through with no access log, got %d", recorder.Code)
+	}
+
+	mr := &MutableRouter{}
+	if logger := mr.openActivityLog(); logger != nil {
+		t.Error("Expected no access log to be opened without a path")
+	}
+}
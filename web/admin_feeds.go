@@ -0,0 +1,112 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/feeds"
+	"github.com/tacusci/logging"
+)
+
+//feedSlugPattern feed slugs become part of the feed's URI
+var feedSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+//AdminFeedsHandler lists the configured feed collections and creates new ones
+type AdminFeedsHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (afh *AdminFeedsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	ft := db.FeedsTable{}
+	collections, err := ft.SelectAll(db.Conn)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("title", "Feeds")
+	pctx.Set("adminhiddenpassword", "")
+	pctx.Set("quillenabled", false)
+	pctx.Set("feeds", collections)
+	pctx.Set("feedsdisabled", afh.Router.disabled(&afh.Router.NoFeeds))
+	pctx.Set("defaultitemcount", DefaultFeedItemCount)
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("deleteroute", "/admin/feeds/delete")
+	if afh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", afh.Router.AdminHiddenPassword))
+		pctx.Set("deleteroute", fmt.Sprintf("/%s/admin/feeds/delete", afh.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.feeds.html", pctx)
+}
+
+//Post handles post requests to URI
+func (afh *AdminFeedsHandler) Post(w http.ResponseWriter, r *http.Request) {
+	defer http.Redirect(w, r, r.RequestURI, http.StatusFound)
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	itemCount, err := strconv.Atoi(r.PostFormValue("itemcount"))
+	if err != nil || itemCount < 1 {
+		itemCount = DefaultFeedItemCount
+	}
+
+	feedToCreate := &db.Feed{
+		CreatedDateTime: time.Now().Unix(),
+		Slug:            r.PostFormValue("slug"),
+		Title:           r.PostFormValue("title"),
+		RoutePrefix:     r.PostFormValue("routeprefix"),
+		Tag:             strings.ToLower(strings.TrimSpace(r.PostFormValue("tag"))),
+		ItemCount:       itemCount,
+	}
+
+	if !feedSlugPattern.MatchString(feedToCreate.Slug) {
+		logging.Error(fmt.Sprintf("Invalid feed slug '%s', only lower case letters, digits and '-' are allowed", feedToCreate.Slug))
+		return
+	}
+
+	ft := db.FeedsTable{}
+	if err := ft.Insert(db.Conn, feedToCreate); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	feeds.Reset()
+	//the new feed needs advertising in rendered pages
+	afh.Router.Reload()
+}
+
+//Route get URI route for handler
+func (afh *AdminFeedsHandler) Route() string { return afh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (afh *AdminFeedsHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (afh *AdminFeedsHandler) HandlesPost() bool { return true }
@@ -0,0 +1,65 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/feeds"
+	"github.com/tacusci/logging"
+)
+
+//AdminFeedsDeleteHandler deletes feed collections
+type AdminFeedsDeleteHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (afdh *AdminFeedsDeleteHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (afdh *AdminFeedsDeleteHandler) Post(w http.ResponseWriter, r *http.Request) {
+	var redirectURI = "/admin/feeds"
+	if afdh.Router.AdminHidden {
+		redirectURI = fmt.Sprintf("/%s", afdh.Router.AdminHiddenPassword) + redirectURI
+	}
+	defer http.Redirect(w, r, redirectURI, http.StatusFound)
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	ft := db.FeedsTable{}
+	if _, err := ft.DeleteBySlug(db.Conn, r.PostFormValue("slug")); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	feeds.Reset()
+	afdh.Router.Reload()
+}
+
+//Route get URI route for handler
+func (afdh *AdminFeedsDeleteHandler) Route() string { return afdh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (afdh *AdminFeedsDeleteHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (afdh *AdminFeedsDeleteHandler) HandlesPost() bool { return true }
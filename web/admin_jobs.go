@@ -0,0 +1,128 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/scheduler"
+)
+
+//deferredJobsListed most recent deferred jobs shown in the jobs list
+const deferredJobsListed = 50
+
+//AdminJobsHandler lists the background jobs, when they last ran, when they're next due and whether they failed, only root can
+type AdminJobsHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//jobListing a scheduled job as shown in the jobs list
+type jobListing struct {
+	Name      string
+	Schedule  string
+	LastRun   string
+	Took      string
+	NextRun   string
+	Runs      string
+	Failures  string
+	LastError string
+	Failing   bool
+}
+
+//deferredJobListing a deferred job as shown in the jobs list
+type deferredJobListing struct {
+	Kind      string
+	Status    string
+	Due       string
+	Attempts  string
+	LastError string
+}
+
+//Get handles get requests to URI
+func (ajh *AdminJobsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !loggedInAsRoot(r) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	jobs := []jobListing{}
+	for _, job := range scheduler.Jobs() {
+		listing := jobListing{
+			Name:      job.Name,
+			Schedule:  job.Schedule,
+			LastRun:   "Never",
+			Took:      job.LastDuration.String(),
+			NextRun:   UnixToTimeString(job.NextRun.Unix()),
+			Runs:      strconv.Itoa(job.Runs),
+			Failures:  strconv.Itoa(job.Failures),
+			LastError: job.LastError,
+			Failing:   job.Failures > 0,
+		}
+		if !job.LastRun.IsZero() {
+			listing.LastRun = UnixToTimeString(job.LastRun.Unix())
+		}
+		if job.Running {
+			listing.NextRun = "Running now"
+		}
+		jobs = append(jobs, listing)
+	}
+
+	djt := db.DeferredJobsTable{}
+	deferred, err := djt.SelectRecent(db.Conn, deferredJobsListed)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	deferredJobs := []deferredJobListing{}
+	for _, dj := range deferred {
+		due := dj.RunDateTime
+		if dj.Status != scheduler.StatusQueued {
+			due = dj.FinishedDateTime
+		}
+		deferredJobs = append(deferredJobs, deferredJobListing{
+			Kind:      dj.Kind,
+			Status:    dj.Status,
+			Due:       UnixToTimeString(due),
+			Attempts:  strconv.Itoa(dj.Attempts),
+			LastError: dj.LastError,
+		})
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("title", "Jobs")
+	pctx.Set("adminhiddenpassword", adminRoutePrefix(ajh.Router))
+	pctx.Set("quillenabled", false)
+	pctx.Set("jobs", jobs)
+	pctx.Set("deferredjobs", deferredJobs)
+
+	RenderDefault(w, "admin.jobs.html", pctx)
+}
+
+//Post handles post requests to URI
+func (ajh *AdminJobsHandler) Post(w http.ResponseWriter, r *http.Request) {}
+
+//Route get URI route for handler
+func (ajh *AdminJobsHandler) Route() string { return ajh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ajh *AdminJobsHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ajh *AdminJobsHandler) HandlesPost() bool { return false }
@@ -0,0 +1,207 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/oidc"
+	"github.com/tacusci/logging"
+)
+
+//providerSlugPattern provider slugs become part of their sign in URIs
+var providerSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+//AdminOIDCHandler lists, creates and edits the OpenID Connect providers users can sign in with, only root can
+type AdminOIDCHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (aoh *AdminOIDCHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if !loggedInAsRoot(r) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+	aoh.render(w, r, nil, nil)
+}
+
+//Post handles post requests to URI
+func (aoh *AdminOIDCHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if !loggedInAsRoot(r) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+		return
+	}
+
+	opt := db.OIDCProvidersTable{}
+
+	draft := &db.OIDCProvider{
+		Slug:          strings.TrimSpace(r.PostFormValue("slug")),
+		Title:         strings.TrimSpace(r.PostFormValue("title")),
+		Issuer:        strings.TrimRight(strings.TrimSpace(r.PostFormValue("issuer")), "/"),
+		ClientID:      strings.TrimSpace(r.PostFormValue("clientid")),
+		ClientSecret:  r.PostFormValue("clientsecret"),
+		Scopes:        strings.Join(strings.Fields(strings.Replace(r.PostFormValue("scopes"), ",", " ", -1)), " "),
+		GroupsClaim:   strings.TrimSpace(r.PostFormValue("groupsclaim")),
+		GroupMappings: strings.TrimSpace(r.PostFormValue("groupmappings")),
+		RoleMappings:  strings.TrimSpace(r.PostFormValue("rolemappings")),
+		DefaultRole:   int(db.REG_USER),
+		Enabled:       r.PostFormValue("enabled") == "on",
+	}
+	if r.PostFormValue("defaultrole") == "mod" {
+		draft.DefaultRole = int(db.MOD_USER)
+	}
+
+	existing, err := opt.SelectBySlug(db.Conn, draft.Slug)
+	editing := r.PostFormValue("action") == "save" && err == nil
+	if editing {
+		draft.Oidcproviderid = existing.Oidcproviderid
+		draft.CreatedDateTime = existing.CreatedDateTime
+		//the secret isn't shown again, leaving it blank keeps the saved one
+		if len(draft.ClientSecret) == 0 {
+			draft.ClientSecret = existing.ClientSecret
+		}
+	}
+
+	problems := validateOIDCProvider(draft)
+	if !editing && err == nil {
+		problems = append(problems, fmt.Sprintf("A provider with slug '%s' already exists", draft.Slug))
+	}
+	if len(problems) > 0 {
+		aoh.render(w, r, draft, problems)
+		return
+	}
+
+	if editing {
+		err = opt.Update(db.Conn, draft)
+	} else if r.PostFormValue("action") == "create" {
+		draft.CreatedDateTime = time.Now().Unix()
+		err = opt.Insert(db.Conn, draft)
+	} else {
+		err = fmt.Errorf("No provider '%s' to save", draft.Slug)
+	}
+
+	if err != nil {
+		aoh.render(w, r, draft, []string{err.Error()})
+		return
+	}
+
+	//the issuer may have changed, so it needs discovering again
+	oidc.Reset()
+
+	http.Redirect(w, r, r.RequestURI, http.StatusFound)
+}
+
+//render shows the saved providers with draft in place of the provider it edits
+func (aoh *AdminOIDCHandler) render(w http.ResponseWriter, r *http.Request, draft *db.OIDCProvider, problems []string) {
+	opt := db.OIDCProvidersTable{}
+	providers, err := opt.SelectAll(db.Conn)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	newProvider := &db.OIDCProvider{Scopes: "profile email", GroupsClaim: "groups", DefaultRole: int(db.REG_USER), Enabled: true}
+	if draft != nil {
+		newProvider = draft
+		for i, provider := range providers {
+			if draft.Oidcproviderid != 0 && provider.Oidcproviderid == draft.Oidcproviderid {
+				providers[i] = draft
+				newProvider = &db.OIDCProvider{}
+			}
+		}
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("title", "Single Sign On")
+	pctx.Set("adminhiddenpassword", adminRoutePrefix(aoh.Router))
+	pctx.Set("quillenabled", false)
+	pctx.Set("providers", providers)
+	pctx.Set("newprovider", newProvider)
+	pctx.Set("modrole", int(db.MOD_USER))
+	pctx.Set("problems", problems)
+	if baseURL := configuredBaseURL(); len(baseURL) > 0 {
+		pctx.Set("callbackroot", fmt.Sprintf("%s%s/login/oidc/", baseURL, adminRoutePrefix(aoh.Router)))
+	} else {
+		pctx.Set("callbackroot", "")
+	}
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("deleteroute", adminRoutePrefix(aoh.Router)+"/admin/oidc/delete")
+
+	RenderDefault(w, "admin.oidc.html", pctx)
+}
+
+//validateOIDCProvider get everything wrong with the provider's config
+func validateOIDCProvider(p *db.OIDCProvider) []string {
+	problems := []string{}
+
+	if !providerSlugPattern.MatchString(p.Slug) {
+		problems = append(problems, fmt.Sprintf("Slug '%s' can only contain lower case letters, digits and '-'", p.Slug))
+	}
+	if len(p.Title) == 0 {
+		problems = append(problems, "Title can't be blank")
+	}
+	if issuer, err := url.Parse(p.Issuer); err != nil || (issuer.Scheme != "https" && issuer.Scheme != "http") || len(issuer.Host) == 0 {
+		problems = append(problems, fmt.Sprintf("Issuer '%s' must be an absolute http or https URL", p.Issuer))
+	}
+	if len(p.ClientID) == 0 {
+		problems = append(problems, "Client ID can't be blank")
+	}
+
+	if _, err := parseOIDCMappings(p.GroupMappings); err != nil {
+		problems = append(problems, fmt.Sprintf("Group mappings: %s", err.Error()))
+	}
+	roleMappings, err := parseOIDCMappings(p.RoleMappings)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("Role mappings: %s", err.Error()))
+	}
+	for _, mapping := range roleMappings {
+		if _, err := parseOIDCRole(mapping.Value); err != nil {
+			problems = append(problems, fmt.Sprintf("Role mappings: %s", err.Error()))
+		}
+	}
+
+	return problems
+}
+
+//loggedInAsRoot checks the requesting client is logged in as the root user
+func loggedInAsRoot(r *http.Request) bool {
+	amw := AuthMiddleware{}
+	user, err := amw.LoggedInUser(r)
+	return err == nil && user != nil && db.UsersRoleFlag(user.UserroleId) == db.ROOT_USER
+}
+
+//Route get URI route for handler
+func (aoh *AdminOIDCHandler) Route() string { return aoh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (aoh *AdminOIDCHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (aoh *AdminOIDCHandler) HandlesPost() bool { return true }
@@ -0,0 +1,69 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminOIDCDeleteHandler deletes OpenID Connect providers, users created by them are kept but can no longer sign in
+type AdminOIDCDeleteHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (aodh *AdminOIDCDeleteHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (aodh *AdminOIDCDeleteHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if !loggedInAsRoot(r) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	defer http.Redirect(w, r, adminRoutePrefix(aodh.Router)+"/admin/oidc", http.StatusFound)
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	slug := r.PostFormValue("slug")
+
+	opt := db.OIDCProvidersTable{}
+	if _, err := opt.DeleteBySlug(db.Conn, slug); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	//a new provider created with the same slug mustn't sign in as users of the old one
+	oit := db.OIDCIdentitiesTable{}
+	if _, err := oit.DeleteByProviderSlug(db.Conn, slug); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//Route get URI route for handler
+func (aodh *AdminOIDCDeleteHandler) Route() string { return aodh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (aodh *AdminOIDCDeleteHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (aodh *AdminOIDCDeleteHandler) HandlesPost() bool { return true }
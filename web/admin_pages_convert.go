@@ -0,0 +1,100 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminPagesConvertHandler converts an existing page's content to another content format
+type AdminPagesConvertHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (apch *AdminPagesConvertHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (apch *AdminPagesConvertHandler) Post(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var redirectURI = fmt.Sprintf("/admin/pages/edit/%s", vars["uuid"])
+	if apch.Router.AdminHidden {
+		redirectURI = fmt.Sprintf("/%s", apch.Router.AdminHiddenPassword) + redirectURI
+	}
+	defer http.Redirect(w, r, redirectURI, http.StatusFound)
+
+	err := r.ParseForm()
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	pt := db.PagesTable{}
+	pageToConvert, err := pt.SelectByUUID(db.Conn, vars["uuid"])
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	if pageToConvert == nil {
+		logging.Error("Page to convert doesn't exist, stopping...")
+		return
+	}
+
+	targetFormat := contentFormatByName(r.PostFormValue("contentformat")).Name
+
+	convertedContent, err := convertContent(pageToConvert.Content, pageToConvert.ContentFormat, targetFormat)
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	pageToConvert.Content = convertedContent
+	pageToConvert.ContentFormat = targetFormat
+	pageToConvert.ModifiedDateTime = time.Now().Unix()
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil {
+		logging.Error(err.Error())
+	}
+
+	for _, violation := range applyContentPolicy(pageToConvert, loggedInUser) {
+		addFlash(w, r, "contentviolations", violation)
+	}
+
+	if err := pt.Update(db.Conn, pageToConvert); err != nil {
+		logging.Error(err.Error())
+	}
+
+	pagesChanged()
+}
+
+//Route get URI route for handler
+func (apch *AdminPagesConvertHandler) Route() string { return apch.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (apch *AdminPagesConvertHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (apch *AdminPagesConvertHandler) HandlesPost() bool { return true }
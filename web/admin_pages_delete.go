@@ -47,6 +47,7 @@ func (apdh *AdminPagesDeleteHandler) Post(w http.ResponseWriter, r *http.Request
 	}
 
 	if deletedPages {
+		pagesChanged()
 		apdh.Router.Reload()
 	}
 
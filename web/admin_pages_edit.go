@@ -19,13 +19,14 @@ import (
 	"html/template"
 	"net/http"
 	"strings"
-
-	"github.com/dchenk/go-render-quill"
+	"time"
 
 	"github.com/tacusci/logging"
 
 	"github.com/gorilla/mux"
 	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/sitemap"
+	"github.com/tacusci/berrycms/themes"
 
 	"github.com/gobuffalo/plush"
 )
@@ -47,22 +48,51 @@ func (apeh *AdminPagesEditHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if html, err := quill.Render([]byte(pageToEdit.Content)); err == nil {
-		pctx := plush.NewContext()
-		pctx.Set("title", fmt.Sprintf("Edit Page - %s", pageToEdit.Title))
-		pctx.Set("submitroute", r.RequestURI)
-		pctx.Set("pagetitle", pageToEdit.Title)
-		pctx.Set("pageroute", pageToEdit.Route)
-		pctx.Set("pagecontent", template.HTML(string(html)))
-		pctx.Set("adminhiddenpassword", "")
-		if apeh.Router.AdminHidden {
-			pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", apeh.Router.AdminHiddenPassword))
+	format := contentFormatByName(pageToEdit.ContentFormat).Name
+
+	pctx := plush.NewContext()
+	pctx.Set("title", fmt.Sprintf("Edit Page - %s", pageToEdit.Title))
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("previewroute", "/admin/pages/preview")
+	pctx.Set("convertroute", fmt.Sprintf("/admin/pages/convert/%s", pageToEdit.UUID))
+	pctx.Set("pagetitle", pageToEdit.Title)
+	pctx.Set("pageroute", pageToEdit.Route)
+	pctx.Set("pagetags", pageToEdit.Tags)
+	pctx.Set("pageformat", format)
+	pctx.Set("contentformats", ContentFormats())
+	pctx.Set("cachepolicies", CachePolicies())
+	pctx.Set("pagecachepolicy", cachePolicyByName(pageToEdit.CachePolicy).Name)
+	pctx.Set("pagelayouts", themes.Active().Layouts())
+	pctx.Set("pagelayout", pageLayoutByName(pageToEdit.Layout))
+	pctx.Set("changefreqs", sitemap.ChangeFreqs())
+	pctx.Set("pagechangefreq", pageToEdit.SitemapChangeFreq)
+	pctx.Set("priorities", sitemapPriorities())
+	pctx.Set("pagepriority", pageToEdit.SitemapPriority)
+	pageSEOContext(pctx, pageToEdit)
+	pctx.Set("adminhiddenpassword", "")
+	if apeh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", apeh.Router.AdminHiddenPassword))
+		pctx.Set("previewroute", fmt.Sprintf("/%s/admin/pages/preview", apeh.Router.AdminHiddenPassword))
+		pctx.Set("convertroute", fmt.Sprintf("/%s/admin/pages/convert/%s", apeh.Router.AdminHiddenPassword, pageToEdit.UUID))
+	}
+	pctx.Set("quillenabled", format == ContentFormatQuill)
+	pctx.Set("contentviolations", popFlashes(w, r, "contentviolations"))
+	pctx.Set("seoproblems", popFlashes(w, r, "seoproblems"))
+
+	if format == ContentFormatQuill {
+		//quill editor is loaded with the rendered HTML of the delta
+		html, err := renderPageContent(pageToEdit)
+		if err != nil {
+			Error(w, err)
+			return
 		}
-		pctx.Set("quillenabled", true)
-		RenderDefault(w, "admin.pages.edit.html", pctx)
+		pctx.Set("pagecontent", template.HTML(html))
 	} else {
-		Error(w, err)
+		//source editors show the content as is, escaped inside their textarea
+		pctx.Set("pagecontent", pageToEdit.Content)
 	}
+
+	RenderDefault(w, "admin.pages.edit.html", pctx)
 }
 
 //Post handles post requests to URI
@@ -92,6 +122,27 @@ func (apeh *AdminPagesEditHandler) Post(w http.ResponseWriter, r *http.Request)
 	oldPageRoute := pageToEdit.Route
 	pageToEdit.Route = r.PostFormValue("route")
 	pageToEdit.Content = r.PostFormValue("pagecontent")
+	pageToEdit.CachePolicy = cachePolicyByName(r.PostFormValue("cachepolicy")).Name
+	pageToEdit.Layout = pageLayoutByName(r.PostFormValue("layout"))
+	pageToEdit.ContentFormat = contentFormatByName(r.PostFormValue("contentformat")).Name
+	pageToEdit.Tags = normaliseTags(r.PostFormValue("tags"))
+	pageToEdit.SitemapChangeFreq = sitemapChangeFreqByName(r.PostFormValue("changefreq"))
+	pageToEdit.SitemapPriority = sitemapPriorityByValue(r.PostFormValue("priority"))
+	pageToEdit.ModifiedDateTime = time.Now().Unix()
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil {
+		logging.Error(err.Error())
+	}
+
+	for _, problem := range applySEOForm(pageToEdit, r) {
+		addFlash(w, r, "seoproblems", problem)
+	}
+
+	for _, violation := range applyContentPolicy(pageToEdit, loggedInUser) {
+		addFlash(w, r, "contentviolations", violation)
+	}
 
 	err = pt.Update(db.Conn, pageToEdit)
 
@@ -99,6 +150,8 @@ func (apeh *AdminPagesEditHandler) Post(w http.ResponseWriter, r *http.Request)
 		logging.Error(err.Error())
 	}
 
+	pagesChanged()
+
 	//reloading all page routes is potentially really intensive, so only do this if the route has actually changed
 	if strings.Compare(oldPageRoute, pageToEdit.Route) != 0 {
 		apeh.Router.Reload()
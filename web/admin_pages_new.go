@@ -21,6 +21,8 @@ import (
 
 	"github.com/gobuffalo/plush"
 	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/sitemap"
+	"github.com/tacusci/berrycms/themes"
 	"github.com/tacusci/logging"
 )
 
@@ -32,16 +34,32 @@ type AdminPagesNewHandler struct {
 
 //Get handles get requests to URI
 func (apnh *AdminPagesNewHandler) Get(w http.ResponseWriter, r *http.Request) {
+	format := contentFormatByName(r.URL.Query().Get("format")).Name
+
 	pctx := plush.NewContext()
 	pctx.Set("title", "New Page")
 	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("previewroute", "/admin/pages/preview")
 	pctx.Set("pagetitle", "")
 	pctx.Set("pageroute", "")
+	pctx.Set("pagetags", "")
 	pctx.Set("pagecontent", "")
-	pctx.Set("quillenabled", true)
+	pctx.Set("pageformat", format)
+	pctx.Set("contentformats", ContentFormats())
+	pctx.Set("cachepolicies", CachePolicies())
+	pctx.Set("pagecachepolicy", DefaultCachePolicy)
+	pctx.Set("pagelayouts", themes.Active().Layouts())
+	pctx.Set("pagelayout", themes.DefaultLayout)
+	pctx.Set("changefreqs", sitemap.ChangeFreqs())
+	pctx.Set("pagechangefreq", "")
+	pctx.Set("priorities", sitemapPriorities())
+	pctx.Set("pagepriority", "")
+	pageSEOContext(pctx, &db.Page{})
+	pctx.Set("quillenabled", format == ContentFormatQuill)
 	pctx.Set("adminhiddenpassword", "")
 	if apnh.Router.AdminHidden {
 		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", apnh.Router.AdminHiddenPassword))
+		pctx.Set("previewroute", fmt.Sprintf("/%s/admin/pages/preview", apnh.Router.AdminHiddenPassword))
 	}
 	RenderDefault(w, "admin.pages.new.html", pctx)
 }
@@ -71,11 +89,26 @@ func (apnh *AdminPagesNewHandler) Post(w http.ResponseWriter, r *http.Request) {
 	}
 
 	pageToCreate := &db.Page{
-		CreatedDateTime: time.Now().Unix(),
-		Title:           r.PostFormValue("title"),
-		AuthorUUID:      loggedInUser.UUID,
-		Route:           r.PostFormValue("route"),
-		Content:         r.PostFormValue("pagecontent"),
+		CreatedDateTime:   time.Now().Unix(),
+		ModifiedDateTime:  time.Now().Unix(),
+		Title:             r.PostFormValue("title"),
+		AuthorUUID:        loggedInUser.UUID,
+		Route:             r.PostFormValue("route"),
+		Content:           r.PostFormValue("pagecontent"),
+		CachePolicy:       cachePolicyByName(r.PostFormValue("cachepolicy")).Name,
+		Layout:            pageLayoutByName(r.PostFormValue("layout")),
+		ContentFormat:     contentFormatByName(r.PostFormValue("contentformat")).Name,
+		Tags:              normaliseTags(r.PostFormValue("tags")),
+		SitemapChangeFreq: sitemapChangeFreqByName(r.PostFormValue("changefreq")),
+		SitemapPriority:   sitemapPriorityByValue(r.PostFormValue("priority")),
+	}
+
+	for _, problem := range applySEOForm(pageToCreate, r) {
+		addFlash(w, r, "seoproblems", problem)
+	}
+
+	for _, violation := range applyContentPolicy(pageToCreate, loggedInUser) {
+		addFlash(w, r, "contentviolations", violation)
 	}
 
 	err = pt.Insert(db.Conn, pageToCreate)
@@ -84,6 +117,8 @@ func (apnh *AdminPagesNewHandler) Post(w http.ResponseWriter, r *http.Request) {
 		logging.Error(err.Error())
 	}
 
+	pagesChanged()
+
 	pageToCreate, err = pt.SelectByRoute(db.Conn, pageToCreate.Route)
 
 	if err != nil {
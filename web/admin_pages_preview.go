@@ -0,0 +1,75 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/tacusci/logging"
+)
+
+//AdminPagesPreviewHandler renders page content posted from the editor so it can be previewed live
+type AdminPagesPreviewHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (apph *AdminPagesPreviewHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (apph *AdminPagesPreviewHandler) Post(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+
+	if err != nil {
+		logging.Error(err.Error())
+		Error(w, err)
+		return
+	}
+
+	html, err := renderContent(r.PostFormValue("pagecontent"), r.PostFormValue("contentformat"))
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil {
+		logging.Error(err.Error())
+	}
+
+	if !canPublishTrustedHTML(loggedInUser) {
+		sanitised := sanitiseHTML(html)
+		if violations := htmlViolations(html, sanitised); len(violations) > 0 {
+			w.Header().Set("X-Content-Violations", strings.Join(violations, ", "))
+		}
+		html = sanitised
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(html))
+}
+
+//Route get URI route for handler
+func (apph *AdminPagesPreviewHandler) Route() string { return apph.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (apph *AdminPagesPreviewHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (apph *AdminPagesPreviewHandler) HandlesPost() bool { return true }
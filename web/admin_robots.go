@@ -0,0 +1,159 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/robots"
+	"github.com/tacusci/logging"
+)
+
+//AdminRobotsHandler lists, previews and saves the user-agent groups added to robots.txt
+type AdminRobotsHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (arh *AdminRobotsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	preview, err := robots.Preview(0, nil)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+	arh.render(w, r, nil, string(preview), nil)
+}
+
+//Post handles post requests to URI
+func (arh *AdminRobotsHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PostFormValue("groupid"))
+	if err != nil {
+		id = 0
+	}
+
+	draft := &db.RobotsGroup{
+		Robotsgroupid: id,
+		UserAgents:    r.PostFormValue("useragents"),
+		Rules:         r.PostFormValue("rules"),
+	}
+
+	group, errs := robots.ParseGroup(draft.UserAgents, draft.Rules)
+	if len(errs) > 0 {
+		problems := []string{}
+		for _, err := range errs {
+			problems = append(problems, err.Error())
+		}
+		arh.render(w, r, draft, "", problems)
+		return
+	}
+
+	if r.PostFormValue("action") == "preview" {
+		preview, err := robots.Preview(id, group)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		arh.render(w, r, draft, string(preview), nil)
+		return
+	}
+
+	//saved in canonical form so directives are consistently cased
+	draft.UserAgents = strings.Join(group.UserAgents, "\n")
+	draft.Rules = robots.FormatRules(group.Rules)
+
+	rgt := db.RobotsGroupsTable{}
+	if id == 0 {
+		draft.CreatedDateTime = time.Now().Unix()
+		err = rgt.Insert(db.Conn, draft)
+	} else {
+		var existing *db.RobotsGroup
+		existing, err = rgt.SelectByID(db.Conn, id)
+		if err == nil {
+			draft.PluginManaged = existing.PluginManaged
+			err = rgt.Update(db.Conn, draft)
+		}
+	}
+
+	if err != nil {
+		logging.Error(err.Error())
+	} else if err := robots.Regenerate(); err != nil {
+		logging.Error(err.Error())
+	}
+
+	http.Redirect(w, r, r.RequestURI, http.StatusFound)
+}
+
+//render shows the saved groups with draft in place of the group it edits, along with the robots.txt preview
+func (arh *AdminRobotsHandler) render(w http.ResponseWriter, r *http.Request, draft *db.RobotsGroup, preview string, problems []string) {
+	rgt := db.RobotsGroupsTable{}
+	groups, err := rgt.SelectAll(db.Conn)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	newGroup := &db.RobotsGroup{}
+	if draft != nil {
+		if draft.Robotsgroupid == 0 {
+			newGroup = draft
+		}
+		for i, group := range groups {
+			if group.Robotsgroupid == draft.Robotsgroupid {
+				draft.PluginManaged = group.PluginManaged
+				groups[i] = draft
+			}
+		}
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("title", "Robots")
+	pctx.Set("adminhiddenpassword", "")
+	pctx.Set("quillenabled", false)
+	pctx.Set("robotsdisabled", arh.Router.disabled(&arh.Router.NoRobots))
+	pctx.Set("groups", groups)
+	pctx.Set("newgroup", newGroup)
+	pctx.Set("preview", preview)
+	pctx.Set("problems", problems)
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("deleteroute", "/admin/robots/delete")
+	if arh.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", arh.Router.AdminHiddenPassword))
+		pctx.Set("deleteroute", fmt.Sprintf("/%s/admin/robots/delete", arh.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.robots.html", pctx)
+}
+
+//Route get URI route for handler
+func (arh *AdminRobotsHandler) Route() string { return arh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (arh *AdminRobotsHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (arh *AdminRobotsHandler) HandlesPost() bool { return true }
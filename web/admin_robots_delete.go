@@ -0,0 +1,73 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/robots"
+	"github.com/tacusci/logging"
+)
+
+//AdminRobotsDeleteHandler deletes user-agent groups added to robots.txt
+type AdminRobotsDeleteHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (ardh *AdminRobotsDeleteHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (ardh *AdminRobotsDeleteHandler) Post(w http.ResponseWriter, r *http.Request) {
+	var redirectURI = "/admin/robots"
+	if ardh.Router.AdminHidden {
+		redirectURI = fmt.Sprintf("/%s", ardh.Router.AdminHiddenPassword) + redirectURI
+	}
+	defer http.Redirect(w, r, redirectURI, http.StatusFound)
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	id, err := strconv.Atoi(r.PostFormValue("groupid"))
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	rgt := db.RobotsGroupsTable{}
+	if _, err := rgt.DeleteByID(db.Conn, id); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	if err := robots.Regenerate(); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//Route get URI route for handler
+func (ardh *AdminRobotsDeleteHandler) Route() string { return ardh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ardh *AdminRobotsDeleteHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ardh *AdminRobotsDeleteHandler) HandlesPost() bool { return true }
@@ -0,0 +1,76 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/logging"
+)
+
+//AdminSEOHandler edits the site wide SEO defaults used by pages which leave fields blank
+type AdminSEOHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (ash *AdminSEOHandler) Get(w http.ResponseWriter, r *http.Request) {
+	pctx := plush.NewContext()
+	pctx.Set("title", "SEO")
+	pctx.Set("adminhiddenpassword", "")
+	pctx.Set("quillenabled", false)
+	pctx.Set("seodefaults", loadSEODefaults())
+	pctx.Set("twittercards", TwitterCards())
+	pctx.Set("staticimages", staticImages())
+	pctx.Set("submitroute", r.RequestURI)
+	if ash.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", ash.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.seo.html", pctx)
+}
+
+//Post handles post requests to URI
+func (ash *AdminSEOHandler) Post(w http.ResponseWriter, r *http.Request) {
+	defer http.Redirect(w, r, r.RequestURI, http.StatusFound)
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	err := saveSEODefaults(SEODefaults{
+		SiteName:    r.PostFormValue("sitename"),
+		Description: r.PostFormValue("description"),
+		Image:       r.PostFormValue("image"),
+		TwitterCard: r.PostFormValue("twittercard"),
+		TwitterSite: r.PostFormValue("twittersite"),
+	})
+	if err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//Route get URI route for handler
+func (ash *AdminSEOHandler) Route() string { return ash.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ash *AdminSEOHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ash *AdminSEOHandler) HandlesPost() bool { return true }
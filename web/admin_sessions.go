@@ -0,0 +1,125 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+)
+
+//AdminSessionsHandler lists where the logged in user is logged in, and for root where everyone is
+type AdminSessionsHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//sessionListing a session as shown in the sessions list
+type sessionListing struct {
+	SessionUUID        string
+	Username           string
+	IPAddress          string
+	UserAgent          string
+	CreatedDateTime    int64
+	LastActiveDateTime int64
+	Current            bool
+}
+
+//Get handles get requests to URI
+func (ash *AdminSessionsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		http.Redirect(w, r, adminRoutePrefix(ash.Router)+"/login", http.StatusFound)
+		return
+	}
+
+	ast := db.AuthSessionsTable{}
+	ownSessions, err := ast.SelectByUserUUID(db.Conn, loggedInUser.UUID)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	current := currentSessionUUID(r)
+	usernames := map[string]string{loggedInUser.UUID: loggedInUser.Username}
+
+	isRoot := db.UsersRoleFlag(loggedInUser.UserroleId) == db.ROOT_USER
+	othersSessions := []*db.AuthSession{}
+	if isRoot {
+		allSessions, err := ast.SelectAll(db.Conn)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		for _, as := range allSessions {
+			if as.UserUUID != loggedInUser.UUID {
+				othersSessions = append(othersSessions, as)
+			}
+		}
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("title", "Sessions")
+	pctx.Set("adminhiddenpassword", adminRoutePrefix(ash.Router))
+	pctx.Set("quillenabled", false)
+	pctx.Set("sessions", listSessions(ownSessions, current, usernames))
+	pctx.Set("otherssessions", listSessions(othersSessions, current, usernames))
+	pctx.Set("isroot", isRoot)
+	pctx.Set("unixtostring", UnixToTimeString)
+	pctx.Set("revokeroute", adminRoutePrefix(ash.Router)+"/admin/sessions/revoke")
+
+	RenderDefault(w, "admin.sessions.html", pctx)
+}
+
+//listSessions describe sessions for the sessions list, looking up and remembering in usernames who each belongs to
+func listSessions(sessions []*db.AuthSession, current string, usernames map[string]string) []sessionListing {
+	ut := db.UsersTable{}
+
+	listings := []sessionListing{}
+	for _, as := range sessions {
+		username, ok := usernames[as.UserUUID]
+		if !ok {
+			if user, err := ut.SelectByUUID(db.Conn, as.UserUUID); err == nil && user != nil {
+				username = user.Username
+			}
+			usernames[as.UserUUID] = username
+		}
+
+		listings = append(listings, sessionListing{
+			SessionUUID:        as.SessionUUID,
+			Username:           username,
+			IPAddress:          as.IPAddress,
+			UserAgent:          as.UserAgent,
+			CreatedDateTime:    as.CreatedDateTime,
+			LastActiveDateTime: as.LastActiveDateTime,
+			Current:            as.SessionUUID == current,
+		})
+	}
+	return listings
+}
+
+//Post handles post requests to URI
+func (ash *AdminSessionsHandler) Post(w http.ResponseWriter, r *http.Request) {}
+
+//Route get URI route for handler
+func (ash *AdminSessionsHandler) Route() string { return ash.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ash *AdminSessionsHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ash *AdminSessionsHandler) HandlesPost() bool { return false }
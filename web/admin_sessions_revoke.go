@@ -0,0 +1,109 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminSessionsRevokeHandler logs out one of the logged in user's sessions, or all but the one they're using,
+//root can log out anyone's sessions
+type AdminSessionsRevokeHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (asrh *AdminSessionsRevokeHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (asrh *AdminSessionsRevokeHandler) Post(w http.ResponseWriter, r *http.Request) {
+	redirectURI := adminRoutePrefix(asrh.Router) + "/admin/sessions"
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		http.Redirect(w, r, redirectURI, http.StatusFound)
+		return
+	}
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		http.Redirect(w, r, adminRoutePrefix(asrh.Router)+"/login", http.StatusFound)
+		return
+	}
+
+	current := currentSessionUUID(r)
+	ast := db.AuthSessionsTable{}
+
+	if r.PostFormValue("others") == "true" {
+		sessions, err := ast.SelectByUserUUID(db.Conn, loggedInUser.UUID)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		for _, as := range sessions {
+			if as.SessionUUID == current {
+				continue
+			}
+			if err := ast.DeleteBySessionUUID(db.Conn, as.SessionUUID); err != nil {
+				logging.Error(err.Error())
+			}
+		}
+		logging.Info(fmt.Sprintf("User %s logged out of their other sessions", loggedInUser.Username))
+		http.Redirect(w, r, redirectURI, http.StatusFound)
+		return
+	}
+
+	as, err := ast.SelectBySessionUUID(db.Conn, r.PostFormValue("sessionuuid"))
+	if err != nil {
+		http.Redirect(w, r, redirectURI, http.StatusFound)
+		return
+	}
+
+	//users can only revoke their own sessions, apart from root who can revoke anyone's
+	if as.UserUUID != loggedInUser.UUID && db.UsersRoleFlag(loggedInUser.UserroleId) != db.ROOT_USER {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	if as.SessionUUID == current {
+		if err := logout(w, r); err != nil {
+			Error(w, err)
+		}
+		return
+	}
+
+	if err := ast.DeleteBySessionUUID(db.Conn, as.SessionUUID); err != nil {
+		Error(w, err)
+		return
+	}
+	logging.Info(fmt.Sprintf("User %s revoked a session of user UUID %s from %s", loggedInUser.Username, as.UserUUID, as.IPAddress))
+
+	http.Redirect(w, r, redirectURI, http.StatusFound)
+}
+
+//Route get URI route for handler
+func (asrh *AdminSessionsRevokeHandler) Route() string { return asrh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (asrh *AdminSessionsRevokeHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (asrh *AdminSessionsRevokeHandler) HandlesPost() bool { return true }
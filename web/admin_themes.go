@@ -0,0 +1,77 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/logging"
+
+	"github.com/tacusci/berrycms/themes"
+)
+
+//AdminThemesHandler lists installed themes and switches the active one
+type AdminThemesHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (ath *AdminThemesHandler) Get(w http.ResponseWriter, r *http.Request) {
+	activeTheme := themes.Active()
+
+	pctx := plush.NewContext()
+	pctx.Set("title", "Themes")
+	pctx.Set("adminhiddenpassword", "")
+	pctx.Set("quillenabled", false)
+	pctx.Set("themes", themes.List())
+	pctx.Set("activetheme", activeTheme.Name)
+	pctx.Set("activethemelayouts", activeTheme.Layouts())
+	pctx.Set("submitroute", r.RequestURI)
+	if ath.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", ath.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.themes.html", pctx)
+}
+
+//Post handles post requests to URI
+func (ath *AdminThemesHandler) Post(w http.ResponseWriter, r *http.Request) {
+	defer http.Redirect(w, r, r.RequestURI, http.StatusFound)
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	if err := themes.SetActive(r.PostFormValue("theme")); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	//the theme's assets are mapped when the routes are
+	ath.Router.Reload()
+}
+
+//Route get URI route for handler
+func (ath *AdminThemesHandler) Route() string { return ath.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ath *AdminThemesHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ath *AdminThemesHandler) HandlesPost() bool { return true }
@@ -0,0 +1,116 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminTokensHandler lists and creates the logged in user's personal API tokens
+type AdminTokensHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (ath *AdminTokensHandler) Get(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+	ath.render(w, r, loggedInUser, "", "")
+}
+
+//Post handles post requests to URI
+func (ath *AdminTokensHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+		return
+	}
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		http.Redirect(w, r, "/login", http.StatusFound)
+		return
+	}
+
+	days, err := strconv.Atoi(r.PostFormValue("expirydays"))
+	if err != nil || days < 0 {
+		days = APITokenExpiries()[0].Days
+	}
+
+	token, _, err := createAPIToken(loggedInUser, r.PostFormValue("name"), r.Form["scopes"], days)
+	if err != nil {
+		ath.render(w, r, loggedInUser, "", err.Error())
+		return
+	}
+
+	//the token is only ever shown in this response, only its hash is kept
+	ath.render(w, r, loggedInUser, token, "")
+}
+
+//render shows user's tokens, with newToken shown once if one has just been created
+func (ath *AdminTokensHandler) render(w http.ResponseWriter, r *http.Request, user *db.User, newToken string, problem string) {
+	att := db.APITokensTable{}
+	tokens, err := att.SelectByUserUUID(db.Conn, user.UUID)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	pctx := plush.NewContext()
+	pctx.Set("title", "API Tokens")
+	pctx.Set("adminhiddenpassword", "")
+	pctx.Set("quillenabled", false)
+	pctx.Set("tokens", tokens)
+	pctx.Set("newtoken", newToken)
+	pctx.Set("problem", problem)
+	pctx.Set("scopes", APIScopesForRole(db.UsersRoleFlag(user.UserroleId)))
+	pctx.Set("expiries", APITokenExpiries())
+	pctx.Set("unixtostring", UnixToTimeString)
+	pctx.Set("unixtostringornever", func(unix int64) string {
+		if unix == 0 {
+			return "Never"
+		}
+		return UnixToTimeString(unix)
+	})
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("revokeroute", "/admin/tokens/revoke")
+	if ath.Router.AdminHidden {
+		pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", ath.Router.AdminHiddenPassword))
+		pctx.Set("revokeroute", fmt.Sprintf("/%s/admin/tokens/revoke", ath.Router.AdminHiddenPassword))
+	}
+
+	RenderDefault(w, "admin.tokens.html", pctx)
+}
+
+//Route get URI route for handler
+func (ath *AdminTokensHandler) Route() string { return ath.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ath *AdminTokensHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ath *AdminTokensHandler) HandlesPost() bool { return true }
@@ -0,0 +1,77 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminTokensRevokeHandler revokes one of the logged in user's personal API tokens
+type AdminTokensRevokeHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (atrh *AdminTokensRevokeHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (atrh *AdminTokensRevokeHandler) Post(w http.ResponseWriter, r *http.Request) {
+	var redirectURI = "/admin/tokens"
+	if atrh.Router.AdminHidden {
+		redirectURI = fmt.Sprintf("/%s", atrh.Router.AdminHiddenPassword) + redirectURI
+	}
+	defer http.Redirect(w, r, redirectURI, http.StatusFound)
+
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		return
+	}
+
+	att := db.APITokensTable{}
+	token, err := att.SelectByUUID(db.Conn, r.PostFormValue("tokenuuid"))
+	if err != nil {
+		logging.Error(err.Error())
+		return
+	}
+
+	//users can only revoke their own tokens
+	if token.UserUUID != loggedInUser.UUID {
+		return
+	}
+
+	if _, err := att.DeleteByUUID(db.Conn, token.UUID); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//Route get URI route for handler
+func (atrh *AdminTokensRevokeHandler) Route() string { return atrh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (atrh *AdminTokensRevokeHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (atrh *AdminTokensRevokeHandler) HandlesPost() bool { return true }
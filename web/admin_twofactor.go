@@ -0,0 +1,237 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//twoFactorPolicyOption a role or group root can require two-factor authentication for
+type twoFactorPolicyOption struct {
+	Value    string
+	Label    string
+	Required bool
+}
+
+//twoFactorPageState what the two-factor page shows besides the user's status
+type twoFactorPageState struct {
+	Enrolling     bool
+	RecoveryCodes []string
+	Problem       string
+}
+
+//AdminTwoFactorHandler lets users set up and manage their two-factor authentication, and root set which roles and groups must use it
+type AdminTwoFactorHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (atfh *AdminTwoFactorHandler) Get(w http.ResponseWriter, r *http.Request) {
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		http.Redirect(w, r, adminRoutePrefix(atfh.Router)+"/login", http.StatusFound)
+		return
+	}
+	atfh.render(w, r, loggedInUser, twoFactorPageState{})
+}
+
+//Post handles post requests to URI
+func (atfh *AdminTwoFactorHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		logging.Error(err.Error())
+		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+		return
+	}
+
+	amw := AuthMiddleware{}
+	loggedInUser, err := amw.LoggedInUser(r)
+	if err != nil || loggedInUser == nil {
+		http.Redirect(w, r, adminRoutePrefix(atfh.Router)+"/login", http.StatusFound)
+		return
+	}
+
+	state := twoFactorPageState{}
+
+	switch r.PostFormValue("action") {
+	case "begin":
+		if _, err := beginTwoFactorEnrolment(loggedInUser); err != nil {
+			state.Problem = err.Error()
+		} else {
+			state.Enrolling = true
+		}
+	case "confirm":
+		recoveryCodes, err := confirmTwoFactorEnrolment(loggedInUser, r.PostFormValue("code"))
+		if err != nil {
+			state.Problem = err.Error()
+			state.Enrolling = !twoFactorEnabled(loggedInUser)
+		}
+		state.RecoveryCodes = recoveryCodes
+	case "regenerate":
+		if !verifySecondFactor(loggedInUser, r.PostFormValue("code")) {
+			state.Problem = "That code isn't right, recovery codes weren't regenerated"
+			break
+		}
+		recoveryCodes, err := generateRecoveryCodes(loggedInUser)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		state.RecoveryCodes = recoveryCodes
+	case "disable":
+		if twoFactorRequired(loggedInUser) {
+			state.Problem = "Two-factor authentication is required for your account, so can't be turned off"
+			break
+		}
+		if !verifySecondFactor(loggedInUser, r.PostFormValue("code")) {
+			state.Problem = "That code isn't right, two-factor authentication is still on"
+			break
+		}
+		if err := disableTwoFactor(loggedInUser); err != nil {
+			Error(w, err)
+			return
+		}
+	case "policy":
+		if db.UsersRoleFlag(loggedInUser.UserroleId) != db.ROOT_USER {
+			http.Error(w, "Access denied", http.StatusForbidden)
+			return
+		}
+		if err := saveTwoFactorPolicy(atfh.policyFromForm(r)); err != nil {
+			Error(w, err)
+			return
+		}
+		http.Redirect(w, r, r.RequestURI, http.StatusFound)
+		return
+	}
+
+	atfh.render(w, r, loggedInUser, state)
+}
+
+//policyFromForm reads the policy from the submitted form, unknown roles and groups are ignored
+func (atfh *AdminTwoFactorHandler) policyFromForm(r *http.Request) TwoFactorPolicy {
+	policy := TwoFactorPolicy{Roles: []int{}, Groups: []string{}}
+
+	for _, role := range r.Form["roles"] {
+		id, err := strconv.Atoi(role)
+		if err != nil {
+			continue
+		}
+		switch db.UsersRoleFlag(id) {
+		case db.ROOT_USER, db.MOD_USER, db.REG_USER:
+			policy.Roles = append(policy.Roles, id)
+		}
+	}
+
+	gt := db.GroupTable{}
+	for _, groupUUID := range r.Form["groups"] {
+		if group, err := gt.SelectByUUID(db.Conn, groupUUID); err == nil && len(group.UUID) > 0 {
+			policy.Groups = append(policy.Groups, group.UUID)
+		}
+	}
+
+	return policy
+}
+
+//render shows user's two-factor status, along with the policy if they're root
+func (atfh *AdminTwoFactorHandler) render(w http.ResponseWriter, r *http.Request, user *db.User, state twoFactorPageState) {
+	pctx := plush.NewContext()
+	pctx.Set("title", "Two-Factor Authentication")
+	pctx.Set("adminhiddenpassword", adminRoutePrefix(atfh.Router))
+	pctx.Set("quillenabled", false)
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("enabled", twoFactorEnabled(user))
+	pctx.Set("required", twoFactorRequired(user))
+	pctx.Set("enrolling", state.Enrolling)
+	pctx.Set("recoverycodes", state.RecoveryCodes)
+	pctx.Set("problem", state.Problem)
+	pctx.Set("secret", "")
+	pctx.Set("otpauthuri", "")
+	pctx.Set("qrcode", "")
+
+	if state.Enrolling {
+		tf, err := pendingTwoFactorEnrolment(user)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		uri, qr, err := twoFactorQRCode(user, tf.Secret)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		pctx.Set("secret", tf.Secret)
+		pctx.Set("otpauthuri", uri)
+		pctx.Set("qrcode", qr)
+	}
+
+	rct := db.RecoveryCodesTable{}
+	remaining, err := rct.SelectByUserUUID(db.Conn, user.UUID)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+	pctx.Set("remainingcodes", len(remaining))
+
+	isRoot := db.UsersRoleFlag(user.UserroleId) == db.ROOT_USER
+	pctx.Set("isroot", isRoot)
+	pctx.Set("roleoptions", []twoFactorPolicyOption{})
+	pctx.Set("groupoptions", []twoFactorPolicyOption{})
+
+	if isRoot {
+		policy := loadTwoFactorPolicy()
+
+		roleOptions := []twoFactorPolicyOption{}
+		for _, role := range []struct {
+			flag  db.UsersRoleFlag
+			label string
+		}{{db.ROOT_USER, "Root"}, {db.MOD_USER, "Moderators"}, {db.REG_USER, "Regular users"}} {
+			roleOptions = append(roleOptions, twoFactorPolicyOption{
+				Value:    strconv.Itoa(int(role.flag)),
+				Label:    role.label,
+				Required: policy.RequiresRole(int(role.flag)),
+			})
+		}
+		pctx.Set("roleoptions", roleOptions)
+
+		gt := db.GroupTable{}
+		groups, _, err := gt.List(db.Conn, db.ListOptions{Limit: db.MaxListLimit})
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		groupOptions := []twoFactorPolicyOption{}
+		for _, group := range groups {
+			groupOptions = append(groupOptions, twoFactorPolicyOption{Value: group.UUID, Label: group.Title, Required: policy.RequiresGroup(group.UUID)})
+		}
+		pctx.Set("groupoptions", groupOptions)
+	}
+
+	RenderDefault(w, "admin.2fa.html", pctx)
+}
+
+//Route get URI route for handler
+func (atfh *AdminTwoFactorHandler) Route() string { return atfh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (atfh *AdminTwoFactorHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (atfh *AdminTwoFactorHandler) HandlesPost() bool { return true }
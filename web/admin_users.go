@@ -17,6 +17,8 @@ package web
 import (
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gobuffalo/plush"
 	"github.com/tacusci/berrycms/db"
@@ -56,6 +58,19 @@ func (uh *AdminUsersHandler) Get(w http.ResponseWriter, r *http.Request) {
 	}
 	pctx.Set("unixtostring", UnixToTimeString)
 
+	locked, err := lockedAccounts(time.Now())
+	if err != nil {
+		Error(w, err)
+		return
+	}
+	pctx.Set("lockeduntil", func(username string) string {
+		if until, ok := locked[strings.ToLower(username)]; ok {
+			return UnixToTimeString(until)
+		}
+		return ""
+	})
+	pctx.Set("isroot", loggedInAsRoot(r))
+
 	RenderDefault(w, "admin.users.html", pctx)
 }
 
@@ -91,11 +91,23 @@ func (audh *AdminUsersDeleteHandler) Post(w http.ResponseWriter, r *http.Request
 
 				//make sure that the user to delete isn't the author of any pages (should probably do something different to this in future)
 				if rowCount == 0 {
-					st.Delete(db.Conn, fmt.Sprintf("uuid = '%s'", userToDelete.UUID))
+					st.DeleteByUserUUID(db.Conn, userToDelete.UUID)
 					ut.DeleteByUUID(db.Conn, userToDelete.UUID)
 					gmt := db.GroupMembershipTable{}
 					//will delete user from all groups, maybe this should be a different function?
 					gmt.DeleteUserFromGroup(db.Conn, userToDelete, &db.Group{UUID: "*"})
+					att := db.APITokensTable{}
+					att.DeleteByUserUUID(db.Conn, userToDelete.UUID)
+					oit := db.OIDCIdentitiesTable{}
+					oit.DeleteByUserUUID(db.Conn, userToDelete.UUID)
+					tft := db.TwoFactorsTable{}
+					tft.DeleteByUserUUID(db.Conn, userToDelete.UUID)
+					tfct := db.TwoFactorChallengesTable{}
+					tfct.DeleteByUserUUID(db.Conn, userToDelete.UUID)
+					rct := db.RecoveryCodesTable{}
+					rct.DeleteByUserUUID(db.Conn, userToDelete.UUID)
+					prt := db.PasswordResetsTable{}
+					prt.DeleteByUserUUID(db.Conn, userToDelete.UUID)
 				}
 			}
 		}
@@ -0,0 +1,71 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//AdminUsersUnlockHandler lets root lift the lockout of an account which has had too many failed logins
+type AdminUsersUnlockHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (auuh *AdminUsersUnlockHandler) Get(w http.ResponseWriter, r *http.Request) {}
+
+//Post handles post requests to URI
+func (auuh *AdminUsersUnlockHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if !loggedInAsRoot(r) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		Error(w, err)
+		return
+	}
+
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUUID(db.Conn, r.PostFormValue("uuid"))
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	if len(user.UUID) > 0 {
+		if err := unlockAccount(user.Username); err != nil {
+			Error(w, err)
+			return
+		}
+		logging.Info(fmt.Sprintf("Unlocked account %s", user.Username))
+	}
+
+	http.Redirect(w, r, adminRoutePrefix(auuh.Router)+"/admin/users", http.StatusFound)
+}
+
+//Route get URI route for handler
+func (auuh *AdminUsersUnlockHandler) Route() string { return auuh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (auuh *AdminUsersUnlockHandler) HandlesGet() bool { return false }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (auuh *AdminUsersUnlockHandler) HandlesPost() bool { return true }
@@ -0,0 +1,258 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//APIPrefix URI prefix every version 1 API endpoint is served under
+const APIPrefix = "/api/v1"
+
+//maxAPIBodySize largest request body the API will read
+const maxAPIBodySize = 4 << 20
+
+//apiParam a query string parameter accepted by an endpoint
+type apiParam struct {
+	Name        string
+	Description string
+}
+
+//apiEndpoint a single API operation, used both to map its route and to describe it in the OpenAPI document
+type apiEndpoint struct {
+	Method  string
+	Path    string
+	Summary string
+	Tag     string
+	//Scope personal API tokens need to be granted to use the endpoint
+	Scope string
+	//Query filters accepted by list endpoints, named after the columns they filter
+	Query []apiParam
+	//Request zero value of the type decoded from the request body, nil if there's no body
+	Request interface{}
+	//Response zero value of the type returned in the response's data, nil if there's no body
+	Response interface{}
+	//List whether the response is a paginated list of Response
+	List bool
+	//Status status code of a successful response
+	Status int
+	Handle func(w http.ResponseWriter, r *http.Request, caller *db.User)
+}
+
+//apiError the body of every API error response
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+//apiPagination describes which part of a list has been returned
+type apiPagination struct {
+	Limit  int `json:"limit"`
+	Offset int `json:"offset"`
+	Total  int `json:"total"`
+}
+
+//errAPINotFound returned by API handlers when the requested item doesn't exist
+var errAPINotFound = errors.New("Not found")
+
+//apiEndpoints get every API endpoint
+func (mr *MutableRouter) apiEndpoints() []apiEndpoint {
+	endpoints := []apiEndpoint{}
+	endpoints = append(endpoints, mr.apiPageEndpoints()...)
+	endpoints = append(endpoints, mr.apiUserEndpoints()...)
+	endpoints = append(endpoints, mr.apiGroupEndpoints()...)
+	return endpoints
+}
+
+//mapAPI maps every API endpoint and the OpenAPI document describing them
+func (mr *MutableRouter) mapAPI(r *mux.Router) {
+	if mr.NoAPI {
+		return
+	}
+
+	api := r.PathPrefix(APIPrefix).Subrouter()
+	api.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "No API endpoint at this URI")
+	})
+	api.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusMethodNotAllowed, fmt.Sprintf("Method %s isn't allowed at this URI", r.Method))
+	})
+
+	endpoints := mr.apiEndpoints()
+
+	logging.Debug(fmt.Sprintf("Mapping default GET route %s/openapi.json", APIPrefix))
+	api.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIJSON(w, http.StatusOK, openAPIDocument(endpoints))
+	}).Methods("GET")
+
+	for _, endpoint := range endpoints {
+		logging.Debug(fmt.Sprintf("Mapping API %s route %s%s", endpoint.Method, APIPrefix, endpoint.Path))
+		api.HandleFunc(endpoint.Path, mr.apiHandler(endpoint)).Methods(endpoint.Method)
+	}
+}
+
+//apiHandler authenticates requests to endpoint before passing them to it
+func (mr *MutableRouter) apiHandler(endpoint apiEndpoint) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, caller, err := apiCaller(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer realm=\"berrycms\"")
+			writeAPIError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !tokenGrantsScope(token, caller, endpoint.Scope) {
+			writeAPIError(w, http.StatusForbidden, fmt.Sprintf("API token hasn't been granted the '%s' scope", endpoint.Scope))
+			return
+		}
+		endpoint.Handle(w, r, caller)
+	}
+}
+
+//apiCaller get the personal token a request's bearer token is, along with the user it authenticates as
+func apiCaller(r *http.Request) (*db.APIToken, *db.User, error) {
+	token := bearerToken(r)
+	if len(token) == 0 {
+		return nil, nil, errors.New("Missing 'Authorization: Bearer' token")
+	}
+	return authenticateAPIToken(token)
+}
+
+//bearerToken get the token from the request's 'Authorization: Bearer' header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+//writeAPIJSON writes val as the JSON response body
+func writeAPIJSON(w http.ResponseWriter, status int, val interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if val == nil {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(val); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//writeAPIData writes val as the data of a successful response
+func writeAPIData(w http.ResponseWriter, status int, val interface{}) {
+	writeAPIJSON(w, status, map[string]interface{}{"data": val})
+}
+
+//writeAPIList writes items as the data of a successful paginated list response
+func writeAPIList(w http.ResponseWriter, items interface{}, pagination apiPagination) {
+	writeAPIJSON(w, http.StatusOK, map[string]interface{}{"data": items, "pagination": pagination})
+}
+
+//writeAPIError writes a JSON error body with status
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeAPIJSON(w, status, apiError{Error: apiErrorDetail{Status: status, Message: message}})
+}
+
+//writeAPIFailure writes err as a not found, or logs it and writes an internal server error
+func writeAPIFailure(w http.ResponseWriter, err error) {
+	if err == errAPINotFound {
+		writeAPIError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	logging.Error(err.Error())
+	writeAPIError(w, http.StatusInternalServerError, "Internal server error")
+}
+
+//decodeAPIBody decodes the request's JSON body into val, unknown fields are rejected
+func decodeAPIBody(w http.ResponseWriter, r *http.Request, val interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(val); err != nil {
+		writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON body -> %s", err.Error()))
+		return false
+	}
+	return true
+}
+
+//apiListOptions reads pagination and filters from the query string, only the endpoint's filters are used
+func apiListOptions(w http.ResponseWriter, r *http.Request, filters []apiParam) (db.ListOptions, bool) {
+	query := r.URL.Query()
+	opts := db.ListOptions{Limit: db.DefaultListLimit, Filters: map[string]string{}}
+
+	for _, name := range []string{"limit", "offset"} {
+		raw := query.Get(name)
+		if len(raw) == 0 {
+			continue
+		}
+		val, err := strconv.Atoi(raw)
+		if err != nil || val < 0 {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("Query parameter '%s' must be a positive whole number", name))
+			return opts, false
+		}
+		if name == "limit" {
+			opts.Limit = val
+		} else {
+			opts.Offset = val
+		}
+	}
+
+	if opts.Limit == 0 || opts.Limit > db.MaxListLimit {
+		opts.Limit = db.MaxListLimit
+	}
+
+	for _, filter := range filters {
+		if val := query.Get(filter.Name); len(val) > 0 {
+			opts.Filters[filter.Name] = val
+		}
+	}
+
+	return opts, true
+}
+
+//paginationFor describes the page of a list returned for opts
+func paginationFor(opts db.ListOptions, total int) apiPagination {
+	return apiPagination{Limit: opts.Limit, Offset: opts.Offset, Total: total}
+}
+
+//apiBoolFilter converts a true/false filter into the value booleans are stored as
+func apiBoolFilter(opts *db.ListOptions, name string) bool {
+	val, ok := opts.Filters[name]
+	if !ok {
+		return true
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false
+	}
+	opts.Filters[name] = "0"
+	if b {
+		opts.Filters[name] = "1"
+	}
+	return true
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+)
+
+//apiGroupFilters query parameters groups can be listed by
+var apiGroupFilters = []apiParam{
+	{Name: "title", Description: "Groups with titles containing this"},
+}
+
+//apiMembershipFilters query parameters a group's memberships can be listed by
+var apiMembershipFilters = []apiParam{
+	{Name: "useruuid", Description: "Memberships of the user with this UUID"},
+}
+
+//apiGroupRequest a group as sent to the API
+type apiGroupRequest struct {
+	Title string `json:"title"`
+}
+
+//apiMembershipRequest a user to add to a group
+type apiMembershipRequest struct {
+	UserUUID string `json:"useruuid"`
+}
+
+func (mr *MutableRouter) apiGroupEndpoints() []apiEndpoint {
+	return []apiEndpoint{
+		{
+			Method: "GET", Path: "/groups", Summary: "List groups", Tag: "groups", Scope: ScopeUsersManage, Query: apiGroupFilters,
+			Response: db.Group{}, List: true, Status: http.StatusOK, Handle: mr.apiListGroups,
+		},
+		{
+			Method: "POST", Path: "/groups", Summary: "Create a group", Tag: "groups", Scope: ScopeUsersManage,
+			Request: apiGroupRequest{}, Response: db.Group{}, Status: http.StatusCreated, Handle: mr.apiCreateGroup,
+		},
+		{
+			Method: "GET", Path: "/groups/{uuid}", Summary: "Get a group", Tag: "groups", Scope: ScopeUsersManage,
+			Response: db.Group{}, Status: http.StatusOK, Handle: mr.apiGetGroup,
+		},
+		{
+			Method: "PUT", Path: "/groups/{uuid}", Summary: "Rename a group", Tag: "groups", Scope: ScopeUsersManage,
+			Request: apiGroupRequest{}, Response: db.Group{}, Status: http.StatusOK, Handle: mr.apiUpdateGroup,
+		},
+		{
+			Method: "DELETE", Path: "/groups/{uuid}", Summary: "Delete a group and its memberships", Tag: "groups", Scope: ScopeUsersManage,
+			Status: http.StatusNoContent, Handle: mr.apiDeleteGroup,
+		},
+		{
+			Method: "GET", Path: "/groups/{uuid}/members", Summary: "List a group's memberships", Tag: "groups", Scope: ScopeUsersManage, Query: apiMembershipFilters,
+			Response: db.GroupMembership{}, List: true, Status: http.StatusOK, Handle: mr.apiListMemberships,
+		},
+		{
+			Method: "POST", Path: "/groups/{uuid}/members", Summary: "Add a user to a group", Tag: "groups", Scope: ScopeUsersManage,
+			Request: apiMembershipRequest{}, Response: db.GroupMembership{}, Status: http.StatusCreated, Handle: mr.apiAddMembership,
+		},
+		{
+			Method: "DELETE", Path: "/groups/{uuid}/members/{useruuid}", Summary: "Remove a user from a group", Tag: "groups", Scope: ScopeUsersManage,
+			Status: http.StatusNoContent, Handle: mr.apiRemoveMembership,
+		},
+	}
+}
+
+func (mr *MutableRouter) apiListGroups(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	opts, ok := apiListOptions(w, r, apiGroupFilters)
+	if !ok {
+		return
+	}
+
+	gt := db.GroupTable{}
+	groups, total, err := gt.List(db.Conn, opts)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	writeAPIList(w, groups, paginationFor(opts, total))
+}
+
+func (mr *MutableRouter) apiGetGroup(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	g, err := apiGroup(r)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+	writeAPIData(w, http.StatusOK, g)
+}
+
+func (mr *MutableRouter) apiCreateGroup(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	req := apiGroupRequest{}
+	if !decodeAPIBody(w, r, &req) {
+		return
+	}
+
+	if err := validateAPIGroupTitle(&req, ""); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	g := &db.Group{CreatedDateTime: time.Now().Unix(), Title: req.Title}
+
+	gt := db.GroupTable{}
+	if err := gt.Insert(db.Conn, g); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/groups/%s", APIPrefix, g.UUID))
+	writeAPIData(w, http.StatusCreated, g)
+}
+
+func (mr *MutableRouter) apiUpdateGroup(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	g, err := apiGroup(r)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	req := apiGroupRequest{Title: g.Title}
+	if !decodeAPIBody(w, r, &req) {
+		return
+	}
+
+	if err := validateAPIGroupTitle(&req, g.Title); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	g.Title = req.Title
+
+	gt := db.GroupTable{}
+	if err := gt.Update(db.Conn, g); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	writeAPIData(w, http.StatusOK, g)
+}
+
+func (mr *MutableRouter) apiDeleteGroup(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	g, err := apiGroup(r)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	gt := db.GroupTable{}
+	if _, err := gt.DeleteByUUID(db.Conn, g.UUID); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	writeAPIJSON(w, http.StatusNoContent, nil)
+}
+
+func (mr *MutableRouter) apiListMemberships(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	g, err := apiGroup(r)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	opts, ok := apiListOptions(w, r, apiMembershipFilters)
+	if !ok {
+		return
+	}
+	opts.Filters["groupuuid"] = g.UUID
+
+	gmt := db.GroupMembershipTable{}
+	memberships, total, err := gmt.List(db.Conn, opts)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	writeAPIList(w, memberships, paginationFor(opts, total))
+}
+
+func (mr *MutableRouter) apiAddMembership(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	g, err := apiGroup(r)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	req := apiMembershipRequest{}
+	if !decodeAPIBody(w, r, &req) {
+		return
+	}
+
+	u, err := apiUserByUUID(req.UserUUID)
+	if err == errAPINotFound {
+		writeAPIError(w, http.StatusUnprocessableEntity, fmt.Sprintf("No user with UUID '%s'", req.UserUUID))
+		return
+	}
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	gmt := db.GroupMembershipTable{}
+	_, total, err := gmt.List(db.Conn, db.ListOptions{Limit: 1, Filters: map[string]string{"groupuuid": g.UUID, "useruuid": u.UUID}})
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+	if total > 0 {
+		writeAPIError(w, http.StatusConflict, fmt.Sprintf("User '%s' is already a member of group '%s'", u.UUID, g.UUID))
+		return
+	}
+
+	gm := &db.GroupMembership{CreatedDateTime: time.Now().Unix(), GroupUUID: g.UUID, UserUUID: u.UUID}
+	if err := gmt.Insert(db.Conn, gm); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	writeAPIData(w, http.StatusCreated, gm)
+}
+
+func (mr *MutableRouter) apiRemoveMembership(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	g, err := apiGroup(r)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	u, err := apiUserByUUID(mux.Vars(r)["useruuid"])
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	gmt := db.GroupMembershipTable{}
+	removed, err := gmt.DeleteUserFromGroup(db.Conn, u, g)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+	if removed == 0 {
+		writeAPIFailure(w, errAPINotFound)
+		return
+	}
+
+	writeAPIJSON(w, http.StatusNoContent, nil)
+}
+
+//apiGroup get the group identified by the request's uuid path variable
+func apiGroup(r *http.Request) (*db.Group, error) {
+	groupUUID := mux.Vars(r)["uuid"]
+	if !uuidPattern.MatchString(groupUUID) {
+		return nil, errAPINotFound
+	}
+
+	gt := db.GroupTable{}
+	g, err := gt.SelectByUUID(db.Conn, groupUUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(g.UUID) == 0 {
+		return nil, errAPINotFound
+	}
+	return g, nil
+}
+
+//validateAPIGroupTitle checks a group's title isn't blank or already taken, currentTitle is the group's saved title if it already exists
+func validateAPIGroupTitle(req *apiGroupRequest, currentTitle string) error {
+	req.Title = strings.TrimSpace(req.Title)
+	if len(req.Title) == 0 {
+		return fmt.Errorf("Group 'title' can't be blank")
+	}
+
+	if req.Title != currentTitle {
+		gt := db.GroupTable{}
+		existing, err := gt.SelectByTitle(db.Conn, req.Title)
+		if err != nil {
+			return err
+		}
+		if len(existing.UUID) > 0 {
+			return fmt.Errorf("A group titled '%s' already exists", req.Title)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/tacusci/berrycms/db"
+)
+
+//pathParamPattern matches the '{name}' variables in an endpoint's path
+var pathParamPattern = regexp.MustCompile(`\{([^}:]+)\}`)
+
+//openAPIDocument generates an OpenAPI 3 document describing endpoints
+func openAPIDocument(endpoints []apiEndpoint) map[string]interface{} {
+	schemas := map[string]interface{}{
+		"Error":      schemaFor(reflect.TypeOf(apiError{}), nil),
+		"Pagination": schemaFor(reflect.TypeOf(apiPagination{}), nil),
+	}
+
+	paths := map[string]map[string]interface{}{}
+	for _, endpoint := range endpoints {
+		operation := map[string]interface{}{
+			"summary":     endpoint.Summary,
+			"description": fmt.Sprintf("Personal API tokens need the '%s' scope.", endpoint.Scope),
+			"tags":        []string{endpoint.Tag},
+			"operationId": operationID(endpoint),
+			"responses": map[string]interface{}{
+				"default": map[string]interface{}{
+					"description": "Error",
+					"content":     jsonContent(schemaRef("Error")),
+				},
+			},
+		}
+
+		parameters := []map[string]interface{}{}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(endpoint.Path, -1) {
+			parameters = append(parameters, map[string]interface{}{
+				"name": match[1], "in": "path", "required": true,
+				"schema": map[string]string{"type": "string", "format": "uuid"},
+			})
+		}
+		if endpoint.List {
+			parameters = append(parameters,
+				map[string]interface{}{
+					"name": "limit", "in": "query", "description": fmt.Sprintf("Most items to return, up to %d", db.MaxListLimit),
+					"schema": map[string]interface{}{"type": "integer", "minimum": 0, "default": db.DefaultListLimit},
+				},
+				map[string]interface{}{
+					"name": "offset", "in": "query", "description": "Number of items to skip",
+					"schema": map[string]interface{}{"type": "integer", "minimum": 0, "default": 0},
+				},
+			)
+		}
+		for _, param := range endpoint.Query {
+			parameters = append(parameters, map[string]interface{}{
+				"name": param.Name, "in": "query", "description": param.Description,
+				"schema": map[string]string{"type": "string"},
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if endpoint.Request != nil {
+			name := registerSchema(schemas, endpoint.Request)
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content":  jsonContent(schemaRef(name)),
+			}
+		}
+
+		response := map[string]interface{}{"description": http.StatusText(endpoint.Status)}
+		if endpoint.Response != nil {
+			name := registerSchema(schemas, endpoint.Response)
+			data := map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"data": schemaRef(name)},
+			}
+			if endpoint.List {
+				data["properties"] = map[string]interface{}{
+					"data":       map[string]interface{}{"type": "array", "items": schemaRef(name)},
+					"pagination": schemaRef("Pagination"),
+				}
+			}
+			response["content"] = jsonContent(data)
+		}
+		operation["responses"].(map[string]interface{})[fmt.Sprintf("%d", endpoint.Status)] = response
+
+		if paths[endpoint.Path] == nil {
+			paths[endpoint.Path] = map[string]interface{}{}
+		}
+		paths[endpoint.Path][strings.ToLower(endpoint.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":   "Berry CMS API",
+			"version": db.VERSION,
+		},
+		"servers": []map[string]string{{"url": APIPrefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []map[string][]string{{"bearerAuth": {}}},
+	}
+}
+
+//registerSchema adds val's type to schemas, named after the type, returning its name
+func registerSchema(schemas map[string]interface{}, val interface{}) string {
+	t := reflect.TypeOf(val)
+	name := strings.TrimPrefix(t.Name(), "api")
+	name = strings.ToUpper(name[:1]) + name[1:]
+
+	var readOnly []string
+	if t == reflect.TypeOf(db.Page{}) {
+		//pages are sent and returned as the same type, fields the server sets are only returned
+		readOnly = pageReadOnlyFields
+	}
+
+	if _, exists := schemas[name]; !exists {
+		schemas[name] = schemaFor(t, readOnly)
+	}
+	return name
+}
+
+//schemaFor describes struct type t by its json field names, fields in readOnly are marked as such
+func schemaFor(t reflect.Type, readOnly []string) map[string]interface{} {
+	properties := map[string]interface{}{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if len(name) == 0 {
+			name = field.Name
+		}
+
+		var property map[string]interface{}
+		switch field.Type.Kind() {
+		case reflect.Bool:
+			property = map[string]interface{}{"type": "boolean"}
+		case reflect.Int, reflect.Int32:
+			property = map[string]interface{}{"type": "integer"}
+		case reflect.Int64:
+			property = map[string]interface{}{"type": "integer", "format": "int64"}
+		case reflect.Struct:
+			property = schemaFor(field.Type, nil)
+		default:
+			property = map[string]interface{}{"type": "string"}
+		}
+
+		for _, ro := range readOnly {
+			if ro == name {
+				property["readOnly"] = true
+			}
+		}
+		properties[name] = property
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func schemaRef(name string) map[string]string {
+	return map[string]string{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(schema interface{}) map[string]interface{} {
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+}
+
+//operationID names an endpoint's operation from its method and path, eg., 'get_pages_uuid'
+func operationID(endpoint apiEndpoint) string {
+	path := pathParamPattern.ReplaceAllString(endpoint.Path, "$1")
+	parts := []string{strings.ToLower(endpoint.Method)}
+	for _, part := range strings.Split(path, "/") {
+		if len(part) > 0 {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, "_")
+}
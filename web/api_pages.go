@@ -0,0 +1,256 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+)
+
+//uuidPattern matches the UUIDs identifying rows, anything else can't exist so isn't looked up
+var uuidPattern = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+
+//apiPageFilters query parameters pages can be listed by
+var apiPageFilters = []apiParam{
+	{Name: "route", Description: "Pages with exactly this route"},
+	{Name: "title", Description: "Pages with titles containing this"},
+	{Name: "authoruuid", Description: "Pages written by the user with this UUID"},
+	{Name: "contentformat", Description: "Pages written in this format"},
+	{Name: "tags", Description: "Pages with tags containing this"},
+	{Name: "roleprotected", Description: "Pages which are, or aren't, only visible when logged in"},
+}
+
+//pageReadOnlyFields page fields set by the server, any values sent for them are ignored
+var pageReadOnlyFields = []string{"pageid", "createddatetime", "UUID", "authoruuid", "modifieddatetime", "trustedhtml"}
+
+func (mr *MutableRouter) apiPageEndpoints() []apiEndpoint {
+	return []apiEndpoint{
+		{
+			Method: "GET", Path: "/pages", Summary: "List pages, newest first", Tag: "pages", Scope: ScopePagesRead,
+			Query:    apiPageFilters,
+			Response: db.Page{}, List: true, Status: http.StatusOK, Handle: mr.apiListPages,
+		},
+		{
+			Method: "POST", Path: "/pages", Summary: "Create a page", Tag: "pages", Scope: ScopePagesWrite,
+			Request: db.Page{}, Response: db.Page{}, Status: http.StatusCreated, Handle: mr.apiCreatePage,
+		},
+		{
+			Method: "GET", Path: "/pages/{uuid}", Summary: "Get a page", Tag: "pages", Scope: ScopePagesRead,
+			Response: db.Page{}, Status: http.StatusOK, Handle: mr.apiGetPage,
+		},
+		{
+			Method: "PUT", Path: "/pages/{uuid}", Summary: "Update a page, fields left out keep their values", Tag: "pages", Scope: ScopePagesWrite,
+			Request: db.Page{}, Response: db.Page{}, Status: http.StatusOK, Handle: mr.apiUpdatePage,
+		},
+		{
+			Method: "DELETE", Path: "/pages/{uuid}", Summary: "Delete a page", Tag: "pages", Scope: ScopePagesWrite,
+			Status: http.StatusNoContent, Handle: mr.apiDeletePage,
+		},
+	}
+}
+
+func (mr *MutableRouter) apiListPages(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	opts, ok := apiListOptions(w, r, apiPageFilters)
+	if !ok {
+		return
+	}
+
+	if !apiBoolFilter(&opts, "roleprotected") {
+		writeAPIError(w, http.StatusBadRequest, "Query parameter 'roleprotected' must be true or false")
+		return
+	}
+
+	pt := db.PagesTable{}
+	pages, total, err := pt.List(db.Conn, opts)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	writeAPIList(w, pages, paginationFor(opts, total))
+}
+
+func (mr *MutableRouter) apiGetPage(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	p, err := apiPage(r)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+	writeAPIData(w, http.StatusOK, p)
+}
+
+func (mr *MutableRouter) apiCreatePage(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	p := &db.Page{}
+	if !decodeAPIBody(w, r, p) {
+		return
+	}
+
+	now := time.Now().Unix()
+	p.PageId = 0
+	p.UUID = ""
+	p.CreatedDateTime = now
+	p.ModifiedDateTime = now
+	p.AuthorUUID = caller.UUID
+
+	if err := normaliseAPIPage(p, ""); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	applyContentPolicy(p, caller)
+
+	pt := db.PagesTable{}
+	if err := pt.Insert(db.Conn, p); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	pagesChanged()
+	mr.Reload()
+
+	w.Header().Set("Location", fmt.Sprintf("%s/pages/%s", APIPrefix, p.UUID))
+	writeAPIData(w, http.StatusCreated, p)
+}
+
+func (mr *MutableRouter) apiUpdatePage(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	existing, err := apiPage(r)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	//decoding over a copy of the existing page leaves any fields which weren't sent unchanged
+	p := *existing
+	if !decodeAPIBody(w, r, &p) {
+		return
+	}
+
+	p.PageId = existing.PageId
+	p.CreatedDateTime = existing.CreatedDateTime
+	p.UUID = existing.UUID
+	p.AuthorUUID = existing.AuthorUUID
+	p.ModifiedDateTime = time.Now().Unix()
+
+	if err := normaliseAPIPage(&p, existing.Route); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	applyContentPolicy(&p, caller)
+
+	pt := db.PagesTable{}
+	if err := pt.Update(db.Conn, &p); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	pagesChanged()
+	if p.Route != existing.Route {
+		mr.Reload()
+	}
+
+	writeAPIData(w, http.StatusOK, &p)
+}
+
+func (mr *MutableRouter) apiDeletePage(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	p, err := apiPage(r)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	pt := db.PagesTable{}
+	if _, err := pt.DeleteByUUID(db.Conn, p.UUID); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	pagesChanged()
+	mr.Reload()
+
+	writeAPIJSON(w, http.StatusNoContent, nil)
+}
+
+//apiPage get the page identified by the request's uuid path variable
+func apiPage(r *http.Request) (*db.Page, error) {
+	pageUUID := mux.Vars(r)["uuid"]
+	if !uuidPattern.MatchString(pageUUID) {
+		return nil, errAPINotFound
+	}
+
+	pt := db.PagesTable{}
+	p, err := pt.SelectByUUID(db.Conn, pageUUID)
+	if err != nil {
+		return nil, errAPINotFound
+	}
+	return p, nil
+}
+
+//normaliseAPIPage validates a page sent to the API, falling back to defaults for choices which aren't
+//available the same way the editor does, currentRoute is the page's saved route if it already exists
+func normaliseAPIPage(p *db.Page, currentRoute string) error {
+	p.Title = strings.TrimSpace(p.Title)
+	p.Route = strings.TrimSpace(p.Route)
+
+	if len(p.Title) == 0 {
+		return fmt.Errorf("Page 'title' can't be blank")
+	}
+
+	//special pages, eg., '[404]', aren't served at a URI
+	special := strings.HasPrefix(p.Route, "[") && strings.HasSuffix(p.Route, "]")
+	if !special && (!strings.HasPrefix(p.Route, "/") || strings.ContainsAny(p.Route, " \t\n'\"")) {
+		return fmt.Errorf("Page 'route' must start with '/' and can't contain whitespace or quotes")
+	}
+
+	if strings.HasPrefix(p.Route, "/admin") || strings.HasPrefix(p.Route, "/api/") {
+		return fmt.Errorf("Page 'route' can't be under /admin or /api")
+	}
+
+	if p.Route != currentRoute {
+		pt := db.PagesTable{}
+		if _, err := pt.SelectByRoute(db.Conn, p.Route); err == nil {
+			return fmt.Errorf("A page with route '%s' already exists", p.Route)
+		}
+	}
+
+	p.CachePolicy = cachePolicyByName(p.CachePolicy).Name
+	p.Layout = pageLayoutByName(p.Layout)
+	p.ContentFormat = contentFormatByName(p.ContentFormat).Name
+	p.Tags = normaliseTags(p.Tags)
+	p.SitemapChangeFreq = sitemapChangeFreqByName(p.SitemapChangeFreq)
+	p.SitemapPriority = sitemapPriorityByValue(p.SitemapPriority)
+	p.TwitterCard = twitterCardByName(p.TwitterCard)
+
+	p.CanonicalURL = strings.TrimSpace(p.CanonicalURL)
+	if len(p.CanonicalURL) > 0 {
+		if u, err := url.Parse(p.CanonicalURL); err != nil || (!u.IsAbs() && !strings.HasPrefix(p.CanonicalURL, "/")) {
+			return fmt.Errorf("Page 'canonicalurl' must be absolute or start with '/'")
+		}
+	}
+
+	p.JSONLD = strings.TrimSpace(p.JSONLD)
+	if !validJSONLD(p.JSONLD) {
+		return fmt.Errorf("Page 'jsonld' must be a JSON object or array")
+	}
+
+	return nil
+}
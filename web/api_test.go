@@ -0,0 +1,230 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+)
+
+func apiRequest(r *mux.Router, method string, uri string, token string, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest(method, uri, strings.NewReader(body))
+	if len(token) > 0 {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	responseRecorder := httptest.NewRecorder()
+	r.ServeHTTP(responseRecorder, req)
+
+	decoded := map[string]interface{}{}
+	json.NewDecoder(responseRecorder.Body).Decode(&decoded)
+	return responseRecorder, decoded
+}
+
+func TestAPIGroupsAndMembers(t *testing.T) {
+	ut := db.UsersTable{}
+	if !ut.RootUserExists() {
+		ut.Insert(db.Conn, &db.User{
+			CreatedDateTime: time.Now().Unix(),
+			UserroleId:      int(db.ROOT_USER),
+			Username:        "apiroot",
+			AuthHash:        util.HashAndSalt([]byte("apiroot")),
+			Email:           "apiroot@example.com",
+		})
+	}
+
+	root, err := ut.SelectRootUser(db.Conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := insertAPIToken(t, root, ScopeUsersManage)
+
+	mr := &MutableRouter{}
+	r := mux.NewRouter()
+	mr.mapAPI(r)
+
+	if resp, body := apiRequest(r, "GET", "/api/v1/groups", "wrongtoken", ""); resp.Code != http.StatusUnauthorized || body["error"] == nil {
+		t.Fatalf("Expected 401 JSON error for invalid token, got %d", resp.Code)
+	}
+
+	readOnly := insertAPIToken(t, root, ScopePagesRead)
+	if resp, body := apiRequest(r, "GET", "/api/v1/groups", readOnly, ""); resp.Code != http.StatusForbidden || body["error"] == nil {
+		t.Errorf("Expected 403 JSON error for the root user's token without the scope, got %d", resp.Code)
+	}
+
+	resp, body := apiRequest(r, "POST", "/api/v1/groups", token, `{"title": "API Testers"}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 creating group, got %d: %v", resp.Code, body)
+	}
+	groupUUID := body["data"].(map[string]interface{})["UUID"].(string)
+
+	if resp, _ := apiRequest(r, "POST", "/api/v1/groups", token, `{"title": "API Testers"}`); resp.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected 422 creating group with duplicate title, got %d", resp.Code)
+	}
+
+	resp, body = apiRequest(r, "POST", "/api/v1/users", token, `{"username": "apiuser", "password": "secret", "firstname": "Api", "lastname": "User", "email": "apiuser@example.com"}`)
+	if resp.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 creating user, got %d: %v", resp.Code, body)
+	}
+	user := body["data"].(map[string]interface{})
+	if _, exists := user["authhash"]; exists {
+		t.Errorf("User returned by API includes their password hash")
+	}
+	userUUID := user["UUID"].(string)
+
+	if resp, body := apiRequest(r, "POST", "/api/v1/groups/"+groupUUID+"/members", token, `{"useruuid": "`+userUUID+`"}`); resp.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 adding member, got %d: %v", resp.Code, body)
+	}
+
+	resp, body = apiRequest(r, "GET", "/api/v1/groups/"+groupUUID+"/members?limit=10", token, "")
+	pagination := body["pagination"].(map[string]interface{})
+	if resp.Code != http.StatusOK || pagination["total"].(float64) != 1 || pagination["limit"].(float64) != 10 {
+		t.Errorf("Expected one membership listed, got %d: %v", resp.Code, body)
+	}
+
+	resp, body = apiRequest(r, "GET", "/api/v1/groups?title=Testers", token, "")
+	if resp.Code != http.StatusOK || len(body["data"].([]interface{})) != 1 {
+		t.Errorf("Expected filtering groups by title to find one group, got %d: %v", resp.Code, body)
+	}
+
+	if resp, _ := apiRequest(r, "DELETE", "/api/v1/groups/"+groupUUID+"/members/"+userUUID, token, ""); resp.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 removing member, got %d", resp.Code)
+	}
+
+	if resp, body := apiRequest(r, "GET", "/api/v1/groups/not-a-uuid", token, ""); resp.Code != http.StatusNotFound || body["error"] == nil {
+		t.Errorf("Expected 404 JSON error for unknown group, got %d", resp.Code)
+	}
+}
+
+//insertAPIToken saves a token for u with scopes directly, skipping the checks made when tokens are created
+func insertAPIToken(t *testing.T, u *db.User, scopes string) string {
+	secret := fmt.Sprintf("secret%d", time.Now().UnixNano())
+	token := &db.APIToken{
+		CreatedDateTime: time.Now().Unix(),
+		UserUUID:        u.UUID,
+		Name:            "Inserted",
+		SecretHash:      hashAPITokenSecret(secret),
+		Scopes:          scopes,
+	}
+	att := db.APITokensTable{}
+	if err := att.Insert(db.Conn, token); err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%s%s_%s", apiTokenPrefix, token.UUID, secret)
+}
+
+func TestAPIUsersRootOnly(t *testing.T) {
+	ut := db.UsersTable{}
+	if !ut.RootUserExists() {
+		ut.Insert(db.Conn, &db.User{
+			CreatedDateTime: time.Now().Unix(),
+			UserroleId:      int(db.ROOT_USER),
+			Username:        "apiroot",
+			AuthHash:        util.HashAndSalt([]byte("apiroot")),
+			Email:           "apiroot@example.com",
+		})
+	}
+	root, err := ut.SelectRootUser(db.Conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	moderator := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.MOD_USER),
+		Username:        "apimoderator",
+		AuthHash:        util.HashAndSalt([]byte("apimoderator")),
+		FirstName:       "Api",
+		LastName:        "Moderator",
+		Email:           "apimoderator@example.com",
+	}
+	if err := ut.Insert(db.Conn, moderator); err != nil {
+		t.Fatal(err)
+	}
+	token := insertAPIToken(t, moderator, ScopeUsersManage)
+
+	rootToken := insertAPIToken(t, root, ScopeUsersManage)
+
+	mr := &MutableRouter{}
+	r := mux.NewRouter()
+	mr.mapAPI(r)
+
+	takeover := `{"password": "taken", "email": "attacker@example.com"}`
+	if resp, _ := apiRequest(r, "PUT", "/api/v1/users/"+root.UUID, token, takeover); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a moderator changing the root user's credentials, got %d", resp.Code)
+	}
+	if resp, _ := apiRequest(r, "POST", "/api/v1/users", token, `{"username": "apimodmade", "password": "secret", "firstname": "Api", "lastname": "User", "email": "apimodmade@example.com"}`); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a moderator creating a user, got %d", resp.Code)
+	}
+	if resp, _ := apiRequest(r, "GET", "/api/v1/users", token, ""); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a moderator listing users, got %d", resp.Code)
+	}
+
+	unchanged, err := ut.SelectRootUser(db.Conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged.Email != root.Email || unchanged.AuthHash != root.AuthHash {
+		t.Fatal("Expected the root user's credentials to be unchanged")
+	}
+
+	req := apiUserRequest{UserroleId: root.UserroleId, Username: root.Username, FirstName: "Root", LastName: "User", Email: "attacker@example.com"}
+	if err := validateAPIUser(&req, root, moderator); err == nil {
+		t.Error("Expected changing the root user's email as someone else to be invalid")
+	}
+	req = apiUserRequest{UserroleId: root.UserroleId, Username: root.Username, FirstName: "Root", LastName: "User", Email: root.Email, Password: "taken"}
+	if err := validateAPIUser(&req, root, moderator); err == nil {
+		t.Error("Expected changing the root user's password as someone else to be invalid")
+	}
+	if err := validateAPIUser(&req, root, root); err != nil {
+		t.Errorf("Expected the root user to be able to change their own password, got %s", err.Error())
+	}
+
+	if resp, body := apiRequest(r, "GET", "/api/v1/users/"+moderator.UUID, rootToken, ""); resp.Code != http.StatusOK {
+		t.Errorf("Expected 200 for the root user getting a user, got %d: %v", resp.Code, body)
+	}
+}
+
+func TestAPIOpenAPIDocument(t *testing.T) {
+	mr := &MutableRouter{}
+	r := mux.NewRouter()
+	mr.mapAPI(r)
+
+	resp, body := apiRequest(r, "GET", "/api/v1/openapi.json", "", "")
+	if resp.Code != http.StatusOK {
+		t.Fatalf("Expected 200 fetching OpenAPI document, got %d", resp.Code)
+	}
+
+	paths := body["paths"].(map[string]interface{})
+	for _, endpoint := range mr.apiEndpoints() {
+		path, exists := paths[endpoint.Path].(map[string]interface{})
+		if !exists || path[strings.ToLower(endpoint.Method)] == nil {
+			t.Errorf("OpenAPI document is missing %s %s", endpoint.Method, endpoint.Path)
+		}
+	}
+
+	user := body["components"].(map[string]interface{})["schemas"].(map[string]interface{})["User"].(map[string]interface{})
+	if _, exists := user["properties"].(map[string]interface{})["authhash"]; exists {
+		t.Errorf("OpenAPI User schema includes the password hash")
+	}
+}
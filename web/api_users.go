@@ -0,0 +1,357 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+)
+
+//apiUserFilters query parameters users can be listed by
+var apiUserFilters = []apiParam{
+	{Name: "username", Description: "Users with usernames containing this"},
+	{Name: "email", Description: "Users with emails containing this"},
+	{Name: "userroleid", Description: "Users with this role, 2 root, 3 moderator or 4 regular"},
+}
+
+//apiUser a user as returned by the API, without their password hash
+type apiUser struct {
+	UserId          int    `json:"userid"`
+	CreatedDateTime int64  `json:"createddatetime"`
+	UserroleId      int    `json:"userroleid"`
+	UUID            string `json:"UUID"`
+	Username        string `json:"username"`
+	FirstName       string `json:"firstname"`
+	LastName        string `json:"lastname"`
+	Email           string `json:"email"`
+}
+
+//apiUserRequest a user as sent to the API, password is only required when creating a user
+type apiUserRequest struct {
+	UserroleId int    `json:"userroleid"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	FirstName  string `json:"firstname"`
+	LastName   string `json:"lastname"`
+	Email      string `json:"email"`
+}
+
+func newAPIUser(u *db.User) apiUser {
+	return apiUser{
+		UserId:          u.UserId,
+		CreatedDateTime: u.CreatedDateTime,
+		UserroleId:      u.UserroleId,
+		UUID:            u.UUID,
+		Username:        u.Username,
+		FirstName:       u.FirstName,
+		LastName:        u.LastName,
+		Email:           u.Email,
+	}
+}
+
+func (mr *MutableRouter) apiUserEndpoints() []apiEndpoint {
+	return []apiEndpoint{
+		{
+			Method: "GET", Path: "/users", Summary: "List users", Tag: "users", Scope: ScopeUsersManage, Query: apiUserFilters,
+			Response: apiUser{}, List: true, Status: http.StatusOK, Handle: mr.apiListUsers,
+		},
+		{
+			Method: "POST", Path: "/users", Summary: "Create a user", Tag: "users", Scope: ScopeUsersManage,
+			Request: apiUserRequest{}, Response: apiUser{}, Status: http.StatusCreated, Handle: mr.apiCreateUser,
+		},
+		{
+			Method: "GET", Path: "/users/{uuid}", Summary: "Get a user", Tag: "users", Scope: ScopeUsersManage,
+			Response: apiUser{}, Status: http.StatusOK, Handle: mr.apiGetUser,
+		},
+		{
+			Method: "PUT", Path: "/users/{uuid}", Summary: "Update a user, fields left out keep their values", Tag: "users", Scope: ScopeUsersManage,
+			Request: apiUserRequest{}, Response: apiUser{}, Status: http.StatusOK, Handle: mr.apiUpdateUser,
+		},
+		{
+			Method: "DELETE", Path: "/users/{uuid}", Summary: "Delete a user along with their group memberships and API tokens", Tag: "users", Scope: ScopeUsersManage,
+			Status: http.StatusNoContent, Handle: mr.apiDeleteUser,
+		},
+	}
+}
+
+//apiCallerIsRoot checks caller is the root user, only root can manage users, writes a forbidden response if they're not
+func apiCallerIsRoot(w http.ResponseWriter, caller *db.User) bool {
+	if caller == nil || db.UsersRoleFlag(caller.UserroleId) != db.ROOT_USER {
+		writeAPIError(w, http.StatusForbidden, "Only the root user can manage users")
+		return false
+	}
+	return true
+}
+
+func (mr *MutableRouter) apiListUsers(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	if !apiCallerIsRoot(w, caller) {
+		return
+	}
+
+	opts, ok := apiListOptions(w, r, apiUserFilters)
+	if !ok {
+		return
+	}
+
+	ut := db.UsersTable{}
+	users, total, err := ut.List(db.Conn, opts)
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	views := []apiUser{}
+	for _, u := range users {
+		views = append(views, newAPIUser(u))
+	}
+
+	writeAPIList(w, views, paginationFor(opts, total))
+}
+
+func (mr *MutableRouter) apiGetUser(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	if !apiCallerIsRoot(w, caller) {
+		return
+	}
+
+	u, err := apiUserByUUID(mux.Vars(r)["uuid"])
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+	writeAPIData(w, http.StatusOK, newAPIUser(u))
+}
+
+func (mr *MutableRouter) apiCreateUser(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	if !apiCallerIsRoot(w, caller) {
+		return
+	}
+
+	req := apiUserRequest{UserroleId: int(db.REG_USER)}
+	if !decodeAPIBody(w, r, &req) {
+		return
+	}
+
+	if err := validateAPIUser(&req, nil, caller); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if len(req.Password) == 0 {
+		writeAPIError(w, http.StatusUnprocessableEntity, "User 'password' can't be blank")
+		return
+	}
+
+	u := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      req.UserroleId,
+		Username:        req.Username,
+		AuthHash:        util.HashAndSalt([]byte(req.Password)),
+		FirstName:       req.FirstName,
+		LastName:        req.LastName,
+		Email:           req.Email,
+	}
+
+	ut := db.UsersTable{}
+	if err := ut.Insert(db.Conn, u); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("%s/users/%s", APIPrefix, u.UUID))
+	writeAPIData(w, http.StatusCreated, newAPIUser(u))
+}
+
+func (mr *MutableRouter) apiUpdateUser(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	if !apiCallerIsRoot(w, caller) {
+		return
+	}
+
+	u, err := apiUserByUUID(mux.Vars(r)["uuid"])
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	//decoding over the existing user leaves any fields which weren't sent unchanged
+	req := apiUserRequest{
+		UserroleId: u.UserroleId,
+		Username:   u.Username,
+		FirstName:  u.FirstName,
+		LastName:   u.LastName,
+		Email:      u.Email,
+	}
+	if !decodeAPIBody(w, r, &req) {
+		return
+	}
+
+	if err := validateAPIUser(&req, u, caller); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	u.UserroleId = req.UserroleId
+	u.Username = req.Username
+	u.FirstName = req.FirstName
+	u.LastName = req.LastName
+	u.Email = req.Email
+	if len(req.Password) > 0 {
+		u.AuthHash = util.HashAndSalt([]byte(req.Password))
+	}
+
+	ut := db.UsersTable{}
+	if err := ut.Update(db.Conn, u); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	writeAPIData(w, http.StatusOK, newAPIUser(u))
+}
+
+func (mr *MutableRouter) apiDeleteUser(w http.ResponseWriter, r *http.Request, caller *db.User) {
+	if !apiCallerIsRoot(w, caller) {
+		return
+	}
+
+	u, err := apiUserByUUID(mux.Vars(r)["uuid"])
+	if err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	if db.UsersRoleFlag(u.UserroleId) == db.ROOT_USER {
+		writeAPIError(w, http.StatusForbidden, "The root user can't be deleted")
+		return
+	}
+
+	gmt := db.GroupMembershipTable{}
+	if _, err := gmt.DeleteUserFromGroup(db.Conn, u, &db.Group{UUID: "*"}); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	att := db.APITokensTable{}
+	if _, err := att.DeleteByUserUUID(db.Conn, u.UUID); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	oit := db.OIDCIdentitiesTable{}
+	if _, err := oit.DeleteByUserUUID(db.Conn, u.UUID); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	tft := db.TwoFactorsTable{}
+	if _, err := tft.DeleteByUserUUID(db.Conn, u.UUID); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	tfct := db.TwoFactorChallengesTable{}
+	if _, err := tfct.DeleteByUserUUID(db.Conn, u.UUID); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	rct := db.RecoveryCodesTable{}
+	if _, err := rct.DeleteByUserUUID(db.Conn, u.UUID); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	prt := db.PasswordResetsTable{}
+	if _, err := prt.DeleteByUserUUID(db.Conn, u.UUID); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	ut := db.UsersTable{}
+	if _, err := ut.DeleteByUUID(db.Conn, u.UUID); err != nil {
+		writeAPIFailure(w, err)
+		return
+	}
+
+	writeAPIJSON(w, http.StatusNoContent, nil)
+}
+
+//apiUserByUUID get the user with userUUID
+func apiUserByUUID(userUUID string) (*db.User, error) {
+	if !uuidPattern.MatchString(userUUID) {
+		return nil, errAPINotFound
+	}
+
+	ut := db.UsersTable{}
+	u, err := ut.SelectByUUID(db.Conn, userUUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(u.UUID) == 0 {
+		return nil, errAPINotFound
+	}
+	return u, nil
+}
+
+//validateAPIUser checks a user sent to the API by caller is valid, current is the saved user if they already exist
+func validateAPIUser(req *apiUserRequest, current *db.User, caller *db.User) error {
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	req.FirstName = strings.TrimSpace(req.FirstName)
+	req.LastName = strings.TrimSpace(req.LastName)
+
+	if len(req.FirstName) == 0 || len(req.LastName) == 0 || len(req.Email) == 0 || len(req.Username) == 0 {
+		return fmt.Errorf("User 'username', 'email', 'firstname' and 'lastname' can't be blank")
+	}
+
+	if match, err := regexp.MatchString(usernameRegex, req.Username); err != nil || !match {
+		return fmt.Errorf("User 'username' does not match pattern %s", usernameRegex)
+	}
+
+	if match, err := regexp.MatchString(emailRegex, req.Email); err != nil || !match {
+		return fmt.Errorf("User 'email' does not match pattern %s", emailRegex)
+	}
+
+	if current == nil || req.Username != current.Username {
+		ut := db.UsersTable{}
+		if existing, err := ut.SelectByUsername(db.Conn, req.Username); err == nil && len(existing.UUID) > 0 {
+			return fmt.Errorf("A user with username '%s' already exists", req.Username)
+		}
+	}
+
+	//there can only be one root user, who keeps their role and is the only one who can change their credentials
+	if current != nil && db.UsersRoleFlag(current.UserroleId) == db.ROOT_USER {
+		if req.UserroleId != current.UserroleId {
+			return fmt.Errorf("The root user's 'userroleid' can't be changed")
+		}
+		if caller == nil || caller.UUID != current.UUID {
+			if len(req.Password) > 0 || req.Email != current.Email {
+				return fmt.Errorf("Only the root user can change their 'password' or 'email'")
+			}
+		}
+		return nil
+	}
+
+	if role := db.UsersRoleFlag(req.UserroleId); role != db.MOD_USER && role != db.REG_USER {
+		return fmt.Errorf("User 'userroleid' must be %d (moderator) or %d (regular)", db.MOD_USER, db.REG_USER)
+	}
+
+	return nil
+}
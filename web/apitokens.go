@@ -0,0 +1,253 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//ScopePagesRead allows reading pages, including role protected ones
+	ScopePagesRead = "pages:read"
+	//ScopePagesWrite allows creating, editing and deleting pages
+	ScopePagesWrite = "pages:write"
+	//ScopeUsersManage allows managing users and groups
+	ScopeUsersManage = "users:manage"
+
+	//apiTokenPrefix starts every personal API token so they're recognisable, eg., in leaked secret scans
+	apiTokenPrefix = "berry_"
+	//apiTokenSecretSize number of random bytes in a token's secret
+	apiTokenSecretSize = 32
+)
+
+//APIScope describes what a personal API token can be allowed to do, and the least privileged role which can grant it
+type APIScope struct {
+	Name  string
+	Label string
+	Role  db.UsersRoleFlag
+}
+
+//APIScopes get every scope a personal API token can be granted
+func APIScopes() []APIScope {
+	return []APIScope{
+		{Name: ScopePagesRead, Label: "Read pages", Role: db.REG_USER},
+		{Name: ScopePagesWrite, Label: "Write pages", Role: db.MOD_USER},
+		{Name: ScopeUsersManage, Label: "Manage users and groups", Role: db.ROOT_USER},
+	}
+}
+
+//APIScopesForRole get the scopes a user with role can grant their tokens
+func APIScopesForRole(role db.UsersRoleFlag) []APIScope {
+	scopes := []APIScope{}
+	for _, scope := range APIScopes() {
+		if roleCanGrantScope(role, scope.Name) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+//roleCanGrantScope checks a user with role can grant scope, roles with lower numbers are more privileged
+func roleCanGrantScope(role db.UsersRoleFlag, scope string) bool {
+	for _, s := range APIScopes() {
+		if s.Name == scope {
+			return role >= db.ROOT_USER && role <= s.Role
+		}
+	}
+	return false
+}
+
+//tokenGrantsScope checks token was granted scope and its owner u's role still allows it, eg., they
+//might have been demoted since the token was created
+func tokenGrantsScope(token *db.APIToken, u *db.User, scope string) bool {
+	return token.HasScope(scope) && roleCanGrantScope(db.UsersRoleFlag(u.UserroleId), scope)
+}
+
+//APITokenExpiry an expiry which can be chosen for a new token
+type APITokenExpiry struct {
+	Days  int
+	Label string
+}
+
+//APITokenExpiries get the expiries which can be chosen for a new token, 0 days never expires
+func APITokenExpiries() []APITokenExpiry {
+	return []APITokenExpiry{
+		{Days: 30, Label: "30 days"},
+		{Days: 90, Label: "90 days"},
+		{Days: 365, Label: "1 year"},
+		{Days: 0, Label: "Never"},
+	}
+}
+
+//apiScopesByName keeps only the known scopes in names, in a fixed order
+func apiScopesByName(names []string) []string {
+	scopes := []string{}
+	for _, scope := range APIScopes() {
+		for _, name := range names {
+			if name == scope.Name {
+				scopes = append(scopes, scope.Name)
+				break
+			}
+		}
+	}
+	return scopes
+}
+
+//hashAPITokenSecret hashes a token's secret for storage, secrets are random so don't need a slow hash
+func hashAPITokenSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+//createAPIToken creates a named token for user with scopes, expiring after days or never if 0,
+//returning the token to show the user, it can't be recovered once they've left the page
+func createAPIToken(u *db.User, name string, scopes []string, days int) (string, *db.APIToken, error) {
+	name = strings.TrimSpace(name)
+	if len(name) == 0 {
+		return "", nil, errors.New("Token name can't be blank")
+	}
+
+	scopes = apiScopesByName(scopes)
+	if len(scopes) == 0 {
+		return "", nil, errors.New("Token needs at least one scope")
+	}
+
+	for _, scope := range scopes {
+		if !roleCanGrantScope(db.UsersRoleFlag(u.UserroleId), scope) {
+			return "", nil, fmt.Errorf("Your role can't grant tokens the '%s' scope", scope)
+		}
+	}
+
+	secretBytes := make([]byte, apiTokenSecretSize)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return "", nil, err
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	now := time.Now()
+	t := &db.APIToken{
+		CreatedDateTime: now.Unix(),
+		UserUUID:        u.UUID,
+		Name:            name,
+		SecretHash:      hashAPITokenSecret(secret),
+		Scopes:          strings.Join(scopes, ","),
+	}
+	if days > 0 {
+		t.ExpiresDateTime = now.AddDate(0, 0, days).Unix()
+	}
+
+	att := db.APITokensTable{}
+	if err := att.Insert(db.Conn, t); err != nil {
+		return "", nil, err
+	}
+
+	return fmt.Sprintf("%s%s_%s", apiTokenPrefix, t.UUID, secret), t, nil
+}
+
+//authenticateAPIToken checks raw is a valid unexpired personal token, recording it's been used,
+//and returns it along with the user it belongs to
+func authenticateAPIToken(raw string) (*db.APIToken, *db.User, error) {
+	invalid := errors.New("Invalid API token")
+
+	if !strings.HasPrefix(raw, apiTokenPrefix) {
+		return nil, nil, invalid
+	}
+	parts := strings.SplitN(strings.TrimPrefix(raw, apiTokenPrefix), "_", 2)
+	if len(parts) != 2 || !uuidPattern.MatchString(parts[0]) {
+		return nil, nil, invalid
+	}
+
+	att := db.APITokensTable{}
+	t, err := att.SelectByUUID(db.Conn, parts[0])
+	if err != nil {
+		return nil, nil, invalid
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashAPITokenSecret(parts[1])), []byte(t.SecretHash)) != 1 {
+		return nil, nil, invalid
+	}
+
+	now := time.Now().Unix()
+	if t.Expired(now) {
+		return nil, nil, errors.New("API token has expired")
+	}
+
+	ut := db.UsersTable{}
+	u, err := ut.SelectByUUID(db.Conn, t.UserUUID)
+	if err != nil || len(u.UUID) == 0 {
+		return nil, nil, invalid
+	}
+
+	if err := att.UpdateLastUsed(db.Conn, t.UUID, now); err != nil {
+		logging.Error(err.Error())
+	}
+
+	return t, u, nil
+}
+
+//tokenScopeForRoute get the scope a token needs to access a protected route with method, blank if
+//tokens can't access it at all, adminPrefix is the hidden admin prefix if admin pages are hidden
+func tokenScopeForRoute(method string, route string, adminPrefix string) string {
+	write := method != "GET" && method != "HEAD"
+
+	if strings.HasPrefix(route, adminPrefix+"/admin") {
+		route = strings.TrimPrefix(route, adminPrefix+"/admin")
+		switch {
+		case strings.HasPrefix(route, "/pages"):
+			if write {
+				return ScopePagesWrite
+			}
+			return ScopePagesRead
+		case strings.HasPrefix(route, "/users"):
+			return ScopeUsersManage
+		}
+		//the rest of the admin pages change site wide settings, which only a browser login can do
+		return ""
+	}
+
+	//everything else protected is a role protected page
+	if write {
+		return ScopePagesWrite
+	}
+	return ScopePagesRead
+}
+
+//tokenHasScopeForRequest checks the request's bearer token is valid and grants access to the requested route
+func (amw *AuthMiddleware) tokenHasScopeForRequest(r *http.Request) bool {
+	t, u, err := authenticateAPIToken(bearerToken(r))
+	if err != nil {
+		logging.Debug(err.Error())
+		return false
+	}
+
+	adminPrefix := ""
+	if amw.Router != nil && amw.Router.AdminHidden {
+		adminPrefix = fmt.Sprintf("/%s", amw.Router.AdminHiddenPassword)
+	}
+
+	scope := tokenScopeForRoute(r.Method, r.URL.Path, adminPrefix)
+	return len(scope) > 0 && tokenGrantsScope(t, u, scope)
+}
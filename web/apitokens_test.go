@@ -0,0 +1,147 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+)
+
+func TestAPITokenScopes(t *testing.T) {
+	u := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.MOD_USER),
+		Username:        "tokenowner",
+		AuthHash:        util.HashAndSalt([]byte("tokenowner")),
+		Email:           "tokenowner@example.com",
+	}
+	ut := db.UsersTable{}
+	if err := ut.Insert(db.Conn, u); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := createAPIToken(u, "No scopes", []string{"everything"}, 30); err == nil {
+		t.Errorf("Expected creating a token without any known scopes to fail")
+	}
+
+	token, created, err := createAPIToken(u, "Reader", []string{ScopePagesRead}, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mr := &MutableRouter{}
+	r := mux.NewRouter()
+	mr.mapAPI(r)
+
+	if resp, body := apiRequest(r, "GET", "/api/v1/pages", token, ""); resp.Code != http.StatusOK {
+		t.Errorf("Expected 200 listing pages with pages:read token, got %d: %v", resp.Code, body)
+	}
+
+	if resp, _ := apiRequest(r, "GET", "/api/v1/users", token, ""); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 listing users with pages:read token, got %d", resp.Code)
+	}
+
+	if resp, _ := apiRequest(r, "GET", "/api/v1/pages", token+"0", ""); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for token with wrong secret, got %d", resp.Code)
+	}
+
+	att := db.APITokensTable{}
+	used, err := att.SelectByUUID(db.Conn, created.UUID)
+	if err != nil || used.LastUsedDateTime == 0 {
+		t.Errorf("Expected token's last used time to be recorded")
+	}
+
+	amw := AuthMiddleware{Router: mr}
+	req := httptest.NewRequest("GET", "/admin/pages", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if !amw.IsLoggedIn(req) {
+		t.Errorf("Expected pages:read token to be logged in for GET /admin/pages")
+	}
+	req = httptest.NewRequest("POST", "/admin/pages/new", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if amw.IsLoggedIn(req) {
+		t.Errorf("Expected pages:read token not to be logged in for POST /admin/pages/new")
+	}
+
+	expired, _, err := createAPIToken(u, "Expired", []string{ScopePagesRead}, 30)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Conn.Exec("UPDATE apitokens SET expiresdatetime = ? WHERE tokenname = ?", time.Now().Add(-time.Hour).Unix(), "Expired")
+	if resp, _ := apiRequest(r, "GET", "/api/v1/pages", expired, ""); resp.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for expired token, got %d", resp.Code)
+	}
+}
+
+func TestAPITokenScopesLimitedByRole(t *testing.T) {
+	ut := db.UsersTable{}
+	regular := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.REG_USER),
+		Username:        "regulartokenowner",
+		AuthHash:        util.HashAndSalt([]byte("regulartokenowner")),
+		Email:           "regulartokenowner@example.com",
+	}
+	if err := ut.Insert(db.Conn, regular); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := createAPIToken(regular, "Manager", []string{ScopeUsersManage}, 30); err == nil {
+		t.Error("Expected a regular user creating a users:manage token to fail")
+	}
+	if _, _, err := createAPIToken(regular, "Writer", []string{ScopePagesRead, ScopePagesWrite}, 30); err == nil {
+		t.Error("Expected a regular user creating a pages:write token to fail")
+	}
+	if _, _, err := createAPIToken(regular, "Reader", []string{ScopePagesRead}, 30); err != nil {
+		t.Errorf("Expected a regular user to be able to create a pages:read token, got %s", err.Error())
+	}
+
+	if scopes := APIScopesForRole(db.REG_USER); len(scopes) != 1 || scopes[0].Name != ScopePagesRead {
+		t.Errorf("Expected regular users to only be offered pages:read, got %v", scopes)
+	}
+	if scopes := APIScopesForRole(db.MOD_USER); len(scopes) != 2 {
+		t.Errorf("Expected moderators to be offered pages:read and pages:write, got %v", scopes)
+	}
+	if scopes := APIScopesForRole(db.ROOT_USER); len(scopes) != len(APIScopes()) {
+		t.Errorf("Expected the root user to be offered every scope, got %v", scopes)
+	}
+
+	//a token granted more than its owner's role allows, eg., they've since been demoted, is checked again when used
+	token := insertAPIToken(t, regular, ScopeUsersManage+","+ScopePagesWrite)
+
+	mr := &MutableRouter{}
+	r := mux.NewRouter()
+	mr.mapAPI(r)
+
+	if resp, _ := apiRequest(r, "GET", "/api/v1/users", token, ""); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 listing users with a regular user's users:manage token, got %d", resp.Code)
+	}
+	if resp, _ := apiRequest(r, "POST", "/api/v1/pages", token, `{"title": "Not allowed", "route": "/notallowed"}`); resp.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 creating a page with a regular user's pages:write token, got %d", resp.Code)
+	}
+
+	amw := AuthMiddleware{Router: mr}
+	req := httptest.NewRequest("GET", "/admin/users", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if amw.IsLoggedIn(req) {
+		t.Error("Expected a regular user's users:manage token not to be logged in for GET /admin/users")
+	}
+}
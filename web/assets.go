@@ -0,0 +1,92 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/tacusci/berrycms/themes"
+)
+
+//assets file system containing the 'res' templates, 'static' files and 'themes', until set it's the working directory
+var assets fs.FS = os.DirFS(".")
+
+//overrideDir the on disk directory layered on top of the default assets, blank if there isn't one
+var overrideDir string
+
+//SetAssets sets the default assets, usually compiled into the binary, and optionally a directory
+//whose 'res', 'static' and 'themes' files take precedence over them
+func SetAssets(defaults fs.FS, override string) {
+	overrideDir = override
+	if len(override) == 0 {
+		assets = defaults
+	} else {
+		assets = &layeredFS{
+			upper: os.DirFS(override),
+			lower: defaults,
+		}
+	}
+	themes.SetFS(assets)
+}
+
+//OverrideDir get the on disk directory layered on top of the default assets
+func OverrideDir() string { return overrideDir }
+
+//layeredFS looks up files in the upper file system first, falling back to the lower one
+type layeredFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+//Open opens named file from the upper file system if it exists there, otherwise from the lower
+func (lfs *layeredFS) Open(name string) (fs.File, error) {
+	f, err := lfs.upper.Open(name)
+	if err == nil {
+		return f, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return lfs.lower.Open(name)
+}
+
+//ReadDir merges directory entries of both file systems, upper entries replace lower ones of the same name
+func (lfs *layeredFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upperEntries, upperErr := fs.ReadDir(lfs.upper, name)
+	lowerEntries, lowerErr := fs.ReadDir(lfs.lower, name)
+
+	if upperErr != nil && lowerErr != nil {
+		return nil, lowerErr
+	}
+
+	merged := map[string]fs.DirEntry{}
+	for _, entry := range lowerEntries {
+		merged[entry.Name()] = entry
+	}
+	for _, entry := range upperEntries {
+		merged[entry.Name()] = entry
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, entry := range merged {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	return entries, nil
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/tacusci/berrycms/themes"
+)
+
+func TestAssetOverrides(t *testing.T) {
+	previous := assets
+	defer func() {
+		assets = previous
+		overrideDir = ""
+		themes.SetFS(nil)
+	}()
+
+	defaults := fstest.MapFS{
+		"res/login.html":       {Data: []byte("built in login")},
+		"res/admin.html":       {Data: []byte("built in admin")},
+		"static/css/site.css":  {Data: []byte("built in css")},
+		"themes/default/x.txt": {Data: []byte("built in theme")},
+	}
+
+	override := t.TempDir()
+	for name, content := range map[string]string{
+		"res/login.html":       "overridden login",
+		"res/extra.snip":       "added snippet",
+		"static/css/site.css":  "overridden css",
+		"themes/custom/y.txt":  "added theme",
+		"themes/default/x.txt": "overridden theme",
+	} {
+		path := filepath.Join(override, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	SetAssets(defaults, override)
+	if OverrideDir() != override {
+		t.Errorf("Expected override directory %s, got %s", override, OverrideDir())
+	}
+
+	for name, want := range map[string]string{
+		"res/login.html":       "overridden login",
+		"res/admin.html":       "built in admin",
+		"res/extra.snip":       "added snippet",
+		"static/css/site.css":  "overridden css",
+		"themes/default/x.txt": "overridden theme",
+	} {
+		got, err := fs.ReadFile(assets, name)
+		if err != nil {
+			t.Errorf("Unable to read %s -> %s", name, err.Error())
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("Expected %s to be %q, got %q", name, want, got)
+		}
+	}
+
+	if _, err := assets.Open("res/missing.html"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Expected a file in neither to not exist, got %v", err)
+	}
+
+	entries, err := fs.ReadDir(assets, "res")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != 3 || names[0] != "admin.html" || names[1] != "extra.snip" || names[2] != "login.html" {
+		t.Errorf("Expected the merged, sorted entries of both res directories, got %v", names)
+	}
+
+	if themeNames := themes.List(); len(themeNames) != 2 || themeNames[0] != "custom" || themeNames[1] != "default" {
+		t.Errorf("Expected themes from both the built in and override directories, got %v", themeNames)
+	}
+
+	SetAssets(defaults, "")
+	if len(OverrideDir()) > 0 {
+		t.Error("Expected no override directory once it's been unset")
+	}
+	if got, _ := fs.ReadFile(assets, "res/login.html"); string(got) != "built in login" {
+		t.Errorf("Expected the built in login template without an override directory, got %q", got)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+)
+
+//CachePolicy describes a named Cache-Control header value which can be selected per page
+type CachePolicy struct {
+	Name         string
+	Label        string
+	CacheControl string
+}
+
+//DefaultCachePolicy policy used for pages which have not chosen one, always revalidate
+const DefaultCachePolicy = "revalidate"
+
+//CachePolicies get fixed list of cache policies available in the page editor
+func CachePolicies() []CachePolicy {
+	return []CachePolicy{
+		{Name: DefaultCachePolicy, Label: "Always revalidate", CacheControl: "no-cache"},
+		{Name: "nostore", Label: "Never cache", CacheControl: "no-store"},
+		{Name: "short", Label: "Cache for 5 minutes", CacheControl: "public, max-age=300"},
+		{Name: "hour", Label: "Cache for 1 hour", CacheControl: "public, max-age=3600"},
+		{Name: "day", Label: "Cache for 1 day", CacheControl: "public, max-age=86400"},
+	}
+}
+
+//cachePolicyByName finds cache policy matching name, falls back to the default policy if none match
+func cachePolicyByName(name string) CachePolicy {
+	policies := CachePolicies()
+	for _, policy := range policies {
+		if policy.Name == name {
+			return policy
+		}
+	}
+	return policies[0]
+}
+
+//pageCacheControl get the Cache-Control header value to send for given page
+func pageCacheControl(p *db.Page) string {
+	//protected pages must never end up in a shared cache
+	if p.Roleprotected {
+		return "private, no-cache"
+	}
+	return cachePolicyByName(p.CachePolicy).CacheControl
+}
+
+var (
+	renderSettingsMu sync.RWMutex
+	//renderSettingsChanged when something every rendered page depends on, such as the theme, shortcodes,
+	//SEO defaults or sanitiser policy, last changed, starting from when the server started
+	renderSettingsChanged = time.Now()
+)
+
+//renderSettingsModified notes that something every rendered page depends on has just changed
+func renderSettingsModified() {
+	renderSettingsMu.Lock()
+	defer renderSettingsMu.Unlock()
+	renderSettingsChanged = time.Now()
+}
+
+//renderedModifiedTime get the time the rendered page last changed, whichever is later of when the page
+//was modified and when what pages are rendered with last changed
+func renderedModifiedTime(p *db.Page) time.Time {
+	renderSettingsMu.RLock()
+	defer renderSettingsMu.RUnlock()
+
+	modified := pageModifiedTime(p)
+	if renderSettingsChanged.After(modified) {
+		return renderSettingsChanged
+	}
+	return modified
+}
+
+//pageModifiedTime get the time the page was last modified, zero time if it's unknown
+func pageModifiedTime(p *db.Page) time.Time {
+	if p.ModifiedDateTime > 0 {
+		return time.Unix(p.ModifiedDateTime, 0)
+	}
+	if p.CreatedDateTime > 0 {
+		return time.Unix(p.CreatedDateTime, 0)
+	}
+	return time.Time{}
+}
+
+//strongETag generates a strong entity tag from the exact bytes of the response body
+func strongETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("\"%s\"", hex.EncodeToString(sum[:16]))
+}
+
+//setValidators writes the cache validator headers to the response
+func setValidators(w http.ResponseWriter, etag string, modtime time.Time) {
+	if len(etag) > 0 {
+		w.Header().Set("ETag", etag)
+	}
+	if !modtime.IsZero() && modtime.Unix() != 0 {
+		w.Header().Set("Last-Modified", modtime.UTC().Format(http.TimeFormat))
+	}
+}
+
+//notModified checks the request's If-None-Match header against the etag of the current representation,
+//falling back to If-Modified-Since against modtime, which has to include when the theme, shortcodes,
+//SEO defaults and sanitiser policy last changed as well as the page
+func notModified(r *http.Request, etag string, modtime time.Time) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); len(inm) > 0 {
+		return etagMatches(inm, etag)
+	}
+
+	if modtime.IsZero() || modtime.Unix() == 0 {
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	//the header only has whole seconds
+	return !modtime.Truncate(time.Second).After(ims)
+}
+
+//etagMatches weak comparison of the If-None-Match header list against the current etag
+func etagMatches(header string, etag string) bool {
+	if len(etag) == 0 {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+//writeNotModified sends the 304 response, entity headers must not be sent with it
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,419 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/tacusci/logging"
+)
+
+//DefaultCompressionMinSize responses smaller than this many bytes aren't worth compressing
+const DefaultCompressionMinSize = 1024
+
+//DefaultCompressibleContentTypes content types which are compressed when no allowlist has been provided
+var DefaultCompressibleContentTypes = []string{
+	"text/html",
+	"text/css",
+	"text/plain",
+	"text/xml",
+	"text/javascript",
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"image/svg+xml",
+}
+
+//encoding describes a supported content coding and the file extension of its precompressed siblings
+type encoding struct {
+	name string
+	ext  string
+}
+
+//supported encodings, in order of preference
+var encodings = []encoding{
+	{name: "br", ext: ".br"},
+	{name: "gzip", ext: ".gz"},
+}
+
+//CompressionMiddleware negotiates gzip/brotli compression of responses
+type CompressionMiddleware struct {
+	Router       *MutableRouter
+	MinSize      int
+	ContentTypes []string
+}
+
+//Middleware attaches http handler to middleware
+func (cm *CompressionMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted := acceptedEncodings(r)
+		if len(accepted) == 0 || r.Method == "HEAD" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			encoding:       accepted[0],
+			minSize:        cm.MinSize,
+			contentTypes:   cm.ContentTypes,
+		}
+		defer cw.Close()
+
+		next.ServeHTTP(cw, r)
+	})
+}
+
+//acceptedEncodings parses the request's Accept-Encoding header into the supported encodings
+//the client will accept, ordered by server preference
+func acceptedEncodings(r *http.Request) []encoding {
+	header := r.Header.Get("Accept-Encoding")
+	if len(header) == 0 {
+		return nil
+	}
+
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(strings.TrimSpace(part), ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if parsed, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		qualities[name] = q
+	}
+
+	accepted := []encoding{}
+	for _, enc := range encodings {
+		q, ok := qualities[enc.name]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > 0 {
+			accepted = append(accepted, enc)
+		}
+	}
+	return accepted
+}
+
+//compressibleContentType checks whether content type is in the allowlist, ignoring any parameters
+func compressibleContentType(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		allowed = DefaultCompressibleContentTypes
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowedType := range allowed {
+		if strings.EqualFold(mediaType, strings.TrimSpace(allowedType)) {
+			return true
+		}
+	}
+	return false
+}
+
+//compressResponseWriter buffers the start of a response until it knows whether it's worth compressing
+type compressResponseWriter struct {
+	http.ResponseWriter
+	encoding     encoding
+	minSize      int
+	contentTypes []string
+	code         int
+	buf          []byte
+	decided      bool
+	encoder      io.WriteCloser
+}
+
+func (cw *compressResponseWriter) WriteHeader(code int) {
+	if cw.code == 0 {
+		cw.code = code
+	}
+	//responses without a body can be sent immediately
+	if code == http.StatusNoContent || code == http.StatusNotModified || code < 200 {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressResponseWriter) Write(data []byte) (int, error) {
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+
+	if !cw.decided {
+		cw.buf = append(cw.buf, data...)
+		if len(cw.buf) < cw.minSize {
+			return len(data), nil
+		}
+		cw.decide(true)
+		return len(data), nil
+	}
+
+	if cw.encoder != nil {
+		return cw.encoder.Write(data)
+	}
+	return cw.ResponseWriter.Write(data)
+}
+
+//decide works out whether to compress the response and writes out the headers and anything buffered so far
+func (cw *compressResponseWriter) decide(bigEnough bool) {
+	if cw.decided {
+		return
+	}
+	cw.decided = true
+
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+
+	h := cw.Header()
+	if len(h.Get("Content-Type")) == 0 && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+
+	compressible := compressibleContentType(h.Get("Content-Type"), cw.contentTypes)
+	if compressible {
+		addVary(h, "Accept-Encoding")
+	}
+
+	if bigEnough && compressible && len(h.Get("Content-Encoding")) == 0 && cw.code == http.StatusOK {
+		h.Set("Content-Encoding", cw.encoding.name)
+		h.Del("Content-Length")
+		//byte ranges would refer to the uncompressed body
+		h.Del("Accept-Ranges")
+		//the compressed representation is no longer byte for byte the same as what a strong tag describes
+		if etag := h.Get("ETag"); len(etag) > 0 && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		switch cw.encoding.name {
+		case "br":
+			cw.encoder = brotli.NewWriterLevel(cw.ResponseWriter, brotli.DefaultCompression)
+		case "gzip":
+			cw.encoder = gzip.NewWriter(cw.ResponseWriter)
+		}
+	}
+
+	cw.ResponseWriter.WriteHeader(cw.code)
+
+	if len(cw.buf) > 0 {
+		if cw.encoder != nil {
+			cw.encoder.Write(cw.buf)
+		} else {
+			cw.ResponseWriter.Write(cw.buf)
+		}
+	}
+	cw.buf = nil
+}
+
+//Flush sends anything buffered to the client, implements http.Flusher
+func (cw *compressResponseWriter) Flush() {
+	cw.decide(true)
+	if flusher, ok := cw.encoder.(interface{ Flush() error }); ok {
+		flusher.Flush()
+	}
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+//Close finishes the response, flushing the buffer and compressed stream
+func (cw *compressResponseWriter) Close() error {
+	//nothing was ever written, leave the response writer untouched
+	if cw.code == 0 && len(cw.buf) == 0 {
+		return nil
+	}
+	cw.decide(len(cw.buf) >= cw.minSize)
+	if cw.encoder != nil {
+		return cw.encoder.Close()
+	}
+	return nil
+}
+
+//precompressedFileServer serves '.br'/'.gz' siblings of requested files if they exist and the client accepts them
+type precompressedFileServer struct {
+	root       http.FileSystem
+	fileServer http.Handler
+}
+
+func newPrecompressedFileServer(root http.FileSystem) *precompressedFileServer {
+	return &precompressedFileServer{
+		root:       root,
+		fileServer: http.FileServer(root),
+	}
+}
+
+func (pfs *precompressedFileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := path.Clean("/" + r.URL.Path)
+
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		for _, enc := range acceptedEncodings(r) {
+			if pfs.serveEncoded(w, r, name, enc) {
+				return
+			}
+		}
+	}
+
+	pfs.fileServer.ServeHTTP(w, r)
+}
+
+func (pfs *precompressedFileServer) serveEncoded(w http.ResponseWriter, r *http.Request, name string, enc encoding) bool {
+	f, err := pfs.root.Open(name + enc.ext)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return false
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if len(contentType) == 0 {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Encoding", enc.name)
+	addVary(w.Header(), "Accept-Encoding")
+	http.ServeContent(w, r, name, info.ModTime(), f)
+	return true
+}
+
+//addVary adds field to the Vary header unless it's already listed, so responses which pass through
+//more than one layer which negotiates on it don't list it twice
+func addVary(h http.Header, field string) {
+	for _, vary := range h.Values("Vary") {
+		for _, listed := range strings.Split(vary, ",") {
+			if listed = strings.TrimSpace(listed); listed == "*" || strings.EqualFold(listed, field) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", field)
+}
+
+//PrecompressStatic writes '.gz' and '.br' siblings of every compressible file in the 'static' directory of the
+//default assets, with overrideDir layered on top, into overrideDir where they're served from alongside the
+//overrides, siblings already there are only rewritten once they're older than the file they were compressed from
+func PrecompressStatic(defaults fs.FS, overrideDir string, minSize int, contentTypes []string) (int, error) {
+	if len(overrideDir) == 0 {
+		return 0, errors.New("Precompressed files are written to the override directory, set one with -overrides")
+	}
+
+	src := &layeredFS{upper: os.DirFS(overrideDir), lower: defaults}
+	compressedCount := 0
+
+	err := fs.WalkDir(src, "static", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() < int64(minSize) {
+			return nil
+		}
+
+		ext := path.Ext(name)
+		for _, enc := range encodings {
+			if ext == enc.ext {
+				return nil
+			}
+		}
+
+		if !compressibleContentType(mime.TypeByExtension(ext), contentTypes) {
+			return nil
+		}
+
+		for _, enc := range encodings {
+			target := filepath.Join(overrideDir, filepath.FromSlash(name+enc.ext))
+			//files compiled into the binary have no modified time, so their siblings are always rewritten
+			if targetInfo, err := os.Stat(target); err == nil && !info.ModTime().IsZero() && !targetInfo.ModTime().Before(info.ModTime()) {
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			logging.Debug(fmt.Sprintf("Precompressing %s -> %s", name, target))
+			if err := compressFile(src, name, target, enc); err != nil {
+				return err
+			}
+			compressedCount++
+		}
+
+		return nil
+	})
+
+	return compressedCount, err
+}
+
+func compressFile(src fs.FS, name string, dst string, enc encoding) error {
+	in, err := src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var encoder io.WriteCloser
+	switch enc.name {
+	case "br":
+		encoder = brotli.NewWriterLevel(out, brotli.BestCompression)
+	case "gzip":
+		encoder, err = gzip.NewWriterLevel(out, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("Unsupported encoding %s", enc.name)
+	}
+
+	if _, err := io.Copy(encoder, in); err != nil {
+		encoder.Close()
+		return err
+	}
+
+	return encoder.Close()
+}
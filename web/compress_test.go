@@ -0,0 +1,225 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+//compressedBody the text which is compressed in the tests, long enough to be worth compressing
+var compressedBody = strings.Repeat("<p>Berry CMS compresses this paragraph.</p>\n", 100)
+
+//serveCompressed sends a request with acceptEncoding through the compression middleware to handler
+func serveCompressed(handler http.HandlerFunc, acceptEncoding string, setup func(r *http.Request)) *http.Response {
+	cm := CompressionMiddleware{MinSize: DefaultCompressionMinSize}
+	req := httptest.NewRequest("GET", "/page", nil)
+	if len(acceptEncoding) > 0 {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	if setup != nil {
+		setup(req)
+	}
+	recorder := httptest.NewRecorder()
+	cm.Middleware(handler).ServeHTTP(recorder, req)
+	return recorder.Result()
+}
+
+//serveText responds with body as contentType
+func serveText(contentType string, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("ETag", `"page"`)
+		w.Write([]byte(body))
+	}
+}
+
+//decompress reads resp's body, decoding it as its Content-Encoding says
+func decompress(t *testing.T, resp *http.Response) string {
+	var data []byte
+	var err error
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		var gr *gzip.Reader
+		if gr, err = gzip.NewReader(resp.Body); err == nil {
+			data, err = ioutil.ReadAll(gr)
+		}
+	case "br":
+		data, err = ioutil.ReadAll(brotli.NewReader(resp.Body))
+	default:
+		data, err = ioutil.ReadAll(resp.Body)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	tests := []struct {
+		acceptEncoding string
+		encoding       string
+	}{
+		{"", ""},
+		{"gzip", "gzip"},
+		{"br", "br"},
+		{"gzip, br", "br"},
+		{"br;q=0, gzip", "gzip"},
+		{"*", "br"},
+		{"identity", ""},
+		{"gzip;q=0", ""},
+	}
+
+	for _, test := range tests {
+		resp := serveCompressed(serveText("text/html; charset=utf-8", compressedBody), test.acceptEncoding, nil)
+		if encoding := resp.Header.Get("Content-Encoding"); encoding != test.encoding {
+			t.Errorf("Accept-Encoding %q should respond with encoding %q, got %q", test.acceptEncoding, test.encoding, encoding)
+		}
+		if body := decompress(t, resp); body != compressedBody {
+			t.Errorf("Accept-Encoding %q response doesn't decode to the original body", test.acceptEncoding)
+		}
+		if len(test.encoding) > 0 {
+			if !strings.Contains(resp.Header.Get("Vary"), "Accept-Encoding") {
+				t.Errorf("Accept-Encoding %q compressed response doesn't vary by Accept-Encoding", test.acceptEncoding)
+			}
+			if etag := resp.Header.Get("ETag"); etag != `W/"page"` {
+				t.Errorf("Accept-Encoding %q compressed response should weaken its ETag, got %s", test.acceptEncoding, etag)
+			}
+		}
+	}
+}
+
+func TestCompressionSkipped(t *testing.T) {
+	small := serveCompressed(serveText("text/html", "<p>Too small</p>"), "gzip", nil)
+	if len(small.Header.Get("Content-Encoding")) > 0 || decompress(t, small) != "<p>Too small</p>" {
+		t.Error("Responses smaller than the minimum size shouldn't be compressed")
+	}
+
+	image := serveCompressed(serveText("image/png", compressedBody), "gzip", nil)
+	if len(image.Header.Get("Content-Encoding")) > 0 || decompress(t, image) != compressedBody {
+		t.Error("Responses with content types not in the allowlist shouldn't be compressed")
+	}
+
+	//serve content answers ranges with 206 partial content, which must be sent as the bytes asked for
+	ranged := serveCompressed(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(compressedBody))
+	}, "gzip", func(r *http.Request) { r.Header.Set("Range", "bytes=0-1499") })
+	if ranged.StatusCode != http.StatusPartialContent {
+		t.Fatalf("Expected range request to respond with 206, got %d", ranged.StatusCode)
+	}
+	if len(ranged.Header.Get("Content-Encoding")) > 0 {
+		t.Error("Partial content responses shouldn't be compressed")
+	}
+	if body := decompress(t, ranged); body != compressedBody[:1500] {
+		t.Errorf("Partial content response should be the 1500 bytes asked for, got %d", len(body))
+	}
+
+	full := serveCompressed(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		http.ServeContent(w, r, "", time.Time{}, strings.NewReader(compressedBody))
+	}, "gzip", nil)
+	if full.Header.Get("Content-Encoding") != "gzip" || len(full.Header.Get("Accept-Ranges")) > 0 {
+		t.Error("Compressed responses shouldn't advertise byte ranges of the uncompressed body")
+	}
+}
+
+func TestPrecompressedFileServer(t *testing.T) {
+	stylesheet := strings.Repeat("body { color: red; }\n", 100)
+	defaults := fstest.MapFS{
+		"static/css/site.css":  {Data: []byte(stylesheet)},
+		"static/img/logo.png":  {Data: bytes.Repeat([]byte{0x89}, 2048)},
+		"static/css/small.css": {Data: []byte("p { margin: 0; }")},
+	}
+	overrideDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(overrideDir, "static", "css"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(overrideDir, "static", "css", "extra.css"), []byte(stylesheet), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := PrecompressStatic(defaults, "", DefaultCompressionMinSize, nil); err == nil {
+		t.Error("Expected precompressing without an override directory to write to to fail")
+	}
+
+	compressedCount, err := PrecompressStatic(defaults, overrideDir, DefaultCompressionMinSize, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compressedCount != 4 {
+		t.Errorf("Expected both stylesheets to be precompressed as gzip and brotli, got %d files", compressedCount)
+	}
+	for _, name := range []string{"css/site.css.gz", "css/site.css.br", "css/extra.css.gz", "css/extra.css.br"} {
+		if _, err := os.Stat(filepath.Join(overrideDir, "static", filepath.FromSlash(name))); err != nil {
+			t.Errorf("Expected %s to be written to the override directory", name)
+		}
+	}
+	for _, name := range []string{"img/logo.png.gz", "css/small.css.gz"} {
+		if _, err := os.Stat(filepath.Join(overrideDir, "static", filepath.FromSlash(name))); err == nil {
+			t.Errorf("Expected %s not to be precompressed", name)
+		}
+	}
+	//the built in stylesheet has no modified time to compare against so is always rewritten, the override is up to date
+	if compressedCount, _ := PrecompressStatic(defaults, overrideDir, DefaultCompressionMinSize, nil); compressedCount != 2 {
+		t.Errorf("Expected only the built in stylesheet to be precompressed again, %d files were written", compressedCount)
+	}
+
+	staticFS, err := fs.Sub(&layeredFS{upper: os.DirFS(overrideDir), lower: defaults}, "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfs := newPrecompressedFileServer(http.FS(staticFS))
+	for acceptEncoding, encoding := range map[string]string{"br, gzip": "br", "gzip": "gzip", "": ""} {
+		req := httptest.NewRequest("GET", "/css/site.css", nil)
+		if len(acceptEncoding) > 0 {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		recorder := httptest.NewRecorder()
+		pfs.ServeHTTP(recorder, req)
+		resp := recorder.Result()
+
+		if resp.Header.Get("Content-Encoding") != encoding {
+			t.Errorf("Accept-Encoding %q should be served the %q sibling, got %q", acceptEncoding, encoding, resp.Header.Get("Content-Encoding"))
+		}
+		if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/css") {
+			t.Errorf("Precompressed sibling should be served as the original's content type, got %s", resp.Header.Get("Content-Type"))
+		}
+		if body := decompress(t, resp); body != stylesheet {
+			t.Errorf("Accept-Encoding %q response doesn't decode to the original stylesheet", acceptEncoding)
+		}
+	}
+
+	//a sibling served through the compression middleware is only said to vary by encoding once
+	resp := serveCompressed(pfs.ServeHTTP, "gzip", func(r *http.Request) { r.URL.Path = "/css/site.css" })
+	if resp.Header.Get("Content-Encoding") != "gzip" || decompress(t, resp) != stylesheet {
+		t.Errorf("Expected the gzip sibling to be served through the middleware as it is")
+	}
+	if vary := resp.Header.Values("Vary"); len(vary) != 1 || vary[0] != "Accept-Encoding" {
+		t.Errorf("Expected Vary to list Accept-Encoding once, got %v", vary)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	mdplugin "github.com/JohannesKaufmann/html-to-markdown/plugin"
+	quill "github.com/dchenk/go-render-quill"
+	"github.com/tacusci/berrycms/db"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer/html"
+)
+
+const (
+	//ContentFormatQuill page content is a Quill delta, the format of every page created before formats existed
+	ContentFormatQuill = "quill"
+	//ContentFormatMarkdown page content is Markdown
+	ContentFormatMarkdown = "markdown"
+	//ContentFormatHTML page content is raw HTML
+	ContentFormatHTML = "html"
+)
+
+//ContentFormat describes a format page content can be written in
+type ContentFormat struct {
+	Name  string
+	Label string
+}
+
+//ContentFormats get fixed list of page content formats available in the page editor
+func ContentFormats() []ContentFormat {
+	return []ContentFormat{
+		{Name: ContentFormatQuill, Label: "Rich text"},
+		{Name: ContentFormatMarkdown, Label: "Markdown"},
+		{Name: ContentFormatHTML, Label: "HTML"},
+	}
+}
+
+//contentFormatByName finds content format matching name, falls back to quill if none match
+func contentFormatByName(name string) ContentFormat {
+	formats := ContentFormats()
+	for _, format := range formats {
+		if format.Name == name {
+			return format
+		}
+	}
+	return formats[0]
+}
+
+//markdown renderer supporting GitHub flavoured tables, strikethrough, autolinks and task lists, plus footnotes
+var markdown = goldmark.New(
+	goldmark.WithExtensions(extension.GFM, extension.Footnote),
+	goldmark.WithRendererOptions(html.WithUnsafe()),
+)
+
+//RenderMarkdown converts Markdown source to HTML
+func RenderMarkdown(source string) (string, error) {
+	var buf bytes.Buffer
+	if err := markdown.Convert([]byte(source), &buf); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+//renderContent converts content written in named format to HTML
+func renderContent(content string, format string) (string, error) {
+	switch contentFormatByName(format).Name {
+	case ContentFormatMarkdown:
+		return RenderMarkdown(content)
+	case ContentFormatHTML:
+		return content, nil
+	default:
+		//content converted to quill is stored as HTML until the editor next saves it as a delta
+		html, err := quill.Render([]byte(content))
+		if err != nil {
+			return content, nil
+		}
+		return string(html), nil
+	}
+}
+
+//renderPageContent converts the page's content to HTML according to its content format,
+//sanitising it unless it was saved by someone allowed to publish trusted HTML
+func renderPageContent(p *db.Page) (string, error) {
+	html, err := renderContent(p.Content, p.ContentFormat)
+	if err != nil {
+		return "", err
+	}
+	if p.TrustedHTML {
+		return html, nil
+	}
+	return sanitiseHTML(html), nil
+}
+
+//convertContent rewrites content from one format into another, going through HTML
+func convertContent(content string, from string, to string) (string, error) {
+	from = contentFormatByName(from).Name
+	to = contentFormatByName(to).Name
+
+	if from == to {
+		return content, nil
+	}
+
+	html, err := renderContent(content, from)
+	if err != nil {
+		return "", err
+	}
+
+	switch to {
+	case ContentFormatMarkdown:
+		converter := md.NewConverter("", true, nil)
+		converter.Use(mdplugin.GitHubFlavored())
+		return converter.ConvertString(html)
+	case ContentFormatHTML, ContentFormatQuill:
+		//the quill editor builds its delta from HTML, so HTML is stored until the page is next saved
+		return html, nil
+	}
+
+	return "", fmt.Errorf("Unable to convert content to %s", to)
+}
+
+//normaliseTags tidies comma separated tags entered in the editor, lower cased with duplicates removed
+func normaliseTags(tags string) string {
+	seen := map[string]bool{}
+	normalised := []string{}
+	for _, tag := range strings.Split(tags, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if len(tag) == 0 || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalised = append(normalised, tag)
+	}
+	return strings.Join(normalised, ",")
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//csrfFormField name of the hidden form field admin forms send their CSRF token in
+	csrfFormField = "csrftoken"
+	//csrfHeader header scripts can send the CSRF token in instead
+	csrfHeader = "X-CSRF-Token"
+)
+
+//CSRFMiddleware rejects state changing requests to the admin which don't carry the client's CSRF token,
+//so another site can't use a logged in admin's browser to make changes
+type CSRFMiddleware struct {
+	Router *MutableRouter
+}
+
+//csrfResponseWriter carries the client's CSRF token through to RenderDefault
+type csrfResponseWriter struct {
+	http.ResponseWriter
+	token string
+}
+
+//Unwrap get the response writer being wrapped
+func (cw *csrfResponseWriter) Unwrap() http.ResponseWriter { return cw.ResponseWriter }
+
+//Middleware attaches http handler to middleware
+func (cm *CSRFMiddleware) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cm.protects(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, err := csrfToken(w, r)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+
+		if csrfStateChanging(r.Method) && !csrfTokenMatches(r, token) {
+			logging.Warn(fmt.Sprintf("Rejected %s %s from %s with missing or incorrect CSRF token", r.Method, r.URL.Path, clientIP(r)))
+			csrfForbidden(w, cm.Router)
+			return
+		}
+		//handlers such as the delete ones treat every value posted as a UUID, so they mustn't see the token
+		r.PostForm.Del(csrfFormField)
+		r.Form.Del(csrfFormField)
+
+		next.ServeHTTP(&csrfResponseWriter{ResponseWriter: w, token: token}, r)
+	})
+}
+
+//protects whether r is to the admin pages from a browser, the API and requests sending
+//a personal API token don't rely on cookies so can't be forged cross site
+func (cm *CSRFMiddleware) protects(r *http.Request) bool {
+	if len(bearerToken(r)) > 0 {
+		return false
+	}
+	prefix := adminRoutePrefix(cm.Router)
+	return strings.HasPrefix(r.URL.Path, prefix+"/admin") || r.URL.Path == prefix+"/logout"
+}
+
+func csrfStateChanging(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return false
+	}
+	return true
+}
+
+//csrfToken get the client's CSRF token, creating one for the session if it doesn't have one yet
+func csrfToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	csrfSessionStore, err := sessionsstore.Get(r, "csrf")
+	if err != nil {
+		logging.Debug(fmt.Sprintf("Error trying to read existing session \"csrf\" -> %s", err.Error()))
+	}
+
+	if token, ok := csrfSessionStore.Values["token"].(string); ok && len(token) > 0 {
+		return token, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+
+	csrfSessionStore.Values["token"] = token
+	if err := csrfSessionStore.Save(r, w); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+//csrfTokenMatches checks r sent token, either in its form or header
+func csrfTokenMatches(r *http.Request, token string) bool {
+	sent := r.Header.Get(csrfHeader)
+	if len(sent) == 0 {
+		sent = r.PostFormValue(csrfFormField)
+	}
+	return len(sent) > 0 && subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+//csrfTokenFor get the CSRF token the middleware passed along with w, blank if it didn't
+func csrfTokenFor(w http.ResponseWriter) string {
+	for {
+		switch rw := w.(type) {
+		case *csrfResponseWriter:
+			return rw.token
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = rw.Unwrap()
+		default:
+			return ""
+		}
+	}
+}
+
+//csrfForbidden explains to the client that their request was rejected as it didn't carry their CSRF token
+func csrfForbidden(w http.ResponseWriter, router *MutableRouter) {
+	pctx := plush.NewContext()
+	pctx.Set("title", "Forbidden")
+	pctx.Set("quillenabled", false)
+	pctx.Set("adminhiddenpassword", adminRoutePrefix(router))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusForbidden)
+	RenderDefault(w, "forbidden.csrf.html", pctx)
+}
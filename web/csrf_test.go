@@ -0,0 +1,105 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	mr := &MutableRouter{}
+	cm := CSRFMiddleware{Router: mr}
+
+	var posted url.Values
+	recordPost := func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		posted = r.PostForm
+	}
+
+	auh := &AdminUsersHandler{Router: mr, route: "/admin/users"}
+	r := mux.NewRouter()
+	r.HandleFunc(auh.Route(), auh.Get).Methods("GET")
+	r.HandleFunc("/admin/users/delete", recordPost).Methods("POST")
+	r.HandleFunc("/api/pages", recordPost).Methods("POST")
+	r.Use(cm.Middleware)
+
+	responseRecorder := httptest.NewRecorder()
+	r.ServeHTTP(responseRecorder, httptest.NewRequest("GET", "/admin/users", nil))
+	match := regexp.MustCompile(`name="csrf-token" content="([0-9a-f]+)"`).FindStringSubmatch(responseRecorder.Body.String())
+	if responseRecorder.Code != http.StatusOK || match == nil {
+		t.Fatalf("Expected admin page to be given the client's CSRF token, got %d", responseRecorder.Code)
+	}
+	token := match[1]
+	cookies := responseRecorder.Result().Cookies()
+
+	post := func(route string, values url.Values, header string, withCookies bool) *httptest.ResponseRecorder {
+		posted = nil
+		req := httptest.NewRequest("POST", route, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if len(header) > 0 {
+			req.Header.Set(csrfHeader, header)
+		}
+		if withCookies {
+			for _, cookie := range cookies {
+				req.AddCookie(cookie)
+			}
+		}
+		responseRecorder := httptest.NewRecorder()
+		r.ServeHTTP(responseRecorder, req)
+		return responseRecorder
+	}
+
+	for _, forged := range []struct {
+		name        string
+		values      url.Values
+		header      string
+		withCookies bool
+	}{
+		{"no token", url.Values{"0": {"someuuid"}}, "", true},
+		{"wrong token", url.Values{"0": {"someuuid"}, "csrftoken": {"0123abcd"}}, "", true},
+		{"another session's token", url.Values{"0": {"someuuid"}, "csrftoken": {token}}, "", false},
+		{"wrong header token", url.Values{"0": {"someuuid"}}, "0123abcd", true},
+	} {
+		responseRecorder := post("/admin/users/delete", forged.values, forged.header, forged.withCookies)
+		if responseRecorder.Code != http.StatusForbidden || posted != nil {
+			t.Errorf("Expected post with %s to be forbidden, got %d", forged.name, responseRecorder.Code)
+		}
+		if !strings.Contains(responseRecorder.Body.String(), "403 Forbidden") {
+			t.Errorf("Expected post with %s to explain why it was forbidden", forged.name)
+		}
+	}
+
+	post("/admin/users/delete", url.Values{"0": {"someuuid"}, "csrftoken": {token}}, "", true)
+	if posted == nil || posted.Get("0") != "someuuid" || len(posted) != 1 {
+		t.Errorf("Expected post with the token to reach the handler without it, got %v", posted)
+	}
+
+	post("/admin/users/delete", url.Values{"0": {"someuuid"}}, token, true)
+	if posted == nil {
+		t.Errorf("Expected post with the token in its header to reach the handler")
+	}
+
+	post("/api/pages", url.Values{"title": {"page"}}, "", false)
+	if posted == nil {
+		t.Errorf("Expected the API not to need a CSRF token")
+	}
+}
@@ -21,7 +21,6 @@ import (
 
 	"github.com/tacusci/logging"
 
-	quill "github.com/dchenk/go-render-quill"
 	"github.com/gobuffalo/plush"
 	"github.com/tacusci/berrycms/db"
 	"github.com/tacusci/berrycms/plugins"
@@ -51,9 +50,11 @@ func (sph *SavedPageHandler) Get(w http.ResponseWriter, r *http.Request) {
 	ctx := plush.NewContext()
 	ctx.Set("pagecontent", template.HTML(p.Content))
 
-	// if trying to render the page content from delta fails, then it just won't replace previous context pagecontent value
-	if html, _ := quill.Render([]byte(p.Content)); err == nil {
+	// if trying to render the page content from its format fails, then it just won't replace previous context pagecontent value
+	if html, err := renderPageContent(p); err == nil {
 		ctx.Set("pagecontent", template.HTML(html))
+	} else {
+		logging.Error(err.Error())
 	}
 
 	Render(w, r, p, ctx)
@@ -19,6 +19,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -71,3 +72,204 @@ func TestSavedPageGet(t *testing.T) {
 		}
 	}
 }
+
+func TestSavedPageGetConditional(t *testing.T) {
+	sph := SavedPageHandler{}
+	pt := db.PagesTable{}
+
+	modified := time.Now().Add(-time.Hour).Unix()
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime:  modified,
+		ModifiedDateTime: modified,
+		Roleprotected:    false,
+		AuthorUUID:       "",
+		Title:            "Test Conditional Page",
+		Route:            "/testconditionalpage",
+		Content:          "[{\"insert\":\"This is a cacheable test page!\\n\"}]",
+		CachePolicy:      "short",
+	})
+
+	req := httptest.NewRequest("GET", "/testconditionalpage", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	sph.Get(responseRecorder, req)
+
+	resp := responseRecorder.Result()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Test get retrieved a respone which is not 200, STATUS: %d...", resp.StatusCode)
+	}
+
+	etag := resp.Header.Get("ETag")
+	if len(etag) == 0 {
+		t.Errorf("Rendered page response is missing ETag header")
+	}
+
+	//the page is older than the settings it's rendered with, so they're what it was last modified by
+	lastModified := resp.Header.Get("Last-Modified")
+	if lastModified != renderedModifiedTime(&db.Page{ModifiedDateTime: modified}).UTC().Format(http.TimeFormat) || lastModified == time.Unix(modified, 0).UTC().Format(http.TimeFormat) {
+		t.Errorf("Rendered page Last-Modified header %s doesn't match when the page or its settings last changed", lastModified)
+	}
+
+	if resp.Header.Get("Cache-Control") != "public, max-age=300" {
+		t.Errorf("Rendered page Cache-Control header doesn't match page cache policy")
+	}
+
+	req = httptest.NewRequest("GET", "/testconditionalpage", nil)
+	req.Header.Set("If-None-Match", etag)
+	responseRecorder = httptest.NewRecorder()
+
+	sph.Get(responseRecorder, req)
+
+	if responseRecorder.Result().StatusCode != http.StatusNotModified {
+		t.Errorf("Matching If-None-Match didn't respond with 304, STATUS: %d...", responseRecorder.Result().StatusCode)
+	}
+
+	//If-Modified-Since on its own is answered from the Last-Modified time
+	ifModifiedSince := func(since string) int {
+		req := httptest.NewRequest("GET", "/testconditionalpage", nil)
+		req.Header.Set("If-Modified-Since", since)
+		responseRecorder := httptest.NewRecorder()
+		sph.Get(responseRecorder, req)
+		return responseRecorder.Result().StatusCode
+	}
+
+	if code := ifModifiedSince(lastModified); code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since matching Last-Modified didn't respond with 304, STATUS: %d...", code)
+	}
+
+	if code := ifModifiedSince(time.Unix(modified, 0).UTC().Format(http.TimeFormat)); code != http.StatusOK {
+		t.Errorf("If-Modified-Since from before the settings last changed should respond with 200, STATUS: %d...", code)
+	}
+
+	if code := ifModifiedSince("not a date"); code != http.StatusOK {
+		t.Errorf("Invalid If-Modified-Since should respond with 200, STATUS: %d...", code)
+	}
+
+	//changing what every page is rendered with, such as the sanitiser policy, makes copies from before it stale
+	time.Sleep(time.Second)
+	if err := SetSanitisePolicy(DefaultSanitisePolicy); err != nil {
+		t.Fatal(err)
+	}
+	if code := ifModifiedSince(lastModified); code != http.StatusOK {
+		t.Errorf("If-Modified-Since from before the sanitiser policy changed should respond with 200, STATUS: %d...", code)
+	}
+
+	req = httptest.NewRequest("GET", "/testconditionalpage", nil)
+	req.Header.Set("If-None-Match", "\"stale\"")
+	req.Header.Set("If-Modified-Since", time.Now().UTC().Format(http.TimeFormat))
+	responseRecorder = httptest.NewRecorder()
+
+	sph.Get(responseRecorder, req)
+
+	if responseRecorder.Result().StatusCode != http.StatusOK {
+		t.Errorf("Non matching If-None-Match should take precedence over If-Modified-Since, STATUS: %d...", responseRecorder.Result().StatusCode)
+	}
+}
+
+func TestSavedPageGetMarkdown(t *testing.T) {
+	sph := SavedPageHandler{}
+	pt := db.PagesTable{}
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime: time.Now().Unix(),
+		Roleprotected:   false,
+		AuthorUUID:      "",
+		Title:           "Test Markdown Page",
+		Route:           "/testmarkdownpage",
+		Content:         "# Docs\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n```go\nfmt.Println()\n```\n\nNote[^1]\n\n[^1]: Footnote.\n",
+		ContentFormat:   ContentFormatMarkdown,
+	})
+
+	req := httptest.NewRequest("GET", "/testmarkdownpage", nil)
+	responseRecorder := httptest.NewRecorder()
+
+	sph.Get(responseRecorder, req)
+
+	resp := responseRecorder.Result()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Test get retrieved a respone which is not 200, STATUS: %d...", resp.StatusCode)
+	}
+
+	bodyText, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"<h1>Docs</h1>", "<table>", "<td>1</td>", "<code class=\"language-go\">", "class=\"footnotes\""} {
+		if !strings.Contains(string(bodyText), expected) {
+			t.Errorf("Rendered markdown page is missing %s", expected)
+		}
+	}
+}
+
+func TestConvertContent(t *testing.T) {
+	markdown, err := convertContent("[{\"insert\":\"Heading\"},{\"attributes\":{\"header\":1},\"insert\":\"\\n\"},{\"insert\":\"Some text\\n\"}]", ContentFormatQuill, ContentFormatMarkdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if markdown != "# Heading\n\nSome text" {
+		t.Errorf("Quill delta converted to unexpected markdown %q", markdown)
+	}
+
+	html, err := convertContent(markdown, ContentFormatMarkdown, ContentFormatHTML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if html != "<h1>Heading</h1>\n<p>Some text</p>\n" {
+		t.Errorf("Markdown converted to unexpected HTML %q", html)
+	}
+}
+
+func TestSavedPageGetSanitised(t *testing.T) {
+	sph := SavedPageHandler{}
+	pt := db.PagesTable{}
+
+	content := "<p onclick=\"steal()\">Hello</p><script>steal()</script>"
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime: time.Now().Unix(),
+		Title:           "Test Untrusted Page",
+		Route:           "/testuntrustedpage",
+		Content:         content,
+		ContentFormat:   ContentFormatHTML,
+	})
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime: time.Now().Unix(),
+		Title:           "Test Trusted Page",
+		Route:           "/testtrustedpage",
+		Content:         content,
+		ContentFormat:   ContentFormatHTML,
+		TrustedHTML:     true,
+	})
+
+	for route, expectScript := range map[string]bool{"/testuntrustedpage": false, "/testtrustedpage": true} {
+		req := httptest.NewRequest("GET", route, nil)
+		responseRecorder := httptest.NewRecorder()
+
+		sph.Get(responseRecorder, req)
+
+		bodyText, err := ioutil.ReadAll(responseRecorder.Result().Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(string(bodyText), "<script>") != expectScript || strings.Contains(string(bodyText), "onclick") != expectScript {
+			t.Errorf("Page %s rendered with unexpected sanitisation: %s", route, string(bodyText))
+		}
+
+		if !strings.Contains(string(bodyText), "Hello</p>") {
+			t.Errorf("Page %s is missing its allowed content", route)
+		}
+	}
+
+	violations := htmlViolations(content, sanitiseHTML(content))
+	if len(violations) != 2 {
+		t.Errorf("Expected script element and onclick attribute violations, got %v", violations)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/feeds"
+	"github.com/tacusci/berrycms/shortcodes"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//DefaultFeedItemCount number of pages included in a feed which hasn't set its own count
+	DefaultFeedItemCount = 20
+	//feedSummaryLength maximum number of characters of page text used as a feed item's summary
+	feedSummaryLength = 280
+)
+
+var (
+	feedLinksMu sync.RWMutex
+	//feedLinks alternate links to every feed, advertised in the head of rendered pages
+	feedLinks template.HTML
+)
+
+//FeedHandler serves a page collection as an RSS or Atom feed
+type FeedHandler struct {
+	Router *MutableRouter
+	route  string
+	format string
+}
+
+//Get handles get requests to URI
+func (fh *FeedHandler) Get(w http.ResponseWriter, r *http.Request) {
+	slug := mux.Vars(r)["slug"]
+	//the links are only made absolute once served so requests made against other hosts don't each add to the cache
+	cacheKey := fmt.Sprintf("%s|%s", slug, fh.format)
+
+	feed, ok := feeds.Cached(cacheKey)
+	if !ok {
+		var err error
+		feed, err = buildFeed(slug, r.URL.Path)
+		if err != nil {
+			logging.Debug(err.Error())
+			fourOhFour(w, r)
+			return
+		}
+		feeds.Store(cacheKey, feed)
+	}
+
+	baseURL := siteBaseURL(r)
+	absolute := feed.Absolute(baseURL)
+	//until the site has a name of its own the feed of all pages is named after the host
+	if len(absolute.Title) == 0 {
+		absolute.Title = baseURL
+		if u, err := url.Parse(baseURL); err == nil {
+			absolute.Title = u.Hostname()
+		}
+	}
+
+	data, err := feeds.Generate(absolute, fh.format)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	contentType := "application/rss+xml; charset=utf-8"
+	if fh.format == feeds.Atom {
+		contentType = "application/atom+xml; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
+}
+
+//Post handles post requests to URI
+func (fh *FeedHandler) Post(w http.ResponseWriter, r *http.Request) {}
+
+//Route get URI route for handler
+func (fh *FeedHandler) Route() string { return fh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (fh *FeedHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (fh *FeedHandler) HandlesPost() bool { return false }
+
+//buildFeed collects the pages of the feed with slug, the blank slug being the feed of all pages,
+//its links are relative to the site
+func buildFeed(slug string, feedPath string) (*feeds.Feed, error) {
+	collection := &db.Feed{ItemCount: DefaultFeedItemCount}
+
+	if len(slug) > 0 {
+		ft := db.FeedsTable{}
+		var err error
+		collection, err = ft.SelectBySlug(db.Conn, slug)
+		if err != nil {
+			return nil, fmt.Errorf("Feed %s not found -> %s", slug, err.Error())
+		}
+	}
+
+	pt := db.PagesTable{}
+	pages, err := pt.SelectPublic(db.Conn)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &feeds.Feed{
+		Title:   collection.Title,
+		Link:    "/",
+		FeedURL: feedPath,
+	}
+
+	ut := db.UsersTable{}
+	authors := map[string]string{}
+
+	for _, p := range pages {
+		if len(feed.Items) >= collection.ItemCount {
+			break
+		}
+
+		if !pageInCollection(p, collection) {
+			continue
+		}
+
+		author, ok := authors[p.AuthorUUID]
+		if !ok && len(p.AuthorUUID) > 0 {
+			if u, err := ut.SelectByUUID(db.Conn, p.AuthorUUID); err == nil {
+				author = strings.TrimSpace(fmt.Sprintf("%s %s", u.FirstName, u.LastName))
+				if len(author) == 0 {
+					author = u.Username
+				}
+			}
+			authors[p.AuthorUUID] = author
+		}
+
+		item := feeds.Item{
+			Title:     p.Title,
+			Link:      p.Route,
+			Summary:   pageSummary(p),
+			Author:    author,
+			Published: time.Unix(p.CreatedDateTime, 0),
+			Updated:   pageModifiedTime(p),
+		}
+
+		if item.Updated.After(feed.Updated) {
+			feed.Updated = item.Updated
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	return feed, nil
+}
+
+//pageInCollection checks whether page matches the collection's route prefix and tag
+func pageInCollection(p *db.Page, collection *db.Feed) bool {
+	if len(collection.RoutePrefix) > 0 && !strings.HasPrefix(p.Route, collection.RoutePrefix) {
+		return false
+	}
+
+	if len(collection.Tag) > 0 {
+		for _, tag := range p.TagList() {
+			if strings.EqualFold(tag, collection.Tag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+//pageSummary get the start of the page's text content, with its shortcodes expanded as they are when it's rendered
+func pageSummary(p *db.Page) string {
+	content, err := renderPageContent(p)
+	if err != nil {
+		return ""
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(shortcodes.Expand(content, p.Route)))
+	if err != nil {
+		return ""
+	}
+
+	summary := strings.Join(strings.Fields(doc.Text()), " ")
+	if utf8.RuneCountInString(summary) > feedSummaryLength {
+		summary = string([]rune(summary)[:feedSummaryLength]) + "…"
+	}
+	return summary
+}
+
+//mapFeeds maps the feed of all pages and each configured collection, ready to be advertised in pages
+func (mr *MutableRouter) mapFeeds(r *mux.Router) {
+	feedLinksMu.Lock()
+	defer feedLinksMu.Unlock()
+
+	feedLinks = ""
+
+	if mr.NoFeeds {
+		return
+	}
+
+	handlers := []*FeedHandler{
+		{Router: mr, route: "/feed.xml", format: feeds.RSS},
+		{Router: mr, route: "/atom.xml", format: feeds.Atom},
+		{Router: mr, route: "/feeds/{slug}/feed.xml", format: feeds.RSS},
+		{Router: mr, route: "/feeds/{slug}/atom.xml", format: feeds.Atom},
+	}
+
+	for _, handler := range handlers {
+		logging.Debug(fmt.Sprintf("Mapping default GET route %s", handler.Route()))
+		r.HandleFunc(handler.Route(), handler.Get).Methods("GET")
+	}
+
+	var links bytes.Buffer
+	links.WriteString("<link rel=\"alternate\" type=\"application/rss+xml\" href=\"/feed.xml\">")
+	links.WriteString("<link rel=\"alternate\" type=\"application/atom+xml\" href=\"/atom.xml\">")
+
+	ft := db.FeedsTable{}
+	collections, err := ft.SelectAll(db.Conn)
+	if err != nil {
+		logging.Error(err.Error())
+	}
+
+	for _, collection := range collections {
+		title := html.EscapeString(collection.Title)
+		slug := html.EscapeString(collection.Slug)
+		links.WriteString(fmt.Sprintf("<link rel=\"alternate\" type=\"application/rss+xml\" title=\"%s\" href=\"/feeds/%s/feed.xml\">", title, slug))
+		links.WriteString(fmt.Sprintf("<link rel=\"alternate\" type=\"application/atom+xml\" title=\"%s\" href=\"/feeds/%s/atom.xml\">", title, slug))
+	}
+
+	feedLinks = template.HTML(links.String())
+}
+
+//currentFeedLinks get the alternate links to advertise every feed
+func currentFeedLinks() template.HTML {
+	feedLinksMu.RLock()
+	defer feedLinksMu.RUnlock()
+	return feedLinks
+}
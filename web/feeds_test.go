@@ -0,0 +1,161 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/feeds"
+	"github.com/tacusci/berrycms/shortcodes"
+)
+
+func TestFeedCollection(t *testing.T) {
+	pt := db.PagesTable{}
+	ft := db.FeedsTable{}
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime: time.Now().Unix(),
+		Title:           "Tagged News Page",
+		Route:           "/news/tagged",
+		Content:         "[{\"insert\":\"Something happened\\n\"}]",
+		Tags:            "announcements,news",
+	})
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime: time.Now().Unix(),
+		Title:           "Untagged News Page",
+		Route:           "/news/untagged",
+		Content:         "[{\"insert\":\"Nothing happened\\n\"}]",
+	})
+
+	ft.Insert(db.Conn, &db.Feed{
+		CreatedDateTime: time.Now().Unix(),
+		Slug:            "announcements",
+		Title:           "Announcements",
+		RoutePrefix:     "/news/",
+		Tag:             "announcements",
+		ItemCount:       10,
+	})
+
+	feeds.Reset()
+
+	fh := FeedHandler{format: feeds.Atom}
+	req := httptest.NewRequest("GET", "/feeds/announcements/atom.xml", nil)
+	req = mux.SetURLVars(req, map[string]string{"slug": "announcements"})
+	responseRecorder := httptest.NewRecorder()
+
+	fh.Get(responseRecorder, req)
+
+	resp := responseRecorder.Result()
+
+	if resp.Header.Get("Content-Type") != "application/atom+xml; charset=utf-8" {
+		t.Errorf("Atom feed served with unexpected content type %s", resp.Header.Get("Content-Type"))
+	}
+
+	bodyText, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := string(bodyText)
+
+	if !strings.Contains(body, "<title>Tagged News Page</title>") || !strings.Contains(body, "<summary>Something happened</summary>") {
+		t.Errorf("Feed is missing the tagged page: %s", body)
+	}
+
+	if strings.Contains(body, "Untagged News Page") {
+		t.Errorf("Feed contains page without the collection's tag")
+	}
+}
+
+func TestFeedCacheIgnoresHost(t *testing.T) {
+	feeds.Reset()
+
+	fh := FeedHandler{format: feeds.RSS}
+	for _, host := range []string{"one.example", "two.example"} {
+		req := httptest.NewRequest("GET", "/feed.xml", nil)
+		req.Host = host
+		responseRecorder := httptest.NewRecorder()
+
+		fh.Get(responseRecorder, req)
+
+		bodyText, err := ioutil.ReadAll(responseRecorder.Result().Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := string(bodyText)
+
+		if !strings.Contains(body, "<title>"+host+"</title>") || !strings.Contains(body, "<link>http://"+host+"/news/tagged</link>") {
+			t.Errorf("Feed requested against %s should link to it: %s", host, body)
+		}
+	}
+
+	if _, ok := feeds.Cached("|" + feeds.RSS); !ok {
+		t.Error("Expected the feed of all pages to be cached by its slug and format")
+	}
+	if _, ok := feeds.Cached("http://two.example||" + feeds.RSS); ok {
+		t.Error("Feeds shouldn't be cached per host")
+	}
+}
+
+func TestFeedSummaryShortcodes(t *testing.T) {
+	shortcodes.Register("test-greeting", func(sc *shortcodes.Shortcode) (string, error) {
+		return "<strong>Hello " + sc.Arg("name", "there") + "</strong>", nil
+	})
+
+	pt := db.PagesTable{}
+	ft := db.FeedsTable{}
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime: time.Now().Unix(),
+		Title:           "Greeting Page",
+		Route:           "/greetings/jane",
+		Content:         "[{\"insert\":\"[test-greeting name=Jane] and welcome\\n\"}]",
+		Tags:            "greetings",
+	})
+
+	ft.Insert(db.Conn, &db.Feed{
+		CreatedDateTime: time.Now().Unix(),
+		Slug:            "greetings",
+		Title:           "Greetings",
+		Tag:             "greetings",
+		ItemCount:       10,
+	})
+
+	feeds.Reset()
+
+	fh := FeedHandler{format: feeds.RSS}
+	req := httptest.NewRequest("GET", "/feeds/greetings/feed.xml", nil)
+	req = mux.SetURLVars(req, map[string]string{"slug": "greetings"})
+	responseRecorder := httptest.NewRecorder()
+
+	fh.Get(responseRecorder, req)
+
+	bodyText, err := ioutil.ReadAll(responseRecorder.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(bodyText)
+
+	if strings.Contains(body, "test-greeting") || !strings.Contains(body, "<description>Hello Jane and welcome</description>") {
+		t.Errorf("Expected the page's shortcode to be expanded in its summary: %s", body)
+	}
+}
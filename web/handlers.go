@@ -17,15 +17,21 @@ package web
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
+	"html/template"
+	"io/fs"
 	"net/http"
-	"os"
+	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/feeds"
 	"github.com/tacusci/berrycms/plugins"
+	"github.com/tacusci/berrycms/robots"
+	"github.com/tacusci/berrycms/shortcodes"
+	"github.com/tacusci/berrycms/sitemap"
 
 	"github.com/gobuffalo/plush"
 	"github.com/tacusci/berrycms/db"
@@ -55,6 +61,26 @@ func GetDefaultHandlers(router *MutableRouter) []Handler {
 			route:  adminHiddenPrefix + "/login",
 			Router: router,
 		},
+		&LoginTwoFactorHandler{
+			route:  adminHiddenPrefix + "/login/2fa",
+			Router: router,
+		},
+		&ForgotPasswordHandler{
+			route:  adminHiddenPrefix + "/login/forgot",
+			Router: router,
+		},
+		&PasswordResetHandler{
+			route:  adminHiddenPrefix + "/login/reset/{token}",
+			Router: router,
+		},
+		&OIDCLoginHandler{
+			route:  adminHiddenPrefix + "/login/oidc/{provider}",
+			Router: router,
+		},
+		&OIDCCallbackHandler{
+			route:  adminHiddenPrefix + "/login/oidc/{provider}/callback",
+			Router: router,
+		},
 		&LogoutHandler{
 			route:  adminHiddenPrefix + "/logout",
 			Router: router,
@@ -75,6 +101,10 @@ func GetDefaultHandlers(router *MutableRouter) []Handler {
 			route:  adminHiddenPrefix + "/admin/users/delete",
 			Router: router,
 		},
+		&AdminUsersUnlockHandler{
+			route:  adminHiddenPrefix + "/admin/users/unlock",
+			Router: router,
+		},
 		&AdminPagesHandler{
 			route:  adminHiddenPrefix + "/admin/pages",
 			Router: router,
@@ -91,6 +121,14 @@ func GetDefaultHandlers(router *MutableRouter) []Handler {
 			route:  adminHiddenPrefix + "/admin/pages/delete",
 			Router: router,
 		},
+		&AdminPagesPreviewHandler{
+			route:  adminHiddenPrefix + "/admin/pages/preview",
+			Router: router,
+		},
+		&AdminPagesConvertHandler{
+			route:  adminHiddenPrefix + "/admin/pages/convert/{uuid}",
+			Router: router,
+		},
 		&AdminUserGroupsHandler{
 			route:  adminHiddenPrefix + "/admin/users/groups",
 			Router: router,
@@ -115,6 +153,62 @@ func GetDefaultHandlers(router *MutableRouter) []Handler {
 			route:  adminHiddenPrefix + "/admin/users/groups/delete",
 			Router: router,
 		},
+		&AdminThemesHandler{
+			route:  adminHiddenPrefix + "/admin/themes",
+			Router: router,
+		},
+		&AdminFeedsHandler{
+			route:  adminHiddenPrefix + "/admin/feeds",
+			Router: router,
+		},
+		&AdminFeedsDeleteHandler{
+			route:  adminHiddenPrefix + "/admin/feeds/delete",
+			Router: router,
+		},
+		&AdminRobotsHandler{
+			route:  adminHiddenPrefix + "/admin/robots",
+			Router: router,
+		},
+		&AdminRobotsDeleteHandler{
+			route:  adminHiddenPrefix + "/admin/robots/delete",
+			Router: router,
+		},
+		&AdminSEOHandler{
+			route:  adminHiddenPrefix + "/admin/seo",
+			Router: router,
+		},
+		&AdminTwoFactorHandler{
+			route:  adminHiddenPrefix + "/admin/2fa",
+			Router: router,
+		},
+		&AdminSessionsHandler{
+			route:  adminHiddenPrefix + "/admin/sessions",
+			Router: router,
+		},
+		&AdminSessionsRevokeHandler{
+			route:  adminHiddenPrefix + "/admin/sessions/revoke",
+			Router: router,
+		},
+		&AdminJobsHandler{
+			route:  adminHiddenPrefix + "/admin/jobs",
+			Router: router,
+		},
+		&AdminTokensHandler{
+			route:  adminHiddenPrefix + "/admin/tokens",
+			Router: router,
+		},
+		&AdminTokensRevokeHandler{
+			route:  adminHiddenPrefix + "/admin/tokens/revoke",
+			Router: router,
+		},
+		&AdminOIDCHandler{
+			route:  adminHiddenPrefix + "/admin/oidc",
+			Router: router,
+		},
+		&AdminOIDCDeleteHandler{
+			route:  adminHiddenPrefix + "/admin/oidc/delete",
+			Router: router,
+		},
 	}
 }
 
@@ -123,16 +217,84 @@ func UnixToTimeString(unix int64) string {
 	return time.Unix(unix, 0).Format("15:04:05 02-01-2006")
 }
 
-//RenderDefault uses plush rendering engine to take default page template and create HTML content
+//pagesChanged invalidates everything generated from the saved pages, call whenever pages are created, edited or deleted
+func pagesChanged() {
+	feeds.Reset()
+	sitemap.Reset()
+	//role protected pages are disallowed in robots.txt
+	if err := robots.Regenerate(); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+var (
+	baseURLMu sync.RWMutex
+	//baseURL canonical scheme and host of the site, eg., 'https://example.com'
+	baseURL string
+)
+
+//SetBaseURL sets the canonical scheme and host used in absolute links to the site, such as in the sitemap,
+//feeds, canonical links, single sign on redirects and password reset emails, a blank URL uses the scheme and
+//host each request was made against for feeds, everything else is left out or refused without one
+func SetBaseURL(rawURL string) error {
+	rawURL = strings.TrimRight(strings.TrimSpace(rawURL), "/")
+
+	if len(rawURL) > 0 {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 || len(u.Path) > 0 {
+			return fmt.Errorf("Base URL '%s' must be a scheme and host only, eg., https://example.com", rawURL)
+		}
+	}
+
+	baseURLMu.Lock()
+	baseURL = rawURL
+	baseURLMu.Unlock()
+
+	//absolute links in pages are made with it
+	renderSettingsModified()
+	return nil
+}
+
+//siteBaseURL get the configured base URL, or the scheme and host the request was made against if there isn't one
+func siteBaseURL(r *http.Request) string {
+	if configured := configuredBaseURL(); len(configured) > 0 {
+		return configured
+	}
+	return requestBaseURL(r)
+}
+
+//configuredBaseURL get the configured base URL, blank if there isn't one, for links which mustn't trust the request's Host header
+func configuredBaseURL() string {
+	baseURLMu.RLock()
+	defer baseURLMu.RUnlock()
+	return baseURL
+}
+
+//requestBaseURL get the scheme and host the request was made against
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s", scheme, r.Host)
+}
+
+//RenderDefault uses plush rendering engine to take default page template and create HTML content,
+//templates get the client's CSRF token as 'csrftoken' to send back with their forms
 func RenderDefault(w http.ResponseWriter, template string, pctx *plush.Context) error {
-	header, err := ioutil.ReadFile("res" + string(os.PathSeparator) + "header.snip")
+	pctx.Set("csrftoken", csrfTokenFor(w))
+
+	header, err := fs.ReadFile(assets, "res/header.snip")
 
 	if err != nil {
 		Error(w, err)
 		return err
 	}
 
-	content, err := ioutil.ReadFile("res" + string(os.PathSeparator) + template)
+	content, err := fs.ReadFile(assets, "res/"+template)
 	if err != nil {
 		Error(w, err)
 		return err
@@ -153,12 +315,20 @@ func RenderDefault(w http.ResponseWriter, template string, pctx *plush.Context)
 func Render(w http.ResponseWriter, r *http.Request, p *db.Page, ctx *plush.Context) error {
 	// assume response is fine/OK
 	var respCode = http.StatusOK
-	var htmlHead = "<head><link rel=\"stylesheet\" href=\"/css/berry-default.css\"><link rel=\"stylesheet\" href=\"/css/font.css\"></head>"
 	var respBytesData []byte
 	var uriVars map[string]string = mux.Vars(r)
 
-	//render page from plush template
-	html, err := plush.Render("<html>"+htmlHead+"<body><%= pagecontent %></body></html>", ctx)
+	//expand shortcodes in the page's content before it's placed into the layout
+	if content, ok := ctx.Value("pagecontent").(template.HTML); ok {
+		ctx.Set("pagecontent", template.HTML(shortcodes.Expand(string(content), p.Route)))
+	}
+
+	if !ctx.Has("seohead") {
+		ctx.Set("seohead", pageSEOHead(p))
+	}
+
+	//render page from the active theme's layout
+	html, err := renderThemeLayout(p, ctx)
 	if err != nil {
 		Error(w, err)
 		return err
@@ -259,7 +429,11 @@ func Render(w http.ResponseWriter, r *http.Request, p *db.Page, ctx *plush.Conte
 	}
 
 	if len(respBytesData) > 0 {
-		http.ServeContent(w, r, "", time.Now(), bytes.NewReader(respBytesData))
+		w.Header().Set("Cache-Control", pageCacheControl(p))
+		modtime := renderedModifiedTime(p)
+		setValidators(w, strongETag(respBytesData), modtime)
+		//serve content deals with If-None-Match and If-Modified-Since itself
+		http.ServeContent(w, r, "", modtime, bytes.NewReader(respBytesData))
 		return nil
 	}
 
@@ -273,6 +447,18 @@ func Render(w http.ResponseWriter, r *http.Request, p *db.Page, ctx *plush.Conte
 
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if respCode == http.StatusOK {
+		etag := strongETag([]byte(html))
+		w.Header().Set("Cache-Control", pageCacheControl(p))
+		modtime := renderedModifiedTime(p)
+		setValidators(w, etag, modtime)
+		if notModified(r, etag, modtime) {
+			writeNotModified(w)
+			return nil
+		}
+	}
+
 	w.WriteHeader(respCode)
 	w.Write([]byte(html))
 	return nil
@@ -280,7 +466,7 @@ func Render(w http.ResponseWriter, r *http.Request, p *db.Page, ctx *plush.Conte
 
 //RenderStr uses plush rendering engine to read page content from the DB and create HTML content as string
 func RenderStr(ctx *plush.Context) string {
-	html, err := plush.Render("<html><head><link rel=\"stylesheet\" href=\"/css/berry-default.css\"><link rel=\"stylesheet\" href=\"/css/font.css\"></head><%= pagecontent %></html>", ctx)
+	html, err := renderThemeLayout(&db.Page{}, ctx)
 	if err != nil {
 		logging.Error(err.Error())
 		return "<h1>500 Server Error</h1>"
@@ -0,0 +1,69 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/scheduler"
+	"github.com/tacusci/berrycms/util"
+)
+
+func TestAdminJobs(t *testing.T) {
+	if err := scheduler.Every("listedjob", "@every 1m", func(time.Time) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if err := scheduler.Defer("listedkind", "", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	//only root can see the jobs
+	ut := db.UsersTable{}
+	cookies := map[string][]*http.Cookie{}
+	for username, role := range map[string]db.UsersRoleFlag{"jobsuser": db.REG_USER, "jobsroot": db.ROOT_USER} {
+		u := &db.User{
+			CreatedDateTime: time.Now().Unix(),
+			UserroleId:      int(role),
+			Username:        username,
+			AuthHash:        util.HashAndSalt([]byte("password")),
+			Email:           username + "@example.com",
+		}
+		if err := ut.Insert(db.Conn, u); err != nil {
+			t.Fatal(err)
+		}
+		cookies[username] = logInAs(t, u, "Browser")
+	}
+
+	ajh := &AdminJobsHandler{Router: &MutableRouter{}, route: "/admin/jobs"}
+	for username, expectedStatus := range map[string]int{"jobsuser": http.StatusForbidden, "jobsroot": http.StatusOK} {
+		req := httptest.NewRequest("GET", "/admin/jobs", nil)
+		for _, cookie := range cookies[username] {
+			req.AddCookie(cookie)
+		}
+		responseRecorder := httptest.NewRecorder()
+		ajh.Get(responseRecorder, req)
+		if responseRecorder.Code != expectedStatus {
+			t.Errorf("Expected jobs page to respond %d to %s, got %d", expectedStatus, username, responseRecorder.Code)
+		}
+		if expectedStatus == http.StatusOK && (!strings.Contains(responseRecorder.Body.String(), "listedjob") || !strings.Contains(responseRecorder.Body.String(), "listedkind")) {
+			t.Errorf("Expected jobs page to list the scheduled and deferred jobs")
+		}
+	}
+}
@@ -50,6 +50,13 @@ func (lh *LoginHandler) Get(w http.ResponseWriter, r *http.Request) {
 		pctx.Set("quillenabled", false)
 		pctx.Set("formhash", lh.mapFormToHash(w, r, "loginform"))
 		pctx.Set("loginerrormessage", "")
+		pctx.Set("oidcproviders", []*db.OIDCProvider{})
+		opt := db.OIDCProvidersTable{}
+		if providers, err := opt.SelectEnabled(db.Conn); err == nil {
+			pctx.Set("oidcproviders", providers)
+		} else {
+			logging.Error(err.Error())
+		}
 		pctx.Set("adminhiddenpassword", "")
 		if lh.Router.AdminHidden {
 			pctx.Set("adminhiddenpassword", fmt.Sprintf("/%s", lh.Router.AdminHiddenPassword))
@@ -94,70 +101,47 @@ func (lh *LoginHandler) Post(w http.ResponseWriter, r *http.Request) {
 
 	if lh.fetchFormHash(w, r, r.PostFormValue("formname")) == r.PostFormValue("hashid") {
 
-		ut := db.UsersTable{}
-		user, err := ut.SelectByUsername(db.Conn, r.PostFormValue("username"))
+		username := r.PostFormValue("username")
+		rememberMe := r.PostFormValue("rememberme") == "on"
+		ip := clientIP(r)
+		now := time.Now()
 
-		if err != nil {
-			Error(w, err)
+		//attempts made at the same time wait their turn, so none get past the throttling before the others are counted
+		unlock := lockLoginAttempts(ip, username)
+		defer unlock()
+
+		if throttled, until := loginThrottled(ip, username, now); throttled {
+			logging.Warn(fmt.Sprintf("Rejected login attempt for username '%s' from %s, throttled until %s", username, ip, until.Format(time.RFC1123)))
+			setLoginErrorMessage(w, r, fmt.Sprintf("Too many failed login attempts, try again in %s...", until.Sub(now).Round(time.Second)))
+			http.Redirect(w, r, lh.route, http.StatusFound)
 			return
 		}
 
-		user.AuthHash = r.PostFormValue("authhash")
-
-		if user.Login() {
+		if user, ok := checkLogin(username, r.PostFormValue("authhash")); ok {
 			logging.Debug("Login successful...")
 
-			v4UUID, err := uuid.NewV4()
-
-			if err != nil {
-				Error(w, err)
-				return
-			}
-
-			sessionUUID := v4UUID.String()
-
-			authSessionsTable := db.AuthSessionsTable{}
-
-			if authSession, err := authSessionsTable.SelectByUserUUID(db.Conn, user.UUID); err != nil {
-				logging.Debug(fmt.Sprintf("There's no existing session uuid for user: %s of UUID: %s, creating session of UUID: %s...", user.Username, user.UUID, sessionUUID))
-				err := authSessionsTable.Insert(db.Conn, &db.AuthSession{
-					CreatedDateTime:    time.Now().Unix(),
-					LastActiveDateTime: time.Now().Unix(),
-					SessionUUID:        sessionUUID,
-					UserUUID:           user.UUID,
-				})
-
-				if err != nil {
-					Error(w, err)
-				}
-			} else {
-				logging.Debug(fmt.Sprintf("Existing session for uuid for user: %s of UUID: %s, updating...", user.Username, user.UUID))
-				err := authSessionsTable.Update(db.Conn, &db.AuthSession{
-					CreatedDateTime:    authSession.CreatedDateTime,
-					LastActiveDateTime: time.Now().Unix(),
-					SessionUUID:        sessionUUID,
-					UserUUID:           user.UUID,
-				})
-				if err != nil {
+			//the account's failures are only forgotten once any second factor's been passed too, so wrong codes add up
+			if needsSecondFactor(user) {
+				if err := startTwoFactorChallenge(w, r, user, rememberMe); err != nil {
 					Error(w, err)
+					return
 				}
+				http.Redirect(w, r, adminRoutePrefix(lh.Router)+"/login/2fa", http.StatusFound)
+				return
 			}
 
-			authSessionStore, err := sessionsstore.Get(r, "auth")
-
-			if err != nil {
+			recordLoginSuccess(username)
+			if err := startAuthSession(w, r, user, rememberMe); err != nil {
 				Error(w, err)
+				return
 			}
-
-			authSessionStore.Values["sessionuuid"] = sessionUUID
-			authSessionStore.Save(r, w)
-
-			logging.Debug("Updated session store with new session UUID and added created date/timestamp")
 		} else {
+			recordLoginFailure(ip, username, now)
+
 			authSessionStore, err := sessionsstore.Get(r, "auth")
 
 			if err != nil {
-				Error(w, err)
+				logging.Debug(fmt.Sprintf("Error trying to read existing session \"auth\" -> %s", err.Error()))
 			}
 
 			logging.Debug("Login unsuccessful...")
@@ -166,14 +150,7 @@ func (lh *LoginHandler) Post(w http.ResponseWriter, r *http.Request) {
 
 			authSessionStore.Save(r, w)
 
-			loginErrorStore, err := sessionsstore.Get(r, "passerrmsg")
-
-			if err != nil {
-				Error(w, err)
-			}
-
-			loginErrorStore.Values["errormessage"] = "Username or password incorrect..."
-			loginErrorStore.Save(r, w)
+			setLoginErrorMessage(w, r, "Username or password incorrect...")
 		}
 	} else {
 		logging.Error("Login form submitted with invalid uuid hash")
@@ -182,6 +159,93 @@ func (lh *LoginHandler) Post(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, lh.route, http.StatusFound)
 }
 
+//startAuthSession logs user in, creating a new auth session for the client and storing its UUID in the client's session store,
+//if rememberMe the session isn't ended for being idle and its cookie outlasts the browser being closed
+func startAuthSession(w http.ResponseWriter, r *http.Request, user *db.User, rememberMe bool) error {
+	v4UUID, err := uuid.NewV4()
+
+	if err != nil {
+		return err
+	}
+
+	sessionUUID := v4UUID.String()
+
+	//each login gets its own session, so logging in somewhere new doesn't log the user out anywhere else
+	logging.Debug(fmt.Sprintf("Creating session of UUID: %s for user: %s of UUID: %s...", sessionUUID, user.Username, user.UUID))
+	authSessionsTable := db.AuthSessionsTable{}
+	err = authSessionsTable.Insert(db.Conn, &db.AuthSession{
+		CreatedDateTime:    time.Now().Unix(),
+		LastActiveDateTime: time.Now().Unix(),
+		SessionUUID:        sessionUUID,
+		UserUUID:           user.UUID,
+		IPAddress:          clientIP(r),
+		UserAgent:          sessionUserAgent(r),
+		RememberMe:         rememberMe,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	authSessionStore, err := sessionsstore.Get(r, "auth")
+
+	if err != nil {
+		logging.Debug(fmt.Sprintf("Error trying to read existing session \"auth\" -> %s", err.Error()))
+	}
+
+	//the client's replacing a session it logged in with before, rather than logging in somewhere new
+	if previousSessionUUID, ok := authSessionStore.Values["sessionuuid"].(string); ok && len(previousSessionUUID) > 0 {
+		if err := authSessionsTable.DeleteBySessionUUID(db.Conn, previousSessionUUID); err != nil {
+			logging.Error(err.Error())
+		}
+	}
+
+	authSessionStore.Values["sessionuuid"] = sessionUUID
+	authSessionStore.Options.MaxAge = 0
+	if rememberMe {
+		_, _, rememberMeLifetime := sessionLifetimes()
+		authSessionStore.Options.MaxAge = int(rememberMeLifetime.Seconds())
+	}
+	if err := authSessionStore.Save(r, w); err != nil {
+		return err
+	}
+
+	logging.Debug("Updated session store with new session UUID and added created date/timestamp")
+
+	return nil
+}
+
+//currentSessionUUID get the UUID of the auth session the client is logged in with, blank if it isn't
+func currentSessionUUID(r *http.Request) string {
+	authSessionStore, err := sessionsstore.Get(r, "auth")
+	if err != nil {
+		return ""
+	}
+	sessionUUID, _ := authSessionStore.Values["sessionuuid"].(string)
+	return sessionUUID
+}
+
+//sessionUserAgent get the client's user agent, cut down to fit in the sessions table
+func sessionUserAgent(r *http.Request) string {
+	userAgent := r.UserAgent()
+	if len(userAgent) > 125 {
+		return userAgent[:125]
+	}
+	return userAgent
+}
+
+//setLoginErrorMessage sets the message shown the next time the client views the login form
+func setLoginErrorMessage(w http.ResponseWriter, r *http.Request, message string) {
+	loginErrorStore, err := sessionsstore.Get(r, "passerrmsg")
+
+	if err != nil {
+		logging.Debug(fmt.Sprintf("Error trying to read existing session \"passerrmsg\" -> %s", err.Error()))
+	}
+
+	loginErrorStore.Values["errormessage"] = message
+	loginErrorStore.Save(r, w)
+}
+
 func (lh *LoginHandler) mapFormToHash(w http.ResponseWriter, r *http.Request, formName string) string {
 	formSessionStore, err := sessionsstore.Get(r, "forms")
 	defer formSessionStore.Save(r, w)
@@ -0,0 +1,170 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/gorilla/sessions"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+//LoginTwoFactorHandler the second step of logging in, challenges users for their TOTP or a recovery code,
+//or has users the policy requires to use two-factor authentication set it up
+type LoginTwoFactorHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (ltfh *LoginTwoFactorHandler) Get(w http.ResponseWriter, r *http.Request) {
+	_, user, _ := pendingTwoFactorChallenge(r)
+	if user == nil {
+		http.Redirect(w, r, adminRoutePrefix(ltfh.Router)+"/login", http.StatusFound)
+		return
+	}
+	ltfh.render(w, r, user, "", nil)
+}
+
+//Post handles post requests to URI
+func (ltfh *LoginTwoFactorHandler) Post(w http.ResponseWriter, r *http.Request) {
+	loginRoute := adminRoutePrefix(ltfh.Router) + "/login"
+
+	challenge, user, twoFactorSessionStore := pendingTwoFactorChallenge(r)
+	if user == nil {
+		http.Redirect(w, r, loginRoute, http.StatusFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		Error(w, err)
+		return
+	}
+
+	//wrong codes count towards the same throttling and lockout as wrong passwords
+	ip := clientIP(r)
+	now := time.Now()
+	unlock := lockLoginAttempts(ip, user.Username)
+	defer unlock()
+	if throttled, until := loginThrottled(ip, user.Username, now); throttled {
+		logging.Warn(fmt.Sprintf("Rejected two-factor attempt for user %s from %s, throttled until %s", user.Username, ip, until.Format(time.RFC1123)))
+		ltfh.render(w, r, user, fmt.Sprintf("Too many failed login attempts, try again in %s...", until.Sub(now).Round(time.Second)), nil)
+		return
+	}
+
+	//the attempt is counted before the code's checked, so attempts made at the same time can't get past the limit
+	tfct := db.TwoFactorChallengesTable{}
+	allowed, err := tfct.UseAttempt(db.Conn, challenge.ChallengeID, maxTwoFactorAttempts)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+	if !allowed {
+		logging.Info(fmt.Sprintf("Too many two-factor attempts for user %s", user.Username))
+		clearTwoFactorChallenge(w, r, twoFactorSessionStore)
+		setLoginErrorMessage(w, r, "Too many incorrect codes, log in again...")
+		http.Redirect(w, r, loginRoute, http.StatusFound)
+		return
+	}
+
+	if !twoFactorEnabled(user) {
+		//the policy requires this user to set up two-factor authentication before they can log in
+		recoveryCodes, err := confirmTwoFactorEnrolment(user, r.PostFormValue("code"))
+		if err != nil {
+			ltfh.failedAttempt(w, r, user, err.Error())
+			return
+		}
+		if !ltfh.logIn(w, r, user, challenge, twoFactorSessionStore) {
+			return
+		}
+		ltfh.render(w, r, user, "", recoveryCodes)
+		return
+	}
+
+	if !verifySecondFactor(user, r.PostFormValue("code")) {
+		ltfh.failedAttempt(w, r, user, "That code isn't right...")
+		return
+	}
+
+	if ltfh.logIn(w, r, user, challenge, twoFactorSessionStore) {
+		http.Redirect(w, r, adminRoutePrefix(ltfh.Router)+"/admin", http.StatusFound)
+	}
+}
+
+//failedAttempt counts a wrong code as a failed login and shows the challenge again
+func (ltfh *LoginTwoFactorHandler) failedAttempt(w http.ResponseWriter, r *http.Request, user *db.User, problem string) {
+	logging.Debug(fmt.Sprintf("Incorrect two-factor code for user %s", user.Username))
+	recordLoginFailure(clientIP(r), user.Username, time.Now())
+	ltfh.render(w, r, user, problem, nil)
+}
+
+//logIn creates user's auth session now they've passed the challenge
+func (ltfh *LoginTwoFactorHandler) logIn(w http.ResponseWriter, r *http.Request, user *db.User, challenge *db.TwoFactorChallenge, twoFactorSessionStore *sessions.Session) bool {
+	clearTwoFactorChallenge(w, r, twoFactorSessionStore)
+	if err := startAuthSession(w, r, user, challenge.RememberMe); err != nil {
+		Error(w, err)
+		return false
+	}
+	recordLoginSuccess(user.Username)
+	logging.Debug(fmt.Sprintf("User %s passed two-factor challenge", user.Username))
+	return true
+}
+
+//render shows the challenge, the enrolment if user hasn't set up two-factor authentication yet,
+//or their recovery codes once they've finished setting it up
+func (ltfh *LoginTwoFactorHandler) render(w http.ResponseWriter, r *http.Request, user *db.User, problem string, recoveryCodes []string) {
+	pctx := plush.NewContext()
+	pctx.Set("title", "Two-Factor Authentication")
+	pctx.Set("quillenabled", false)
+	pctx.Set("adminhiddenpassword", adminRoutePrefix(ltfh.Router))
+	pctx.Set("problem", problem)
+	pctx.Set("recoverycodes", recoveryCodes)
+	pctx.Set("enrolling", false)
+	pctx.Set("secret", "")
+	pctx.Set("otpauthuri", "")
+	pctx.Set("qrcode", "")
+
+	if len(recoveryCodes) == 0 && !twoFactorEnabled(user) {
+		tf, err := pendingTwoFactorEnrolment(user)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		uri, qr, err := twoFactorQRCode(user, tf.Secret)
+		if err != nil {
+			Error(w, err)
+			return
+		}
+		pctx.Set("enrolling", true)
+		pctx.Set("secret", tf.Secret)
+		pctx.Set("otpauthuri", uri)
+		pctx.Set("qrcode", qr)
+	}
+
+	RenderDefault(w, "login.2fa.html", pctx)
+}
+
+//Route get URI route for handler
+func (ltfh *LoginTwoFactorHandler) Route() string { return ltfh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (ltfh *LoginTwoFactorHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (ltfh *LoginTwoFactorHandler) HandlesPost() bool { return true }
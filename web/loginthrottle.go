@@ -0,0 +1,234 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	//loginFreeAttempts failures allowed before each further attempt has to wait
+	loginFreeAttempts = 3
+	//loginBaseDelay wait after the first failure past the free attempts, doubling after each further failure
+	loginBaseDelay = time.Second
+	//loginMaxDelay longest wait between attempts before lockout
+	loginMaxDelay = time.Minute
+	//loginFailureWindow failures are forgotten this long after the last one
+	loginFailureWindow = time.Hour
+	//accountLockoutFailures failures against one username which lock it out
+	accountLockoutFailures = 10
+	//ipLockoutFailures failures from one IP which lock it out, higher than for accounts as IPs can be shared
+	ipLockoutFailures = 50
+	//loginLockoutDuration how long a locked out account or IP has to wait
+	loginLockoutDuration = 15 * time.Minute
+
+	accountAttemptPrefix = "user:"
+	ipAttemptPrefix      = "ip:"
+)
+
+//loginAttemptLock serialises the login attempts against one key, counting who's holding or waiting for it
+type loginAttemptLock struct {
+	sync.Mutex
+	holders int
+}
+
+var (
+	loginAttemptLocksMu sync.Mutex
+	loginAttemptLocks   = map[string]*loginAttemptLock{}
+)
+
+//dummyAuthHash compared against when there's no user with the username tried, so logging in takes as long either way
+var dummyAuthHash, _ = bcrypt.GenerateFromPassword([]byte("berrycms"), bcrypt.DefaultCost)
+
+//clientIP the IP address of the client which made r
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func accountAttemptKey(username string) string {
+	return accountAttemptPrefix + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipAttemptKey(ip string) string {
+	return ipAttemptPrefix + ip
+}
+
+//loginDelay how long after its last failure a key with failures has to wait before trying again
+func loginDelay(failures int) time.Duration {
+	if failures < loginFreeAttempts {
+		return 0
+	}
+	return util.Backoff(failures-loginFreeAttempts+1, loginBaseDelay, loginMaxDelay)
+}
+
+//loginRetryAt when the next login attempt against la will be considered
+func loginRetryAt(la *db.LoginAttempt) time.Time {
+	retryAt := time.Unix(la.LastFailureDateTime, 0).Add(loginDelay(la.Failures))
+	if lockedUntil := time.Unix(la.LockedUntilDateTime, 0); lockedUntil.After(retryAt) {
+		return lockedUntil
+	}
+	return retryAt
+}
+
+//lockLoginAttempts waits for any other login attempt for username or from ip to finish, so each attempt's
+//checked against the failures before it, call the returned func once the attempt's been recorded
+func lockLoginAttempts(ip string, username string) func() {
+	//always taken in the same order so two attempts can't each hold the key the other's waiting for
+	keys := []string{ipAttemptKey(ip), accountAttemptKey(username)}
+
+	locks := make([]*loginAttemptLock, len(keys))
+	for i, key := range keys {
+		loginAttemptLocksMu.Lock()
+		lock, ok := loginAttemptLocks[key]
+		if !ok {
+			lock = &loginAttemptLock{}
+			loginAttemptLocks[key] = lock
+		}
+		lock.holders++
+		loginAttemptLocksMu.Unlock()
+
+		lock.Lock()
+		locks[i] = lock
+	}
+
+	return func() {
+		for i := len(keys) - 1; i >= 0; i-- {
+			locks[i].Unlock()
+
+			loginAttemptLocksMu.Lock()
+			locks[i].holders--
+			if locks[i].holders == 0 {
+				delete(loginAttemptLocks, keys[i])
+			}
+			loginAttemptLocksMu.Unlock()
+		}
+	}
+}
+
+//loginThrottled checks whether login attempts for username from ip have to wait, returning until when
+func loginThrottled(ip string, username string, now time.Time) (bool, time.Time) {
+	lat := db.LoginAttemptsTable{}
+
+	var until time.Time
+	for _, key := range []string{ipAttemptKey(ip), accountAttemptKey(username)} {
+		la, err := lat.SelectByKey(db.Conn, key)
+		if err != nil {
+			logging.Error(err.Error())
+			continue
+		}
+		if retryAt := loginRetryAt(la); retryAt.After(until) {
+			until = retryAt
+		}
+	}
+
+	return now.Before(until), until
+}
+
+//recordLoginFailure counts a failed login for username from ip, locking either out if they've failed too often
+func recordLoginFailure(ip string, username string, now time.Time) {
+	logging.Warn(fmt.Sprintf("Failed login attempt for username '%s' from %s", username, ip))
+
+	lat := db.LoginAttemptsTable{}
+	for _, lockout := range []struct {
+		key      string
+		failures int
+	}{{ipAttemptKey(ip), ipLockoutFailures}, {accountAttemptKey(username), accountLockoutFailures}} {
+		la, err := lat.SelectByKey(db.Conn, lockout.key)
+		if err != nil {
+			logging.Error(err.Error())
+			continue
+		}
+
+		if now.Sub(time.Unix(la.LastFailureDateTime, 0)) > loginFailureWindow {
+			la.Failures = 0
+		}
+		la.Failures++
+		la.LastFailureDateTime = now.Unix()
+
+		if la.Failures >= lockout.failures {
+			la.LockedUntilDateTime = now.Add(loginLockoutDuration).Unix()
+			la.Failures = 0
+			logging.Warn(fmt.Sprintf("Locked out %s until %s after too many failed logins", lockout.key, time.Unix(la.LockedUntilDateTime, 0).Format(time.RFC1123)))
+		}
+
+		if err := lat.Save(db.Conn, la); err != nil {
+			logging.Error(err.Error())
+		}
+	}
+}
+
+//recordLoginSuccess forgets username's failures now they've logged in, the IP's are kept so
+//an attacker with one account can't use it to keep guessing others
+func recordLoginSuccess(username string) {
+	lat := db.LoginAttemptsTable{}
+	if _, err := lat.DeleteByKey(db.Conn, accountAttemptKey(username)); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//unlockAccount lifts any lockout of username and forgets its failures
+func unlockAccount(username string) error {
+	lat := db.LoginAttemptsTable{}
+	_, err := lat.DeleteByKey(db.Conn, accountAttemptKey(username))
+	return err
+}
+
+//lockedAccounts get when each locked out username is locked out until
+func lockedAccounts(now time.Time) (map[string]int64, error) {
+	lat := db.LoginAttemptsTable{}
+	attempts, err := lat.SelectLocked(db.Conn, accountAttemptPrefix, now.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	locked := map[string]int64{}
+	for _, la := range attempts {
+		locked[strings.TrimPrefix(la.AttemptKey, accountAttemptPrefix)] = la.LockedUntilDateTime
+	}
+	return locked, nil
+}
+
+//checkLogin checks password is username's, taking as long whether or not there's a user with username
+func checkLogin(username string, password string) (*db.User, bool) {
+	ut := db.UsersTable{}
+	user, err := ut.SelectByUsername(db.Conn, username)
+	if err != nil {
+		logging.Error(err.Error())
+	}
+
+	if err != nil || len(user.UUID) == 0 {
+		bcrypt.CompareHashAndPassword(dummyAuthHash, []byte(password))
+		return nil, false
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(user.AuthHash), []byte(password)) != nil {
+		return nil, false
+	}
+	return user, true
+}
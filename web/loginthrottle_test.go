@@ -0,0 +1,169 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+)
+
+//loginPost submits the login form for username and password from ip
+func loginPost(lh *LoginHandler, username string, password string, ip string) *httptest.ResponseRecorder {
+	formRecorder := httptest.NewRecorder()
+	hash := lh.mapFormToHash(formRecorder, httptest.NewRequest("GET", "/login", nil), "loginform")
+
+	form := url.Values{"formname": {"loginform"}, "hashid": {hash}, "username": {username}, "authhash": {password}}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.RemoteAddr = ip + ":54321"
+	for _, cookie := range formRecorder.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+
+	responseRecorder := httptest.NewRecorder()
+	lh.Post(responseRecorder, req)
+	return responseRecorder
+}
+
+//backdateLoginFailures moves key's last failure back by ago, as though time had passed
+func backdateLoginFailures(t *testing.T, key string, failures int, ago time.Duration) {
+	lat := db.LoginAttemptsTable{}
+	la, err := lat.SelectByKey(db.Conn, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	la.Failures = failures
+	la.LastFailureDateTime = time.Now().Add(-ago).Unix()
+	if err := lat.Save(db.Conn, la); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoginThrottling(t *testing.T) {
+	u := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.REG_USER),
+		Username:        "lockme",
+		AuthHash:        util.HashAndSalt([]byte("rightpassword")),
+		Email:           "lockme@example.com",
+	}
+	ut := db.UsersTable{}
+	if err := ut.Insert(db.Conn, u); err != nil {
+		t.Fatal(err)
+	}
+
+	lh := &LoginHandler{Router: &MutableRouter{}, route: "/login"}
+
+	for _, username := range []string{"nosuchuser", "x' OR '1'='1", "lockme"} {
+		if responseRecorder := loginPost(lh, username, "wrongpassword", "10.0.0.1"); responseRecorder.Code != http.StatusFound || startedAuthSession(responseRecorder) {
+			t.Errorf("Expected failed login for '%s' to go back to login, got %d", username, responseRecorder.Code)
+		}
+	}
+
+	//past the free attempts the next one has to wait, even with the right password
+	backdateLoginFailures(t, accountAttemptKey("lockme"), loginFreeAttempts, 0)
+	if startedAuthSession(loginPost(lh, "lockme", "rightpassword", "10.0.0.2")) {
+		t.Errorf("Expected login straight after too many failures to be throttled")
+	}
+	backdateLoginFailures(t, accountAttemptKey("lockme"), loginFreeAttempts, loginDelay(loginFreeAttempts))
+	if !startedAuthSession(loginPost(lh, "lockme", "rightpassword", "10.0.0.2")) {
+		t.Fatalf("Expected login to be allowed once the delay has passed")
+	}
+	if la, _ := (&db.LoginAttemptsTable{}).SelectByKey(db.Conn, accountAttemptKey("lockme")); la.Failures != 0 {
+		t.Errorf("Expected logging in to forget the account's failures")
+	}
+
+	//one failure too many locks the account out, from any IP
+	backdateLoginFailures(t, accountAttemptKey("lockme"), accountLockoutFailures-1, loginMaxDelay)
+	loginPost(lh, "lockme", "wrongpassword", "10.0.0.3")
+	if startedAuthSession(loginPost(lh, "lockme", "rightpassword", "10.0.0.4")) {
+		t.Errorf("Expected locked out account not to be able to log in")
+	}
+	locked, err := lockedAccounts(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := locked["lockme"]; !ok {
+		t.Fatalf("Expected account to be listed as locked out")
+	}
+
+	if err := unlockAccount("lockme"); err != nil {
+		t.Fatal(err)
+	}
+	if !startedAuthSession(loginPost(lh, "lockme", "rightpassword", "10.0.0.4")) {
+		t.Errorf("Expected unlocked account to be able to log in")
+	}
+
+	//an IP failing against many accounts is locked out too
+	backdateLoginFailures(t, ipAttemptKey("10.0.0.5"), ipLockoutFailures-1, loginMaxDelay)
+	loginPost(lh, "someoneelse", "wrongpassword", "10.0.0.5")
+	if startedAuthSession(loginPost(lh, "lockme", "rightpassword", "10.0.0.5")) {
+		t.Errorf("Expected locked out IP not to be able to log in")
+	}
+}
+
+func TestParallelLoginThrottling(t *testing.T) {
+	u := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.REG_USER),
+		Username:        "guessme",
+		AuthHash:        util.HashAndSalt([]byte("rightpassword")),
+		Email:           "guessme@example.com",
+	}
+	ut := db.UsersTable{}
+	if err := ut.Insert(db.Conn, u); err != nil {
+		t.Fatal(err)
+	}
+	defer unlockAccount("guessme")
+
+	lh := &LoginHandler{Router: &MutableRouter{}, route: "/login"}
+
+	//guesses sent all at once from different IPs are each checked against the failures before them
+	guesses := loginFreeAttempts * 4
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			loginPost(lh, "guessme", "wrongpassword", fmt.Sprintf("10.0.1.%d", i+1))
+		}(i)
+	}
+	wg.Wait()
+
+	lat := db.LoginAttemptsTable{}
+	la, err := lat.SelectByKey(db.Conn, accountAttemptKey("guessme"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if la.Failures != loginFreeAttempts {
+		t.Errorf("Expected only %d of %d parallel guesses to be tried before throttling, got %d", loginFreeAttempts, guesses, la.Failures)
+	}
+	if throttled, _ := loginThrottled("10.0.1.200", "guessme", time.Unix(la.LastFailureDateTime, 0)); !throttled {
+		t.Errorf("Expected logging in straight after the parallel guesses to be throttled")
+	}
+
+	if len(loginAttemptLocks) != 0 {
+		t.Errorf("Expected the locks for finished attempts to be dropped, %d left", len(loginAttemptLocks))
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"io/fs"
+
+	"github.com/tacusci/berrycms/mail"
+)
+
+//queueTemplatedMail fills in the mail template res/mail/<name>.txt with data, and queues it to be sent to the to addresses,
+//sensitive mail holds a secret so is never logged or kept once sent
+func queueTemplatedMail(to []string, name string, data interface{}, sensitive bool) error {
+	text, err := fs.ReadFile(assets, "res/mail/"+name+".txt")
+	if err != nil {
+		return err
+	}
+
+	t, err := mail.ParseTemplate(name, string(text))
+	if err != nil {
+		return err
+	}
+
+	subject, body, err := t.Render(data)
+	if err != nil {
+		return err
+	}
+
+	return mail.QueueMessage(&mail.Message{To: to, Subject: subject, Body: body, Sensitive: sensitive})
+}
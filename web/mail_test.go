@@ -0,0 +1,146 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/mail"
+	"github.com/tacusci/berrycms/mail/smtptest"
+)
+
+func TestQueuedMailDelivery(t *testing.T) {
+	sink := smtptest.NewServer()
+	defer sink.Close()
+	sink.RequireAuth("berry", "secret")
+
+	if err := mail.SetMailer(&mail.SMTPMailer{Host: sink.Host, Port: sink.Port, Username: "berry", Password: "secret"}, "Berry CMS <berrycms@example.com>"); err != nil {
+		t.Fatal(err)
+	}
+	defer mail.SetMailer(&mail.LogMailer{}, "")
+
+	if err := mail.Queue([]string{"not an address"}, "Subject", "Body"); err == nil {
+		t.Errorf("Expected queueing mail to an invalid address to fail")
+	}
+
+	if err := queueTemplatedMail([]string{"Jane <jane@example.com>"}, "passwordreset", map[string]interface{}{"Username": "jane", "Minutes": 60, "Link": "https://example.com/reset"}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	//the first attempt is turned away, so the message waits to be tried again
+	sink.FailNext(1)
+	now := time.Now()
+	if sent, err := mail.DeliverQueued(now); err != nil || sent != 0 {
+		t.Fatalf("Expected first attempt to fail, sent %d, err %v", sent, err)
+	}
+	ot := db.OutboxTable{}
+	queued, _ := ot.SelectDue(db.Conn, mail.StatusQueued, now.Add(time.Hour).Unix(), 10)
+	if len(queued) != 1 || queued[0].Attempts != 1 || len(queued[0].LastError) == 0 || queued[0].NextAttemptDateTime != now.Add(mail.Backoff(1)).Unix() {
+		t.Fatalf("Expected message to be queued for a retry after backoff")
+	}
+
+	if sent, _ := mail.DeliverQueued(now); sent != 0 {
+		t.Errorf("Expected message not to be retried before its backoff")
+	}
+
+	if sent, err := mail.DeliverQueued(now.Add(mail.Backoff(1))); err != nil || sent != 1 {
+		t.Fatalf("Expected retry to deliver message, sent %d, err %v", sent, err)
+	}
+
+	messages := sink.Messages()
+	if len(messages) != 1 || messages[0].From != "berrycms@example.com" || messages[0].To[0] != "jane@example.com" {
+		t.Fatalf("Expected sink to receive the message, got %+v", messages)
+	}
+	if !strings.Contains(messages[0].Data, "Subject: Reset your password") || !strings.Contains(messages[0].Data, "https://example.com/reset") {
+		t.Errorf("Expected message to be the filled in template, got %s", messages[0].Data)
+	}
+
+	om, _ := ot.SelectByID(db.Conn, queued[0].Outboxid)
+	if om.Status != mail.StatusSent || om.SentDateTime == 0 {
+		t.Errorf("Expected message to be marked sent, got %s", om.Status)
+	}
+
+	//a server which keeps turning the message away is given up on
+	if err := mail.Queue([]string{"bounce@example.com"}, "Subject", "Body"); err != nil {
+		t.Fatal(err)
+	}
+	sink.FailNext(mail.MaxAttempts)
+	for attempt := 0; attempt < mail.MaxAttempts; attempt++ {
+		mail.DeliverQueued(now.Add(time.Duration(attempt) * 24 * time.Hour))
+	}
+	if queued, _ := ot.SelectDue(db.Conn, mail.StatusFailed, now.Add(365*24*time.Hour).Unix(), 10); len(queued) != 1 || queued[0].Attempts != mail.MaxAttempts {
+		t.Errorf("Expected message to be given up on after %d attempts", mail.MaxAttempts)
+	}
+}
+
+func TestSensitiveMail(t *testing.T) {
+	sink := smtptest.NewServer()
+	defer sink.Close()
+
+	if err := mail.SetMailer(&mail.SMTPMailer{Host: sink.Host, Port: sink.Port}, "berrycms@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	defer mail.SetMailer(&mail.LogMailer{}, "")
+
+	link := "https://example.com/login/reset/secrettoken"
+	if err := queueTemplatedMail([]string{"jane@example.com"}, "passwordreset", map[string]interface{}{"Username": "jane", "Minutes": 60, "Link": link}, true); err != nil {
+		t.Fatal(err)
+	}
+
+	ot := db.OutboxTable{}
+	now := time.Now()
+	queued, _ := ot.SelectDue(db.Conn, mail.StatusQueued, now.Unix(), 10)
+	if len(queued) != 1 || !queued[0].Sensitive || !strings.Contains(queued[0].Body, link) {
+		t.Fatalf("Expected the sensitive message to be queued with its body")
+	}
+
+	if sent, err := mail.DeliverQueued(now); err != nil || sent != 1 {
+		t.Fatalf("Expected the sensitive message to be delivered, sent %d, err %v", sent, err)
+	}
+	if messages := sink.Messages(); len(messages) != 1 || !strings.Contains(messages[0].Data, link) {
+		t.Fatalf("Expected the delivered message to hold the link")
+	}
+
+	//once delivered the link is no longer kept in the outbox
+	if om, _ := ot.SelectByID(db.Conn, queued[0].Outboxid); om.Status != mail.StatusSent || len(om.Body) > 0 {
+		t.Errorf("Expected the sent sensitive message's body to be cleared, got %q", om.Body)
+	}
+
+	//the log mailer never writes out sensitive messages
+	dir, err := ioutil.TempDir("", "berrycmsmail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	lm := &mail.LogMailer{Dir: dir}
+	if err := lm.Send(&mail.Message{From: "berrycms@example.com", To: []string{"jane@example.com"}, Subject: "Reset", Body: link, Sensitive: true}); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected no file to be written for a sensitive message, got %d", len(files))
+	}
+	if err := lm.Send(&mail.Message{From: "berrycms@example.com", To: []string{"jane@example.com"}, Subject: "Hello", Body: "Hello"}); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Expected a file to be written for other messages, got %d", len(files))
+	}
+}
@@ -0,0 +1,491 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/oidc"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+)
+
+//oidcSignInTimeout how long a user has to sign in at their provider before having to start again
+const oidcSignInTimeout = 10 * 60
+
+//usernameSeparators runs of characters which can't appear in usernames
+var usernameSeparators = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+//OIDCLoginHandler sends users to sign in at an OpenID Connect provider
+type OIDCLoginHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (olh *OIDCLoginHandler) Get(w http.ResponseWriter, r *http.Request) {
+	op := db.OIDCProvidersTable{}
+	provider, err := op.SelectBySlug(db.Conn, mux.Vars(r)["provider"])
+	if err != nil || !provider.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	cfg, err := oidcConfig(olh.Router, provider)
+	if err != nil {
+		logging.Error(err.Error())
+		setLoginErrorMessage(w, r, fmt.Sprintf("Unable to sign in with %s...", provider.Title))
+		http.Redirect(w, r, adminRoutePrefix(olh.Router)+"/login", http.StatusFound)
+		return
+	}
+
+	state, err := oidc.RandomString()
+	if err != nil {
+		Error(w, err)
+		return
+	}
+	nonce, err := oidc.RandomString()
+	if err != nil {
+		Error(w, err)
+		return
+	}
+	verifier, err := oidc.RandomString()
+	if err != nil {
+		Error(w, err)
+		return
+	}
+
+	authCodeURL, err := oidc.AuthCodeURL(cfg, state, nonce, verifier)
+	if err != nil {
+		logging.Error(err.Error())
+		setLoginErrorMessage(w, r, fmt.Sprintf("Unable to reach %s to sign in...", provider.Title))
+		http.Redirect(w, r, adminRoutePrefix(olh.Router)+"/login", http.StatusFound)
+		return
+	}
+
+	oidcSessionStore, err := sessionsstore.Get(r, "oidc")
+	if err != nil {
+		logging.Debug(fmt.Sprintf("Error trying to read existing session \"oidc\" -> %s", err.Error()))
+	}
+	oidcSessionStore.Options.MaxAge = oidcSignInTimeout
+	oidcSessionStore.Values["provider"] = provider.Slug
+	oidcSessionStore.Values["state"] = state
+	oidcSessionStore.Values["nonce"] = nonce
+	oidcSessionStore.Values["verifier"] = verifier
+	if err := oidcSessionStore.Save(r, w); err != nil {
+		Error(w, err)
+		return
+	}
+
+	http.Redirect(w, r, authCodeURL, http.StatusFound)
+}
+
+//Post handles post requests to URI
+func (olh *OIDCLoginHandler) Post(w http.ResponseWriter, r *http.Request) {}
+
+//Route get URI route for handler
+func (olh *OIDCLoginHandler) Route() string { return olh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (olh *OIDCLoginHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (olh *OIDCLoginHandler) HandlesPost() bool { return false }
+
+//OIDCCallbackHandler signs in users the OpenID Connect provider sends back, creating their user the first time
+type OIDCCallbackHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (och *OIDCCallbackHandler) Get(w http.ResponseWriter, r *http.Request) {
+	loginRoute := adminRoutePrefix(och.Router) + "/login"
+
+	user, err := och.signIn(r)
+	if err != nil {
+		logging.Error(fmt.Sprintf("OpenID Connect sign in failed -> %s", err.Error()))
+		setLoginErrorMessage(w, r, "Single sign on failed...")
+		clearOIDCSession(w, r)
+		http.Redirect(w, r, loginRoute, http.StatusFound)
+		return
+	}
+
+	clearOIDCSession(w, r)
+
+	if needsSecondFactor(user) {
+		if err := startTwoFactorChallenge(w, r, user, false); err != nil {
+			Error(w, err)
+			return
+		}
+		http.Redirect(w, r, adminRoutePrefix(och.Router)+"/login/2fa", http.StatusFound)
+		return
+	}
+
+	if err := startAuthSession(w, r, user, false); err != nil {
+		Error(w, err)
+		return
+	}
+
+	logging.Debug(fmt.Sprintf("User %s signed in with OpenID Connect", user.Username))
+	http.Redirect(w, r, adminRoutePrefix(och.Router)+"/admin", http.StatusFound)
+}
+
+//signIn checks the provider's response matches the sign in the client started, and returns the user it signs in as
+func (och *OIDCCallbackHandler) signIn(r *http.Request) (*db.User, error) {
+	op := db.OIDCProvidersTable{}
+	provider, err := op.SelectBySlug(db.Conn, mux.Vars(r)["provider"])
+	if err != nil || !provider.Enabled {
+		return nil, fmt.Errorf("No enabled provider '%s'", mux.Vars(r)["provider"])
+	}
+
+	if providerErr := r.URL.Query().Get("error"); len(providerErr) > 0 {
+		return nil, fmt.Errorf("%s returned error '%s' %s", provider.Title, providerErr, r.URL.Query().Get("error_description"))
+	}
+
+	oidcSessionStore, err := sessionsstore.Get(r, "oidc")
+	if err != nil {
+		return nil, err
+	}
+
+	sessionValue := func(key string) string {
+		if val, ok := oidcSessionStore.Values[key].(string); ok {
+			return val
+		}
+		return ""
+	}
+
+	state := sessionValue("state")
+	if len(state) == 0 || sessionValue("provider") != provider.Slug {
+		return nil, errors.New("No sign in was started with this provider")
+	}
+	if subtle.ConstantTimeCompare([]byte(state), []byte(r.URL.Query().Get("state"))) != 1 {
+		return nil, errors.New("State returned by provider doesn't match")
+	}
+
+	cfg, err := oidcConfig(och.Router, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := oidc.Exchange(cfg, r.URL.Query().Get("code"), sessionValue("verifier"))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, err := oidc.VerifyIDToken(cfg, tokens.IDToken, sessionValue("nonce"))
+	if err != nil {
+		return nil, err
+	}
+
+	return provisionOIDCUser(provider, claims)
+}
+
+//Post handles post requests to URI
+func (och *OIDCCallbackHandler) Post(w http.ResponseWriter, r *http.Request) {}
+
+//Route get URI route for handler
+func (och *OIDCCallbackHandler) Route() string { return och.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (och *OIDCCallbackHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (och *OIDCCallbackHandler) HandlesPost() bool { return false }
+
+//adminRoutePrefix get the prefix admin routes are hidden behind, blank if they aren't hidden
+func adminRoutePrefix(router *MutableRouter) string {
+	if router.AdminHidden {
+		return fmt.Sprintf("/%s", router.AdminHiddenPassword)
+	}
+	return ""
+}
+
+//oidcConfig get the registration with provider, redirecting back to its callback route on this site, the
+//callback is only ever on the configured base URL as the request's Host header is the client's to choose
+func oidcConfig(router *MutableRouter, provider *db.OIDCProvider) (oidc.Config, error) {
+	baseURL := configuredBaseURL()
+	if len(baseURL) == 0 {
+		return oidc.Config{}, errors.New("OpenID Connect sign in can't be started until the site's base URL is set with -baseurl")
+	}
+	return oidc.Config{
+		Issuer:       provider.Issuer,
+		ClientID:     provider.ClientID,
+		ClientSecret: provider.ClientSecret,
+		RedirectURL:  fmt.Sprintf("%s%s/login/oidc/%s/callback", baseURL, adminRoutePrefix(router), provider.Slug),
+		Scopes:       provider.ScopeList(),
+	}, nil
+}
+
+func clearOIDCSession(w http.ResponseWriter, r *http.Request) {
+	oidcSessionStore, err := sessionsstore.Get(r, "oidc")
+	if err != nil {
+		return
+	}
+	oidcSessionStore.Values = map[interface{}]interface{}{}
+	oidcSessionStore.Options.MaxAge = -1
+	oidcSessionStore.Save(r, w)
+}
+
+//oidcMapping a single 'idp group=value' line of a provider's group or role mappings
+type oidcMapping struct {
+	IDPGroup string
+	Value    string
+}
+
+//parseOIDCMappings reads one 'idp group=value' mapping per line, blank lines and lines starting with '#' are ignored
+func parseOIDCMappings(raw string) ([]oidcMapping, error) {
+	mappings := []oidcMapping{}
+	for i, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 || len(strings.TrimSpace(parts[1])) == 0 {
+			return nil, fmt.Errorf("Mapping on line %d must be of the form 'idp group=value'", i+1)
+		}
+		mappings = append(mappings, oidcMapping{IDPGroup: strings.TrimSpace(parts[0]), Value: strings.TrimSpace(parts[1])})
+	}
+	return mappings, nil
+}
+
+//parseOIDCRole converts a role mapping's value into a role, only moderator and regular roles can be mapped
+func parseOIDCRole(val string) (db.UsersRoleFlag, error) {
+	switch strings.ToLower(val) {
+	case "mod", "moderator":
+		return db.MOD_USER, nil
+	case "reg", "regular":
+		return db.REG_USER, nil
+	}
+	return 0, fmt.Errorf("Role '%s' must be 'mod' or 'reg'", val)
+}
+
+//oidcRole get the role the IdP groups map to, moderator wins over regular, the provider's default role if none map
+func oidcRole(provider *db.OIDCProvider, idpGroups []string) db.UsersRoleFlag {
+	role := db.UsersRoleFlag(provider.DefaultRole)
+	if role != db.MOD_USER {
+		role = db.REG_USER
+	}
+
+	mappings, err := parseOIDCMappings(provider.RoleMappings)
+	if err != nil {
+		logging.Error(err.Error())
+		return role
+	}
+
+	mapped := false
+	for _, mapping := range mappings {
+		if !containsString(idpGroups, mapping.IDPGroup) {
+			continue
+		}
+		mappedRole, err := parseOIDCRole(mapping.Value)
+		if err != nil {
+			logging.Error(err.Error())
+			continue
+		}
+		if !mapped || mappedRole == db.MOD_USER {
+			role = mappedRole
+		}
+		mapped = true
+	}
+
+	return role
+}
+
+//provisionOIDCUser get the user claims signs in as, creating them the first time they sign in
+//and keeping their details, role and mapped group memberships in step with the provider
+func provisionOIDCUser(provider *db.OIDCProvider, claims oidc.Claims) (*db.User, error) {
+	ut := db.UsersTable{}
+	oit := db.OIDCIdentitiesTable{}
+
+	groupsClaim := provider.GroupsClaim
+	if len(groupsClaim) == 0 {
+		groupsClaim = "groups"
+	}
+	idpGroups := claims.Strings(groupsClaim)
+
+	var user *db.User
+	identity, err := oit.SelectByProviderSubject(db.Conn, provider.Slug, claims.Subject())
+	switch {
+	case err == nil:
+		user, err = ut.SelectByUUID(db.Conn, identity.UserUUID)
+		if err != nil {
+			return nil, err
+		}
+		if len(user.UUID) == 0 {
+			return nil, fmt.Errorf("User linked to %s subject %s no longer exists", provider.Slug, claims.Subject())
+		}
+	case err != sql.ErrNoRows:
+		//only a subject which has never signed in before is provisioned, not one whose identity can't be read
+		return nil, err
+	}
+
+	if user == nil {
+		username, err := uniqueUsername(oidcUsername(claims))
+		if err != nil {
+			return nil, err
+		}
+
+		unusablePassword, err := oidc.RandomString()
+		if err != nil {
+			return nil, err
+		}
+
+		user = &db.User{
+			CreatedDateTime: time.Now().Unix(),
+			UserroleId:      int(oidcRole(provider, idpGroups)),
+			Username:        username,
+			//users signing in with a provider have no password of their own
+			AuthHash:  util.HashAndSalt([]byte(unusablePassword)),
+			FirstName: claims.String("given_name"),
+			LastName:  claims.String("family_name"),
+			Email:     claims.String("email"),
+		}
+		if err := ut.Insert(db.Conn, user); err != nil {
+			return nil, err
+		}
+
+		if err := oit.Insert(db.Conn, &db.OIDCIdentity{
+			CreatedDateTime: time.Now().Unix(),
+			ProviderSlug:    provider.Slug,
+			Subject:         claims.Subject(),
+			UserUUID:        user.UUID,
+		}); err != nil {
+			return nil, err
+		}
+
+		logging.Info(fmt.Sprintf("Created user %s for %s subject %s", user.Username, provider.Slug, claims.Subject()))
+	} else if db.UsersRoleFlag(user.UserroleId) != db.ROOT_USER {
+		user.UserroleId = int(oidcRole(provider, idpGroups))
+		for _, field := range []struct {
+			claim string
+			val   *string
+		}{{"given_name", &user.FirstName}, {"family_name", &user.LastName}, {"email", &user.Email}} {
+			if claim := claims.String(field.claim); len(claim) > 0 {
+				*field.val = claim
+			}
+		}
+		if err := ut.Update(db.Conn, user); err != nil {
+			return nil, err
+		}
+	}
+
+	if db.UsersRoleFlag(user.UserroleId) != db.ROOT_USER {
+		if err := syncOIDCGroups(provider, user, idpGroups); err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+//syncOIDCGroups adds user to the groups their IdP groups map to, and removes them from mapped groups they no longer do
+func syncOIDCGroups(provider *db.OIDCProvider, user *db.User, idpGroups []string) error {
+	mappings, err := parseOIDCMappings(provider.GroupMappings)
+	if err != nil {
+		return err
+	}
+	if len(mappings) == 0 {
+		return nil
+	}
+
+	gmt := db.GroupMembershipTable{}
+	memberships, _, err := gmt.List(db.Conn, db.ListOptions{Limit: db.MaxListLimit, Filters: map[string]string{"useruuid": user.UUID}})
+	if err != nil {
+		return err
+	}
+	memberOf := map[string]bool{}
+	for _, membership := range memberships {
+		memberOf[membership.GroupUUID] = true
+	}
+
+	wanted := map[string]bool{}
+	for _, mapping := range mappings {
+		if containsString(idpGroups, mapping.IDPGroup) {
+			wanted[mapping.Value] = true
+		} else if _, exists := wanted[mapping.Value]; !exists {
+			wanted[mapping.Value] = false
+		}
+	}
+
+	gt := db.GroupTable{}
+	for title, member := range wanted {
+		group, err := gt.SelectByTitle(db.Conn, title)
+		if err != nil {
+			return err
+		}
+		if len(group.UUID) == 0 {
+			logging.Error(fmt.Sprintf("Group '%s' mapped from %s doesn't exist", title, provider.Slug))
+			continue
+		}
+
+		if member && !memberOf[group.UUID] {
+			err = gmt.Insert(db.Conn, &db.GroupMembership{CreatedDateTime: time.Now().Unix(), GroupUUID: group.UUID, UserUUID: user.UUID})
+		} else if !member && memberOf[group.UUID] {
+			_, err = gmt.DeleteUserFromGroup(db.Conn, user, group)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+//oidcUsername get the username a new user signing in with claims should be given
+func oidcUsername(claims oidc.Claims) string {
+	candidates := []string{claims.String("preferred_username"), strings.Split(claims.String("email"), "@")[0], claims.String("name")}
+	for _, candidate := range candidates {
+		if username := strings.Trim(usernameSeparators.ReplaceAllString(candidate, "-"), "-"); len(username) > 0 {
+			return username
+		}
+	}
+	return "user"
+}
+
+//uniqueUsername get username, or username with a number appended if it's already taken
+func uniqueUsername(username string) (string, error) {
+	ut := db.UsersTable{}
+	candidate := username
+	for i := 2; ; i++ {
+		existing, err := ut.SelectByUsername(db.Conn, candidate)
+		if err != nil {
+			return "", err
+		}
+		if len(existing.UUID) == 0 {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s-%d", username, i)
+	}
+}
+
+func containsString(vals []string, val string) bool {
+	for _, v := range vals {
+		if v == val {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/oidc/oidctest"
+)
+
+//oidcSignIn runs a sign in from the login link through the mock issuer, returning the callback's response
+func oidcSignIn(t *testing.T, r *mux.Router, tamperState bool) *http.Response {
+	req := httptest.NewRequest("GET", "/login/oidc/mock", nil)
+	responseRecorder := httptest.NewRecorder()
+	r.ServeHTTP(responseRecorder, req)
+	if responseRecorder.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to provider, got %d", responseRecorder.Code)
+	}
+	cookies := responseRecorder.Result().Cookies()
+
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(responseRecorder.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("Expected provider to redirect back, got %d", resp.StatusCode)
+	}
+	if tamperState {
+		query := callback.Query()
+		query.Set("state", "forged")
+		callback.RawQuery = query.Encode()
+	}
+
+	req = httptest.NewRequest("GET", callback.RequestURI(), nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	responseRecorder = httptest.NewRecorder()
+	r.ServeHTTP(responseRecorder, req)
+	return responseRecorder.Result()
+}
+
+func TestOIDCSignInProvisionsUser(t *testing.T) {
+	issuer := oidctest.NewServer("berrycms", "secret")
+	defer issuer.Close()
+
+	opt := db.OIDCProvidersTable{}
+	if err := opt.Insert(db.Conn, &db.OIDCProvider{
+		CreatedDateTime: time.Now().Unix(),
+		Slug:            "mock",
+		Title:           "Mock",
+		Issuer:          issuer.URL,
+		ClientID:        "berrycms",
+		ClientSecret:    "secret",
+		Scopes:          "profile email",
+		GroupsClaim:     "groups",
+		GroupMappings:   "editors=SSO Editors",
+		RoleMappings:    "admins=mod",
+		DefaultRole:     int(db.REG_USER),
+		Enabled:         true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	gt := db.GroupTable{}
+	if err := gt.Insert(db.Conn, &db.Group{Title: "SSO Editors"}); err != nil {
+		t.Fatal(err)
+	}
+	group, _ := gt.SelectByTitle(db.Conn, "SSO Editors")
+
+	mr := &MutableRouter{}
+	r := mux.NewRouter()
+	for _, handler := range []Handler{&OIDCLoginHandler{Router: mr, route: "/login/oidc/{provider}"}, &OIDCCallbackHandler{Router: mr, route: "/login/oidc/{provider}/callback"}} {
+		r.HandleFunc(handler.Route(), handler.Get).Methods("GET")
+	}
+
+	issuer.SetUser(map[string]interface{}{"sub": "abc123", "preferred_username": "jane.doe", "email": "jane@example.com", "groups": []string{"editors", "admins"}})
+
+	//the provider is told to redirect back to the configured base URL, never to whatever host the request was made against
+	req := httptest.NewRequest("GET", "/login/oidc/mock", nil)
+	req.Host = "attacker.example"
+	responseRecorder := httptest.NewRecorder()
+	r.ServeHTTP(responseRecorder, req)
+	if location := responseRecorder.Header().Get("Location"); location != "/login" {
+		t.Errorf("Expected sign in without a base URL to go back to login, went to %s", location)
+	}
+
+	if err := SetBaseURL("https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetBaseURL("")
+
+	req = httptest.NewRequest("GET", "/login/oidc/mock", nil)
+	req.Host = "attacker.example"
+	responseRecorder = httptest.NewRecorder()
+	r.ServeHTTP(responseRecorder, req)
+	authCodeURL, err := url.Parse(responseRecorder.Header().Get("Location"))
+	if err != nil || authCodeURL.Query().Get("redirect_uri") != "https://example.com/login/oidc/mock/callback" {
+		t.Errorf("Expected the provider to redirect back to the base URL, got %s", responseRecorder.Header().Get("Location"))
+	}
+
+	if resp := oidcSignIn(t, r, true); resp.Header.Get("Location") != "/login" {
+		t.Errorf("Expected sign in with forged state to go back to login, went to %s", resp.Header.Get("Location"))
+	}
+
+	ut := db.UsersTable{}
+	if user, _ := ut.SelectByUsername(db.Conn, "jane-doe"); len(user.UUID) > 0 {
+		t.Fatal("Expected sign in with forged state not to provision a user")
+	}
+
+	resp := oidcSignIn(t, r, false)
+	if resp.Header.Get("Location") != "/admin" {
+		t.Fatalf("Expected sign in to go to the dashboard, went to %s", resp.Header.Get("Location"))
+	}
+
+	user, err := ut.SelectByUsername(db.Conn, "jane-doe")
+	if err != nil || len(user.UUID) == 0 {
+		t.Fatalf("Expected user jane-doe to be provisioned")
+	}
+	if db.UsersRoleFlag(user.UserroleId) != db.MOD_USER || user.Email != "jane@example.com" {
+		t.Errorf("Expected provisioned user to be a moderator with their email, got role %d email %s", user.UserroleId, user.Email)
+	}
+
+	memberships, total, _ := (&db.GroupMembershipTable{}).List(db.Conn, db.ListOptions{Filters: map[string]string{"useruuid": user.UUID}})
+	if total != 1 || memberships[0].GroupUUID != group.UUID {
+		t.Errorf("Expected provisioned user to be in the mapped group, got %d memberships", total)
+	}
+
+	//leaving the IdP groups is reflected the next time they sign in, as the same user
+	issuer.SetUser(map[string]interface{}{"sub": "abc123", "preferred_username": "jane.doe", "groups": []string{}})
+	oidcSignIn(t, r, false)
+
+	if duplicate, _ := ut.SelectByUsername(db.Conn, "jane-doe-2"); len(duplicate.UUID) > 0 {
+		t.Errorf("Signing in again created a second user")
+	}
+	user, _ = ut.SelectByUUID(db.Conn, user.UUID)
+	if db.UsersRoleFlag(user.UserroleId) != db.REG_USER {
+		t.Errorf("Expected user to fall back to the default role, got %d", user.UserroleId)
+	}
+	if _, total, _ := (&db.GroupMembershipTable{}).List(db.Conn, db.ListOptions{Filters: map[string]string{"useruuid": user.UUID}}); total != 0 {
+		t.Errorf("Expected user to be removed from the mapped group, still in %d", total)
+	}
+}
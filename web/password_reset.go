@@ -0,0 +1,309 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//passwordResetTimeout seconds a password reset link can be used for
+	passwordResetTimeout   = 60 * 60
+	passwordResetTokenSize = 32
+	//passwordResetMaxUnexpired reset links a user can have before no more are sent until one expires or is used,
+	//so the forgot password form can't be used to flood their inbox
+	passwordResetMaxUnexpired = 3
+)
+
+var (
+	//errInvalidPasswordReset the reset link doesn't exist, has been used or has expired
+	errInvalidPasswordReset = errors.New("That password reset link is invalid or has expired...")
+
+	//passwordResetsMu serialises creating reset links, so concurrent requests can't each create one past the limit
+	passwordResetsMu sync.Mutex
+)
+
+//lookupPasswordResetUser finds the user account of the username or email entered on the forgot password form
+func lookupPasswordResetUser(account string) (*db.User, error) {
+	account = strings.TrimSpace(account)
+	if len(account) == 0 {
+		return nil, nil
+	}
+
+	ut := db.UsersTable{}
+	var u *db.User
+	var err error
+	if strings.Contains(account, "@") {
+		u, err = ut.SelectByEmail(db.Conn, account)
+	} else {
+		u, err = ut.SelectByUsername(db.Conn, account)
+	}
+	if err != nil || len(u.UUID) == 0 {
+		return nil, err
+	}
+	return u, nil
+}
+
+//createPasswordReset creates a reset link for u, returning its token, which can't be recovered once sent,
+//unless u already has as many unexpired links as they're allowed
+func createPasswordReset(u *db.User) (string, error) {
+	passwordResetsMu.Lock()
+	defer passwordResetsMu.Unlock()
+
+	now := time.Now().Unix()
+	prt := db.PasswordResetsTable{}
+	unexpired, err := prt.CountUnexpiredByUserUUID(db.Conn, u.UUID, now)
+	if err != nil {
+		return "", err
+	}
+	if unexpired >= passwordResetMaxUnexpired {
+		return "", fmt.Errorf("User %s already has %d unexpired password reset links, not sending another", u.Username, unexpired)
+	}
+
+	tokenBytes := make([]byte, passwordResetTokenSize)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	if err := prt.Insert(db.Conn, &db.PasswordReset{
+		CreatedDateTime: now,
+		ExpiresDateTime: now + passwordResetTimeout,
+		UserUUID:        u.UUID,
+		TokenHash:       hashAPITokenSecret(token),
+	}); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+//sendPasswordReset queues an email to u with a link to reset their password, the link is only ever to the configured
+//base URL as the request's Host header is the client's to choose, and would send the token to wherever they like
+func sendPasswordReset(router *MutableRouter, u *db.User) error {
+	if len(strings.TrimSpace(u.Email)) == 0 {
+		return fmt.Errorf("User %s has no email to send a password reset to", u.Username)
+	}
+
+	baseURL := configuredBaseURL()
+	if len(baseURL) == 0 {
+		return errors.New("Password resets can't be sent until the site's base URL is set with -baseurl")
+	}
+
+	token, err := createPasswordReset(u)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s%s/login/reset/%s", baseURL, adminRoutePrefix(router), token)
+	return queueTemplatedMail([]string{u.Email}, "passwordreset", map[string]interface{}{
+		"Username": u.Username,
+		"Minutes":  passwordResetTimeout / 60,
+		"Link":     link,
+	}, true)
+}
+
+//lookupPasswordReset finds the unexpired reset token belongs to, along with its user
+func lookupPasswordReset(token string) (*db.PasswordReset, *db.User, error) {
+	if len(token) == 0 {
+		return nil, nil, errInvalidPasswordReset
+	}
+
+	prt := db.PasswordResetsTable{}
+	pr, err := prt.SelectByTokenHash(db.Conn, hashAPITokenSecret(token))
+	if err != nil || pr.ExpiresDateTime <= time.Now().Unix() {
+		return nil, nil, errInvalidPasswordReset
+	}
+
+	ut := db.UsersTable{}
+	u, err := ut.SelectByUUID(db.Conn, pr.UserUUID)
+	if err != nil || len(u.UUID) == 0 {
+		return nil, nil, errInvalidPasswordReset
+	}
+
+	return pr, u, nil
+}
+
+//resetPassword uses up pr to set u's password, then logs u out everywhere, forgets any of their other reset links
+//and lifts any lockout, as they've shown they own the account's email
+func resetPassword(pr *db.PasswordReset, u *db.User, password string) error {
+	prt := db.PasswordResetsTable{}
+	if used, err := prt.DeleteByID(db.Conn, pr.Passwordresetid); err != nil {
+		return err
+	} else if used != 1 {
+		return errInvalidPasswordReset
+	}
+
+	u.AuthHash = util.HashAndSalt([]byte(password))
+	ut := db.UsersTable{}
+	if err := ut.Update(db.Conn, u); err != nil {
+		return err
+	}
+
+	if _, err := prt.DeleteByUserUUID(db.Conn, u.UUID); err != nil {
+		return err
+	}
+
+	ast := db.AuthSessionsTable{}
+	if _, err := ast.DeleteByUserUUID(db.Conn, u.UUID); err != nil {
+		return err
+	}
+
+	if err := unlockAccount(u.Username); err != nil {
+		return err
+	}
+
+	logging.Info(fmt.Sprintf("User %s reset their password", u.Username))
+	return nil
+}
+
+//ForgotPasswordHandler lets users who've forgotten their password be emailed a link to reset it
+type ForgotPasswordHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (fph *ForgotPasswordHandler) Get(w http.ResponseWriter, r *http.Request) {
+	fph.render(w, false)
+}
+
+//Post handles post requests to URI
+func (fph *ForgotPasswordHandler) Post(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		Error(w, err)
+		return
+	}
+
+	u, err := lookupPasswordResetUser(r.PostFormValue("account"))
+	if err != nil {
+		logging.Error(err.Error())
+	}
+	if u != nil {
+		if err := sendPasswordReset(fph.Router, u); err != nil {
+			logging.Error(fmt.Sprintf("Unable to send password reset -> %s", err.Error()))
+		}
+	}
+
+	//the same is shown whether or not there's an account, so the form can't be used to find out who has one
+	fph.render(w, true)
+}
+
+func (fph *ForgotPasswordHandler) render(w http.ResponseWriter, sent bool) {
+	pctx := plush.NewContext()
+	pctx.Set("title", "Forgot Password")
+	pctx.Set("quillenabled", false)
+	pctx.Set("adminhiddenpassword", adminRoutePrefix(fph.Router))
+	pctx.Set("sent", sent)
+	pctx.Set("resetminutes", passwordResetTimeout/60)
+	RenderDefault(w, "login.forgot.html", pctx)
+}
+
+//Route get URI route for handler
+func (fph *ForgotPasswordHandler) Route() string { return fph.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (fph *ForgotPasswordHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (fph *ForgotPasswordHandler) HandlesPost() bool { return true }
+
+//PasswordResetHandler lets users set a new password with the link they were emailed
+type PasswordResetHandler struct {
+	Router *MutableRouter
+	route  string
+}
+
+//Get handles get requests to URI
+func (prh *PasswordResetHandler) Get(w http.ResponseWriter, r *http.Request) {
+	if _, _, err := lookupPasswordReset(mux.Vars(r)["token"]); err != nil {
+		setLoginErrorMessage(w, r, err.Error())
+		http.Redirect(w, r, adminRoutePrefix(prh.Router)+"/login", http.StatusFound)
+		return
+	}
+	prh.render(w, r, "")
+}
+
+//Post handles post requests to URI
+func (prh *PasswordResetHandler) Post(w http.ResponseWriter, r *http.Request) {
+	loginRoute := adminRoutePrefix(prh.Router) + "/login"
+
+	pr, u, err := lookupPasswordReset(mux.Vars(r)["token"])
+	if err != nil {
+		setLoginErrorMessage(w, r, err.Error())
+		http.Redirect(w, r, loginRoute, http.StatusFound)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		Error(w, err)
+		return
+	}
+
+	password := r.PostFormValue("authhash")
+	if len(password) == 0 {
+		prh.render(w, r, "Password can't be blank")
+		return
+	}
+	if strings.Compare(password, r.PostFormValue("repeatedauthhash")) != 0 {
+		prh.render(w, r, "Password and repeated passwords don't match")
+		return
+	}
+
+	if err := resetPassword(pr, u, password); err != nil {
+		if err != errInvalidPasswordReset {
+			Error(w, err)
+			return
+		}
+		setLoginErrorMessage(w, r, err.Error())
+		http.Redirect(w, r, loginRoute, http.StatusFound)
+		return
+	}
+
+	setLoginErrorMessage(w, r, "Your password has been reset, log in with your new password...")
+	http.Redirect(w, r, loginRoute, http.StatusFound)
+}
+
+func (prh *PasswordResetHandler) render(w http.ResponseWriter, r *http.Request, problem string) {
+	pctx := plush.NewContext()
+	pctx.Set("title", "Reset Password")
+	pctx.Set("quillenabled", false)
+	pctx.Set("adminhiddenpassword", adminRoutePrefix(prh.Router))
+	pctx.Set("submitroute", r.RequestURI)
+	pctx.Set("problem", problem)
+	RenderDefault(w, "login.reset.html", pctx)
+}
+
+//Route get URI route for handler
+func (prh *PasswordResetHandler) Route() string { return prh.route }
+
+//HandlesGet retrieve whether this handler handles get requests
+func (prh *PasswordResetHandler) HandlesGet() bool { return true }
+
+//HandlesPost retrieve whether this handler handles post requests
+func (prh *PasswordResetHandler) HandlesPost() bool { return true }
@@ -0,0 +1,239 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/mail"
+	"github.com/tacusci/berrycms/util"
+)
+
+//recordingMailer keeps messages instead of delivering them
+type recordingMailer struct {
+	sent []*mail.Message
+}
+
+func (rm *recordingMailer) Send(m *mail.Message) error {
+	rm.sent = append(rm.sent, m)
+	return nil
+}
+
+func postForm(r *mux.Router, route string, values url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", route, strings.NewReader(values.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	responseRecorder := httptest.NewRecorder()
+	r.ServeHTTP(responseRecorder, req)
+	return responseRecorder
+}
+
+func TestPasswordReset(t *testing.T) {
+	rm := &recordingMailer{}
+	mail.SetMailer(rm, "")
+	defer mail.SetMailer(&mail.LogMailer{}, "")
+	if err := SetBaseURL("https://cms.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetBaseURL("")
+
+	u := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.REG_USER),
+		Username:        "forgetfuluser",
+		AuthHash:        util.HashAndSalt([]byte("oldpassword")),
+		Email:           "Forgetful@example.com",
+	}
+	ut := db.UsersTable{}
+	if err := ut.Insert(db.Conn, u); err != nil {
+		t.Fatal(err)
+	}
+	if err := startAuthSession(httptest.NewRecorder(), httptest.NewRequest("POST", "/login", nil), u, false); err != nil {
+		t.Fatal(err)
+	}
+
+	mr := &MutableRouter{}
+	r := mux.NewRouter()
+	for _, handler := range []Handler{&ForgotPasswordHandler{Router: mr, route: "/login/forgot"}, &PasswordResetHandler{Router: mr, route: "/login/reset/{token}"}} {
+		r.HandleFunc(handler.Route(), handler.Get).Methods("GET")
+		r.HandleFunc(handler.Route(), handler.Post).Methods("POST")
+	}
+
+	unknown := postForm(r, "/login/forgot", url.Values{"account": {"nobody@example.com"}})
+	known := postForm(r, "/login/forgot", url.Values{"account": {"forgetful@example.com"}})
+	if unknown.Code != http.StatusOK || unknown.Body.String() != known.Body.String() {
+		t.Errorf("Expected the same response whether or not there's an account")
+	}
+	if _, err := mail.DeliverQueued(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.sent) != 1 || rm.sent[0].To[0] != u.Email || rm.sent[0].From != mail.DefaultFrom {
+		t.Fatalf("Expected one reset mail to be sent to the user, got %d", len(rm.sent))
+	}
+
+	link := regexp.MustCompile(`https://cms\.example\.com(/login/reset/[0-9a-f]+)`).FindStringSubmatch(rm.sent[0].Body)
+	if len(link) == 0 {
+		t.Fatalf("Expected reset mail to contain a reset link to the site's base URL, got %s", rm.sent[0].Body)
+	}
+	resetRoute := link[1]
+
+	responseRecorder := httptest.NewRecorder()
+	r.ServeHTTP(responseRecorder, httptest.NewRequest("GET", resetRoute, nil))
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("Expected reset link to show the reset form, got %d", responseRecorder.Code)
+	}
+
+	responseRecorder = postForm(r, resetRoute, url.Values{"authhash": {"newpassword"}, "repeatedauthhash": {"different"}})
+	if responseRecorder.Code != http.StatusOK || !(&db.User{Username: u.Username, AuthHash: "oldpassword"}).Login() {
+		t.Errorf("Expected mismatched passwords not to reset the password")
+	}
+
+	responseRecorder = postForm(r, resetRoute, url.Values{"authhash": {"newpassword"}, "repeatedauthhash": {"newpassword"}})
+	if responseRecorder.Code != http.StatusFound || responseRecorder.Header().Get("Location") != "/login" {
+		t.Fatalf("Expected reset to go to login, got %d", responseRecorder.Code)
+	}
+	if !(&db.User{Username: u.Username, AuthHash: "newpassword"}).Login() {
+		t.Errorf("Expected user to be able to log in with their new password")
+	}
+
+	ast := db.AuthSessionsTable{}
+	if sessions, err := ast.SelectByUserUUID(db.Conn, u.UUID); err != nil || len(sessions) > 0 {
+		t.Errorf("Expected resetting the password to end the user's sessions")
+	}
+
+	responseRecorder = postForm(r, resetRoute, url.Values{"authhash": {"another"}, "repeatedauthhash": {"another"}})
+	if (&db.User{Username: u.Username, AuthHash: "another"}).Login() {
+		t.Errorf("Expected a reset link to only work once")
+	}
+}
+
+func TestPasswordResetIgnoresHost(t *testing.T) {
+	rm := &recordingMailer{}
+	mail.SetMailer(rm, "")
+	defer mail.SetMailer(&mail.LogMailer{}, "")
+
+	u := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.REG_USER),
+		Username:        "spoofeduser",
+		AuthHash:        util.HashAndSalt([]byte("spoofeduser")),
+		Email:           "spoofed@example.com",
+	}
+	ut := db.UsersTable{}
+	if err := ut.Insert(db.Conn, u); err != nil {
+		t.Fatal(err)
+	}
+
+	mr := &MutableRouter{}
+	r := mux.NewRouter()
+	fph := &ForgotPasswordHandler{Router: mr, route: "/login/forgot"}
+	r.HandleFunc(fph.Route(), fph.Post).Methods("POST")
+
+	spoofedForgot := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login/forgot", strings.NewReader(url.Values{"account": {"spoofeduser"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Host = "attacker.example.com"
+		responseRecorder := httptest.NewRecorder()
+		r.ServeHTTP(responseRecorder, req)
+		return responseRecorder
+	}
+
+	//without a base URL the only host there is to link to is the one the client sent
+	if responseRecorder := spoofedForgot(); responseRecorder.Code != http.StatusOK {
+		t.Fatalf("Expected the same response when resets can't be sent, got %d", responseRecorder.Code)
+	}
+	if _, err := mail.DeliverQueued(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.sent) > 0 {
+		t.Fatalf("Expected no reset to be sent without a base URL, got %s", rm.sent[0].Body)
+	}
+	prt := db.PasswordResetsTable{}
+	if removed, _ := prt.DeleteByUserUUID(db.Conn, u.UUID); removed > 0 {
+		t.Errorf("Expected no reset link to be created without a base URL")
+	}
+
+	if err := SetBaseURL("https://cms.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetBaseURL("")
+	spoofedForgot()
+	if _, err := mail.DeliverQueued(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.sent) != 1 {
+		t.Fatalf("Expected one reset mail once there's a base URL, got %d", len(rm.sent))
+	}
+	if body := rm.sent[0].Body; strings.Contains(body, "attacker.example.com") || !strings.Contains(body, "https://cms.example.com/login/reset/") {
+		t.Errorf("Expected the reset link to be to the base URL rather than the request's Host, got %s", body)
+	}
+}
+
+func TestPasswordResetLimited(t *testing.T) {
+	rm := &recordingMailer{}
+	mail.SetMailer(rm, "")
+	defer mail.SetMailer(&mail.LogMailer{}, "")
+	if err := SetBaseURL("https://cms.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetBaseURL("")
+
+	u := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.REG_USER),
+		Username:        "floodeduser",
+		AuthHash:        util.HashAndSalt([]byte("floodeduser")),
+		Email:           "flooded@example.com",
+	}
+	ut := db.UsersTable{}
+	if err := ut.Insert(db.Conn, u); err != nil {
+		t.Fatal(err)
+	}
+
+	mr := &MutableRouter{}
+	r := mux.NewRouter()
+	fph := &ForgotPasswordHandler{Router: mr, route: "/login/forgot"}
+	r.HandleFunc(fph.Route(), fph.Post).Methods("POST")
+
+	first := postForm(r, "/login/forgot", url.Values{"account": {"floodeduser"}})
+	for i := 1; i < passwordResetMaxUnexpired+5; i++ {
+		if responseRecorder := postForm(r, "/login/forgot", url.Values{"account": {"floodeduser"}}); responseRecorder.Body.String() != first.Body.String() {
+			t.Fatalf("Expected the same response once no more resets are sent")
+		}
+	}
+	if _, err := mail.DeliverQueued(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.sent) != passwordResetMaxUnexpired {
+		t.Fatalf("Expected repeated requests to stop sending resets after %d, got %d", passwordResetMaxUnexpired, len(rm.sent))
+	}
+
+	//once the links sent expire another can be sent
+	db.Conn.Exec("UPDATE passwordresets SET expiresdatetime = ? WHERE useruuid = ?", time.Now().Add(-time.Minute).Unix(), u.UUID)
+	postForm(r, "/login/forgot", url.Values{"account": {"floodeduser"}})
+	if _, err := mail.DeliverQueued(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rm.sent) != passwordResetMaxUnexpired+1 {
+		t.Errorf("Expected a reset to be sent once the others have expired, got %d", len(rm.sent))
+	}
+}
@@ -32,6 +32,7 @@ func (rh *RobotsHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.Write(robots.CacheBytes())
 }
 
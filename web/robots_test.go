@@ -0,0 +1,70 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/robots"
+)
+
+func TestRobotsGet(t *testing.T) {
+	if err := robots.Generate(false); err != nil {
+		t.Fatal(err)
+	}
+
+	rgt := db.RobotsGroupsTable{}
+	rgt.Insert(db.Conn, &db.RobotsGroup{
+		CreatedDateTime: time.Now().Unix(),
+		UserAgents:      "*",
+		Rules:           "disallow: /drafts\nSitemap: https://example.com/sitemap.xml",
+	})
+	rgt.Insert(db.Conn, &db.RobotsGroup{
+		CreatedDateTime: time.Now().Unix(),
+		UserAgents:      "Googlebot\nBingbot",
+		Rules:           "Allow: /\nCrawl-delay: 10",
+	})
+
+	if err := robots.Regenerate(); err != nil {
+		t.Fatal(err)
+	}
+
+	rh := RobotsHandler{}
+	responseRecorder := httptest.NewRecorder()
+	rh.Get(responseRecorder, httptest.NewRequest("GET", "/robots.txt", nil))
+
+	bodyText, err := ioutil.ReadAll(responseRecorder.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "User-agent: *\nDisallow: /admin\nDisallow: /drafts\n\nUser-agent: Googlebot\nUser-agent: Bingbot\nAllow: /\nCrawl-delay: 10\n\nSitemap: https://example.com/sitemap.xml\n"
+	if string(bodyText) != expected {
+		t.Errorf("Robots.txt output %q, expected %q", string(bodyText), expected)
+	}
+
+	robots.Reset()
+}
+
+func TestRobotsParseGroupInvalid(t *testing.T) {
+	_, errs := robots.ParseGroup("", "Disallow: drafts\nCrawl-delay: soon\nSitemap: /sitemap.xml\nNoindex: /")
+	if len(errs) != 5 {
+		t.Errorf("Expected 5 problems with group, got %d: %v", len(errs), errs)
+	}
+}
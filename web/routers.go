@@ -15,13 +15,14 @@
 package web
 
 import (
-	"bytes"
 	"fmt"
 	"html/template"
-	"io/ioutil"
+	"io/fs"
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -29,9 +30,11 @@ import (
 	"github.com/gobuffalo/plush"
 	"github.com/gorilla/mux"
 	"github.com/radovskyb/watcher"
+	"github.com/tacusci/berrycms/accesslog"
 	"github.com/tacusci/berrycms/db"
 	"github.com/tacusci/berrycms/plugins"
 	"github.com/tacusci/berrycms/robots"
+	"github.com/tacusci/berrycms/shortcodes"
 	"github.com/tacusci/berrycms/util"
 	"github.com/tacusci/logging"
 )
@@ -40,17 +43,24 @@ import (
 type MutableRouter struct {
 	Server              *http.Server
 	mu                  sync.Mutex
+	settingsMu          sync.RWMutex //guards the settings Reconfigure can change while running
 	Root                *mux.Router
 	AdminOff            bool
 	AdminHidden         bool
 	AdminHiddenPassword string
-	ActivityLogLoc      string
+	ActivityLog         accesslog.Options
 	NoRobots            bool
 	NoSitemap           bool
+	NoFeeds             bool
+	NoAPI               bool
 	CpuProfile          bool
+	NoCompression       bool
+	CompressionMinSize  int
+	CompressionTypes    []string
 	staticwatcher       *watcher.Watcher
 	pluginswatcher      *watcher.Watcher
 	pm                  *plugins.Manager
+	activityLog         *accesslog.Logger
 }
 
 //Swap takes a new mux router, locks accessing for old one, replaces it and then unlocks, keeps existing connections
@@ -61,8 +71,27 @@ func (mr *MutableRouter) Swap(root *mux.Router) {
 	mr.Server.Handler = mr.Root
 }
 
+//Reconfigure makes change to the router's settings while holding its lock, so they aren't changed
+//part way through being read, then reloads the routes with them
+func (mr *MutableRouter) Reconfigure(change func()) {
+	mr.settingsMu.Lock()
+	change()
+	mr.settingsMu.Unlock()
+
+	mr.Reload()
+}
+
+//disabled reads one of the router's on/off settings while holding its lock
+func (mr *MutableRouter) disabled(setting *bool) bool {
+	mr.settingsMu.RLock()
+	defer mr.settingsMu.RUnlock()
+	return *setting
+}
+
 //Reload map all admin/default page routes and load saved page routes from DB
 func (mr *MutableRouter) Reload() {
+	mr.settingsMu.RLock()
+	defer mr.settingsMu.RUnlock()
 
 	if !mr.NoRobots {
 		//creates a robot string and loads into in-memory cache
@@ -70,6 +99,9 @@ func (mr *MutableRouter) Reload() {
 		if err != nil {
 			logging.Error(err.Error())
 		}
+	} else {
+		//robots.txt may have been turned off since it was generated
+		robots.Reset()
 	}
 
 	if mr.staticwatcher != nil {
@@ -145,6 +177,12 @@ func (mr *MutableRouter) Reload() {
 
 	logging.Debug(fmt.Sprintf("Mapping default GET route %s", sitemapHandler.Route()))
 	r.HandleFunc(sitemapHandler.Route(), sitemapHandler.Get).Methods("GET")
+	//numbered sitemaps listed by the sitemap index once there are too many URLs for one file
+	r.HandleFunc("/sitemap-{n:[0-9]+}.xml", sitemapHandler.Get).Methods("GET")
+
+	mr.mapFeeds(r)
+
+	mr.mapAPI(r)
 
 	r.NotFoundHandler = http.HandlerFunc(fourOhFour)
 
@@ -156,6 +194,8 @@ func (mr *MutableRouter) Reload() {
 		logging.Error(err.Error())
 	}
 
+	shortcodes.ResetPlugins()
+
 	pm.Lock()
 	for _, plugin := range *pm.Plugins() {
 		if val, err := plugin.VM.Get("routesToRegister"); err == nil {
@@ -172,29 +212,67 @@ func (mr *MutableRouter) Reload() {
 				}
 			}
 		}
+		if val, err := plugin.VM.Get("shortcodesToRegister"); err == nil {
+			if valInterface, err := val.Export(); err == nil {
+				if shortcodesToRegister, ok := valInterface.([]string); ok {
+					for _, name := range util.RemoveDuplicates(shortcodesToRegister) {
+						logging.Debug(fmt.Sprintf("PLUGIN {%s} -> Registering shortcode '%s'", plugin.UUID(), name))
+						if err := shortcodes.RegisterPlugin(name, pluginShortcode(pm, plugin)); err != nil {
+							plugin.Error(err)
+						}
+					}
+				}
+			}
+		}
 		if _, err := plugin.Call("main", nil, nil); err != nil {
 			logging.Error(fmt.Sprintf("PLUGIN {%s} -> %s", plugin.UUID(), err.Error()))
 		}
 	}
 	pm.Unlock()
 
-	if err := mr.mapStaticDir(r, "static"); err == nil {
-		go mr.monitorStatic("./static", mr.staticwatcher)
-	} else {
-		logging.Error("Unable to map static dir, not listening for directory changes...")
+	if err := mr.mapStaticDir(r, "static"); err != nil {
+		logging.Error(fmt.Sprintf("Unable to map static dir -> %s", err.Error()))
+	}
+
+	mr.mapThemeAssets(r)
+
+	//only files on disk can change, so there's only something to watch if there's an override directory
+	if len(OverrideDir()) > 0 {
+		staticOverrideDir := filepath.Join(OverrideDir(), "static")
+		if info, err := os.Stat(staticOverrideDir); err == nil && info.IsDir() {
+			go mr.monitorStatic(staticOverrideDir, mr.staticwatcher)
+		}
 	}
 	go mr.monitorPlugins("./plugins", mr.pluginswatcher)
 
 	alm := ActivityLogMiddleware{
 		Router: mr,
-		LogLoc: mr.ActivityLogLoc,
+		Logger: mr.openActivityLog(),
 	}
 	r.Use(alm.Middleware)
+	//middleware only runs for matched routes, so requests nothing matched have to be logged separately
+	r.NotFoundHandler = alm.Middleware(r.NotFoundHandler)
+
+	if !mr.NoCompression {
+		cm := CompressionMiddleware{
+			Router:       mr,
+			MinSize:      mr.CompressionMinSize,
+			ContentTypes: mr.CompressionTypes,
+		}
+		r.Use(cm.Middleware)
+	}
 
 	am := AuthMiddleware{Router: mr}
 	r.Use(am.Middleware)
 
+	//last so the CSRF token it passes along reaches the handlers
+	csrfm := CSRFMiddleware{Router: mr}
+	r.Use(csrfm.Middleware)
+
 	mr.Swap(r)
+
+	//the theme, shortcodes or pages rendered with them may have changed
+	renderSettingsModified()
 }
 
 func (mr *MutableRouter) mapSavedPageRoutes(r *mux.Router) {
@@ -225,22 +303,21 @@ func (mr *MutableRouter) mapPluginCreatedRoute(r *mux.Router, route string) {
 }
 
 func (mr *MutableRouter) mapStaticDir(r *mux.Router, sd string) error {
-	fs, err := ioutil.ReadDir(sd)
-	if os.IsNotExist(err) {
-		logging.Error("Unable to find static folder... Creating...")
-		err = os.Mkdir("./static", os.ModeDir)
-		if err != nil {
-			return err
-		}
-	}
+	files, err := fs.ReadDir(assets, sd)
 	if err != nil {
 		return err
 	}
-	for _, f := range fs {
-		pathPrefixLocation := fmt.Sprintf("%s%s%s", string(os.PathSeparator), f.Name(), string(os.PathSeparator))
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		dirFS, err := fs.Sub(assets, path.Join(sd, f.Name()))
+		if err != nil {
+			return err
+		}
 		pathPrefixAddress := fmt.Sprintf("/%s/", f.Name())
 		logging.Debug(fmt.Sprintf("Serving dir (%s)'s files...", f.Name()))
-		r.PathPrefix(pathPrefixAddress).Handler(http.StripPrefix(pathPrefixAddress, http.FileServer(http.Dir(sd+pathPrefixLocation))))
+		r.PathPrefix(pathPrefixAddress).Handler(http.StripPrefix(pathPrefixAddress, newPrecompressedFileServer(http.FS(dirFS))))
 	}
 	return nil
 }
@@ -300,28 +377,6 @@ func (mr *MutableRouter) monitorPlugins(sd string, w *watcher.Watcher) {
 	}
 }
 
-type ActivityLogMiddleware struct {
-	Router *MutableRouter
-	LogLoc string
-}
-
-func (alm *ActivityLogMiddleware) Middleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if f, err := os.OpenFile(alm.LogLoc, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660); err == nil {
-			defer f.Close()
-			var sb bytes.Buffer
-			sb.WriteString(fmt.Sprintf("%s (%s -> %s %s)", logging.GetTimeString(), r.RemoteAddr, r.Method, r.RequestURI))
-			userAgent := r.UserAgent()
-			if len(userAgent) > 0 {
-				sb.WriteString(fmt.Sprintf(" [User Agent: '%s']", userAgent))
-			}
-			sb.WriteString("\n")
-			f.Write(sb.Bytes())
-		}
-		next.ServeHTTP(w, r)
-	})
-}
-
 //AuthMiddleware authentication struct with auth helper functions
 type AuthMiddleware struct {
 	Router *MutableRouter
@@ -375,8 +430,13 @@ func (amw *AuthMiddleware) HasPermissionsForRoute(r *http.Request) bool {
 	return true
 }
 
-//IsLoggedIn checks if the requesting client is currently logged in
+//IsLoggedIn checks if the requesting client is currently logged in, or has sent a
+//personal API token with a scope allowing access to the requested route
 func (amw *AuthMiddleware) IsLoggedIn(r *http.Request) bool {
+	if len(bearerToken(r)) > 0 {
+		return amw.tokenHasScopeForRequest(r)
+	}
+
 	var isLoggedIn bool
 
 	authSessionStore, err := sessionsstore.Get(r, "auth")
@@ -385,9 +445,10 @@ func (amw *AuthMiddleware) IsLoggedIn(r *http.Request) bool {
 			authSessionsTable := db.AuthSessionsTable{}
 			authSession, err := authSessionsTable.SelectBySessionUUID(db.Conn, authSessionUUID.(string))
 			if err == nil {
-				if len(authSession.UserUUID) > 0 {
+				if len(authSession.UserUUID) > 0 && !sessionExpired(authSession, time.Now()) {
 					isLoggedIn = true
 					authSession.LastActiveDateTime = time.Now().Unix()
+					authSession.IPAddress = clientIP(r)
 					authSessionsTable.Update(db.Conn, authSession)
 				} else {
 					authSessionsTable.DeleteBySessionUUID(db.Conn, authSessionUUID.(string))
@@ -406,15 +467,20 @@ func (amw *AuthMiddleware) IsLoggedIn(r *http.Request) bool {
 	return isLoggedIn
 }
 
-//LoggedInUser get user of existing web session
+//LoggedInUser get user of existing web session, or of the personal API token sent
 func (amw *AuthMiddleware) LoggedInUser(r *http.Request) (*db.User, error) {
+	if token := bearerToken(r); len(token) > 0 {
+		_, u, err := authenticateAPIToken(token)
+		return u, err
+	}
+
 	authSessionStore, err := sessionsstore.Get(r, "auth")
 	if err == nil {
 		authSessionsTable := db.AuthSessionsTable{}
 		if authSessionUUID := authSessionStore.Values["sessionuuid"]; authSessionUUID != nil {
 			authSession, err := authSessionsTable.SelectBySessionUUID(db.Conn, authSessionUUID.(string))
 			if err == nil {
-				if len(authSession.UserUUID) > 0 {
+				if len(authSession.UserUUID) > 0 && !sessionExpired(authSession, time.Now()) {
 					ut := db.UsersTable{}
 					loggedInUser, err := ut.SelectByUUID(db.Conn, authSession.UserUUID)
 					if err != nil {
@@ -0,0 +1,183 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//SanitisePolicyStrict user generated content policy, no scripts, styles, frames or event handlers
+	SanitisePolicyStrict = "strict"
+	//SanitisePolicyRelaxed strict policy plus inline styles and https iframes for embedded video
+	SanitisePolicyRelaxed = "relaxed"
+	//SanitisePolicyOff content is never sanitised, every editor is trusted
+	SanitisePolicyOff = "off"
+
+	//DefaultSanitisePolicy policy used unless another has been configured
+	DefaultSanitisePolicy = SanitisePolicyStrict
+)
+
+var (
+	sanitiseMu     sync.RWMutex
+	sanitisePolicy = newSanitisePolicy(DefaultSanitisePolicy)
+)
+
+//classes the quill and markdown renderers emit which themes rely on
+var safeClasses = regexp.MustCompile(`^(\s*(ql-[\w-]+|language-[\w-]+|footnotes|footnote-ref|footnote-backref|task-list-item|contains-task-list)\s*)+$`)
+
+//SetSanitisePolicy sets the named policy to apply to page content at save and render time
+func SetSanitisePolicy(name string) error {
+	switch name {
+	case SanitisePolicyStrict, SanitisePolicyRelaxed, SanitisePolicyOff:
+	default:
+		return fmt.Errorf("Unknown HTML sanitisation policy '%s'", name)
+	}
+
+	sanitiseMu.Lock()
+	sanitisePolicy = newSanitisePolicy(name)
+	sanitiseMu.Unlock()
+
+	renderSettingsModified()
+	return nil
+}
+
+func newSanitisePolicy(name string) *bluemonday.Policy {
+	if name == SanitisePolicyOff {
+		return nil
+	}
+
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("class").Matching(safeClasses).Globally()
+	policy.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-[\w-]+$`)).Globally()
+	//task list checkboxes rendered from markdown
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+
+	if name == SanitisePolicyRelaxed {
+		policy.AllowAttrs("style").Globally()
+		policy.AllowStyling()
+		policy.AllowElements("iframe")
+		policy.AllowAttrs("src").Matching(regexp.MustCompile(`^https://`)).OnElements("iframe")
+		policy.AllowAttrs("frameborder", "allowfullscreen", "width", "height").OnElements("iframe")
+	}
+
+	return policy
+}
+
+//canPublishTrustedHTML checks whether user's page content is published without sanitisation
+func canPublishTrustedHTML(u *db.User) bool {
+	return u != nil && db.UsersRoleFlag(u.UserroleId) == db.ROOT_USER
+}
+
+//applyContentPolicy sanitises page's content on behalf of author, marking the page as trusted instead
+//if the author can publish trusted HTML, returns a description of anything removed
+func applyContentPolicy(p *db.Page, author *db.User) []string {
+	if canPublishTrustedHTML(author) {
+		p.TrustedHTML = true
+		return nil
+	}
+
+	p.TrustedHTML = false
+	content, violations, err := sanitiseContent(p.Content, p.ContentFormat)
+	if err != nil {
+		logging.Error(err.Error())
+		return nil
+	}
+	p.Content = content
+	return violations
+}
+
+//sanitiseHTML strips everything from html the configured policy doesn't allow
+func sanitiseHTML(html string) string {
+	sanitiseMu.RLock()
+	defer sanitiseMu.RUnlock()
+
+	if sanitisePolicy == nil {
+		return html
+	}
+	return sanitisePolicy.Sanitize(html)
+}
+
+//sanitiseContent sanitises content of given format, returning the sanitised content and a
+//description of everything which was removed from the HTML it renders to
+func sanitiseContent(content string, format string) (string, []string, error) {
+	html, err := renderContent(content, format)
+	if err != nil {
+		return content, nil, err
+	}
+
+	sanitised := sanitiseHTML(html)
+	violations := htmlViolations(html, sanitised)
+
+	//only raw HTML is stored as HTML, other formats are sanitised again when rendered
+	if contentFormatByName(format).Name == ContentFormatHTML {
+		return sanitised, violations, nil
+	}
+	return content, violations, nil
+}
+
+//htmlViolations compares the elements and attributes of html before and after sanitisation
+func htmlViolations(original string, sanitised string) []string {
+	if original == sanitised {
+		return nil
+	}
+
+	before := countElementsAndAttrs(original)
+	after := countElementsAndAttrs(sanitised)
+
+	violations := []string{}
+	for key, count := range before {
+		if removed := count - after[key]; removed > 0 {
+			violations = append(violations, fmt.Sprintf("%s (%d removed)", key, removed))
+		}
+	}
+	sort.Strings(violations)
+
+	return violations
+}
+
+//countElementsAndAttrs counts each element and element attribute present in html
+func countElementsAndAttrs(html string) map[string]int {
+	counts := map[string]int{}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return counts
+	}
+
+	doc.Find("*").Each(func(i int, s *goquery.Selection) {
+		node := s.Get(0)
+		//added by the parser to every document
+		if node.Data == "html" || node.Data == "head" || node.Data == "body" {
+			return
+		}
+		counts[fmt.Sprintf("<%s> element", node.Data)]++
+		for _, attr := range node.Attr {
+			counts[fmt.Sprintf("'%s' attribute on <%s>", attr.Key, node.Data)]++
+		}
+	})
+
+	return counts
+}
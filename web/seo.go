@@ -0,0 +1,308 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gobuffalo/plush"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//seoSiteNameSetting site name used in social previews and structured data
+	seoSiteNameSetting = "seo.sitename"
+	//seoDescriptionSetting meta description of pages which haven't set their own
+	seoDescriptionSetting = "seo.description"
+	//seoImageSetting social preview image of pages which haven't set their own
+	seoImageSetting = "seo.image"
+	//seoTwitterCardSetting twitter card type of pages which haven't set their own
+	seoTwitterCardSetting = "seo.twittercard"
+	//seoTwitterSiteSetting twitter @username of the site
+	seoTwitterSiteSetting = "seo.twittersite"
+)
+
+//TwitterCards get the twitter card types which can be chosen for a page
+func TwitterCards() []string {
+	return []string{"summary", "summary_large_image"}
+}
+
+//twitterCardByName checks card is a known twitter card type, blank if not
+func twitterCardByName(card string) string {
+	for _, c := range TwitterCards() {
+		if c == card {
+			return c
+		}
+	}
+	return ""
+}
+
+//SEODefaults site wide values used for any SEO field a page leaves blank
+type SEODefaults struct {
+	SiteName    string
+	Description string
+	Image       string
+	TwitterCard string
+	TwitterSite string
+}
+
+//loadSEODefaults reads the site wide SEO defaults from the settings table
+func loadSEODefaults() SEODefaults {
+	st := db.SettingsTable{}
+	get := func(name string, fallback string) string {
+		val, err := st.Get(db.Conn, name, fallback)
+		if err != nil {
+			logging.Error(err.Error())
+			return fallback
+		}
+		return val
+	}
+
+	return SEODefaults{
+		SiteName:    get(seoSiteNameSetting, ""),
+		Description: get(seoDescriptionSetting, ""),
+		Image:       get(seoImageSetting, ""),
+		TwitterCard: firstNonBlank(twitterCardByName(get(seoTwitterCardSetting, "")), "summary"),
+		TwitterSite: get(seoTwitterSiteSetting, ""),
+	}
+}
+
+//saveSEODefaults writes the site wide SEO defaults to the settings table
+func saveSEODefaults(defaults SEODefaults) error {
+	st := db.SettingsTable{}
+	settings := map[string]string{
+		seoSiteNameSetting:    defaults.SiteName,
+		seoDescriptionSetting: defaults.Description,
+		seoImageSetting:       defaults.Image,
+		seoTwitterCardSetting: twitterCardByName(defaults.TwitterCard),
+		seoTwitterSiteSetting: defaults.TwitterSite,
+	}
+	for name, val := range settings {
+		if err := st.Set(db.Conn, name, strings.TrimSpace(val)); err != nil {
+			return err
+		}
+	}
+	renderSettingsModified()
+	return nil
+}
+
+//validJSONLD checks structured data entered in the editor is blank or a JSON object or array
+func validJSONLD(jsonld string) bool {
+	jsonld = strings.TrimSpace(jsonld)
+	if len(jsonld) == 0 {
+		return true
+	}
+	return json.Valid([]byte(jsonld)) && (strings.HasPrefix(jsonld, "{") || strings.HasPrefix(jsonld, "["))
+}
+
+//pageMetaTitle get the title to use in the page's <title>
+func pageMetaTitle(p *db.Page) string {
+	return firstNonBlank(p.MetaTitle, p.Title)
+}
+
+//pageSEOHead renders the meta description, canonical link, robots directives, social preview
+//tags and structured data for page into the <head>, site relative links are only made absolute
+//against the configured base URL as the request's Host header is the client's to choose
+func pageSEOHead(p *db.Page) template.HTML {
+	defaults := loadSEODefaults()
+	baseURL := configuredBaseURL()
+
+	title := pageMetaTitle(p)
+	description := firstNonBlank(p.MetaDescription, defaults.Description)
+	canonical := absoluteURL(baseURL, firstNonBlank(p.CanonicalURL, p.Route))
+	image := absoluteURL(baseURL, firstNonBlank(p.OGImage, defaults.Image))
+	card := firstNonBlank(twitterCardByName(p.TwitterCard), defaults.TwitterCard)
+
+	var head bytes.Buffer
+	meta := func(attr string, key string, content string) {
+		if len(content) > 0 {
+			head.WriteString(fmt.Sprintf("<meta %s=\"%s\" content=\"%s\">", attr, key, html.EscapeString(content)))
+		}
+	}
+
+	meta("name", "description", description)
+
+	if len(canonical) > 0 {
+		head.WriteString(fmt.Sprintf("<link rel=\"canonical\" href=\"%s\">", html.EscapeString(canonical)))
+	}
+
+	directives := []string{}
+	if p.NoIndex {
+		directives = append(directives, "noindex")
+	}
+	if p.NoFollow {
+		directives = append(directives, "nofollow")
+	}
+	meta("name", "robots", strings.Join(directives, ", "))
+
+	meta("property", "og:type", "website")
+	meta("property", "og:site_name", defaults.SiteName)
+	meta("property", "og:title", firstNonBlank(p.OGTitle, title))
+	meta("property", "og:description", firstNonBlank(p.OGDescription, description))
+	meta("property", "og:url", canonical)
+	meta("property", "og:image", image)
+
+	meta("name", "twitter:card", card)
+	meta("name", "twitter:site", defaults.TwitterSite)
+	meta("name", "twitter:title", firstNonBlank(p.OGTitle, title))
+	meta("name", "twitter:description", firstNonBlank(p.OGDescription, description))
+	meta("name", "twitter:image", image)
+
+	if jsonld := pageJSONLD(p, defaults, title, description, canonical, image); len(jsonld) > 0 {
+		head.WriteString(fmt.Sprintf("<script type=\"application/ld+json\">%s</script>", jsonld))
+	}
+
+	return template.HTML(head.String())
+}
+
+//pageJSONLD get the page's structured data, describing it as a WebPage if it doesn't have its own,
+//escaped so it can't close the script element it's placed in
+func pageJSONLD(p *db.Page, defaults SEODefaults, title string, description string, canonical string, image string) string {
+	data := []byte(strings.TrimSpace(p.JSONLD))
+
+	if len(data) == 0 || !validJSONLD(p.JSONLD) {
+		webPage := map[string]interface{}{
+			"@context": "https://schema.org",
+			"@type":    "WebPage",
+			"name":     title,
+		}
+		if len(canonical) > 0 {
+			webPage["url"] = canonical
+		}
+		if len(description) > 0 {
+			webPage["description"] = description
+		}
+		if len(image) > 0 {
+			webPage["image"] = image
+		}
+		if modified := pageModifiedTime(p); !modified.IsZero() {
+			webPage["dateModified"] = modified.UTC().Format(time.RFC3339)
+		}
+		if len(defaults.SiteName) > 0 {
+			webPage["isPartOf"] = map[string]string{"@type": "WebSite", "name": defaults.SiteName}
+		}
+
+		var err error
+		if data, err = json.Marshal(webPage); err != nil {
+			logging.Error(err.Error())
+			return ""
+		}
+	}
+
+	var compacted bytes.Buffer
+	if err := json.Compact(&compacted, data); err != nil {
+		logging.Error(err.Error())
+		return ""
+	}
+
+	var escaped bytes.Buffer
+	json.HTMLEscape(&escaped, compacted.Bytes())
+	return escaped.String()
+}
+
+//absoluteURL resolves site relative link against baseURL, links which are already absolute are left as they are
+//and site relative links are left out without a base URL to resolve them against
+func absoluteURL(baseURL string, link string) string {
+	if len(link) == 0 || strings.HasPrefix(link, "http://") || strings.HasPrefix(link, "https://") {
+		return link
+	}
+	if len(baseURL) == 0 {
+		return ""
+	}
+	if !strings.HasPrefix(link, "/") {
+		link = "/" + link
+	}
+	return baseURL + link
+}
+
+func firstNonBlank(vals ...string) string {
+	for _, val := range vals {
+		if val = strings.TrimSpace(val); len(val) > 0 {
+			return val
+		}
+	}
+	return ""
+}
+
+//imageExtensions file extensions listed as social preview images
+var imageExtensions = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true, ".svg": true}
+
+//staticImages lists the URIs of every image served from the static dir, offered as social preview images
+func staticImages() []string {
+	images := []string{}
+	err := fs.WalkDir(assets, "static", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && imageExtensions[strings.ToLower(path.Ext(filePath))] {
+			images = append(images, strings.TrimPrefix(filePath, "static"))
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Debug(fmt.Sprintf("Unable to list static images -> %s", err.Error()))
+	}
+	return images
+}
+
+//pageSEOContext sets everything the editor's SEO panel needs for page
+func pageSEOContext(pctx *plush.Context, p *db.Page) {
+	pctx.Set("pageseo", p)
+	pctx.Set("seodefaults", loadSEODefaults())
+	pctx.Set("twittercards", TwitterCards())
+	pctx.Set("staticimages", staticImages())
+}
+
+//applySEOForm sets page's SEO fields from the editor's submitted form, returning a description of
+//any values which weren't valid and were left out
+func applySEOForm(p *db.Page, r *http.Request) []string {
+	problems := []string{}
+
+	p.MetaTitle = strings.TrimSpace(r.PostFormValue("metatitle"))
+	p.MetaDescription = strings.TrimSpace(r.PostFormValue("metadescription"))
+	p.NoIndex = r.PostFormValue("noindex") == "true"
+	p.NoFollow = r.PostFormValue("nofollow") == "true"
+	p.OGTitle = strings.TrimSpace(r.PostFormValue("ogtitle"))
+	p.OGDescription = strings.TrimSpace(r.PostFormValue("ogdescription"))
+	p.OGImage = strings.TrimSpace(r.PostFormValue("ogimage"))
+	p.TwitterCard = twitterCardByName(r.PostFormValue("twittercard"))
+
+	p.CanonicalURL = strings.TrimSpace(r.PostFormValue("canonicalurl"))
+	if len(p.CanonicalURL) > 0 {
+		if u, err := url.Parse(p.CanonicalURL); err != nil || (!u.IsAbs() && !strings.HasPrefix(p.CanonicalURL, "/")) {
+			problems = append(problems, fmt.Sprintf("Canonical URL '%s' must be absolute or start with '/'", p.CanonicalURL))
+			p.CanonicalURL = ""
+		}
+	}
+
+	p.JSONLD = strings.TrimSpace(r.PostFormValue("jsonld"))
+	if !validJSONLD(p.JSONLD) {
+		problems = append(problems, "Structured data must be a JSON object or array, it wasn't saved")
+		p.JSONLD = ""
+	}
+
+	return problems
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tacusci/berrycms/db"
+)
+
+func TestPageSEOHead(t *testing.T) {
+	if err := saveSEODefaults(SEODefaults{SiteName: "Berry Site", Description: "Default description", Image: "/img/default.png", TwitterCard: "summary"}); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &db.Page{
+		Title:       "SEO Page",
+		Route:       "/seo",
+		MetaTitle:   "Better SEO Title",
+		NoIndex:     true,
+		OGImage:     "https://cdn.example.com/preview.png",
+		TwitterCard: "summary_large_image",
+		JSONLD:      "{\"@context\": \"https://schema.org\", \"@type\": \"Article\", \"headline\": \"</script><script>alert(1)</script>\"}",
+	}
+
+	if err := SetBaseURL("https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetBaseURL("")
+
+	head := string(pageSEOHead(p))
+
+	expectedTags := []string{
+		"<meta name=\"description\" content=\"Default description\">",
+		"<link rel=\"canonical\" href=\"https://example.com/seo\">",
+		"<meta name=\"robots\" content=\"noindex\">",
+		"<meta property=\"og:site_name\" content=\"Berry Site\">",
+		"<meta property=\"og:title\" content=\"Better SEO Title\">",
+		"<meta property=\"og:image\" content=\"https://cdn.example.com/preview.png\">",
+		"<meta name=\"twitter:card\" content=\"summary_large_image\">",
+		"<script type=\"application/ld+json\">{\"@context\":\"https://schema.org\",\"@type\":\"Article\",\"headline\":\"\\u003c/script\\u003e\\u003cscript\\u003ealert(1)\\u003c/script\\u003e\"}</script>",
+	}
+
+	for _, tag := range expectedTags {
+		if !strings.Contains(head, tag) {
+			t.Errorf("SEO head is missing %s: %s", tag, head)
+		}
+	}
+
+	saveSEODefaults(SEODefaults{})
+}
+
+func TestPageSEOHeadWithoutBaseURL(t *testing.T) {
+	if err := saveSEODefaults(SEODefaults{SiteName: "Berry Site", Image: "/img/default.png"}); err != nil {
+		t.Fatal(err)
+	}
+	defer saveSEODefaults(SEODefaults{})
+
+	head := string(pageSEOHead(&db.Page{Title: "SEO Page", Route: "/seo"}))
+
+	for _, unexpected := range []string{"rel=\"canonical\"", "og:url", "og:image", "twitter:image", "\"url\"", "\"image\""} {
+		if strings.Contains(head, unexpected) {
+			t.Errorf("Site relative links shouldn't be made absolute without a base URL, found %s: %s", unexpected, head)
+		}
+	}
+
+	p := &db.Page{Title: "SEO Page", Route: "/seo", CanonicalURL: "https://example.org/original"}
+	if head := string(pageSEOHead(p)); !strings.Contains(head, "<link rel=\"canonical\" href=\"https://example.org/original\">") {
+		t.Errorf("Absolute canonical links should be kept without a base URL: %s", head)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//sessionHashKeyLength length in bytes of the keys cookies are signed with
+	sessionHashKeyLength = 32
+	//sessionBlockKeyLength length in bytes of the keys cookies are encrypted with, selects AES-256
+	sessionBlockKeyLength = 32
+	//sessionKeysKept how many keys cookies are read with, the newest and those it replaced
+	sessionKeysKept = 3
+	//sessionKeyRotationAge how long a key signs new cookies before it's replaced
+	sessionKeyRotationAge = 30 * 24 * time.Hour
+)
+
+//LoadSessionKeys start signing and encrypting cookies with the site's keys, generating them on first setup
+//and replacing the newest if it's due to be rotated
+func LoadSessionKeys() error {
+	return refreshSessionKeys(time.Now())
+}
+
+//RotateSessionKeys generate a new key to sign and encrypt cookies with, keeping the previous ones to read cookies
+//they signed unless logEveryoneOut, in which case every existing cookie and session stops working
+func RotateSessionKeys(logEveryoneOut bool) error {
+	sk, err := newSessionKey(time.Now())
+	if err != nil {
+		return err
+	}
+
+	if logEveryoneOut {
+		skt := db.SessionKeysTable{}
+		if _, err := skt.DeleteOlderThan(db.Conn, sk.Sessionkeyid); err != nil {
+			return err
+		}
+		ast := db.AuthSessionsTable{}
+		ended, err := ast.DeleteAll(db.Conn)
+		if err != nil {
+			return err
+		}
+		logging.Warn(fmt.Sprintf("Rotated session keys and logged out %d sessions", ended))
+	}
+
+	return useSessionKeys()
+}
+
+//refreshSessionKeys rotate the keys if the newest is older than the rotation age, and pick up
+//keys another process has rotated in
+func refreshSessionKeys(now time.Time) error {
+	skt := db.SessionKeysTable{}
+	newest, err := skt.SelectNewest(db.Conn, 1)
+	if err != nil {
+		return err
+	}
+
+	if len(newest) == 0 || now.Sub(time.Unix(newest[0].CreatedDateTime, 0)) >= sessionKeyRotationAge {
+		if len(newest) == 0 {
+			logging.Info("Generating session keys...")
+		} else {
+			logging.Info("Rotating session keys...")
+		}
+		if _, err := newSessionKey(now); err != nil {
+			return err
+		}
+		return useSessionKeys()
+	}
+
+	if _, keyID := sessionsstore.current(); keyID != newest[0].Sessionkeyid {
+		return useSessionKeys()
+	}
+	return nil
+}
+
+//newSessionKey generate and save a new pair of keys, dropping any older than those kept
+func newSessionKey(now time.Time) (*db.SessionKey, error) {
+	hashKey, blockKey, err := randomSessionKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	sk := &db.SessionKey{
+		CreatedDateTime: now.Unix(),
+		HashKey:         base64.StdEncoding.EncodeToString(hashKey),
+		BlockKey:        base64.StdEncoding.EncodeToString(blockKey),
+	}
+
+	skt := db.SessionKeysTable{}
+	if err := skt.Insert(db.Conn, sk); err != nil {
+		return nil, err
+	}
+
+	kept, err := skt.SelectNewest(db.Conn, sessionKeysKept)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := skt.DeleteOlderThan(db.Conn, kept[len(kept)-1].Sessionkeyid); err != nil {
+		return nil, err
+	}
+
+	return sk, nil
+}
+
+//randomSessionKeyPair generate a key to sign cookies with and one to encrypt them with
+func randomSessionKeyPair() ([]byte, []byte, error) {
+	hashKey, blockKey := make([]byte, sessionHashKeyLength), make([]byte, sessionBlockKeyLength)
+	if _, err := rand.Read(hashKey); err != nil {
+		return nil, nil, err
+	}
+	if _, err := rand.Read(blockKey); err != nil {
+		return nil, nil, err
+	}
+	return hashKey, blockKey, nil
+}
+
+//useSessionKeys have the session store use the saved keys, newest first
+func useSessionKeys() error {
+	skt := db.SessionKeysTable{}
+	keys, err := skt.SelectNewest(db.Conn, sessionKeysKept)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return errors.New("There are no session keys to use")
+	}
+
+	keyPairs := [][]byte{}
+	for _, sk := range keys {
+		hashKey, err := base64.StdEncoding.DecodeString(sk.HashKey)
+		if err != nil {
+			return err
+		}
+		blockKey, err := base64.StdEncoding.DecodeString(sk.BlockKey)
+		if err != nil {
+			return err
+		}
+		keyPairs = append(keyPairs, hashKey, blockKey)
+	}
+
+	sessionsstore.useKeys(keys[0].Sessionkeyid, keyPairs...)
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+)
+
+//loggedInWith whether a request sending cookies is logged in
+func loggedInWith(cookies []*http.Cookie) bool {
+	req := httptest.NewRequest("GET", "/admin", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	amw := AuthMiddleware{}
+	return amw.IsLoggedIn(req)
+}
+
+func TestSessionKeyRotation(t *testing.T) {
+	if err := LoadSessionKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if _, keyID := sessionsstore.current(); keyID == 0 {
+		t.Fatalf("Expected session keys to be generated on first setup")
+	}
+
+	u := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.REG_USER),
+		Username:        "rotateduser",
+		AuthHash:        util.HashAndSalt([]byte("password")),
+		Email:           "rotated@example.com",
+	}
+	ut := db.UsersTable{}
+	if err := ut.Insert(db.Conn, u); err != nil {
+		t.Fatal(err)
+	}
+
+	responseRecorder := httptest.NewRecorder()
+	if err := startAuthSession(responseRecorder, httptest.NewRequest("POST", "/login", nil), u, false); err != nil {
+		t.Fatal(err)
+	}
+	cookies := responseRecorder.Result().Cookies()
+	if !loggedInWith(cookies) || cookies[0].Secure {
+		t.Fatalf("Expected plain HTTP login to log in with a cookie which isn't Secure")
+	}
+
+	//rotation on schedule keeps reading cookies signed with the old keys
+	_, keyID := sessionsstore.current()
+	if err := refreshSessionKeys(time.Now().Add(sessionKeyRotationAge)); err != nil {
+		t.Fatal(err)
+	}
+	if _, rotatedKeyID := sessionsstore.current(); rotatedKeyID == keyID {
+		t.Errorf("Expected keys to be rotated once the newest is old enough")
+	}
+	if !loggedInWith(cookies) {
+		t.Errorf("Expected cookies signed with an old key to still work after rotation")
+	}
+
+	for i := 0; i < sessionKeysKept; i++ {
+		if err := RotateSessionKeys(false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	skt := db.SessionKeysTable{}
+	if keys, err := skt.SelectNewest(db.Conn, sessionKeysKept+1); err != nil || len(keys) != sessionKeysKept {
+		t.Errorf("Expected only %d keys to be kept, got %d", sessionKeysKept, len(keys))
+	}
+	if loggedInWith(cookies) {
+		t.Errorf("Expected cookies signed with keys no longer kept to stop working")
+	}
+
+	//forced rotation logs everyone out straight away
+	responseRecorder = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.TLS = &tls.ConnectionState{}
+	if err := startAuthSession(responseRecorder, req, u, false); err != nil {
+		t.Fatal(err)
+	}
+	cookies = responseRecorder.Result().Cookies()
+	if !loggedInWith(cookies) || !cookies[0].Secure {
+		t.Fatalf("Expected login over TLS to log in with a Secure cookie")
+	}
+	if err := RotateSessionKeys(true); err != nil {
+		t.Fatal(err)
+	}
+	if loggedInWith(cookies) {
+		t.Errorf("Expected forced rotation to log everyone out")
+	}
+	ast := db.AuthSessionsTable{}
+	if sessions, err := ast.SelectByUserUUID(db.Conn, u.UUID); err != nil || len(sessions) > 0 {
+		t.Errorf("Expected forced rotation to end every session")
+	}
+}
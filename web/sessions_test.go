@@ -0,0 +1,205 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/util"
+)
+
+//logInAs starts a session for u from a browser with userAgent, returning the cookies it's logged in with
+func logInAs(t *testing.T, u *db.User, userAgent string) []*http.Cookie {
+	req := httptest.NewRequest("POST", "/login", nil)
+	req.Header.Set("User-Agent", userAgent)
+	responseRecorder := httptest.NewRecorder()
+	if err := startAuthSession(responseRecorder, req, u, false); err != nil {
+		t.Fatal(err)
+	}
+	return responseRecorder.Result().Cookies()
+}
+
+func TestMultipleSessions(t *testing.T) {
+	ut := db.UsersTable{}
+	users := map[string]*db.User{}
+	for username, role := range map[string]db.UsersRoleFlag{"roaminguser": db.REG_USER, "nosyuser": db.REG_USER, "sessionroot": db.ROOT_USER} {
+		u := &db.User{
+			CreatedDateTime: time.Now().Unix(),
+			UserroleId:      int(role),
+			Username:        username,
+			AuthHash:        util.HashAndSalt([]byte("password")),
+			Email:           username + "@example.com",
+		}
+		if err := ut.Insert(db.Conn, u); err != nil {
+			t.Fatal(err)
+		}
+		users[username] = u
+	}
+
+	laptop := logInAs(t, users["roaminguser"], "Laptop Browser")
+	phone := logInAs(t, users["roaminguser"], "Phone Browser")
+	tablet := logInAs(t, users["roaminguser"], "Tablet Browser")
+	if !loggedInWith(laptop) || !loggedInWith(phone) || !loggedInWith(tablet) {
+		t.Fatalf("Expected logging in somewhere new not to log the user out anywhere else")
+	}
+
+	mr := &MutableRouter{}
+	ash := &AdminSessionsHandler{Router: mr, route: "/admin/sessions"}
+	asrh := &AdminSessionsRevokeHandler{Router: mr, route: "/admin/sessions/revoke"}
+
+	req := httptest.NewRequest("GET", "/admin/sessions", nil)
+	for _, cookie := range laptop {
+		req.AddCookie(cookie)
+	}
+	responseRecorder := httptest.NewRecorder()
+	ash.Get(responseRecorder, req)
+	body := responseRecorder.Body.String()
+	if !strings.Contains(body, "Laptop Browser") || !strings.Contains(body, "Phone Browser") || !strings.Contains(body, "(this session)") {
+		t.Errorf("Expected sessions page to list each of the user's sessions")
+	}
+
+	ast := db.AuthSessionsTable{}
+	sessions, err := ast.SelectByUserUUID(db.Conn, users["roaminguser"].UUID)
+	if err != nil || len(sessions) != 3 {
+		t.Fatalf("Expected user to have 3 sessions, got %d", len(sessions))
+	}
+	sessionUUIDs := map[string]string{}
+	for _, as := range sessions {
+		sessionUUIDs[as.UserAgent] = as.SessionUUID
+	}
+
+	revoke := func(cookies []*http.Cookie, values url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/admin/sessions/revoke", strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		responseRecorder := httptest.NewRecorder()
+		asrh.Post(responseRecorder, req)
+		return responseRecorder
+	}
+
+	nosy := logInAs(t, users["nosyuser"], "Nosy Browser")
+	if responseRecorder := revoke(nosy, url.Values{"sessionuuid": {sessionUUIDs["Phone Browser"]}}); responseRecorder.Code != http.StatusForbidden || !loggedInWith(phone) {
+		t.Errorf("Expected users not to be able to revoke each other's sessions, got %d", responseRecorder.Code)
+	}
+
+	revoke(laptop, url.Values{"sessionuuid": {sessionUUIDs["Phone Browser"]}})
+	if loggedInWith(phone) || !loggedInWith(laptop) {
+		t.Errorf("Expected revoking a session to log out only that session")
+	}
+
+	root := logInAs(t, users["sessionroot"], "Root Browser")
+	revoke(root, url.Values{"sessionuuid": {sessionUUIDs["Tablet Browser"]}})
+	if loggedInWith(tablet) {
+		t.Errorf("Expected root to be able to revoke anyone's sessions")
+	}
+
+	logInAs(t, users["roaminguser"], "Another Browser")
+	revoke(laptop, url.Values{"others": {"true"}})
+	if sessions, _ := ast.SelectByUserUUID(db.Conn, users["roaminguser"].UUID); len(sessions) != 1 || !loggedInWith(laptop) {
+		t.Errorf("Expected logging out everywhere else to keep only the current session")
+	}
+}
+
+//backdateSession makes the session cookies are logged in with look like it was created and last active as long ago as given
+func backdateSession(t *testing.T, cookies []*http.Cookie, created time.Duration, lastActive time.Duration) string {
+	req := httptest.NewRequest("GET", "/admin", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	sessionUUID := currentSessionUUID(req)
+	ast := db.AuthSessionsTable{}
+	if _, err := db.Conn.Exec("UPDATE "+ast.Name()+" SET createddatetime = ?, lastactivedatetime = ? WHERE sessionuuid = ?",
+		time.Now().Add(-created).Unix(), time.Now().Add(-lastActive).Unix(), sessionUUID); err != nil {
+		t.Fatal(err)
+	}
+	return sessionUUID
+}
+
+func TestSessionLifetimes(t *testing.T) {
+	if err := SetSessionLifetimes(time.Hour, time.Minute, time.Hour); err == nil {
+		t.Errorf("Expected an idle timeout longer than the session lifetime to be rejected")
+	}
+	if err := SetSessionLifetimes(20*time.Minute, 24*time.Hour, 30*24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	u := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.REG_USER),
+		Username:        "rememberinguser",
+		AuthHash:        util.HashAndSalt([]byte("password")),
+		Email:           "remembering@example.com",
+	}
+	ut := db.UsersTable{}
+	if err := ut.Insert(db.Conn, u); err != nil {
+		t.Fatal(err)
+	}
+
+	rememberedLogIn := func() []*http.Cookie {
+		responseRecorder := httptest.NewRecorder()
+		if err := startAuthSession(responseRecorder, httptest.NewRequest("POST", "/login", nil), u, true); err != nil {
+			t.Fatal(err)
+		}
+		return responseRecorder.Result().Cookies()
+	}
+
+	plain := logInAs(t, u, "Shared Browser")
+	remembered := rememberedLogIn()
+	if plain[0].MaxAge != 0 || remembered[0].MaxAge != int((30*24*time.Hour).Seconds()) {
+		t.Errorf("Expected only the remembered session's cookie to outlast the browser, got max ages %d and %d", plain[0].MaxAge, remembered[0].MaxAge)
+	}
+
+	//going idle ends a session unless it's remembered
+	backdateSession(t, plain, time.Hour, 21*time.Minute)
+	backdateSession(t, remembered, time.Hour, 21*time.Minute)
+	if loggedInWith(plain) {
+		t.Errorf("Expected a session idle for longer than the timeout to be ended")
+	}
+	if !loggedInWith(remembered) {
+		t.Errorf("Expected a remembered session not to be ended for being idle")
+	}
+
+	//sessions end once they're past their lifetime, however active they've been
+	plain = logInAs(t, u, "Shared Browser")
+	backdateSession(t, plain, 25*time.Hour, 0)
+	backdateSession(t, remembered, 31*24*time.Hour, 0)
+	if loggedInWith(plain) || loggedInWith(remembered) {
+		t.Errorf("Expected sessions past their lifetime to be ended")
+	}
+
+	//the cleanup job clears out the same sessions
+	plain = logInAs(t, u, "Shared Browser")
+	remembered = rememberedLogIn()
+	idleUUID := backdateSession(t, plain, time.Hour, 21*time.Minute)
+	rememberedUUID := backdateSession(t, remembered, time.Hour, 21*time.Minute)
+	if err := ClearOldSessions(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	ast := db.AuthSessionsTable{}
+	if _, err := ast.SelectBySessionUUID(db.Conn, idleUUID); err == nil {
+		t.Errorf("Expected cleanup to delete the idle session")
+	}
+	if _, err := ast.SelectBySessionUUID(db.Conn, rememberedUUID); err != nil {
+		t.Errorf("Expected cleanup to keep the idle remembered session")
+	}
+}
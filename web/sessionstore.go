@@ -15,7 +15,11 @@
 package web
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/tacusci/logging"
@@ -24,37 +28,222 @@ import (
 	"github.com/tacusci/berrycms/db"
 )
 
+const (
+	//DefaultSessionIdleTimeout how long a session can go unused before it's ended unless set otherwise
+	DefaultSessionIdleTimeout = 20 * time.Minute
+	//DefaultSessionLifetime how long after logging in a session is ended unless set otherwise
+	DefaultSessionLifetime = 24 * time.Hour
+	//DefaultSessionRememberMeLifetime how long a remembered session lasts unless set otherwise
+	DefaultSessionRememberMeLifetime = 30 * 24 * time.Hour
+)
+
 var (
-	// need to change this to be random per db somehow
-	sessionStoreSecretKey = []byte("83fdjuif49f4fjdim93490cvk4gkirv349")
-	sessionsstore         = sessions.NewCookieStore(sessionStoreSecretKey)
+	sessionLifetimesMu sync.RWMutex
+	//sessionIdleTimeout how long a session can go unused before it's ended
+	sessionIdleTimeout = DefaultSessionIdleTimeout
+	//sessionLifetime how long after logging in a session is ended, however active it's been
+	sessionLifetime = DefaultSessionLifetime
+	//sessionRememberMeLifetime how long after logging in a session the user asked to be remembered in is ended,
+	//it isn't ended for being idle
+	sessionRememberMeLifetime = DefaultSessionRememberMeLifetime
 )
 
-func init() {
-	sessionsstore.Options = &sessions.Options{
+//SetSessionLifetimes sets how long a session can go unused, how long it lasts however active it's been
+//and how long it lasts if the user asked to be remembered when logging in
+func SetSessionLifetimes(idle time.Duration, lifetime time.Duration, rememberMe time.Duration) error {
+	if idle <= 0 || lifetime <= 0 || rememberMe <= 0 {
+		return errors.New("Session lifetimes must be longer than 0")
+	}
+	if idle > lifetime {
+		return fmt.Errorf("Session idle timeout %s can't be longer than the session lifetime %s", idle, lifetime)
+	}
+
+	sessionLifetimesMu.Lock()
+	sessionIdleTimeout, sessionLifetime, sessionRememberMeLifetime = idle, lifetime, rememberMe
+	sessionLifetimesMu.Unlock()
+
+	//remembered sessions' cookies have to still be readable for as long as they last
+	sessionsstore.setMaxAge(int(rememberMe.Seconds()))
+	return nil
+}
+
+//sessionLifetimes get the idle timeout, lifetime and remember me lifetime of sessions
+func sessionLifetimes() (time.Duration, time.Duration, time.Duration) {
+	sessionLifetimesMu.RLock()
+	defer sessionLifetimesMu.RUnlock()
+	return sessionIdleTimeout, sessionLifetime, sessionRememberMeLifetime
+}
+
+//sessionExpired whether as has gone unused too long or is past its lifetime as of now
+func sessionExpired(as *db.AuthSession, now time.Time) bool {
+	idle, lifetime, rememberMe := sessionLifetimes()
+	created := time.Unix(as.CreatedDateTime, 0)
+	if as.RememberMe {
+		return now.Sub(created) >= rememberMe
+	}
+	return now.Sub(time.Unix(as.LastActiveDateTime, 0)) >= idle || now.Sub(created) >= lifetime
+}
+
+//sessionsstore the cookie store every named session is kept in, it signs with a random key
+//until the site's keys are loaded by LoadSessionKeys
+var sessionsstore = newRotatingCookieStore()
+
+//rotatingCookieStore cookie store whose keys can be swapped for new ones while running, and which marks
+//its cookies Secure when the site is being served over TLS
+type rotatingCookieStore struct {
+	mu      sync.RWMutex
+	cookies *sessions.CookieStore
+	//keyID ID of the newest key in use, 0 if using an ephemeral key
+	keyID    int
+	keyPairs [][]byte
+	//maxAge how many seconds after they're signed cookies can be read
+	maxAge int
+}
+
+func newRotatingCookieStore() *rotatingCookieStore {
+	hashKey, blockKey, err := randomSessionKeyPair()
+	if err != nil {
+		panic(err)
+	}
+	rcs := &rotatingCookieStore{maxAge: int(sessionRememberMeLifetime.Seconds())}
+	rcs.useKeys(0, hashKey, blockKey)
+	return rcs
+}
+
+//useKeys sign and encrypt new cookies with the first pair of keys, and read cookies signed and encrypted with any of them
+func (rcs *rotatingCookieStore) useKeys(newestID int, keyPairs ...[]byte) {
+	rcs.mu.Lock()
+	defer rcs.mu.Unlock()
+	rcs.cookies = newCookieStore(rcs.maxAge, keyPairs)
+	rcs.keyID = newestID
+	rcs.keyPairs = keyPairs
+}
+
+//setMaxAge read cookies for up to maxAge seconds after they're signed
+func (rcs *rotatingCookieStore) setMaxAge(maxAge int) {
+	rcs.mu.Lock()
+	defer rcs.mu.Unlock()
+	rcs.cookies = newCookieStore(maxAge, rcs.keyPairs)
+	rcs.maxAge = maxAge
+}
+
+//newCookieStore cookie store reading cookies for up to maxAge seconds, the cookies it sets last until
+//the browser's closed unless a session says otherwise
+func newCookieStore(maxAge int, keyPairs [][]byte) *sessions.CookieStore {
+	cookies := sessions.NewCookieStore(keyPairs...)
+	cookies.MaxAge(maxAge)
+	cookies.Options = &sessions.Options{
 		HttpOnly: true,
 	}
+	return cookies
 }
 
-//ClearOldSessions start checking every 10 seconds for existing sessions older than 20 minutes
-func ClearOldSessions(stop *chan bool) {
-	startTime := time.Now()
-	authSessionsTable := db.AuthSessionsTable{}
-	for {
-		time.Sleep(5 * time.Millisecond)
-		select {
-		case <-*stop:
-			return
-		default:
-			if time.Since(startTime).Seconds() > 10 {
-				err := authSessionsTable.Delete(db.Conn, fmt.Sprintf("lastactivedatetime + %d <= %d", 60*20, time.Now().Unix()))
-
-				if err != nil {
-					logging.Error(err.Error())
-				}
-
-				startTime = time.Now()
-			}
+func (rcs *rotatingCookieStore) current() (*sessions.CookieStore, int) {
+	rcs.mu.RLock()
+	defer rcs.mu.RUnlock()
+	return rcs.cookies, rcs.keyID
+}
+
+//Get returns a session for the given name after adding it to the registry
+func (rcs *rotatingCookieStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(rcs, name)
+}
+
+//New returns a session for the given name without adding it to the registry
+func (rcs *rotatingCookieStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	cookies, _ := rcs.current()
+	session, err := cookies.New(r, name)
+	session.Options.Secure = requestIsSecure(r)
+	return session, err
+}
+
+//Save adds a single session to the response
+func (rcs *rotatingCookieStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	cookies, _ := rcs.current()
+	return cookies.Save(r, w, session)
+}
+
+//requestIsSecure whether r was made over TLS, either directly or to the https base URL in front of the site
+func requestIsSecure(r *http.Request) bool {
+	if r.TLS != nil {
+		return true
+	}
+	baseURLMu.RLock()
+	defer baseURLMu.RUnlock()
+	return strings.HasPrefix(baseURL, "https://")
+}
+
+//addFlash queues message under key to be shown on the next page rendered for the client
+func addFlash(w http.ResponseWriter, r *http.Request, key string, message string) {
+	flashSession, err := sessionsstore.Get(r, "flash")
+	if err != nil {
+		logging.Debug(fmt.Sprintf("Error trying to read existing session \"flash\" -> %s", err.Error()))
+	}
+	flashSession.AddFlash(message, key)
+	if err := flashSession.Save(r, w); err != nil {
+		logging.Error(err.Error())
+	}
+}
+
+//popFlashes get and clear all messages queued under key for the client
+func popFlashes(w http.ResponseWriter, r *http.Request, key string) []string {
+	messages := []string{}
+
+	flashSession, err := sessionsstore.Get(r, "flash")
+	if err != nil {
+		return messages
+	}
+
+	flashes := flashSession.Flashes(key)
+	if len(flashes) == 0 {
+		return messages
+	}
+
+	for _, flash := range flashes {
+		if message, ok := flash.(string); ok {
+			messages = append(messages, message)
 		}
 	}
+
+	if err := flashSession.Save(r, w); err != nil {
+		logging.Error(err.Error())
+	}
+
+	return messages
+}
+
+//ClearOldSessions removes sessions which have gone unused too long or are past their lifetime as of now, expired password
+//reset links and two-factor challenges and failed logins which have been forgotten, as well as rotating session keys which are due to be
+func ClearOldSessions(now time.Time) error {
+	problems := []string{}
+
+	idle, lifetime, rememberMe := sessionLifetimes()
+	authSessionsTable := db.AuthSessionsTable{}
+	if _, err := authSessionsTable.DeleteExpired(db.Conn, now.Add(-idle).Unix(), now.Add(-lifetime).Unix(), now.Add(-rememberMe).Unix()); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	passwordResetsTable := db.PasswordResetsTable{}
+	if _, err := passwordResetsTable.DeleteExpired(db.Conn, now.Unix()); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	twoFactorChallengesTable := db.TwoFactorChallengesTable{}
+	if _, err := twoFactorChallengesTable.DeleteExpired(db.Conn, now.Add(-twoFactorChallengeTimeout*time.Second).Unix()); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	loginAttemptsTable := db.LoginAttemptsTable{}
+	if _, err := loginAttemptsTable.DeleteStale(db.Conn, now.Add(-loginFailureWindow).Unix(), now.Unix()); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if err := refreshSessionKeys(now); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
 }
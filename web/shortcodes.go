@@ -0,0 +1,78 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strconv"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/plugins"
+	"github.com/tacusci/berrycms/shortcodes"
+)
+
+//maxRecentPages upper limit on how many pages [recent-pages] will list
+const maxRecentPages = 50
+
+func init() {
+	shortcodes.Register("recent-pages", recentPagesShortcode)
+}
+
+//recentPagesShortcode lists links to the newest pages, eg., [recent-pages count=5]
+func recentPagesShortcode(sc *shortcodes.Shortcode) (string, error) {
+	count, err := strconv.Atoi(sc.Arg("count", "5"))
+	if err != nil || count < 1 {
+		return "", fmt.Errorf("count must be a positive number, got '%s'", sc.Arg("count", ""))
+	}
+	if count > maxRecentPages {
+		count = maxRecentPages
+	}
+
+	pt := db.PagesTable{}
+	pages, err := pt.SelectRecent(db.Conn, count)
+	if err != nil {
+		return "", err
+	}
+
+	var sb bytes.Buffer
+	sb.WriteString("<ul class=\"shortcode-recent-pages\">")
+	for _, p := range pages {
+		sb.WriteString(fmt.Sprintf("<li><a href=\"%s\">%s</a></li>", html.EscapeString(p.Route), html.EscapeString(p.Title)))
+	}
+	sb.WriteString("</ul>")
+
+	return sb.String(), nil
+}
+
+//pluginShortcode renders shortcode by calling the plugin's 'onShortcode(name, args, content, route)' function
+func pluginShortcode(pm *plugins.Manager, plugin plugins.Plugin) shortcodes.Func {
+	return func(sc *shortcodes.Shortcode) (string, error) {
+		//plugin functions can't be called more than once at the same time
+		pm.Lock()
+		defer pm.Unlock()
+
+		val, err := plugin.Call("on_shortcode", nil, sc.Name, sc.Args, sc.Content, sc.Route)
+		if err != nil {
+			return "", fmt.Errorf("PLUGIN {%s} -> %s", plugin.UUID(), err.Error())
+		}
+
+		if val.IsUndefined() || val.IsNull() {
+			return "", nil
+		}
+		return val.String(), nil
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/shortcodes"
+)
+
+func TestExpandShortcodes(t *testing.T) {
+	shortcodes.Register("test-box", func(sc *shortcodes.Shortcode) (string, error) {
+		return fmt.Sprintf("<div class=\"%s\">%s</div>", sc.Arg("class", "box"), sc.Content), nil
+	})
+	shortcodes.Register("test-upper", func(sc *shortcodes.Shortcode) (string, error) {
+		return strings.ToUpper(sc.Arg("text", "")), nil
+	})
+
+	tests := map[string]string{
+		"<p>[test-upper text=hi]</p>":                                                 "<p>HI</p>",
+		"<p>[test-upper text=&#34;hello world&#34;]</p>":                              "<p>HELLO WORLD</p>",
+		"[test-box class='outer'][test-box][test-upper text=x][/test-box][/test-box]": "<div class=\"outer\"><div class=\"box\">X</div></div>",
+		"<p>[unknown-code a=1] stays</p>":                                             "<p>[unknown-code a=1] stays</p>",
+		"<p>[[test-upper text=hi]] is how you write it</p>":                           "<p>[test-upper text=hi] is how you write it</p>",
+		"<p>[not closed</p>":                                                          "<p>[not closed</p>",
+	}
+
+	for content, expected := range tests {
+		if expanded := shortcodes.Expand(content, "/"); expanded != expected {
+			t.Errorf("Expanding %q gave %q, expected %q", content, expanded, expected)
+		}
+	}
+}
+
+func TestRecentPagesShortcode(t *testing.T) {
+	pt := db.PagesTable{}
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime: time.Now().Add(time.Hour).Unix(),
+		Title:           "Newest <Page>",
+		Route:           "/testnewestpage",
+		Content:         "",
+	})
+
+	expanded := shortcodes.Expand("[recent-pages count=1]", "/")
+
+	if expanded != "<ul class=\"shortcode-recent-pages\"><li><a href=\"/testnewestpage\">Newest &lt;Page&gt;</a></li></ul>" {
+		t.Errorf("Recent pages shortcode rendered unexpected list %q", expanded)
+	}
+}
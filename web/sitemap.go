@@ -3,6 +3,7 @@ package web
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/tacusci/berrycms/sitemap"
 	"github.com/tacusci/logging"
@@ -15,22 +16,44 @@ type SitemapHandler struct {
 
 func (sh *SitemapHandler) Get(w http.ResponseWriter, r *http.Request) {
 	//if the sitemap.xml has been disabled, don't continue
-	if sh.Router.NoSitemap {
+	if sh.Router != nil && sh.Router.disabled(&sh.Router.NoSitemap) {
 		fourOhFour(w, r)
 		return
 	}
 
-	//if the sitemap.xml page hasn't been visited before cache won't have been generated
+	//pages are only located under the configured base URL, the Host header can be set to anything
+	baseURL := configuredBaseURL()
+	if len(baseURL) == 0 {
+		logging.Warn("Not serving sitemap as there's no base URL to locate pages under, set one with -baseurl")
+		fourOhFour(w, r)
+		return
+	}
+
+	//the cache is dropped whenever pages change, so is generated again on the next visit
 	if !sitemap.CacheExists() {
-		logging.Debug(fmt.Sprintf("Sitemap.xml cache doesn't exist yet, creating it with URL hostname: %s", r.Host))
-		//creates a sitemap string and loads into in-memory cache
-		err := sitemap.Generate(r.URL.Scheme, r.Host)
+		logging.Debug("Sitemap.xml cache doesn't exist yet, creating it...")
+		//collects the sitemap entries and loads them into in-memory cache
+		err := sitemap.Generate()
 		if err != nil {
 			logging.Error(err.Error())
+			Error(w, err)
+			return
 		}
 	}
 
-	w.Write(sitemap.CacheBytes())
+	//the cached entries are relative so changing the base URL doesn't regenerate them
+	data, ok, err := sitemap.File(strings.TrimPrefix(r.URL.Path, "/"), baseURL)
+	if err != nil {
+		Error(w, err)
+		return
+	}
+	if !ok {
+		fourOhFour(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Write(data)
 }
 
 func (rh *SitemapHandler) Post(w http.ResponseWriter, r *http.Request) {}
@@ -43,3 +66,28 @@ func (rh *SitemapHandler) HandlesGet() bool { return true }
 
 //HandlesPost retrieve whether this handler handles post requests
 func (rh *SitemapHandler) HandlesPost() bool { return false }
+
+//sitemapPriorities get the priorities offered in the page editor, from 0.0 to 1.0
+func sitemapPriorities() []string {
+	priorities := []string{}
+	for i := 0; i <= 10; i++ {
+		priorities = append(priorities, fmt.Sprintf("%.1f", float64(i)/10))
+	}
+	return priorities
+}
+
+//sitemapChangeFreqByName checks freq is a change frequency the sitemap protocol allows, blank if not
+func sitemapChangeFreqByName(freq string) string {
+	if sitemap.ValidChangeFreq(freq) {
+		return freq
+	}
+	return ""
+}
+
+//sitemapPriorityByValue checks priority is between 0.0 and 1.0, blank if not
+func sitemapPriorityByValue(priority string) string {
+	if sitemap.ValidPriority(priority) {
+		return priority
+	}
+	return ""
+}
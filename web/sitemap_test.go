@@ -0,0 +1,139 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/sitemap"
+)
+
+func getSitemap(t *testing.T) string {
+	sh := SitemapHandler{}
+	responseRecorder := httptest.NewRecorder()
+	sh.Get(responseRecorder, httptest.NewRequest("GET", "/sitemap.xml", nil))
+
+	bodyText, err := ioutil.ReadAll(responseRecorder.Result().Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(bodyText)
+}
+
+func TestSitemapGet(t *testing.T) {
+	if err := SetBaseURL("https://example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetBaseURL("")
+
+	pt := db.PagesTable{}
+	modified := time.Date(2019, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime:   modified.Unix(),
+		ModifiedDateTime:  modified.Unix(),
+		Title:             "Sitemap Page",
+		Route:             "/sitemap/page",
+		Content:           "[{\"insert\":\"In the sitemap\\n\"}]",
+		SitemapChangeFreq: "weekly",
+		SitemapPriority:   "0.8",
+	})
+	pagesChanged()
+
+	body := getSitemap(t)
+
+	expectedEntry := "<loc>https://example.com/sitemap/page</loc>\n\t\t<lastmod>2019-06-01T12:00:00Z</lastmod>\n\t\t<changefreq>weekly</changefreq>\n\t\t<priority>0.8</priority>"
+	if !strings.Contains(body, expectedEntry) {
+		t.Errorf("Sitemap is missing page entry %s: %s", expectedEntry, body)
+	}
+
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime: time.Now().Unix(),
+		Title:           "Later Sitemap Page",
+		Route:           "/sitemap/later",
+		Content:         "[{\"insert\":\"Also in the sitemap\\n\"}]",
+	})
+	pagesChanged()
+
+	if body := getSitemap(t); !strings.Contains(body, "<loc>https://example.com/sitemap/later</loc>") {
+		t.Errorf("Sitemap wasn't regenerated after a page was created: %s", body)
+	}
+}
+
+func TestSetBaseURLInvalid(t *testing.T) {
+	for _, rawURL := range []string{"example.com", "ftp://example.com", "https://example.com/blog"} {
+		if err := SetBaseURL(rawURL); err == nil {
+			t.Errorf("Base URL %s should have been rejected", rawURL)
+		}
+	}
+	SetBaseURL("")
+}
+
+func TestSitemapIgnoresHost(t *testing.T) {
+	pt := db.PagesTable{}
+	pt.Insert(db.Conn, &db.Page{
+		CreatedDateTime: time.Now().Unix(),
+		Title:           "Hosted Sitemap Page",
+		Route:           "/sitemap/hosted",
+		Content:         "[{\"insert\":\"In every host's sitemap\\n\"}]",
+	})
+	pagesChanged()
+
+	sh := SitemapHandler{}
+	getHosted := func(host string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/sitemap.xml", nil)
+		req.Host = host
+		responseRecorder := httptest.NewRecorder()
+		sh.Get(responseRecorder, req)
+		return responseRecorder
+	}
+
+	//without a base URL there's nothing to trust the pages' locations to but the Host header
+	if responseRecorder := getHosted("attacker.example"); responseRecorder.Code != http.StatusNotFound || strings.Contains(responseRecorder.Body.String(), "attacker.example") {
+		t.Errorf("Expected no sitemap without a base URL, got %d", responseRecorder.Code)
+	}
+
+	if err := SetBaseURL("https://example.com"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetBaseURL("")
+
+	var wg sync.WaitGroup
+	for _, host := range []string{"one.example", "two.example", "one.example", "two.example"} {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			body := getHosted(host).Body.String()
+			if !strings.Contains(body, "<loc>https://example.com/sitemap/hosted</loc>") || strings.Contains(body, host) {
+				t.Errorf("Sitemap requested against %s should locate pages under the base URL: %s", host, body)
+			}
+		}(host)
+	}
+	wg.Wait()
+
+	if !sitemap.CacheExists() {
+		t.Error("Expected the sitemap to stay cached whichever host it's requested against")
+	}
+	if _, ok, _ := sitemap.File("sitemap-1.xml", "https://example.com"); ok {
+		t.Error("Numbered sitemap files only exist once there are too many URLs for one")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gobuffalo/plush"
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/themes"
+	"github.com/tacusci/logging"
+)
+
+//themeAssetsPrefix URI the active theme's assets are served from
+const themeAssetsPrefix = "/theme/"
+
+//renderThemeLayout renders page using its chosen layout from the active theme
+func renderThemeLayout(p *db.Page, ctx *plush.Context) (string, error) {
+	theme := themes.Active()
+
+	layout, err := theme.Layout(p.Layout)
+	if err != nil {
+		return "", err
+	}
+
+	if !ctx.Has("pagetitle") {
+		ctx.Set("pagetitle", p.Title)
+	}
+	if !ctx.Has("pagecontent") {
+		ctx.Set("pagecontent", "")
+	}
+	if !ctx.Has("metatitle") {
+		ctx.Set("metatitle", firstNonBlank(p.MetaTitle, fmt.Sprint(ctx.Value("pagetitle"))))
+	}
+	if !ctx.Has("seohead") {
+		ctx.Set("seohead", "")
+	}
+	ctx.Set("feedlinks", currentFeedLinks())
+	ctx.Set("themename", theme.Name)
+	ctx.Set("themeassets", themeAssetsPrefix)
+	//lets layouts and partials include the theme's partials
+	ctx.Set("partialFeeder", theme.Partial)
+
+	return plush.Render(layout, ctx)
+}
+
+//pageLayoutByName checks the active theme provides named layout, falls back to the default layout if not
+func pageLayoutByName(name string) string {
+	for _, layout := range themes.Active().Layouts() {
+		if layout == name {
+			return layout
+		}
+	}
+	return themes.DefaultLayout
+}
+
+//mapThemeAssets serves the active theme's assets dir, if it has one
+func (mr *MutableRouter) mapThemeAssets(r *mux.Router) {
+	theme := themes.Active()
+	assetsFS, err := theme.Assets()
+	if err != nil {
+		logging.Debug(fmt.Sprintf("Theme %s has no assets to serve", theme.Name))
+		return
+	}
+	logging.Debug(fmt.Sprintf("Serving theme %s's assets...", theme.Name))
+	r.PathPrefix(themeAssetsPrefix).Handler(http.StripPrefix(themeAssetsPrefix, newPrecompressedFileServer(http.FS(assetsFS))))
+}
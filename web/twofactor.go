@@ -0,0 +1,380 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/qrcode"
+	"github.com/tacusci/berrycms/totp"
+	"github.com/tacusci/logging"
+)
+
+const (
+	//twoFactorRolesSetting comma separated IDs of the roles which must use two-factor authentication
+	twoFactorRolesSetting = "twofactor.requiredroles"
+	//twoFactorGroupsSetting comma separated UUIDs of the groups whose members must use two-factor authentication
+	twoFactorGroupsSetting = "twofactor.requiredgroups"
+
+	//twoFactorIssuer name authenticator apps show the account under
+	twoFactorIssuer = "berrycms"
+	//recoveryCodeCount number of recovery codes each user is given
+	recoveryCodeCount = 10
+	//twoFactorChallengeTimeout seconds a user has to enter their code after entering their password
+	twoFactorChallengeTimeout = 5 * 60
+	//maxTwoFactorAttempts wrong codes allowed before the user has to enter their password again
+	maxTwoFactorAttempts = 5
+	//twoFactorChallengeIDSize number of random bytes in the ID of a challenge
+	twoFactorChallengeIDSize = 32
+)
+
+//TwoFactorPolicy the roles and groups root has required to use two-factor authentication
+type TwoFactorPolicy struct {
+	Roles  []int
+	Groups []string
+}
+
+//RequiresRole checks whether users with role must use two-factor authentication
+func (p TwoFactorPolicy) RequiresRole(role int) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+//RequiresGroup checks whether members of the group with groupUUID must use two-factor authentication
+func (p TwoFactorPolicy) RequiresGroup(groupUUID string) bool {
+	return containsString(p.Groups, groupUUID)
+}
+
+//loadTwoFactorPolicy reads the two-factor policy from the settings table
+func loadTwoFactorPolicy() TwoFactorPolicy {
+	st := db.SettingsTable{}
+	policy := TwoFactorPolicy{Roles: []int{}, Groups: []string{}}
+
+	roles, err := st.Get(db.Conn, twoFactorRolesSetting, "")
+	if err != nil {
+		logging.Error(err.Error())
+	}
+	for _, role := range strings.Split(roles, ",") {
+		if id, err := strconv.Atoi(strings.TrimSpace(role)); err == nil {
+			policy.Roles = append(policy.Roles, id)
+		}
+	}
+
+	groups, err := st.Get(db.Conn, twoFactorGroupsSetting, "")
+	if err != nil {
+		logging.Error(err.Error())
+	}
+	for _, group := range strings.Split(groups, ",") {
+		if group = strings.TrimSpace(group); len(group) > 0 {
+			policy.Groups = append(policy.Groups, group)
+		}
+	}
+
+	return policy
+}
+
+//saveTwoFactorPolicy writes the two-factor policy to the settings table
+func saveTwoFactorPolicy(policy TwoFactorPolicy) error {
+	roles := []string{}
+	for _, role := range policy.Roles {
+		roles = append(roles, strconv.Itoa(role))
+	}
+
+	st := db.SettingsTable{}
+	if err := st.Set(db.Conn, twoFactorRolesSetting, strings.Join(roles, ",")); err != nil {
+		return err
+	}
+	return st.Set(db.Conn, twoFactorGroupsSetting, strings.Join(policy.Groups, ","))
+}
+
+//twoFactorRequired checks whether the policy requires u to use two-factor authentication
+func twoFactorRequired(u *db.User) bool {
+	policy := loadTwoFactorPolicy()
+	if policy.RequiresRole(u.UserroleId) {
+		return true
+	}
+	if len(policy.Groups) == 0 {
+		return false
+	}
+
+	gmt := db.GroupMembershipTable{}
+	memberships, _, err := gmt.List(db.Conn, db.ListOptions{Limit: db.MaxListLimit, Filters: map[string]string{"useruuid": u.UUID}})
+	if err != nil {
+		logging.Error(err.Error())
+		//fail closed, rather than let a user skip their second factor
+		return true
+	}
+	for _, membership := range memberships {
+		if policy.RequiresGroup(membership.GroupUUID) {
+			return true
+		}
+	}
+	return false
+}
+
+//twoFactorEnabled checks whether u has confirmed their enrolment
+func twoFactorEnabled(u *db.User) bool {
+	tft := db.TwoFactorsTable{}
+	tf, err := tft.SelectByUserUUID(db.Conn, u.UUID)
+	return err == nil && tf.Enabled
+}
+
+//beginTwoFactorEnrolment gives u a new pending secret, replacing any previous pending one
+func beginTwoFactorEnrolment(u *db.User) (*db.TwoFactor, error) {
+	tft := db.TwoFactorsTable{}
+	if existing, err := tft.SelectByUserUUID(db.Conn, u.UUID); err == nil {
+		if existing.Enabled {
+			return nil, errors.New("Two-factor authentication is already set up")
+		}
+		if _, err := tft.DeleteByUserUUID(db.Conn, u.UUID); err != nil {
+			return nil, err
+		}
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	tf := &db.TwoFactor{CreatedDateTime: time.Now().Unix(), UserUUID: u.UUID, Secret: secret}
+	if err := tft.Insert(db.Conn, tf); err != nil {
+		return nil, err
+	}
+	return tf, nil
+}
+
+//pendingTwoFactorEnrolment get u's pending secret, starting their enrolment if they haven't yet
+func pendingTwoFactorEnrolment(u *db.User) (*db.TwoFactor, error) {
+	tft := db.TwoFactorsTable{}
+	if tf, err := tft.SelectByUserUUID(db.Conn, u.UUID); err == nil && !tf.Enabled {
+		return tf, nil
+	}
+	return beginTwoFactorEnrolment(u)
+}
+
+//twoFactorQRCode get the otpauth URI enrolling secret for u, and a PNG data URI of its QR code
+func twoFactorQRCode(u *db.User, secret string) (string, string, error) {
+	uri := totp.URI(twoFactorIssuer, u.Username, secret)
+	code, err := qrcode.Encode(uri)
+	if err != nil {
+		return "", "", err
+	}
+	img, err := code.PNG(4)
+	if err != nil {
+		return "", "", err
+	}
+	return uri, "data:image/png;base64," + base64.StdEncoding.EncodeToString(img), nil
+}
+
+//confirmTwoFactorEnrolment enables u's pending secret if code is valid, returning their new recovery codes
+func confirmTwoFactorEnrolment(u *db.User, code string) ([]string, error) {
+	tft := db.TwoFactorsTable{}
+	tf, err := tft.SelectByUserUUID(db.Conn, u.UUID)
+	if err != nil || tf.Enabled {
+		return nil, errors.New("There's no two-factor enrolment to confirm")
+	}
+
+	step, ok := totp.Validate(tf.Secret, code, time.Now())
+	if !ok {
+		return nil, errors.New("That code isn't right, check your device's clock and try again")
+	}
+
+	if err := tft.Enable(db.Conn, u.UUID, step); err != nil {
+		return nil, err
+	}
+
+	return generateRecoveryCodes(u)
+}
+
+//disableTwoFactor removes u's secret and recovery codes
+func disableTwoFactor(u *db.User) error {
+	tft := db.TwoFactorsTable{}
+	if _, err := tft.DeleteByUserUUID(db.Conn, u.UUID); err != nil {
+		return err
+	}
+	rct := db.RecoveryCodesTable{}
+	_, err := rct.DeleteByUserUUID(db.Conn, u.UUID)
+	return err
+}
+
+//normaliseRecoveryCode ignores case, spaces and dashes so codes can be typed however they're read
+func normaliseRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+}
+
+//hashRecoveryCode hashes a recovery code for storage, like token secrets they're random so don't need a slow hash
+func hashRecoveryCode(code string) string {
+	return hashAPITokenSecret(normaliseRecoveryCode(code))
+}
+
+//generateRecoveryCodes replaces u's recovery codes, returning the new ones to show them once
+func generateRecoveryCodes(u *db.User) ([]string, error) {
+	rct := db.RecoveryCodesTable{}
+	if _, err := rct.DeleteByUserUUID(db.Conn, u.UUID); err != nil {
+		return nil, err
+	}
+
+	codes := []string{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b))[:10]
+		code := raw[:5] + "-" + raw[5:]
+
+		if err := rct.Insert(db.Conn, &db.RecoveryCode{
+			CreatedDateTime: time.Now().Unix(),
+			UserUUID:        u.UUID,
+			CodeHash:        hashRecoveryCode(code),
+		}); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+//verifySecondFactor checks code is u's current TOTP code or one of their unused recovery codes,
+//codes can only be used once
+func verifySecondFactor(u *db.User, code string) bool {
+	tft := db.TwoFactorsTable{}
+	tf, err := tft.SelectByUserUUID(db.Conn, u.UUID)
+	if err != nil || !tf.Enabled {
+		return false
+	}
+
+	if step, ok := totp.Validate(tf.Secret, code, time.Now()); ok {
+		unused, err := tft.UseStep(db.Conn, u.UUID, step)
+		if err != nil {
+			logging.Error(err.Error())
+		}
+		return unused
+	}
+
+	rct := db.RecoveryCodesTable{}
+	recoveryCodes, err := rct.SelectByUserUUID(db.Conn, u.UUID)
+	if err != nil {
+		logging.Error(err.Error())
+		return false
+	}
+
+	hash := hashRecoveryCode(code)
+	for _, recoveryCode := range recoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(recoveryCode.CodeHash)) == 1 {
+			deleted, err := rct.DeleteByID(db.Conn, recoveryCode.Recoverycodeid)
+			if err != nil {
+				logging.Error(err.Error())
+			}
+			if deleted > 0 {
+				logging.Info(fmt.Sprintf("User %s signed in with a recovery code", u.Username))
+			}
+			return deleted > 0
+		}
+	}
+
+	return false
+}
+
+//needsSecondFactor checks whether u has to pass a two-factor challenge before their auth session is created
+func needsSecondFactor(u *db.User) bool {
+	return twoFactorEnabled(u) || twoFactorRequired(u)
+}
+
+//startTwoFactorChallenge records u has entered their password, so the two-factor challenge knows who to challenge
+//and whether they asked to be remembered once they've passed it, the challenge and the wrong codes counted against it
+//are kept server side, the client's cookie only holds its random ID
+func startTwoFactorChallenge(w http.ResponseWriter, r *http.Request, u *db.User, rememberMe bool) error {
+	challengeIDBytes := make([]byte, twoFactorChallengeIDSize)
+	if _, err := rand.Read(challengeIDBytes); err != nil {
+		return err
+	}
+	challengeID := hex.EncodeToString(challengeIDBytes)
+
+	tfct := db.TwoFactorChallengesTable{}
+	if err := tfct.Insert(db.Conn, &db.TwoFactorChallenge{
+		CreatedDateTime: time.Now().Unix(),
+		ChallengeID:     challengeID,
+		UserUUID:        u.UUID,
+		RememberMe:      rememberMe,
+	}); err != nil {
+		return err
+	}
+
+	twoFactorSessionStore, err := sessionsstore.Get(r, "twofactor")
+	if err != nil {
+		logging.Debug(fmt.Sprintf("Error trying to read existing session \"twofactor\" -> %s", err.Error()))
+	}
+	twoFactorSessionStore.Options.MaxAge = twoFactorChallengeTimeout
+	twoFactorSessionStore.Values = map[interface{}]interface{}{"challengeid": challengeID}
+	return twoFactorSessionStore.Save(r, w)
+}
+
+//pendingTwoFactorChallenge get the challenge of the user who's entered their password but not yet their second factor, and the user
+func pendingTwoFactorChallenge(r *http.Request) (*db.TwoFactorChallenge, *db.User, *sessions.Session) {
+	twoFactorSessionStore, err := sessionsstore.Get(r, "twofactor")
+	if err != nil {
+		return nil, nil, twoFactorSessionStore
+	}
+
+	challengeID, _ := twoFactorSessionStore.Values["challengeid"].(string)
+	if len(challengeID) == 0 {
+		return nil, nil, twoFactorSessionStore
+	}
+
+	tfct := db.TwoFactorChallengesTable{}
+	challenge, err := tfct.SelectByChallengeID(db.Conn, challengeID)
+	if err != nil || time.Now().Unix()-challenge.CreatedDateTime > twoFactorChallengeTimeout {
+		return nil, nil, twoFactorSessionStore
+	}
+
+	ut := db.UsersTable{}
+	u, err := ut.SelectByUUID(db.Conn, challenge.UserUUID)
+	if err != nil || len(u.UUID) == 0 {
+		return nil, nil, twoFactorSessionStore
+	}
+
+	return challenge, u, twoFactorSessionStore
+}
+
+//clearTwoFactorChallenge forgets the pending two-factor challenge, both server side and in the client's cookie
+func clearTwoFactorChallenge(w http.ResponseWriter, r *http.Request, twoFactorSessionStore *sessions.Session) {
+	if challengeID, ok := twoFactorSessionStore.Values["challengeid"].(string); ok {
+		tfct := db.TwoFactorChallengesTable{}
+		if _, err := tfct.DeleteByChallengeID(db.Conn, challengeID); err != nil {
+			logging.Error(err.Error())
+		}
+	}
+	twoFactorSessionStore.Values = map[interface{}]interface{}{}
+	twoFactorSessionStore.Options.MaxAge = -1
+	twoFactorSessionStore.Save(r, w)
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2019 tacusci ltd
+//
+// Licensed under the GNU GENERAL PUBLIC LICENSE Version 3 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.gnu.org/licenses/gpl-3.0.html
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tacusci/berrycms/db"
+	"github.com/tacusci/berrycms/totp"
+	"github.com/tacusci/berrycms/util"
+)
+
+//twoFactorChallenge starts a challenge for u, as though they'd just entered their password, returning its cookies
+func twoFactorChallenge(t *testing.T, u *db.User) []*http.Cookie {
+	responseRecorder := httptest.NewRecorder()
+	if err := startTwoFactorChallenge(responseRecorder, httptest.NewRequest("POST", "/login", nil), u, false); err != nil {
+		t.Fatal(err)
+	}
+	return responseRecorder.Result().Cookies()
+}
+
+//postTwoFactorCode submits code to the challenge
+func postTwoFactorCode(r *mux.Router, cookies []*http.Cookie, code string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/login/2fa", strings.NewReader(url.Values{"code": {code}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	responseRecorder := httptest.NewRecorder()
+	r.ServeHTTP(responseRecorder, req)
+	return responseRecorder
+}
+
+//startedAuthSession checks whether the response logged the client in
+func startedAuthSession(responseRecorder *httptest.ResponseRecorder) bool {
+	for _, cookie := range responseRecorder.Result().Cookies() {
+		if cookie.Name == "auth" && cookie.MaxAge >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//forgetLoginFailures forgets the failed logins recorded against u and the address test requests come from
+func forgetLoginFailures(t *testing.T, u *db.User) {
+	lat := db.LoginAttemptsTable{}
+	for _, key := range []string{accountAttemptKey(u.Username), ipAttemptKey(clientIP(httptest.NewRequest("GET", "/", nil)))} {
+		if _, err := lat.DeleteByKey(db.Conn, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTwoFactorLoginChallenge(t *testing.T) {
+	u := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.REG_USER),
+		Username:        "twofactoruser",
+		AuthHash:        util.HashAndSalt([]byte("twofactoruser")),
+		Email:           "twofactoruser@example.com",
+	}
+	ut := db.UsersTable{}
+	if err := ut.Insert(db.Conn, u); err != nil {
+		t.Fatal(err)
+	}
+	u, _ = ut.SelectByUsername(db.Conn, "twofactoruser")
+
+	if needsSecondFactor(u) {
+		t.Fatalf("Expected user without two-factor authentication or a policy to log in with just their password")
+	}
+
+	gt := db.GroupTable{}
+	if err := gt.Insert(db.Conn, &db.Group{Title: "Two-Factor Required"}); err != nil {
+		t.Fatal(err)
+	}
+	group, _ := gt.SelectByTitle(db.Conn, "Two-Factor Required")
+	gmt := db.GroupMembershipTable{}
+	if err := gmt.AddUserToGroup(db.Conn, u, group.Title); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveTwoFactorPolicy(TwoFactorPolicy{Roles: []int{}, Groups: []string{group.UUID}}); err != nil {
+		t.Fatal(err)
+	}
+	defer saveTwoFactorPolicy(TwoFactorPolicy{Roles: []int{}, Groups: []string{}})
+
+	if !needsSecondFactor(u) {
+		t.Fatalf("Expected the policy to require user in its group to use two-factor authentication")
+	}
+
+	mr := &MutableRouter{}
+	r := mux.NewRouter()
+	ltfh := &LoginTwoFactorHandler{Router: mr, route: "/login/2fa"}
+	r.HandleFunc(ltfh.Route(), ltfh.Get).Methods("GET")
+	r.HandleFunc(ltfh.Route(), ltfh.Post).Methods("POST")
+
+	//the policy has user set up two-factor authentication before they're logged in
+	cookies := twoFactorChallenge(t, u)
+	req := httptest.NewRequest("GET", "/login/2fa", nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	responseRecorder := httptest.NewRecorder()
+	r.ServeHTTP(responseRecorder, req)
+	if responseRecorder.Code != http.StatusOK {
+		t.Fatalf("Expected enrolment to be shown, got %d", responseRecorder.Code)
+	}
+
+	tft := db.TwoFactorsTable{}
+	tf, err := tft.SelectByUserUUID(db.Conn, u.UUID)
+	if err != nil || len(tf.Secret) == 0 {
+		t.Fatalf("Expected a pending secret to be created for user")
+	}
+
+	if responseRecorder = postTwoFactorCode(r, cookies, "000000"); startedAuthSession(responseRecorder) {
+		t.Errorf("Expected a wrong code not to log user in")
+	}
+
+	code, _ := totp.Code(tf.Secret, time.Now())
+	responseRecorder = postTwoFactorCode(r, cookies, code)
+	if !startedAuthSession(responseRecorder) || !twoFactorEnabled(u) {
+		t.Fatalf("Expected confirming enrolment to turn on two-factor authentication and log user in")
+	}
+
+	rct := db.RecoveryCodesTable{}
+	if recoveryCodes, _ := rct.SelectByUserUUID(db.Conn, u.UUID); len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, got %d", recoveryCodeCount, len(recoveryCodes))
+	}
+
+	//a code can't be replayed to log in again
+	if responseRecorder = postTwoFactorCode(r, twoFactorChallenge(t, u), code); startedAuthSession(responseRecorder) {
+		t.Errorf("Expected a used code to be rejected")
+	}
+
+	recoveryCodes, err := generateRecoveryCodes(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responseRecorder = postTwoFactorCode(r, twoFactorChallenge(t, u), strings.ToUpper(recoveryCodes[0]))
+	if !startedAuthSession(responseRecorder) || responseRecorder.Header().Get("Location") != "/admin" {
+		t.Errorf("Expected a recovery code to log user in")
+	}
+	if responseRecorder = postTwoFactorCode(r, twoFactorChallenge(t, u), recoveryCodes[0]); startedAuthSession(responseRecorder) {
+		t.Errorf("Expected a recovery code to only work once")
+	}
+
+	//too many wrong codes ends the challenge, even once they're no longer throttled
+	cookies = twoFactorChallenge(t, u)
+	for i := 0; i <= maxTwoFactorAttempts; i++ {
+		forgetLoginFailures(t, u)
+		responseRecorder = postTwoFactorCode(r, cookies, "000000")
+		cookies = append(responseRecorder.Result().Cookies(), cookies...)
+	}
+	if responseRecorder.Header().Get("Location") != "/login" {
+		t.Errorf("Expected too many wrong codes to go back to login, got %d", responseRecorder.Code)
+	}
+}
+
+func TestTwoFactorChallengeReplay(t *testing.T) {
+	u := &db.User{
+		CreatedDateTime: time.Now().Unix(),
+		UserroleId:      int(db.REG_USER),
+		Username:        "twofactorreplay",
+		AuthHash:        util.HashAndSalt([]byte("twofactorreplay")),
+		Email:           "twofactorreplay@example.com",
+	}
+	ut := db.UsersTable{}
+	if err := ut.Insert(db.Conn, u); err != nil {
+		t.Fatal(err)
+	}
+	u, _ = ut.SelectByUsername(db.Conn, "twofactorreplay")
+
+	tf, err := beginTwoFactorEnrolment(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tft := db.TwoFactorsTable{}
+	if err := tft.Enable(db.Conn, u.UUID, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer forgetLoginFailures(t, u)
+
+	mr := &MutableRouter{}
+	r := mux.NewRouter()
+	ltfh := &LoginTwoFactorHandler{Router: mr, route: "/login/2fa"}
+	r.HandleFunc(ltfh.Route(), ltfh.Post).Methods("POST")
+
+	//the cookie from when the password was entered is sent every time, as though the client had kept a copy
+	forgetLoginFailures(t, u)
+	cookies := twoFactorChallenge(t, u)
+	for i := 0; i < maxTwoFactorAttempts; i++ {
+		forgetLoginFailures(t, u)
+		if responseRecorder := postTwoFactorCode(r, cookies, "000000"); responseRecorder.Code != http.StatusOK {
+			t.Fatalf("Expected wrong code %d to show the challenge again, got %d", i+1, responseRecorder.Code)
+		}
+	}
+	forgetLoginFailures(t, u)
+	code, _ := totp.Code(tf.Secret, time.Now())
+	responseRecorder := postTwoFactorCode(r, cookies, code)
+	if startedAuthSession(responseRecorder) || responseRecorder.Header().Get("Location") != "/login" {
+		t.Errorf("Expected replaying the challenge's cookie not to reset its wrong codes")
+	}
+	if responseRecorder = postTwoFactorCode(r, cookies, code); startedAuthSession(responseRecorder) {
+		t.Errorf("Expected the ended challenge's cookie not to be usable again")
+	}
+
+	//wrong codes are failed logins, so they're throttled along with wrong passwords
+	cookies = twoFactorChallenge(t, u)
+	for i := 0; i < loginFreeAttempts; i++ {
+		postTwoFactorCode(r, cookies, "000000")
+	}
+	lat := db.LoginAttemptsTable{}
+	if la, _ := lat.SelectByKey(db.Conn, accountAttemptKey(u.Username)); la.Failures != loginFreeAttempts {
+		t.Errorf("Expected each wrong code to be counted as a failed login, got %d", la.Failures)
+	}
+	if throttled, _ := loginThrottled(clientIP(httptest.NewRequest("GET", "/", nil)), u.Username, time.Now()); !throttled {
+		t.Errorf("Expected logging in to be throttled after too many wrong codes")
+	}
+	if responseRecorder = postTwoFactorCode(r, cookies, code); startedAuthSession(responseRecorder) {
+		t.Errorf("Expected a right code to wait while logging in is throttled")
+	}
+}